@@ -16,16 +16,22 @@ terraform {
 
 provider "aws" {
   region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 # --------------------------------------------------------------------
-# CREATE THE VPC
+# CREATE THE VPC, UNLESS THE TESTS PASS A SHARED VPC
 # --------------------------------------------------------------------
 
 module "vpc" {
   source  = "terraform-aws-modules/vpc/aws"
   version = "~> 5.1.2"
 
+  count = var.vpc_id == null ? 1 : 0
+
   name = "vpc-test${var.random_id}"
   cidr = "10.0.0.0/16"
 
@@ -33,6 +39,11 @@ module "vpc" {
   public_subnets = ["10.0.1.0/24", "10.0.2.0/24"]
 }
 
+locals {
+  vpc_id            = var.vpc_id != null ? var.vpc_id : one(module.vpc[*].vpc_id)
+  public_subnet_ids = var.public_subnet_ids != null ? var.public_subnet_ids : one(module.vpc[*].public_subnets)
+}
+
 
 # --------------------------------------------------------------------
 # CREATE THE ALB
@@ -43,8 +54,8 @@ module "alb" {
 
   alb_name = "alb-test${var.random_id}"
 
-  vpc_id         = module.vpc.vpc_id
-  vpc_subnet_ids = module.vpc.public_subnets
+  vpc_id         = local.vpc_id
+  vpc_subnet_ids = local.public_subnet_ids
 
   enable_https_listener = true
 
@@ -9,15 +9,27 @@ terraform {
 
 provider "aws" {
   region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 module "vpc" {
   source = "../../modules/vpc"
 
+  # The tests can pass a shared VPC instead
+  count = var.vpc_id == null ? 1 : 0
+
   vpc_name               = "ecs-cluster-test${var.random_id}"
   num_availability_zones = 3
 }
 
+locals {
+  vpc_id             = var.vpc_id != null ? var.vpc_id : one(module.vpc[*].vpc_id)
+  private_subnet_ids = var.private_subnet_ids != null ? var.private_subnet_ids : one(module.vpc[*].private_subnet_ids)
+}
+
 module "cluster" {
   source = "../../modules/ecs-cluster"
 
@@ -25,8 +37,10 @@ module "cluster" {
 
   cluster_instance_ami = var.cluster_instance_ami
 
-  vpc_id         = module.vpc.vpc_id
-  vpc_subnet_ids = module.vpc.private_subnet_ids
+  vpc_id         = local.vpc_id
+  vpc_subnet_ids = local.private_subnet_ids
 
   cluster_max_size = 2
+
+  tags = var.tags
 }
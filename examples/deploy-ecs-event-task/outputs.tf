@@ -0,0 +1,36 @@
+# Convienient outputs from other modules that can be used
+# during the testing of the ecs-service module.
+
+output "ecs_cluster_arn" {
+  description = "The ARN of the ECS cluster."
+  value       = local.ecs_cluster_arn
+}
+
+output "ecs_cluster_name" {
+  description = "The name of the ECS cluster."
+  value       = local.ecs_cluster_name
+}
+
+output "public_subnet_ids" {
+  description = "The IDs of the public subnets the event tasks are placed in."
+  value       = local.public_subnet_ids
+}
+
+
+# Outputs from the event driven instance
+# of the ecs-service module.
+
+output "ecs_task_definition_arn" {
+  description = "The full ARN of the task definition that is deployed."
+  value       = module.ecs-scheduled-task.ecs_task_definition_arn
+}
+
+output "ecs_task_event_rule_arn" {
+  description = "The ARN of the EventBridge event rule that is used for the event driven ECS task."
+  value       = module.ecs-scheduled-task.ecs_task_event_rule_arn
+}
+
+output "ecs_task_event_rule_name" {
+  description = "The name of the EventBridge event rule that is used for the event driven ECS task."
+  value       = module.ecs-scheduled-task.ecs_task_event_rule_name
+}
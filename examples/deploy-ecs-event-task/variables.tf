@@ -10,6 +10,24 @@ variable "container_image" {
   default     = "cyber4all/mock-container-image:latest"
 }
 
+variable "ecs_cluster_name" {
+  description = "The name of an existing ECS cluster to deploy to instead of creating one, set by the tests to use a shared cluster."
+  type        = string
+  default     = null
+}
+
+variable "private_subnet_ids" {
+  description = "The IDs of the private subnets of vpc_id, set by the tests to use a shared VPC."
+  type        = list(string)
+  default     = null
+}
+
+variable "public_subnet_ids" {
+  description = "The IDs of the public subnets of vpc_id, set by the tests to use a shared VPC."
+  type        = list(string)
+  default     = null
+}
+
 variable "random_id" {
   description = "Random id generated for the purpose of testing"
   type        = string
@@ -21,3 +39,15 @@ variable "region" {
   type        = string
   default     = "us-east-1"
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
+
+variable "vpc_id" {
+  description = "The ID of an existing VPC to deploy to instead of creating one, set by the tests to use a shared VPC."
+  type        = string
+  default     = null
+}
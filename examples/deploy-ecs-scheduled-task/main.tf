@@ -29,6 +29,10 @@ terraform {
 
 provider "aws" {
   region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 
@@ -38,16 +42,24 @@ provider "aws" {
 
 locals {
   name = "scheduled-test${var.random_id}"
+
+  vpc_id            = var.vpc_id != null ? var.vpc_id : one(module.vpc[*].vpc_id)
+  public_subnet_ids = var.public_subnet_ids != null ? var.public_subnet_ids : one(module.vpc[*].public_subnet_ids)
+  ecs_cluster_name  = var.ecs_cluster_name != null ? var.ecs_cluster_name : one(module.cluster[*].ecs_cluster_name)
+  ecs_cluster_arn   = var.ecs_cluster_name != null ? one(data.aws_ecs_cluster.shared[*].arn) : one(module.cluster[*].ecs_cluster_arn)
 }
 
 
 # -------------------------------------------
-# CREATE VPC TO DEPLOY ECS CLUSTER AND SERVICES
+# CREATE VPC TO DEPLOY ECS CLUSTER AND SERVICES,
+# UNLESS THE TESTS PASS A SHARED VPC
 # -------------------------------------------
 
 module "vpc" {
   source = "../../modules/vpc"
 
+  count = var.vpc_id == null ? 1 : 0
+
   vpc_name = local.name
 
   create_private_subnets = false
@@ -55,20 +67,31 @@ module "vpc" {
 
 
 # -------------------------------------------
-# CREATE ECS CLUSTER
+# CREATE ECS CLUSTER, UNLESS THE TESTS PASS A
+# SHARED CLUSTER
 # -------------------------------------------
 
 module "cluster" {
   source = "../../modules/ecs-cluster"
 
+  count = var.ecs_cluster_name == null ? 1 : 0
+
   cluster_name = local.name
 
   cluster_instance_ami = var.cluster_instance_ami
 
-  vpc_id         = module.vpc.vpc_id
-  vpc_subnet_ids = module.vpc.public_subnet_ids
+  vpc_id         = local.vpc_id
+  vpc_subnet_ids = local.public_subnet_ids
 
   cluster_max_size = 1
+
+  tags = var.tags
+}
+
+data "aws_ecs_cluster" "shared" {
+  count = var.ecs_cluster_name != null ? 1 : 0
+
+  cluster_name = var.ecs_cluster_name
 }
 
 
@@ -79,7 +102,7 @@ module "cluster" {
 module "ecs-scheduled-task-expression" {
   source = "../../modules/ecs-service"
 
-  ecs_cluster_name = module.cluster.ecs_cluster_name
+  ecs_cluster_name = local.ecs_cluster_name
   ecs_service_name = "${local.name}-expression"
 
   ecs_container_image = var.container_image
@@ -89,13 +112,13 @@ module "ecs-scheduled-task-expression" {
 
   create_scheduled_task          = true
   scheduled_task_cron_expression = "rate(2 minutes)"
-  scheduled_task_subnet_ids      = module.vpc.public_subnet_ids
+  scheduled_task_subnet_ids      = local.public_subnet_ids
 }
 
 module "ecs-scheduled-task-cron" {
   source = "../../modules/ecs-service"
 
-  ecs_cluster_name = module.cluster.ecs_cluster_name
+  ecs_cluster_name = local.ecs_cluster_name
   ecs_service_name = "${local.name}-cron"
 
   ecs_container_image = var.container_image
@@ -107,5 +130,5 @@ module "ecs-scheduled-task-cron" {
 
   create_scheduled_task          = true
   scheduled_task_cron_expression = "cron(0/2 * * * ? *)"
-  scheduled_task_subnet_ids      = module.vpc.public_subnet_ids
+  scheduled_task_subnet_ids      = local.public_subnet_ids
 }
@@ -0,0 +1,55 @@
+# Convienient outputs from other modules that can be used
+# during the testing of the ecs-service module.
+
+output "ecs_cluster_arn" {
+  description = "The ARN of the ECS cluster."
+  value       = local.ecs_cluster_arn
+}
+
+output "ecs_cluster_name" {
+  description = "The name of the ECS cluster."
+  value       = local.ecs_cluster_name
+}
+
+output "public_subnet_ids" {
+  description = "The IDs of the public subnets the scheduled tasks are placed in."
+  value       = local.public_subnet_ids
+}
+
+
+# Outputs from the rate expression instance
+# of the ecs-service module.
+
+output "expression_ecs_task_definition_arn" {
+  description = "The full ARN of the task definition that is deployed."
+  value       = module.ecs-scheduled-task-expression.ecs_task_definition_arn
+}
+
+output "expression_ecs_task_event_rule_arn" {
+  description = "The ARN of the EventBridge event rule that is used for the scheduled ECS task."
+  value       = module.ecs-scheduled-task-expression.ecs_task_event_rule_arn
+}
+
+output "expression_ecs_task_event_rule_name" {
+  description = "The name of the EventBridge event rule that is used for the scheduled ECS task."
+  value       = module.ecs-scheduled-task-expression.ecs_task_event_rule_name
+}
+
+
+# Outputs from the cron expression instance
+# of the ecs-service module.
+
+output "cron_ecs_task_definition_arn" {
+  description = "The full ARN of the task definition that is deployed."
+  value       = module.ecs-scheduled-task-cron.ecs_task_definition_arn
+}
+
+output "cron_ecs_task_event_rule_arn" {
+  description = "The ARN of the EventBridge event rule that is used for the scheduled ECS task."
+  value       = module.ecs-scheduled-task-cron.ecs_task_event_rule_arn
+}
+
+output "cron_ecs_task_event_rule_name" {
+  description = "The name of the EventBridge event rule that is used for the scheduled ECS task."
+  value       = module.ecs-scheduled-task-cron.ecs_task_event_rule_name
+}
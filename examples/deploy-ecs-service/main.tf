@@ -37,6 +37,10 @@ terraform {
 
 provider "aws" {
   region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 
@@ -46,16 +50,24 @@ provider "aws" {
 
 locals {
   name = "service-test${var.random_id}"
+
+  vpc_id             = var.vpc_id != null ? var.vpc_id : one(module.vpc[*].vpc_id)
+  public_subnet_ids  = var.public_subnet_ids != null ? var.public_subnet_ids : one(module.vpc[*].public_subnet_ids)
+  private_subnet_ids = var.private_subnet_ids != null ? var.private_subnet_ids : one(module.vpc[*].private_subnet_ids)
+  ecs_cluster_name   = var.ecs_cluster_name != null ? var.ecs_cluster_name : one(module.cluster[*].ecs_cluster_name)
 }
 
 
 # -------------------------------------------
-# CREATE VPC TO DEPLOY ECS CLUSTER AND SERVICES
+# CREATE VPC TO DEPLOY ECS CLUSTER AND SERVICES,
+# UNLESS THE TESTS PASS A SHARED VPC
 # -------------------------------------------
 
 module "vpc" {
   source = "../../modules/vpc"
 
+  count = var.vpc_id == null ? 1 : 0
+
   vpc_name               = local.name
   num_availability_zones = 3
 }
@@ -70,26 +82,31 @@ module "alb" {
 
   alb_name = local.name
 
-  vpc_id         = module.vpc.vpc_id
-  vpc_subnet_ids = module.vpc.public_subnet_ids
+  vpc_id         = local.vpc_id
+  vpc_subnet_ids = local.public_subnet_ids
 
   enable_https_listener = false
 }
 
 
 # -------------------------------------------
-# CREATE ECS CLUSTER
+# CREATE ECS CLUSTER, UNLESS THE TESTS PASS A
+# SHARED CLUSTER
 # -------------------------------------------
 
 module "cluster" {
   source = "../../modules/ecs-cluster"
 
+  count = var.ecs_cluster_name == null ? 1 : 0
+
   cluster_name = local.name
 
   cluster_instance_ami = var.cluster_instance_ami
 
-  vpc_id         = module.vpc.vpc_id
-  vpc_subnet_ids = module.vpc.private_subnet_ids
+  vpc_id         = local.vpc_id
+  vpc_subnet_ids = local.private_subnet_ids
+
+  tags = var.tags
 }
 
 
@@ -118,7 +135,7 @@ module "secrets-manager" {
 module "external-ecs-service" {
   source = "../../modules/ecs-service"
 
-  ecs_cluster_name = module.cluster.ecs_cluster_name
+  ecs_cluster_name = local.ecs_cluster_name
   ecs_service_name = "${local.name}-external"
 
   ecs_container_image = var.external_container_image
@@ -134,5 +151,5 @@ module "external-ecs-service" {
 
   enable_load_balancer   = true
   lb_listener_arn        = module.alb.http_listener_arn
-  lb_target_group_vpc_id = module.vpc.vpc_id
+  lb_target_group_vpc_id = local.vpc_id
 }
@@ -13,7 +13,7 @@ output "alb_name" {
 
 output "ecs_cluster_name" {
   description = "The name of the ECS cluster."
-  value       = module.cluster.ecs_cluster_name
+  value       = local.ecs_cluster_name
 }
 
 
@@ -25,4 +25,5 @@ module "mongodb" {
   # Disabled for testing purposes
   enable_cluster_terimination_protection = false
 
+  tags = var.tags
 }
@@ -8,3 +8,9 @@ variable "random_id" {
   description = "A random ID to append to the cluster name"
   default     = ""
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
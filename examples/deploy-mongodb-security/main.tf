@@ -14,6 +14,10 @@ terraform {
 
 provider "aws" {
   region = "us-east-1"
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 provider "mongodbatlas" {
@@ -2,3 +2,9 @@ variable "mongodb_role_arn" {
   type        = string
   description = "The ARN of the IAM role to assume when interacting with MongoDB Atlas"
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
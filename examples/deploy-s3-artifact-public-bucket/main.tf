@@ -12,4 +12,6 @@ module "s3_artifact" {
 
   bucket_name          = var.bucket_name
   enable_public_access = var.enable_public_access
+
+  tags = var.tags
 }
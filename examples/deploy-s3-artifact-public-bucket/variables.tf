@@ -9,3 +9,9 @@ variable "enable_public_access" {
   description = "Whether or not to enable public access to the S3 bucket. Defaults to false."
   default     = true
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
@@ -11,4 +11,6 @@ module "s3_artifact" {
   source = "../../modules/s3-artifact"
 
   bucket_name = var.bucket_name
+
+  tags = var.tags
 }
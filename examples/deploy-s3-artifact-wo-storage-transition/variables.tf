@@ -3,3 +3,9 @@ variable "bucket_name" {
   description = "The name of the S3 bucket."
   default     = "cyber4all-bucket-no-transition"
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
@@ -12,4 +12,6 @@ module "s3_artifact" {
 
   bucket_name                     = var.bucket_name
   enable_storage_class_transition = var.enable_storage_class_transition
+
+  tags = var.tags
 }
@@ -0,0 +1,28 @@
+variable "region" {
+  description = "The AWS region to provision resources to."
+  type        = string
+  default     = "us-east-1"
+}
+
+variable "secrets" {
+  description = "List of secrets to manage with the module."
+  type = list(object({
+    name                  = string
+    description           = optional(string)
+    environment_variables = map(string)
+  }))
+  default = [
+    {
+      name = "testing/example/secrets-manager"
+      environment_variables = {
+        "SECRET" = "SUPER_SECRET_VALUE"
+      }
+    }
+  ]
+}
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
@@ -9,3 +9,9 @@ variable "random_id" {
   type        = string
   default     = ""
 }
+
+variable "tags" {
+  description = "Tags to apply to the resources of the example, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
@@ -255,6 +255,18 @@ resource "aws_autoscaling_group" "cluster" {
     propagate_at_launch = true
   }
 
+  # The default_tags of the provider are not applied to
+  # the ASG or the instances that it launches.
+  dynamic "tag" {
+    for_each = var.tags
+
+    content {
+      key                 = tag.key
+      value               = tag.value
+      propagate_at_launch = true
+    }
+  }
+
   depends_on = [
     # The cluster must be created prior to the ASG.
     # The EC2 instances will not be able to register
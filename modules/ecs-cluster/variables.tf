@@ -92,3 +92,9 @@ variable "cluster_min_size" {
   description = "The minimum number of instances to run in the ECS cluster"
   default     = 1
 }
+
+variable "tags" {
+  type        = map(string)
+  description = "Tags to apply to the ASG and the EC2 instances it launches. The default_tags of the AWS provider are not applied to them."
+  default     = {}
+}
@@ -133,6 +133,15 @@ resource "mongodbatlas_cluster" "cluster" {
 
   termination_protection_enabled = var.enable_cluster_terimination_protection
 
+  dynamic "labels" {
+    for_each = var.tags
+
+    content {
+      key   = labels.key
+      value = labels.value
+    }
+  }
+
   lifecycle {
     precondition {
       condition = (
@@ -97,3 +97,9 @@ variable "enable_retain_deleted_cluster_backups" {
   type        = bool
   default     = false
 }
+
+variable "tags" {
+  description = "Tags to apply to the cluster as Atlas labels."
+  type        = map(string)
+  default     = {}
+}
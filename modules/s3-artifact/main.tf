@@ -60,11 +60,19 @@ terraform {
 
 provider "aws" {
   region = var.primary_region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 provider "aws" {
   alias  = "replica"
   region = var.replica_region
+
+  default_tags {
+    tags = var.tags
+  }
 }
 
 
@@ -53,3 +53,9 @@ variable "replica_region" {
   description = "The AWS region in which to create the replica S3 bucket."
   default     = "us-east-2"
 }
+
+variable "tags" {
+  type        = map(string)
+  description = "Tags to apply to all the resources created by the module."
+  default     = {}
+}
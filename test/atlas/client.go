@@ -0,0 +1,153 @@
+// Package atlas wraps the MongoDB Atlas Admin API with the lookups that the
+// module tests need to validate the resources deployed by the mongodb modules.
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/atlas-sdk/v20231001002/admin"
+)
+
+// BaseURLEnvVar is the environment variable used to override the base URL of the
+// Atlas Admin API. The mongodbatlas Terraform provider reads the same variable.
+const BaseURLEnvVar = "MONGODB_ATLAS_BASE_URL"
+
+// Client is a MongoDB Atlas Admin API client
+type Client struct {
+	admin *admin.APIClient
+}
+
+// Cluster is the configuration of a replica set cluster deployed to a single region,
+// which is the only topology that the mongodb-cluster module deploys.
+type Cluster struct {
+	Name                         string
+	StateName                    string
+	MongoDBMajorVersion          string
+	MongoDBVersion               string
+	VersionReleaseSystem         string
+	ClusterType                  string
+	DiskSizeGB                   float64
+	BackupEnabled                bool
+	PitEnabled                   bool
+	TerminationProtectionEnabled bool
+
+	// Region configuration of the first replication spec
+	ProviderName   string
+	RegionName     string
+	InstanceSize   string
+	ElectableNodes int
+	Priority       int
+
+	// Auto scaling of the cluster tier and storage
+	ComputeAutoScalingEnabled bool
+	ComputeScaleDownEnabled   bool
+	MinInstanceSize           string
+	MaxInstanceSize           string
+	DiskAutoScalingEnabled    bool
+}
+
+// NewClient creates an Atlas Admin API client authenticated with the programmatic API
+// keys. The base URL defaults to https://cloud.mongodb.com when it is empty and the
+// keys can be left empty when the base URL is a fake that does not authenticate.
+func NewClient(baseURL string, publicKey string, privateKey string) (*Client, error) {
+	modifiers := []admin.ClientModifier{
+		admin.UseBaseURL(baseURL),
+	}
+	if publicKey != "" || privateKey != "" {
+		modifiers = append(modifiers, admin.UseDigestAuth(publicKey, privateKey))
+	}
+
+	client, err := admin.NewClient(modifiers...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the atlas admin client: %w", err)
+	}
+	return &Client{admin: client}, nil
+}
+
+// GetProjectId returns the ID of the project with the name
+func (c *Client) GetProjectId(ctx context.Context, projectName string) (string, error) {
+	project, _, err := c.admin.ProjectsApi.GetProjectByName(ctx, projectName).Execute()
+	if err != nil {
+		return "", fmt.Errorf("unable to get project %s: %w", projectName, err)
+	}
+	return project.GetId(), nil
+}
+
+// GetCluster returns the cluster with the name in the project with the name
+func (c *Client) GetCluster(ctx context.Context, projectName string, clusterName string) (*Cluster, error) {
+	projectId, err := c.GetProjectId(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	description, _, err := c.admin.ClustersApi.GetCluster(ctx, projectId, clusterName).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cluster %s in project %s: %w", clusterName, projectName, err)
+	}
+
+	return newCluster(description), nil
+}
+
+// IsNotFound returns true if the error is an Atlas API error for a resource that does not exist
+func IsNotFound(err error) bool {
+	apiErr, ok := admin.AsError(err)
+	return ok && apiErr.GetError() == http.StatusNotFound
+}
+
+// newCluster flattens the cluster description into a Cluster
+func newCluster(description *admin.AdvancedClusterDescription) *Cluster {
+	cluster := &Cluster{
+		Name:                         description.GetName(),
+		StateName:                    description.GetStateName(),
+		MongoDBMajorVersion:          description.GetMongoDBMajorVersion(),
+		MongoDBVersion:               description.GetMongoDBVersion(),
+		VersionReleaseSystem:         description.GetVersionReleaseSystem(),
+		ClusterType:                  description.GetClusterType(),
+		DiskSizeGB:                   description.GetDiskSizeGB(),
+		BackupEnabled:                description.GetBackupEnabled(),
+		PitEnabled:                   description.GetPitEnabled(),
+		TerminationProtectionEnabled: description.GetTerminationProtectionEnabled(),
+	}
+
+	specs := description.GetReplicationSpecs()
+	if len(specs) == 0 || len(specs[0].GetRegionConfigs()) == 0 {
+		return cluster
+	}
+
+	region := specs[0].GetRegionConfigs()[0]
+	cluster.ProviderName = region.GetProviderName()
+	cluster.RegionName = region.GetRegionName()
+	cluster.Priority = region.GetPriority()
+
+	electable := region.GetElectableSpecs()
+	cluster.InstanceSize = electable.GetInstanceSize()
+	cluster.ElectableNodes = electable.GetNodeCount()
+
+	autoScaling := region.GetAutoScaling()
+	compute := autoScaling.GetCompute()
+	cluster.ComputeAutoScalingEnabled = compute.GetEnabled()
+	cluster.ComputeScaleDownEnabled = compute.GetScaleDownEnabled()
+	cluster.MinInstanceSize = compute.GetMinInstanceSize()
+	cluster.MaxInstanceSize = compute.GetMaxInstanceSize()
+	diskGB := autoScaling.GetDiskGB()
+	cluster.DiskAutoScalingEnabled = diskGB.GetEnabled()
+
+	return cluster
+}
+
+// InstanceSizeTier returns the tier of an Atlas instance size, i.e. 10 for M10.
+// Instance sizes compare by tier, so M10 <= size <= M50 is 10 <= tier <= 50.
+func InstanceSizeTier(instanceSize string) (int, error) {
+	if !strings.HasPrefix(instanceSize, "M") {
+		return 0, fmt.Errorf("unsupported instance size %q", instanceSize)
+	}
+	tier, err := strconv.Atoi(strings.TrimPrefix(instanceSize, "M"))
+	if err != nil {
+		return 0, fmt.Errorf("unsupported instance size %q", instanceSize)
+	}
+	return tier, nil
+}
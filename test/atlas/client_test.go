@@ -0,0 +1,111 @@
+package atlas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/atlas-sdk/v20231001002/admin"
+)
+
+// newFakeCluster returns the description of a cluster deployed with the defaults of the mongodb-cluster module
+func newFakeCluster(name string) *admin.AdvancedClusterDescription {
+	return &admin.AdvancedClusterDescription{
+		Name:                         admin.PtrString(name),
+		StateName:                    admin.PtrString("IDLE"),
+		ClusterType:                  admin.PtrString("REPLICASET"),
+		MongoDBMajorVersion:          admin.PtrString("5.0"),
+		MongoDBVersion:               admin.PtrString("5.0.21"),
+		VersionReleaseSystem:         admin.PtrString("LTS"),
+		DiskSizeGB:                   admin.PtrFloat64(10),
+		BackupEnabled:                admin.PtrBool(true),
+		PitEnabled:                   admin.PtrBool(true),
+		TerminationProtectionEnabled: admin.PtrBool(false),
+		ReplicationSpecs: []admin.ReplicationSpec{{
+			NumShards: admin.PtrInt(1),
+			RegionConfigs: []admin.CloudRegionConfig{{
+				ProviderName: admin.PtrString("AWS"),
+				RegionName:   admin.PtrString("US_EAST_1"),
+				Priority:     admin.PtrInt(7),
+				ElectableSpecs: &admin.HardwareSpec{
+					InstanceSize: admin.PtrString("M10"),
+					NodeCount:    admin.PtrInt(3),
+				},
+				AutoScaling: &admin.AdvancedAutoScalingSettings{
+					Compute: &admin.AdvancedComputeAutoScaling{
+						Enabled:          admin.PtrBool(true),
+						ScaleDownEnabled: admin.PtrBool(true),
+						MinInstanceSize:  admin.PtrString("M10"),
+						MaxInstanceSize:  admin.PtrString("M50"),
+					},
+					DiskGB: &admin.DiskGBAutoScaling{Enabled: admin.PtrBool(true)},
+				},
+			}},
+		}},
+	}
+}
+
+func TestGetCluster(t *testing.T) {
+	s := NewFakeServer(t)
+	projectId := s.AddProject("Sandbox")
+	s.PutCluster(projectId, newFakeCluster("mongo-cluster-test"))
+
+	client, err := NewClient(s.URL, "", "")
+	require.NoError(t, err)
+
+	cluster, err := client.GetCluster(context.TODO(), "Sandbox", "mongo-cluster-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, &Cluster{
+		Name:                         "mongo-cluster-test",
+		StateName:                    "IDLE",
+		MongoDBMajorVersion:          "5.0",
+		MongoDBVersion:               "5.0.21",
+		VersionReleaseSystem:         "LTS",
+		ClusterType:                  "REPLICASET",
+		DiskSizeGB:                   10,
+		BackupEnabled:                true,
+		PitEnabled:                   true,
+		TerminationProtectionEnabled: false,
+		ProviderName:                 "AWS",
+		RegionName:                   "US_EAST_1",
+		InstanceSize:                 "M10",
+		ElectableNodes:               3,
+		Priority:                     7,
+		ComputeAutoScalingEnabled:    true,
+		ComputeScaleDownEnabled:      true,
+		MinInstanceSize:              "M10",
+		MaxInstanceSize:              "M50",
+		DiskAutoScalingEnabled:       true,
+	}, cluster)
+}
+
+func TestGetClusterNotFound(t *testing.T) {
+	s := NewFakeServer(t)
+	s.AddProject("Sandbox")
+
+	client, err := NewClient(s.URL, "", "")
+	require.NoError(t, err)
+
+	// The cluster does not exist
+	_, err = client.GetCluster(context.TODO(), "Sandbox", "mongo-cluster-test")
+	assert.True(t, IsNotFound(err), "Expected a not found error, got %v", err)
+
+	// The project does not exist
+	_, err = client.GetCluster(context.TODO(), "Production", "mongo-cluster-test")
+	assert.True(t, IsNotFound(err), "Expected a not found error, got %v", err)
+}
+
+func TestInstanceSizeTier(t *testing.T) {
+	tier, err := InstanceSizeTier("M10")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, tier)
+
+	tier, err = InstanceSizeTier("M50")
+	assert.NoError(t, err)
+	assert.Equal(t, 50, tier)
+
+	_, err = InstanceSizeTier("R40")
+	assert.Error(t, err)
+}
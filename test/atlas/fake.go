@@ -0,0 +1,107 @@
+package atlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/atlas-sdk/v20231001002/admin"
+)
+
+// FakeServer is an in-process fake of the Atlas Admin API that serves the
+// projects and clusters added to it. Requests are not authenticated.
+type FakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	projects map[string]string                                       // project name -> project id
+	clusters map[string]map[string]*admin.AdvancedClusterDescription // project id -> cluster name -> cluster
+}
+
+// NewFakeServer starts a fake Atlas Admin API that is closed when the test finishes
+func NewFakeServer(t *testing.T) *FakeServer {
+	s := &FakeServer{
+		projects: map[string]string{},
+		clusters: map[string]map[string]*admin.AdvancedClusterDescription{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddProject adds a project with the name and returns its ID
+func (s *FakeServer) AddProject(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := fmt.Sprintf("%024x", len(s.projects)+1)
+	s.projects[name] = id
+	s.clusters[id] = map[string]*admin.AdvancedClusterDescription{}
+	return id
+}
+
+// PutCluster adds or replaces the cluster in the project with the ID
+func (s *FakeServer) PutCluster(projectId string, cluster *admin.AdvancedClusterDescription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cluster.GroupId = &projectId
+	s.clusters[projectId][cluster.GetName()] = cluster
+}
+
+func (s *FakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// /api/atlas/v2/groups/byName/{groupName}
+	// /api/atlas/v2/groups/{groupId}/clusters/{clusterName}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/atlas/v2/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(path) == 3 && path[0] == "groups" && path[1] == "byName":
+		id, ok := s.projects[path[2]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "GROUP_NAME_NOT_FOUND", "No group with name %s exists.", path[2])
+			return
+		}
+		writeJSON(w, admin.Group{Id: &id, Name: path[2]})
+
+	case r.Method == http.MethodGet && len(path) == 4 && path[0] == "groups" && path[2] == "clusters":
+		clusters, ok := s.clusters[path[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "GROUP_NOT_FOUND", "No group with ID %s exists.", path[1])
+			return
+		}
+		cluster, ok := clusters[path[3]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "CLUSTER_NOT_FOUND", "No cluster named %s exists in group %s.", path[3], path[1])
+			return
+		}
+		writeJSON(w, cluster)
+
+	default:
+		writeError(w, http.StatusNotFound, "RESOURCE_NOT_FOUND", "Cannot find resource %s.", r.URL.Path)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.atlas.2023-02-01+json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, format string, args ...interface{}) {
+	detail := fmt.Sprintf(format, args...)
+	reason := http.StatusText(status)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(admin.ApiError{
+		Detail:    &detail,
+		Error:     &status,
+		ErrorCode: &code,
+		Reason:    &reason,
+	})
+}
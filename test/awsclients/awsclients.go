@@ -0,0 +1,134 @@
+// Package awsclients creates the aws-sdk-go-v2 clients that the validators check the
+// deployed examples with. Every client is built from one config, so pointing the config
+// at another endpoint runs the same validators against a local stand-in of AWS, such as
+// the fakeaws server, or a server that replays recorded responses.
+package awsclients
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// EndpointEnvVar sends the requests of every client to the endpoint instead of AWS
+const EndpointEnvVar = "TERRATEST_AWS_ENDPOINT"
+
+// Clients creates the clients of the AWS APIs from a single config
+type Clients struct {
+	cfg aws.Config
+}
+
+// New loads the default config for the region. The requests are sent to the endpoint
+// of EndpointEnvVar when it is set.
+func New(ctx context.Context, region string) (*Clients, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint := os.Getenv(EndpointEnvVar); endpoint != "" {
+		cfg.EndpointResolverWithOptions = Endpoint(endpoint)
+	}
+	return FromConfig(cfg), nil
+}
+
+// FromConfig creates the clients from the config, i.e. the config of a fake server
+func FromConfig(cfg aws.Config) *Clients {
+	return &Clients{cfg: cfg}
+}
+
+// Endpoint resolves the endpoint of every service and region to the URL. The hostname
+// is left as is, so the services are not told apart by their hostnames.
+func Endpoint(url string) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		return aws.Endpoint{URL: url, SigningRegion: region, HostnameImmutable: true, Source: aws.EndpointSourceCustom}, nil
+	})
+}
+
+// Config returns a copy of the config that the clients are created from
+func (c *Clients) Config() aws.Config {
+	return c.cfg.Copy()
+}
+
+// Region returns the region of the clients
+func (c *Clients) Region() string {
+	return c.cfg.Region
+}
+
+// InRegion returns the clients of another region with the same credentials and endpoint
+func (c *Clients) InRegion(region string) *Clients {
+	cfg := c.cfg.Copy()
+	cfg.Region = region
+	return &Clients{cfg: cfg}
+}
+
+// AutoScaling returns an Auto Scaling client
+func (c *Clients) AutoScaling() *autoscaling.Client {
+	return autoscaling.NewFromConfig(c.cfg)
+}
+
+// CloudWatch returns a CloudWatch client
+func (c *Clients) CloudWatch() *cloudwatch.Client {
+	return cloudwatch.NewFromConfig(c.cfg)
+}
+
+// CloudWatchLogs returns a CloudWatch Logs client
+func (c *Clients) CloudWatchLogs() *cloudwatchlogs.Client {
+	return cloudwatchlogs.NewFromConfig(c.cfg)
+}
+
+// Ec2 returns an EC2 client
+func (c *Clients) Ec2() *ec2.Client {
+	return ec2.NewFromConfig(c.cfg)
+}
+
+// Ecs returns an ECS client
+func (c *Clients) Ecs() *ecs.Client {
+	return ecs.NewFromConfig(c.cfg)
+}
+
+// Elbv2 returns an Elastic Load Balancing v2 client
+func (c *Clients) Elbv2() *elasticloadbalancingv2.Client {
+	return elasticloadbalancingv2.NewFromConfig(c.cfg)
+}
+
+// EventBridge returns an EventBridge client
+func (c *Clients) EventBridge() *eventbridge.Client {
+	return eventbridge.NewFromConfig(c.cfg)
+}
+
+// Iam returns an IAM client
+func (c *Clients) Iam() *iam.Client {
+	return iam.NewFromConfig(c.cfg)
+}
+
+// S3 returns an S3 client. Buckets are addressed by path when the endpoint is
+// overridden, as a custom endpoint does not serve a subdomain for each bucket.
+func (c *Clients) S3() *s3.Client {
+	return s3.NewFromConfig(c.cfg, func(o *s3.Options) {
+		o.UsePathStyle = c.cfg.EndpointResolverWithOptions != nil
+	})
+}
+
+// SecretsManager returns a Secrets Manager client
+func (c *Clients) SecretsManager() *secretsmanager.Client {
+	return secretsmanager.NewFromConfig(c.cfg)
+}
+
+// Sts returns an STS client
+func (c *Clients) Sts() *sts.Client {
+	return sts.NewFromConfig(c.cfg)
+}
@@ -0,0 +1,55 @@
+package awsclients
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithEndpoint(t *testing.T) {
+	s := fakeaws.NewServer(t, "us-east-2")
+
+	// Isolate the default config from the profiles of the machine running the test
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", fakeaws.AccessKeyId)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", fakeaws.SecretAccessKey)
+	t.Setenv(EndpointEnvVar, s.URL)
+
+	clients, err := New(context.TODO(), "us-east-2")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-2", clients.Region())
+
+	identity, err := clients.Sts().GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+	assert.Equal(t, fakeaws.AccountId, *identity.Account)
+	assert.Equal(t, 1, s.Calls("sts", "GetCallerIdentity"))
+
+	// The other clients use the overridden endpoint too
+	buckets, err := clients.S3().ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	require.NoError(t, err)
+	assert.Equal(t, fakeaws.CanonicalUserId, *buckets.Owner.ID)
+}
+
+func TestInRegion(t *testing.T) {
+	s := fakeaws.NewServer(t, "us-east-1")
+
+	clients := FromConfig(s.Config())
+	replica := clients.InRegion("us-east-2")
+	assert.Equal(t, "us-east-1", clients.Region())
+	assert.Equal(t, "us-east-2", replica.Region())
+
+	// The clients of the other region keep the endpoint and credentials
+	zones, err := replica.Ec2().DescribeAvailabilityZones(context.TODO(), &ec2.DescribeAvailabilityZonesInput{})
+	require.NoError(t, err)
+	assert.Len(t, zones.AvailabilityZones, fakeaws.NumAvailabilityZones)
+	assert.Equal(t, 1, s.Calls("ec2", "DescribeAvailabilityZones"))
+}
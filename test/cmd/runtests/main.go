@@ -0,0 +1,289 @@
+// Command runtests runs the tests of the Terraform examples with the credentials of an
+// assumed role. The role is assumed with the AWS SDK and its credentials are served to
+// the tests from memory, so they are refreshed when a test run outlives the session
+// and are never written to disk. The role is also passed to the MongoDB examples,
+// which assume it to read the Atlas API keys.
+//
+// Usage:
+//
+//	go run ./cmd/runtests -arn arn:aws:iam::123456789012:role/terratest
+//	go run ./cmd/runtests -plan-only
+//	go run ./cmd/runtests -arn <role> -tests vpc,ecs-cluster -stages plan,apply,validate
+//	go run ./cmd/runtests -arn <role> -report-dir /tmp/test-report
+//	go run ./cmd/runtests -arn <role> -resume
+//	go run ./cmd/runtests -arn <role> -cleanup-only
+//	go run ./cmd/runtests -arn <role> -base-ref origin/main
+//	go run ./cmd/runtests -base-ref origin/main -explain
+//	go run ./cmd/runtests -arn <role> -upgrade
+//	go run ./cmd/runtests -arn <role> -upgrade-from v2.1.0 -tests s3-artifact
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/credentials"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/idempotency"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/impact"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/journal"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/report"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/survivors"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/upgrade"
+)
+
+// stages are the test stages of TestExamplesForTerraformModules, each stage is
+// skipped by setting SKIP_<stage>. The upgrade stage only runs in the upgrade tests,
+// and the resources are only checked after the destroy stage destroyed them.
+var stages = []string{"plan", "apply", idempotency.Stage, "validate", upgrade.Stage, "destroy", survivors.Stage}
+
+// testName is the test that runs the examples
+const testName = "TestExamplesForTerraformModules"
+
+func main() {
+	arn := flag.String("arn", "", "The role ARN to assume and pass to the MongoDB examples")
+	skipRoleAssumption := flag.Bool("skip-role-assumption", false, "Run the tests with the default credentials instead of assuming the role")
+	duration := flag.Duration("duration", time.Hour, "The duration of each role session, credentials are refreshed before they expire")
+	stageList := flag.String("stages", strings.Join(stages, ","), "Comma separated stages to run")
+	planOnly := flag.Bool("plan-only", false, "Only run the offline plan of the examples, no AWS account is required")
+	tests := flag.String("tests", "", "Comma separated names of the test cases to run, i.e. vpc,ecs-cluster. Defaults to all")
+	timeout := flag.Duration("timeout", 2*time.Hour, "The timeout of the go test run")
+	parallel := flag.Int("parallel", 0, "The number of test cases to run in parallel, defaults to go test's default")
+	reportDir := flag.String("report-dir", os.Getenv(report.DirEnvVar), "The directory to write the JUnit report and a log per test to, no report is written when empty")
+	resume := flag.Bool("resume", false, "Resume the tests that an interrupted run left a journal for, skipping the stages it completed")
+	cleanupOnly := flag.Bool("cleanup-only", false, "Only destroy the tests that an interrupted run left a journal for")
+	baseRef := flag.String("base-ref", "", "Only run the tests whose examples are affected by the changes since the git ref, i.e. origin/main")
+	explain := flag.Bool("explain", false, "Print why each test is selected or skipped by -base-ref without running the tests")
+	upgradeLatest := flag.Bool("upgrade", false, "Apply the examples at the release before VERSION and plan their upgrade to the working tree")
+	upgradeFrom := flag.String("upgrade-from", "", "Apply the examples at the git tag and plan their upgrade to the working tree")
+	flag.Parse()
+
+	log.SetFlags(log.LstdFlags)
+
+	mode, err := journalMode(*resume, *cleanupOnly, *planOnly)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	selected, err := selectStages(*stageList, *planOnly)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for _, stage := range stages {
+		// Stages are selected by the flags only, SKIP_* variables
+		// left in the environment by earlier runs are overridden
+		env["SKIP_"+stage] = ""
+		if !selected[stage] {
+			env["SKIP_"+stage] = "true"
+		}
+	}
+
+	env[journal.ModeEnvVar] = string(mode)
+
+	from, err := upgradeFromFlags(*upgradeLatest, *upgradeFrom, *planOnly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	env[upgrade.FromEnvVar] = from
+
+	if *explain && *baseRef == "" {
+		log.Fatal("-explain requires -base-ref")
+	}
+	env[impact.BaseRefEnvVar] = *baseRef
+	env[impact.ExplainEnvVar] = ""
+	if *explain {
+		env[impact.ExplainEnvVar] = "true"
+	}
+
+	if *reportDir != "" {
+		dir, err := filepath.Abs(*reportDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		env[report.DirEnvVar] = dir
+	}
+
+	if *arn == "" {
+		log.Print("[WARN] ARN not set. This could lead to tests failing if running MongoDB tests.")
+	} else {
+		env["TF_VAR_mongodb_role_arn"] = *arn
+	}
+
+	if os.Getenv("MONGODB_SECRET_ARN") == "" {
+		log.Print("[WARN] MONGODB_SECRET_ARN not set. This could lead to tests failing if running MongoDB tests.")
+	}
+
+	// Only the plan stage runs without an AWS account
+	deploys := (selected["apply"] || selected[idempotency.Stage] || selected["validate"] || selected[upgrade.Stage] || selected["destroy"] || selected[survivors.Stage]) && !*explain
+	if *skipRoleAssumption || *arn == "" || !deploys {
+		log.Print("Skipping role assumption... Arn is not set, skip-role-assumption flag is set or nothing is deployed")
+	} else {
+		server, err := serveRoleCredentials(*arn, *duration)
+		if err != nil {
+			log.Fatalf("Unable to assume role %s: %s", *arn, err)
+		}
+		defer server.Close()
+
+		// Credentials in the environment take precedence over the
+		// served credentials, so they are removed for the tests
+		for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE"} {
+			env[key] = ""
+		}
+		for key, value := range server.EnvVars() {
+			env[key] = value
+		}
+	}
+
+	args := []string{"test", ".", "-v", "-timeout", timeout.String()}
+	if *parallel > 0 {
+		args = append(args, "-parallel", fmt.Sprint(*parallel))
+	}
+	if *tests != "" {
+		args = append(args, "-run", runPattern(strings.Split(*tests, ",")))
+	}
+
+	log.Print("Running tests")
+	os.Exit(runGoTest(args, env))
+}
+
+// journalMode returns how the tests treat the journals of interrupted runs
+func journalMode(resume bool, cleanupOnly bool, planOnly bool) (journal.Mode, error) {
+	switch {
+	case resume && cleanupOnly:
+		return journal.ModeNormal, fmt.Errorf("-resume and -cleanup-only cannot be used together")
+	case (resume || cleanupOnly) && planOnly:
+		return journal.ModeNormal, fmt.Errorf("-plan-only cannot resume or clean up deployed tests")
+	case resume:
+		return journal.ModeResume, nil
+	case cleanupOnly:
+		return journal.ModeCleanupOnly, nil
+	}
+	return journal.ModeNormal, nil
+}
+
+// upgradeFromFlags returns the tag that the upgrade tests apply the examples at, empty
+// when the tests run as usual
+func upgradeFromFlags(latest bool, from string, planOnly bool) (string, error) {
+	switch {
+	case latest && from != "":
+		return "", fmt.Errorf("-upgrade and -upgrade-from cannot be used together")
+	case (latest || from != "") && planOnly:
+		return "", fmt.Errorf("-plan-only cannot run the upgrade tests, they deploy the previous release")
+	case latest:
+		return upgrade.Previous, nil
+	}
+	return from, nil
+}
+
+// selectStages returns the stages to run
+func selectStages(stageList string, planOnly bool) (map[string]bool, error) {
+	selected := map[string]bool{}
+	if planOnly {
+		selected["plan"] = true
+		return selected, nil
+	}
+
+	for _, stage := range strings.Split(stageList, ",") {
+		stage = strings.TrimSpace(stage)
+		if stage == "" {
+			continue
+		}
+
+		known := false
+		for _, s := range stages {
+			known = known || s == stage
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown stage %s, expected one of %s", stage, strings.Join(stages, ", "))
+		}
+		selected[stage] = true
+	}
+	return selected, nil
+}
+
+// runPattern returns the -run pattern that selects the test cases by name
+func runPattern(names []string) string {
+	quoted := []string{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	return fmt.Sprintf("^%s$/^(%s)$", testName, strings.Join(quoted, "|"))
+}
+
+// serveRoleCredentials assumes the role and serves its credentials to the tests
+func serveRoleCredentials(arn string, duration time.Duration) (*credentials.Server, error) {
+	log.Print("Setting up role assumption")
+
+	ctx := context.Background()
+	provider, err := credentials.AssumeRole(ctx, arn, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assume the role before running the tests so an invalid role fails fast
+	creds, err := provider.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Assumed role %s. Expiration: %s", arn, creds.Expires.Format(time.RFC3339))
+
+	return credentials.NewServer(provider)
+}
+
+// runGoTest runs go test with the environment overrides and returns its exit code.
+// Interrupts are forwarded to go test, so the tests can destroy their resources.
+func runGoTest(args []string, env map[string]string) int {
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = []string{}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := env[key]; !ok {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	for key, value := range env {
+		if value != "" {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("Unable to run go test: %s", err)
+		return 1
+	}
+
+	go func() {
+		for sig := range signals {
+			log.Printf("Received %s, waiting for the tests to clean up", sig)
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+		log.Printf("go test failed: %s", err)
+		return 1
+	}
+	return 0
+}
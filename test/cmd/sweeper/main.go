@@ -0,0 +1,81 @@
+// Command sweeper deletes the resources that the example tests leak when a test
+// run is interrupted before its destroy stage, i.e. when a CI run times out.
+//
+// Resources are found by the "-test<random_id>" suffix that the examples add to
+// their names and by the tags that the test suite stamps on the resources it deploys.
+// Only the resources with the suite tag are deleted, the resources that are only
+// matched by their name are reported as skipped. The creation time and TTL tags are
+// used for the age of the resources when present.
+//
+// Usage:
+//
+//	go run ./cmd/sweeper -dry-run
+//	go run ./cmd/sweeper -regions us-east-1 -min-age 6h
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/modules"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/sweeper"
+)
+
+func main() {
+	regions := flag.String("regions", strings.Join(modules.AwsRegions, ","), "Comma separated regions to sweep")
+	minAge := flag.Duration("min-age", 6*time.Hour, "Only delete the resources of deployments older than this age")
+	dryRun := flag.Bool("dry-run", false, "Print the deletion plan without deleting any resources")
+	timeout := flag.Duration("timeout", 10*time.Minute, "How long to retry deleting a resource that other resources still depend on")
+	flag.Parse()
+
+	resources := []sweeper.Resource{}
+	sweepers := map[string]*sweeper.Sweeper{}
+	for _, region := range strings.Split(*regions, ",") {
+		region = strings.TrimSpace(region)
+		clients, err := awsclients.New(context.TODO(), region)
+		if err != nil {
+			fatalf("Unable to load the AWS config for %s: %s", region, err)
+		}
+		s := sweeper.New(clients)
+		sweepers[region] = s
+
+		found, err := s.Find()
+		if err != nil {
+			fatalf("Unable to find the resources in %s: %s", region, err)
+		}
+		resources = append(resources, found...)
+	}
+
+	plan := sweeper.NewPlan(resources, time.Now(), *minAge)
+	fmt.Print(plan)
+
+	if *dryRun {
+		return
+	}
+
+	// A resource that fails to delete is reported, the resources that depend on
+	// it are still attempted since they may be deleted by a later sweep
+	failed := 0
+	for _, r := range plan.Resources {
+		fmt.Printf("Deleting %s\n", r)
+		if err := sweepers[r.Region].Delete(r, *timeout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fatalf("Failed to delete %d of %d resources", failed, len(plan.Resources))
+	}
+	fmt.Printf("Deleted %d resources\n", len(plan.Resources))
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,146 @@
+// Package credentials assumes the role that the tests are run with and serves its
+// credentials to the test processes, so the credentials are only kept in memory and
+// are refreshed for test runs that outlive the session of the role.
+package credentials
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// SessionName is the name of the role session that the tests are run with
+const SessionName = "terratest-session"
+
+// AssumeRole returns a provider for the credentials of the role, assumed with the default
+// credentials. The credentials are cached in memory and refreshed before they expire.
+func AssumeRole(ctx context.Context, roleArn string, duration time.Duration) (aws.CredentialsProvider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = SessionName
+		o.Duration = duration
+	})
+
+	return aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		// Refresh early so a terraform apply is not started with credentials that
+		// expire before the provider reads them again
+		o.ExpiryWindow = 5 * time.Minute
+	}), nil
+}
+
+// Server serves credentials over the container credentials endpoint that the AWS SDKs,
+// the AWS CLI and the Terraform AWS provider read when AWS_CONTAINER_CREDENTIALS_FULL_URI
+// is set. The processes that are given EnvVars request credentials from the server each
+// time their credentials expire, so they are never written to disk.
+type Server struct {
+	provider aws.CredentialsProvider
+	token    string
+	listener net.Listener
+	server   *http.Server
+}
+
+// credentialsResponse is the response format of the container credentials endpoint
+type credentialsResponse struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      *time.Time `json:",omitempty"`
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewServer starts a server on the loopback interface for the credentials of the provider
+func NewServer(provider aws.CredentialsProvider) (*Server, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	// The SDKs only send the authorization token to a loopback address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		provider: provider,
+		token:    hex.EncodeToString(token),
+		listener: listener,
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveHTTP)}
+
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// URL is the endpoint of the server
+func (s *Server) URL() string {
+	return fmt.Sprintf("http://%s/credentials", s.listener.Addr())
+}
+
+// Token is the authorization token that requests to the server must send
+func (s *Server) Token() string {
+	return s.token
+}
+
+// EnvVars returns the environment variables that point the AWS SDKs at the server
+func (s *Server) EnvVars() map[string]string {
+	return map[string]string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI": s.URL(),
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN":  s.token,
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	err := s.server.Close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Header.Get("Authorization") != s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(errorResponse{Code: "Unauthorized", Message: "invalid authorization token"})
+		return
+	}
+
+	creds, err := s.provider.Retrieve(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(errorResponse{Code: "CredentialsError", Message: err.Error()})
+		return
+	}
+
+	response := credentialsResponse{
+		AccessKeyId:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+	}
+	if creds.CanExpire {
+		response.Expiration = &creds.Expires
+	}
+	json.NewEncoder(w).Encode(response)
+}
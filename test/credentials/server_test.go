@@ -0,0 +1,105 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotatingProvider returns new credentials that expire after the ttl on each call
+type rotatingProvider struct {
+	calls int32
+	ttl   time.Duration
+}
+
+func (p *rotatingProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	n := atomic.AddInt32(&p.calls, 1)
+	return aws.Credentials{
+		AccessKeyID:     fmt.Sprintf("AKIA%d", n),
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Now().Add(p.ttl),
+	}, nil
+}
+
+func newTestServer(t *testing.T, provider aws.CredentialsProvider) *Server {
+	server, err := NewServer(provider)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestServerServesContainerCredentials(t *testing.T) {
+	server := newTestServer(t, &rotatingProvider{ttl: time.Hour})
+
+	// Read the credentials the way the SDKs do when AWS_CONTAINER_CREDENTIALS_FULL_URI is set
+	client := endpointcreds.New(server.URL(), func(o *endpointcreds.Options) {
+		o.AuthorizationToken = server.Token()
+	})
+
+	creds, err := client.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIA1", creds.AccessKeyID)
+	assert.Equal(t, "secret", creds.SecretAccessKey)
+	assert.Equal(t, "token", creds.SessionToken)
+	assert.True(t, creds.CanExpire)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), creds.Expires, time.Minute)
+
+	assert.Equal(t, map[string]string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI": server.URL(),
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN":  server.Token(),
+	}, server.EnvVars())
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	server := newTestServer(t, &rotatingProvider{ttl: time.Hour})
+
+	response, err := http.Get(server.URL())
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	client := endpointcreds.New(server.URL(), func(o *endpointcreds.Options) {
+		o.AuthorizationToken = "wrong"
+	})
+	_, err = client.Retrieve(context.Background())
+	assert.Error(t, err)
+}
+
+func TestServerRefreshesExpiredCredentials(t *testing.T) {
+	provider := &rotatingProvider{ttl: 10 * time.Minute}
+	cache := aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = 5 * time.Minute
+	})
+	server := newTestServer(t, cache)
+
+	client := endpointcreds.New(server.URL(), func(o *endpointcreds.Options) {
+		o.AuthorizationToken = server.Token()
+	})
+
+	// Credentials are served from the cache until they are within the expiry window
+	first, err := client.Retrieve(context.Background())
+	require.NoError(t, err)
+	second, err := client.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, first.AccessKeyID, second.AccessKeyID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.calls))
+
+	// Credentials that expire within the window are refreshed
+	provider.ttl = time.Minute
+	cache.Invalidate()
+	_, err = client.Retrieve(context.Background())
+	require.NoError(t, err)
+	refreshed, err := client.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIA3", refreshed.AccessKeyID)
+}
@@ -0,0 +1,544 @@
+package fakeaws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TargetTrackingPolicy is a target tracking scaling policy of the memory utilization of
+// an ECS service, with the capacity limits of its scalable target
+type TargetTrackingPolicy struct {
+	// TargetValue is the average memory utilization in percent that the policy tracks
+	TargetValue float64
+
+	ScaleInCooldown  time.Duration
+	ScaleOutCooldown time.Duration
+
+	MinCapacity int64
+	MaxCapacity int64
+}
+
+// ModulePolicy returns the policy that the ecs-service module creates for the
+// auto_scaling_memory_util_threshold and the min and max number of tasks. The module
+// sets scale_in_cooldown to 60 and leaves the scale out cooldown at the ECS default.
+func ModulePolicy(threshold float64, minCapacity int64, maxCapacity int64) TargetTrackingPolicy {
+	return TargetTrackingPolicy{
+		TargetValue:      threshold,
+		ScaleInCooldown:  60 * time.Second,
+		ScaleOutCooldown: 300 * time.Second,
+		MinCapacity:      minCapacity,
+		MaxCapacity:      maxCapacity,
+	}
+}
+
+const (
+	// highDatapoints and lowDatapoints are the one minute datapoints that the alarms of a
+	// target tracking policy evaluate, the low alarm fires below 90% of the target value
+	highDatapoints = 3
+	lowDatapoints  = 15
+)
+
+// AutoScaling simulates the CloudWatch alarms and the Application Auto Scaling target
+// tracking policies of ECS services. Memory utilization that is published with
+// PutMemoryUtilization, or an alarm that is set with SetAlarmState, puts the AlarmHigh
+// or AlarmLow alarm of a policy into ALARM and the policy sets the desired count of the
+// service on the fake ECS API. An alarm that stays in ALARM keeps scaling the service on
+// each evaluation once its cooldown expired, like Application Auto Scaling does.
+type AutoScaling struct {
+	// Now is the clock of the cooldowns and the alarm history
+	Now func() time.Time
+
+	server *Server
+	ecs    *Ecs
+
+	mu         sync.Mutex
+	policies   map[string]*scalingPolicy
+	alarms     map[string]*metricAlarm
+	history    []alarmHistoryItem
+	activities []scalingActivity
+}
+
+type scalingPolicy struct {
+	TargetTrackingPolicy
+
+	clusterName string
+	serviceName string
+	arn         string
+	datapoints  []float64
+	createdAt   time.Time
+
+	lastScaleIn  time.Time
+	lastScaleOut time.Time
+	// scaledOutFrom is the capacity before the last scale out
+	scaledOutFrom int64
+	high          *metricAlarm
+	low           *metricAlarm
+}
+
+func (p *scalingPolicy) resourceId() string {
+	return fmt.Sprintf("service/%s/%s", p.clusterName, p.serviceName)
+}
+
+type metricAlarm struct {
+	AlarmName          string   `xml:"AlarmName"`
+	AlarmArn           string   `xml:"AlarmArn"`
+	StateValue         string   `xml:"StateValue"`
+	StateReason        string   `xml:"StateReason"`
+	Namespace          string   `xml:"Namespace"`
+	MetricName         string   `xml:"MetricName"`
+	Statistic          string   `xml:"Statistic"`
+	Period             int      `xml:"Period"`
+	EvaluationPeriods  int      `xml:"EvaluationPeriods"`
+	Threshold          float64  `xml:"Threshold"`
+	ComparisonOperator string   `xml:"ComparisonOperator"`
+	AlarmActions       []string `xml:"AlarmActions>member"`
+
+	policy *scalingPolicy
+	// metric is the average of the datapoints that put the alarm into its state
+	metric float64
+}
+
+type alarmHistoryItem struct {
+	AlarmName       string `xml:"AlarmName"`
+	AlarmType       string `xml:"AlarmType"`
+	Timestamp       string `xml:"Timestamp"`
+	HistoryItemType string `xml:"HistoryItemType"`
+	HistorySummary  string `xml:"HistorySummary"`
+}
+
+type scalingActivity struct {
+	ActivityId        string  `json:"ActivityId"`
+	ServiceNamespace  string  `json:"ServiceNamespace"`
+	ResourceId        string  `json:"ResourceId"`
+	ScalableDimension string  `json:"ScalableDimension"`
+	Description       string  `json:"Description"`
+	Cause             string  `json:"Cause"`
+	StatusCode        string  `json:"StatusCode"`
+	StartTime         float64 `json:"StartTime"`
+	EndTime           float64 `json:"EndTime"`
+}
+
+type describeAlarmsResponse struct {
+	XMLName          xml.Name         `xml:"http://monitoring.amazonaws.com/doc/2010-08-01/ DescribeAlarmsResponse"`
+	MetricAlarms     []metricAlarm    `xml:"DescribeAlarmsResult>MetricAlarms>member"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+type describeAlarmHistoryResponse struct {
+	XMLName           xml.Name           `xml:"http://monitoring.amazonaws.com/doc/2010-08-01/ DescribeAlarmHistoryResponse"`
+	AlarmHistoryItems []alarmHistoryItem `xml:"DescribeAlarmHistoryResult>AlarmHistoryItems>member"`
+	ResponseMetadata  ResponseMetadata   `xml:"ResponseMetadata"`
+}
+
+type setAlarmStateResponse struct {
+	XMLName          xml.Name         `xml:"http://monitoring.amazonaws.com/doc/2010-08-01/ SetAlarmStateResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+// NewAutoScaling registers the CloudWatch alarm and Application Auto Scaling APIs on
+// the server, the policies scale the services of the fake ECS API
+func NewAutoScaling(s *Server, ecs *Ecs) *AutoScaling {
+	a := &AutoScaling{
+		Now:      time.Now,
+		server:   s,
+		ecs:      ecs,
+		policies: map[string]*scalingPolicy{},
+		alarms:   map[string]*metricAlarm{},
+	}
+
+	s.Handle("monitoring", "DescribeAlarms", a.describeAlarms)
+	s.Handle("monitoring", "DescribeAlarmHistory", a.describeAlarmHistory)
+	s.Handle("monitoring", "SetAlarmState", a.setAlarmState)
+	s.Handle("application-autoscaling", "DescribeScalableTargets", a.describeScalableTargets)
+	s.Handle("application-autoscaling", "DescribeScalingPolicies", a.describeScalingPolicies)
+	s.Handle("application-autoscaling", "DescribeScalingActivities", a.describeScalingActivities)
+	return a
+}
+
+// AddTargetTrackingPolicy attaches the policy to the service of the fake ECS API and
+// returns the ARNs of its AlarmHigh and AlarmLow alarms
+func (a *AutoScaling) AddTargetTrackingPolicy(clusterName string, serviceName string, policy TargetTrackingPolicy) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id := fmt.Sprintf("%08x-0000-4000-8000-%012x", len(a.policies)+1, len(a.policies)+1)
+	p := &scalingPolicy{
+		TargetTrackingPolicy: policy,
+		clusterName:          clusterName,
+		serviceName:          serviceName,
+		createdAt:            a.Now(),
+	}
+	p.arn = fmt.Sprintf("arn:aws:autoscaling:%s:%s:scalingPolicy:%s:resource/ecs/%s:policyName/%s-mem-scaling", a.server.Region, AccountId, id, p.resourceId(), serviceName)
+	p.high = a.addAlarm(p, fmt.Sprintf("TargetTracking-%s-AlarmHigh-%s", p.resourceId(), id), "GreaterThanThreshold", highDatapoints, policy.TargetValue)
+	p.low = a.addAlarm(p, fmt.Sprintf("TargetTracking-%s-AlarmLow-%s", p.resourceId(), id), "LessThanThreshold", lowDatapoints, policy.TargetValue*0.9)
+	a.policies[p.resourceId()] = p
+
+	return []string{p.high.AlarmArn, p.low.AlarmArn}
+}
+
+func (a *AutoScaling) addAlarm(p *scalingPolicy, name string, comparisonOperator string, evaluationPeriods int, threshold float64) *metricAlarm {
+	alarm := &metricAlarm{
+		AlarmName:          name,
+		AlarmArn:           fmt.Sprintf("arn:aws:cloudwatch:%s:%s:alarm:%s", a.server.Region, AccountId, name),
+		StateValue:         "INSUFFICIENT_DATA",
+		Namespace:          "AWS/ECS",
+		MetricName:         "MemoryUtilization",
+		Statistic:          "Average",
+		Period:             60,
+		EvaluationPeriods:  evaluationPeriods,
+		Threshold:          threshold,
+		ComparisonOperator: comparisonOperator,
+		AlarmActions:       []string{p.arn},
+		policy:             p,
+	}
+	a.alarms[name] = alarm
+	return alarm
+}
+
+// PutMemoryUtilization publishes a one minute datapoint of the average memory
+// utilization of the service and evaluates the alarms of its policy
+func (a *AutoScaling) PutMemoryUtilization(clusterName string, serviceName string, percent float64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.policies[fmt.Sprintf("service/%s/%s", clusterName, serviceName)]
+	if !ok {
+		return fmt.Errorf("service %s of cluster %s has no scaling policy", serviceName, clusterName)
+	}
+	p.datapoints = append(p.datapoints, percent)
+
+	for _, alarm := range []*metricAlarm{p.high, p.low} {
+		if len(p.datapoints) < alarm.EvaluationPeriods {
+			continue
+		}
+		recent := p.datapoints[len(p.datapoints)-alarm.EvaluationPeriods:]
+		breaching := true
+		sum := 0.0
+		for _, datapoint := range recent {
+			sum += datapoint
+			if alarm.ComparisonOperator == "GreaterThanThreshold" && datapoint <= alarm.Threshold ||
+				alarm.ComparisonOperator == "LessThanThreshold" && datapoint >= alarm.Threshold {
+				breaching = false
+			}
+		}
+
+		state := "OK"
+		if breaching {
+			state = "ALARM"
+		}
+		reason := fmt.Sprintf("Threshold Crossed: %d datapoints %v were evaluated against the threshold (%s).", len(recent), recent, strconv.FormatFloat(alarm.Threshold, 'f', -1, 64))
+		if err := a.setState(alarm, state, reason, sum/float64(len(recent))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate scales the services whose alarms are in ALARM when their cooldown expired
+func (a *AutoScaling) Evaluate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.evaluate()
+}
+
+func (a *AutoScaling) evaluate() error {
+	for _, alarm := range a.alarms {
+		if alarm.StateValue == "ALARM" {
+			if err := a.execute(alarm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setState moves the alarm into the state, an alarm that changes to ALARM executes
+// the scaling policy
+func (a *AutoScaling) setState(alarm *metricAlarm, state string, reason string, metric float64) error {
+	previous := alarm.StateValue
+	alarm.StateValue = state
+	alarm.StateReason = reason
+	alarm.metric = metric
+	if previous == state {
+		if state == "ALARM" {
+			return a.execute(alarm)
+		}
+		return nil
+	}
+
+	a.addHistory(alarm, "StateUpdate", fmt.Sprintf("Alarm updated from %s to %s", previous, state))
+	if state != "ALARM" {
+		return nil
+	}
+	if err := a.execute(alarm); err != nil {
+		a.addHistory(alarm, "Action", fmt.Sprintf("Failed to execute action %s. Received error: %s", alarm.policy.arn, err))
+		return nil
+	}
+	a.addHistory(alarm, "Action", fmt.Sprintf("Successfully executed action %s", alarm.policy.arn))
+	return nil
+}
+
+func (a *AutoScaling) addHistory(alarm *metricAlarm, itemType string, summary string) {
+	a.history = append(a.history, alarmHistoryItem{
+		AlarmName:       alarm.AlarmName,
+		AlarmType:       "MetricAlarm",
+		Timestamp:       a.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		HistoryItemType: itemType,
+		HistorySummary:  summary,
+	})
+}
+
+// execute sets the desired count of the service to the capacity that brings the metric
+// of the alarm to the target value, within the limits of the scalable target. The
+// capacity that a scale out added counts as part of the capacity of the next scale out
+// during its cooldown, so an alarm that stays in ALARM does not scale the service out
+// again and again, and the service is not scaled in during the scale in cooldown of the
+// last scaling activity.
+func (a *AutoScaling) execute(alarm *metricAlarm) error {
+	p := alarm.policy
+	now := a.Now()
+
+	current, err := a.ecs.desiredCount(p.clusterName, p.serviceName)
+	if err != nil {
+		return err
+	}
+
+	scaleOut := alarm == p.high
+	base := current
+	if scaleOut && now.Sub(p.lastScaleOut) < p.ScaleOutCooldown {
+		base = p.scaledOutFrom
+	}
+	desired := int64(math.Ceil(float64(base) * alarm.metric / p.TargetValue))
+	desired = max(p.MinCapacity, min(p.MaxCapacity, desired))
+
+	switch {
+	case scaleOut && desired <= current:
+		return nil
+	case !scaleOut && desired >= current:
+		return nil
+	case !scaleOut && (now.Sub(p.lastScaleIn) < p.ScaleInCooldown || now.Sub(p.lastScaleOut) < p.ScaleInCooldown):
+		return nil
+	}
+
+	if _, err := a.ecs.scale(p.clusterName, p.serviceName, desired); err != nil {
+		return err
+	}
+	if scaleOut {
+		p.lastScaleOut = now
+		p.scaledOutFrom = base
+	} else {
+		p.lastScaleIn = now
+	}
+
+	a.activities = append(a.activities, scalingActivity{
+		ActivityId:        fmt.Sprintf("%08x-0000-4000-8000-000000000000", len(a.activities)+1),
+		ServiceNamespace:  "ecs",
+		ResourceId:        p.resourceId(),
+		ScalableDimension: "ecs:service:DesiredCount",
+		Description:       fmt.Sprintf("Setting desired count to %d.", desired),
+		Cause:             fmt.Sprintf("monitor alarm %s in state ALARM triggered policy %s-mem-scaling", alarm.AlarmName, p.serviceName),
+		StatusCode:        "Successful",
+		StartTime:         float64(now.Unix()),
+		EndTime:           float64(now.Unix()),
+	})
+	return nil
+}
+
+func (a *AutoScaling) describeAlarms(r *Request) (interface{}, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	names := members(r, "AlarmNames")
+	res := describeAlarmsResponse{ResponseMetadata: ResponseMetadata{RequestId: requestId}}
+	for _, name := range names {
+		if alarm, ok := a.alarms[name]; ok {
+			res.MetricAlarms = append(res.MetricAlarms, *alarm)
+		}
+	}
+	return res, nil
+}
+
+// describeAlarmHistory returns the history of the alarm, newest first. Reading the
+// history evaluates the alarms like the minutes passing between the checks of a test.
+func (a *AutoScaling) describeAlarmHistory(r *Request) (interface{}, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.evaluate(); err != nil {
+		return nil, err
+	}
+
+	maxRecords := 100
+	if value := r.Form.Get("MaxRecords"); value != "" {
+		maxRecords, _ = strconv.Atoi(value)
+	}
+
+	res := describeAlarmHistoryResponse{ResponseMetadata: ResponseMetadata{RequestId: requestId}}
+	for i := len(a.history) - 1; i >= 0 && len(res.AlarmHistoryItems) < maxRecords; i-- {
+		item := a.history[i]
+		if name := r.Form.Get("AlarmName"); name != "" && item.AlarmName != name {
+			continue
+		}
+		if itemType := r.Form.Get("HistoryItemType"); itemType != "" && item.HistoryItemType != itemType {
+			continue
+		}
+		res.AlarmHistoryItems = append(res.AlarmHistoryItems, item)
+	}
+	return res, nil
+}
+
+// setAlarmState forces the state of the alarm, the recentDatapoints of the state reason
+// data set the metric that the policy scales on. Forcing an alarm into ALARM moves the
+// other alarm of the policy to OK, like CloudWatch would on its next evaluation.
+func (a *AutoScaling) setAlarmState(r *Request) (interface{}, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alarm, ok := a.alarms[r.Form.Get("AlarmName")]
+	if !ok {
+		return nil, Errorf("ResourceNotFound", "Alarm %s not found", r.Form.Get("AlarmName"))
+	}
+
+	data := struct {
+		RecentDatapoints []float64 `json:"recentDatapoints"`
+	}{}
+	if value := r.Form.Get("StateReasonData"); value != "" {
+		if err := json.Unmarshal([]byte(value), &data); err != nil {
+			return nil, Errorf("InvalidFormat", "Invalid StateReasonData: %s", err)
+		}
+	}
+	metric := alarm.policy.TargetValue
+	if len(data.RecentDatapoints) > 0 {
+		sum := 0.0
+		for _, datapoint := range data.RecentDatapoints {
+			sum += datapoint
+		}
+		metric = sum / float64(len(data.RecentDatapoints))
+	}
+
+	// The metric that breaches one alarm of the policy is within the other
+	if state := r.Form.Get("StateValue"); state == "ALARM" {
+		other := alarm.policy.low
+		if alarm == other {
+			other = alarm.policy.high
+		}
+		if err := a.setState(other, "OK", r.Form.Get("StateReason"), metric); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.setState(alarm, r.Form.Get("StateValue"), r.Form.Get("StateReason"), metric); err != nil {
+		return nil, err
+	}
+	return setAlarmStateResponse{ResponseMetadata: ResponseMetadata{RequestId: requestId}}, nil
+}
+
+// resourcePolicies returns the policies of the ECS resource ids, or every policy
+func (a *AutoScaling) resourcePolicies(resourceIds []string) []*scalingPolicy {
+	if len(resourceIds) == 0 {
+		for resourceId := range a.policies {
+			resourceIds = append(resourceIds, resourceId)
+		}
+	}
+
+	policies := []*scalingPolicy{}
+	for _, resourceId := range resourceIds {
+		if p, ok := a.policies[resourceId]; ok {
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+func (a *AutoScaling) describeScalableTargets(r *Request) (interface{}, error) {
+	input := struct {
+		ResourceIds []string `json:"ResourceIds"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	targets := []map[string]interface{}{}
+	for _, p := range a.resourcePolicies(input.ResourceIds) {
+		targets = append(targets, map[string]interface{}{
+			"ServiceNamespace":  "ecs",
+			"ResourceId":        p.resourceId(),
+			"ScalableDimension": "ecs:service:DesiredCount",
+			"MinCapacity":       p.MinCapacity,
+			"MaxCapacity":       p.MaxCapacity,
+			"RoleARN":           fmt.Sprintf("arn:aws:iam::%s:role/aws-service-role/ecs.application-autoscaling.amazonaws.com/AWSServiceRoleForApplicationAutoScaling_ECSService", AccountId),
+			"CreationTime":      float64(p.createdAt.Unix()),
+		})
+	}
+	return map[string]interface{}{"ScalableTargets": targets}, nil
+}
+
+func (a *AutoScaling) describeScalingPolicies(r *Request) (interface{}, error) {
+	input := struct {
+		ResourceId string `json:"ResourceId"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resourceIds := []string{}
+	if input.ResourceId != "" {
+		resourceIds = append(resourceIds, input.ResourceId)
+	}
+
+	policies := []map[string]interface{}{}
+	for _, p := range a.resourcePolicies(resourceIds) {
+		policies = append(policies, map[string]interface{}{
+			"PolicyARN":         p.arn,
+			"PolicyName":        p.serviceName + "-mem-scaling",
+			"ServiceNamespace":  "ecs",
+			"ResourceId":        p.resourceId(),
+			"ScalableDimension": "ecs:service:DesiredCount",
+			"PolicyType":        "TargetTrackingScaling",
+			"TargetTrackingScalingPolicyConfiguration": map[string]interface{}{
+				"TargetValue":                   p.TargetValue,
+				"PredefinedMetricSpecification": map[string]string{"PredefinedMetricType": "ECSServiceAverageMemoryUtilization"},
+				"ScaleInCooldown":               int(p.ScaleInCooldown.Seconds()),
+				"ScaleOutCooldown":              int(p.ScaleOutCooldown.Seconds()),
+			},
+			"Alarms": []map[string]string{
+				{"AlarmName": p.high.AlarmName, "AlarmARN": p.high.AlarmArn},
+				{"AlarmName": p.low.AlarmName, "AlarmARN": p.low.AlarmArn},
+			},
+			"CreationTime": float64(p.createdAt.Unix()),
+		})
+	}
+	return map[string]interface{}{"ScalingPolicies": policies}, nil
+}
+
+// describeScalingActivities returns the scaling activities of the resource, newest first
+func (a *AutoScaling) describeScalingActivities(r *Request) (interface{}, error) {
+	input := struct {
+		ResourceId string `json:"ResourceId"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	activities := []scalingActivity{}
+	for i := len(a.activities) - 1; i >= 0; i-- {
+		if input.ResourceId == "" || a.activities[i].ResourceId == input.ResourceId {
+			activities = append(activities, a.activities[i])
+		}
+	}
+	return map[string]interface{}{"ScalingActivities": activities}, nil
+}
@@ -0,0 +1,162 @@
+package fakeaws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	aws_sdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type autoScalingTest struct {
+	*AutoScaling
+
+	ecs        *Ecs
+	cloudwatch *cloudwatch.Client
+	scaling    *applicationautoscaling.ApplicationAutoScaling
+	now        time.Time
+	high       string
+	low        string
+}
+
+// newAutoScaling returns a simulator with a service of 2 tasks that the module's policy
+// scales between 1 and 4 tasks at 50% memory utilization
+func newAutoScaling(t *testing.T) *autoScalingTest {
+	s := NewServer(t, "us-east-1")
+	ecs := NewEcs(s)
+	ecs.AddCluster("cluster", 1)
+	ecs.AddService("cluster", "service", ecs.AddTaskDefinition("service", "nginx:1"), 2)
+
+	a := &autoScalingTest{
+		AutoScaling: NewAutoScaling(s, ecs),
+		ecs:         ecs,
+		cloudwatch:  cloudwatch.NewFromConfig(s.Config()),
+		scaling:     applicationautoscaling.New(s.Session()),
+		now:         time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	a.Now = func() time.Time { return a.now }
+
+	alarmArns := a.AddTargetTrackingPolicy("cluster", "service", ModulePolicy(50, 1, 4))
+	a.high = alarmArns[0][len("arn:aws:cloudwatch:us-east-1:123456789012:alarm:"):]
+	a.low = alarmArns[1][len("arn:aws:cloudwatch:us-east-1:123456789012:alarm:"):]
+	return a
+}
+
+func (a *autoScalingTest) desiredCount(t *testing.T) int64 {
+	count, err := a.ecs.desiredCount("cluster", "service")
+	require.NoError(t, err)
+	return count
+}
+
+func (a *autoScalingTest) putMemoryUtilization(t *testing.T, percent float64, minutes int) {
+	for i := 0; i < minutes; i++ {
+		a.now = a.now.Add(time.Minute)
+		require.NoError(t, a.PutMemoryUtilization("cluster", "service", percent))
+	}
+}
+
+func (a *autoScalingTest) setAlarmState(t *testing.T, alarmName string, datapoints string) {
+	_, err := a.cloudwatch.SetAlarmState(context.TODO(), &cloudwatch.SetAlarmStateInput{
+		AlarmName:       &alarmName,
+		StateValue:      types.StateValueAlarm,
+		StateReason:     aws_sdk.String("Setting alarm to ALARM state for testing"),
+		StateReasonData: aws_sdk.String(`{"version":"1.0","recentDatapoints":` + datapoints + `}`),
+	})
+	require.NoError(t, err)
+}
+
+func TestAutoScalingScaleOut(t *testing.T) {
+	a := newAutoScaling(t)
+
+	// The alarm needs 3 datapoints above the target value
+	a.putMemoryUtilization(t, 75, 2)
+	assert.Equal(t, int64(2), a.desiredCount(t))
+	a.putMemoryUtilization(t, 75, 1)
+	assert.Equal(t, int64(3), a.desiredCount(t))
+
+	history, err := a.cloudwatch.DescribeAlarmHistory(context.TODO(), &cloudwatch.DescribeAlarmHistoryInput{AlarmName: &a.high})
+	require.NoError(t, err)
+	require.Len(t, history.AlarmHistoryItems, 2)
+	assert.Contains(t, *history.AlarmHistoryItems[0].HistorySummary, "Successfully executed action arn:aws:autoscaling:us-east-1:123456789012:scalingPolicy:")
+	assert.Equal(t, types.HistoryItemTypeAction, history.AlarmHistoryItems[0].HistoryItemType)
+	assert.Equal(t, "Alarm updated from INSUFFICIENT_DATA to ALARM", *history.AlarmHistoryItems[1].HistorySummary)
+
+	// The capacity of the scale out counts during its cooldown, the alarm that stays in
+	// ALARM does not scale out again for the same utilization
+	a.putMemoryUtilization(t, 75, 3)
+	assert.Equal(t, int64(3), a.desiredCount(t))
+
+	// Scaling out beyond the max capacity is clamped to it
+	a.setAlarmState(t, a.high, "[100,100,100]")
+	assert.Equal(t, int64(4), a.desiredCount(t))
+	a.now = a.now.Add(10 * time.Minute)
+	require.NoError(t, a.Evaluate())
+	assert.Equal(t, int64(4), a.desiredCount(t))
+
+	activities, err := a.scaling.DescribeScalingActivities(&applicationautoscaling.DescribeScalingActivitiesInput{
+		ServiceNamespace: aws_sdk.String("ecs"),
+		ResourceId:       aws_sdk.String("service/cluster/service"),
+	})
+	require.NoError(t, err)
+	require.Len(t, activities.ScalingActivities, 2)
+	assert.Equal(t, "Setting desired count to 4.", *activities.ScalingActivities[0].Description)
+	assert.Equal(t, "Setting desired count to 3.", *activities.ScalingActivities[1].Description)
+}
+
+func TestAutoScalingScaleIn(t *testing.T) {
+	a := newAutoScaling(t)
+	a.setAlarmState(t, a.high, "[100,100,100]")
+	assert.Equal(t, int64(4), a.desiredCount(t))
+
+	alarms, err := a.cloudwatch.DescribeAlarms(context.TODO(), &cloudwatch.DescribeAlarmsInput{AlarmNames: []string{a.high, a.low}})
+	require.NoError(t, err)
+	require.Len(t, alarms.MetricAlarms, 2)
+	assert.Equal(t, types.StateValueAlarm, alarms.MetricAlarms[0].StateValue)
+	assert.Equal(t, types.StateValueOk, alarms.MetricAlarms[1].StateValue)
+
+	// The service is not scaled in during the scale in cooldown of the scale out
+	a.setAlarmState(t, a.low, "[20,20,20]")
+	assert.Equal(t, int64(4), a.desiredCount(t))
+
+	a.now = a.now.Add(time.Minute)
+	require.NoError(t, a.Evaluate())
+	assert.Equal(t, int64(2), a.desiredCount(t))
+
+	// Scaling in below the min capacity is clamped to it, after the cooldown of the
+	// previous scale in
+	a.putMemoryUtilization(t, 5, 15)
+	assert.Equal(t, int64(1), a.desiredCount(t))
+
+	targets, err := a.scaling.DescribeScalableTargets(&applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace: aws_sdk.String("ecs"),
+		ResourceIds:      []*string{aws_sdk.String("service/cluster/service")},
+	})
+	require.NoError(t, err)
+	require.Len(t, targets.ScalableTargets, 1)
+	assert.Equal(t, int64(1), *targets.ScalableTargets[0].MinCapacity)
+	assert.Equal(t, int64(4), *targets.ScalableTargets[0].MaxCapacity)
+
+	policies, err := a.scaling.DescribeScalingPolicies(&applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace: aws_sdk.String("ecs"),
+		ResourceId:       aws_sdk.String("service/cluster/service"),
+	})
+	require.NoError(t, err)
+	require.Len(t, policies.ScalingPolicies, 1)
+	configuration := policies.ScalingPolicies[0].TargetTrackingScalingPolicyConfiguration
+	assert.Equal(t, float64(50), *configuration.TargetValue)
+	assert.Equal(t, int64(60), *configuration.ScaleInCooldown)
+	assert.Len(t, policies.ScalingPolicies[0].Alarms, 2)
+
+	_, err = a.cloudwatch.SetAlarmState(context.TODO(), &cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws_sdk.String("missing"),
+		StateValue:  types.StateValueAlarm,
+		StateReason: aws_sdk.String("Setting alarm to ALARM state for testing"),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ResourceNotFound")
+}
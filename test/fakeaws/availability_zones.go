@@ -0,0 +1,58 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// NumAvailabilityZones is the number of availability zones that the fake
+// server reports for its region, i.e. us-east-1a, us-east-1b, us-east-1c.
+const NumAvailabilityZones = 3
+
+type describeAvailabilityZonesResponse struct {
+	XMLName   xml.Name           `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeAvailabilityZonesResponse"`
+	RequestId string             `xml:"requestId"`
+	Zones     []availabilityZone `xml:"availabilityZoneInfo>item"`
+}
+
+type availabilityZone struct {
+	ZoneName           string `xml:"zoneName"`
+	ZoneId             string `xml:"zoneId"`
+	ZoneState          string `xml:"zoneState"`
+	ZoneType           string `xml:"zoneType"`
+	RegionName         string `xml:"regionName"`
+	GroupName          string `xml:"groupName"`
+	NetworkBorderGroup string `xml:"networkBorderGroup"`
+	OptInStatus        string `xml:"optInStatus"`
+}
+
+// AvailabilityZones returns the names of the availability zones that the fake
+// server reports for the region
+func AvailabilityZones(region string) []string {
+	zones := []string{}
+	for i := 0; i < NumAvailabilityZones; i++ {
+		zones = append(zones, fmt.Sprintf("%s%c", region, 'a'+i))
+	}
+	return zones
+}
+
+// registerAvailabilityZoneOperations answers ec2:DescribeAvailabilityZones
+// which is read by the vpc module to place subnets.
+func registerAvailabilityZoneOperations(s *Server) {
+	s.Handle("ec2", "DescribeAvailabilityZones", func(r *Request) (interface{}, error) {
+		res := describeAvailabilityZonesResponse{RequestId: requestId}
+		for i, name := range AvailabilityZones(s.Region) {
+			res.Zones = append(res.Zones, availabilityZone{
+				ZoneName:           name,
+				ZoneId:             fmt.Sprintf("fake-az%d", i+1),
+				ZoneState:          "available",
+				ZoneType:           "availability-zone",
+				RegionName:         s.Region,
+				GroupName:          s.Region,
+				NetworkBorderGroup: s.Region,
+				OptInStatus:        "opt-in-not-required",
+			})
+		}
+		return res, nil
+	})
+}
@@ -0,0 +1,439 @@
+package fakeaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRolloutChecks is the number of times a service is described before the
+// deployment that UpdateService started leaves the IN_PROGRESS state
+const DefaultRolloutChecks = 2
+
+// Ecs is an in-memory ECS API that keeps clusters, services, task definitions and the
+// deployments of the services. A deployment started by UpdateService is IN_PROGRESS
+// until its service has been described RolloutChecks times, then it is COMPLETED, or
+// FAILED when a failure was set for the service with FailRollout.
+type Ecs struct {
+	// RolloutChecks is the number of DescribeServices calls that a rollout takes
+	RolloutChecks int
+
+	server *Server
+
+	mu              sync.Mutex
+	clusters        map[string]*ecsCluster
+	taskDefinitions map[string]map[string]interface{}
+	revisions       map[string]int
+	rolloutFailures map[string]string
+	deployments     int
+}
+
+type ecsCluster struct {
+	ClusterArn                        string   `json:"clusterArn"`
+	ClusterName                       string   `json:"clusterName"`
+	Status                            string   `json:"status"`
+	RegisteredContainerInstancesCount int64    `json:"registeredContainerInstancesCount"`
+	ActiveServicesCount               int64    `json:"activeServicesCount"`
+	CapacityProviders                 []string `json:"capacityProviders"`
+
+	services map[string]*ecsService
+}
+
+type ecsService struct {
+	ServiceArn     string           `json:"serviceArn"`
+	ServiceName    string           `json:"serviceName"`
+	ClusterArn     string           `json:"clusterArn"`
+	Status         string           `json:"status"`
+	TaskDefinition string           `json:"taskDefinition"`
+	DesiredCount   int64            `json:"desiredCount"`
+	RunningCount   int64            `json:"runningCount"`
+	PendingCount   int64            `json:"pendingCount"`
+	Deployments    []*ecsDeployment `json:"deployments"`
+
+	// checks counts the describe calls since the rollout of the primary deployment started
+	checks int
+}
+
+type ecsDeployment struct {
+	Id                 string  `json:"id"`
+	Status             string  `json:"status"`
+	TaskDefinition     string  `json:"taskDefinition"`
+	DesiredCount       int64   `json:"desiredCount"`
+	RunningCount       int64   `json:"runningCount"`
+	PendingCount       int64   `json:"pendingCount"`
+	RolloutState       string  `json:"rolloutState"`
+	RolloutStateReason string  `json:"rolloutStateReason"`
+	CreatedAt          float64 `json:"createdAt"`
+	UpdatedAt          float64 `json:"updatedAt"`
+}
+
+type ecsFailure struct {
+	Arn    string `json:"arn"`
+	Reason string `json:"reason"`
+}
+
+// NewEcs registers an empty ECS API on the server
+func NewEcs(s *Server) *Ecs {
+	e := &Ecs{
+		RolloutChecks:   DefaultRolloutChecks,
+		server:          s,
+		clusters:        map[string]*ecsCluster{},
+		taskDefinitions: map[string]map[string]interface{}{},
+		revisions:       map[string]int{},
+		rolloutFailures: map[string]string{},
+	}
+
+	s.Handle("ecs", "DescribeClusters", e.describeClusters)
+	s.Handle("ecs", "DescribeServices", e.describeServices)
+	s.Handle("ecs", "DescribeTaskDefinition", e.describeTaskDefinition)
+	s.Handle("ecs", "RegisterTaskDefinition", e.registerTaskDefinition)
+	s.Handle("ecs", "UpdateService", e.updateService)
+	return e
+}
+
+func (e *Ecs) arn(resource string) string {
+	return fmt.Sprintf("arn:aws:ecs:%s:%s:%s", e.server.Region, AccountId, resource)
+}
+
+// AddCluster adds an ACTIVE cluster with the number of registered container instances
+// and returns its ARN
+func (e *Ecs) AddCluster(name string, containerInstances int) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster := &ecsCluster{
+		ClusterArn:                        e.arn("cluster/" + name),
+		ClusterName:                       name,
+		Status:                            "ACTIVE",
+		RegisteredContainerInstancesCount: int64(containerInstances),
+		CapacityProviders:                 []string{"FARGATE", name + "-cp"},
+		services:                          map[string]*ecsService{},
+	}
+	e.clusters[name] = cluster
+	return cluster.ClusterArn
+}
+
+// AddTaskDefinition registers a revision of the family with a single essential
+// container that runs the image and returns its ARN
+func (e *Ecs) AddTaskDefinition(family string, image string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.register(map[string]interface{}{
+		"family": family,
+		"containerDefinitions": []interface{}{
+			map[string]interface{}{"name": family, "image": image, "essential": true},
+		},
+	})
+}
+
+// AddService adds a service to the cluster whose deployment of the task definition
+// is COMPLETED, and returns its ARN
+func (e *Ecs) AddService(clusterName string, serviceName string, taskDefinitionArn string, desiredCount int) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster := e.clusters[clusterName]
+	service := &ecsService{
+		ServiceArn:     e.arn(fmt.Sprintf("service/%s/%s", clusterName, serviceName)),
+		ServiceName:    serviceName,
+		ClusterArn:     cluster.ClusterArn,
+		Status:         "ACTIVE",
+		TaskDefinition: taskDefinitionArn,
+		DesiredCount:   int64(desiredCount),
+		RunningCount:   int64(desiredCount),
+	}
+	deployment := e.newDeployment(service)
+	deployment.RunningCount = int64(desiredCount)
+	deployment.RolloutState = "COMPLETED"
+	deployment.RolloutStateReason = fmt.Sprintf("ECS deployment %s completed.", deployment.Id)
+	service.Deployments = []*ecsDeployment{deployment}
+
+	cluster.services[serviceName] = service
+	cluster.ActiveServicesCount++
+	return service.ServiceArn
+}
+
+// FailRollout makes the rollouts of the service fail with the reason
+func (e *Ecs) FailRollout(clusterName string, serviceName string, reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rolloutFailures[e.arn(fmt.Sprintf("service/%s/%s", clusterName, serviceName))] = reason
+}
+
+// desiredCount returns the desired count of the service
+func (e *Ecs) desiredCount(clusterName string, serviceName string) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, ok := e.clusters[clusterName]
+	if !ok {
+		return 0, Errorf("ClusterNotFoundException", "Cluster not found.")
+	}
+	service, ok := cluster.services[serviceName]
+	if !ok {
+		return 0, Errorf("ServiceNotFoundException", "Service not found.")
+	}
+	return service.DesiredCount, nil
+}
+
+// scale sets the desired count of the service and returns the previous desired count,
+// the tasks of the primary deployment start and stop right away
+func (e *Ecs) scale(clusterName string, serviceName string, desiredCount int64) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, ok := e.clusters[clusterName]
+	if !ok {
+		return 0, Errorf("ClusterNotFoundException", "Cluster not found.")
+	}
+	service, ok := cluster.services[serviceName]
+	if !ok {
+		return 0, Errorf("ServiceNotFoundException", "Service not found.")
+	}
+
+	previous := service.DesiredCount
+	service.DesiredCount = desiredCount
+	service.RunningCount = desiredCount
+	service.Deployments[0].DesiredCount = desiredCount
+	service.Deployments[0].RunningCount = desiredCount
+	return previous, nil
+}
+
+// register stores a revision of the task definition and returns its ARN
+func (e *Ecs) register(definition map[string]interface{}) string {
+	family, _ := definition["family"].(string)
+	e.revisions[family]++
+	revision := e.revisions[family]
+
+	taskDefinitionArn := e.arn(fmt.Sprintf("task-definition/%s:%d", family, revision))
+	definition["taskDefinitionArn"] = taskDefinitionArn
+	definition["revision"] = revision
+	definition["status"] = "ACTIVE"
+	definition["registeredAt"] = float64(time.Now().Unix())
+	e.taskDefinitions[taskDefinitionArn] = definition
+	return taskDefinitionArn
+}
+
+// newDeployment returns a PRIMARY deployment of the task definition of the service
+func (e *Ecs) newDeployment(service *ecsService) *ecsDeployment {
+	e.deployments++
+	now := float64(time.Now().Unix())
+	return &ecsDeployment{
+		Id:             fmt.Sprintf("ecs-svc/%019d", e.deployments),
+		Status:         "PRIMARY",
+		TaskDefinition: service.TaskDefinition,
+		DesiredCount:   service.DesiredCount,
+		RolloutState:   "IN_PROGRESS",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// rollout advances the rollout of the primary deployment of the service
+func (e *Ecs) rollout(service *ecsService) {
+	primary := service.Deployments[0]
+	if primary.RolloutState != "IN_PROGRESS" {
+		return
+	}
+	service.checks++
+	if service.checks < e.RolloutChecks {
+		return
+	}
+
+	primary.UpdatedAt = float64(time.Now().Unix())
+	if reason, ok := e.rolloutFailures[service.ServiceArn]; ok {
+		primary.RolloutState = "FAILED"
+		primary.RolloutStateReason = reason
+		service.RunningCount = 0
+	} else {
+		primary.RolloutState = "COMPLETED"
+		primary.RolloutStateReason = fmt.Sprintf("ECS deployment %s completed.", primary.Id)
+		primary.RunningCount = primary.DesiredCount
+		service.RunningCount = primary.DesiredCount
+	}
+	service.Deployments = []*ecsDeployment{primary}
+}
+
+// cluster returns the cluster by name or ARN, ECS uses the default cluster when the
+// cluster is not set
+func (e *Ecs) cluster(nameOrArn string) (*ecsCluster, bool) {
+	if nameOrArn == "" {
+		nameOrArn = "default"
+	}
+	cluster, ok := e.clusters[nameOrArn[strings.LastIndex(nameOrArn, "/")+1:]]
+	return cluster, ok
+}
+
+// taskDefinition returns the task definition by ARN, family:revision or family, the
+// family returns its latest revision
+func (e *Ecs) taskDefinition(id string) (map[string]interface{}, bool) {
+	if definition, ok := e.taskDefinitions[id]; ok {
+		return definition, true
+	}
+	id = id[strings.LastIndex(id, "/")+1:]
+	if !strings.Contains(id, ":") {
+		id = fmt.Sprintf("%s:%d", id, e.revisions[id])
+	}
+	definition, ok := e.taskDefinitions[e.arn("task-definition/"+id)]
+	return definition, ok
+}
+
+// encode marshals the response while the state is locked, the server writes it after
+// the lock is released
+func encode(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+func (e *Ecs) describeClusters(r *Request) (interface{}, error) {
+	input := struct {
+		Clusters []string `json:"clusters"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+	if len(input.Clusters) == 0 {
+		input.Clusters = []string{"default"}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	clusters := []*ecsCluster{}
+	failures := []ecsFailure{}
+	for _, id := range input.Clusters {
+		if cluster, ok := e.cluster(id); ok {
+			clusters = append(clusters, cluster)
+		} else {
+			failures = append(failures, ecsFailure{Arn: e.arn("cluster/" + id), Reason: "MISSING"})
+		}
+	}
+	return encode(map[string]interface{}{"clusters": clusters, "failures": failures})
+}
+
+func (e *Ecs) describeServices(r *Request) (interface{}, error) {
+	input := struct {
+		Cluster  string   `json:"cluster"`
+		Services []string `json:"services"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, ok := e.cluster(input.Cluster)
+	if !ok {
+		return nil, Errorf("ClusterNotFoundException", "Cluster not found.")
+	}
+
+	services := []*ecsService{}
+	failures := []ecsFailure{}
+	for _, id := range input.Services {
+		service, ok := cluster.services[id[strings.LastIndex(id, "/")+1:]]
+		if !ok {
+			failures = append(failures, ecsFailure{Arn: id, Reason: "MISSING"})
+			continue
+		}
+		e.rollout(service)
+		services = append(services, service)
+	}
+	return encode(map[string]interface{}{"services": services, "failures": failures})
+}
+
+func (e *Ecs) describeTaskDefinition(r *Request) (interface{}, error) {
+	input := struct {
+		TaskDefinition string `json:"taskDefinition"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	definition, ok := e.taskDefinition(input.TaskDefinition)
+	if !ok {
+		return nil, Errorf("ClientException", "Unable to describe task definition.")
+	}
+	return encode(map[string]interface{}{"taskDefinition": definition, "tags": []interface{}{}})
+}
+
+func (e *Ecs) registerTaskDefinition(r *Request) (interface{}, error) {
+	definition := map[string]interface{}{}
+	if err := r.Decode(&definition); err != nil {
+		return nil, err
+	}
+	if family, _ := definition["family"].(string); family == "" {
+		return nil, Errorf("ClientException", "Family is required.")
+	}
+	if containers, _ := definition["containerDefinitions"].([]interface{}); len(containers) == 0 {
+		return nil, Errorf("ClientException", "Container list cannot be empty.")
+	}
+	delete(definition, "tags")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	taskDefinitionArn := e.register(definition)
+	return encode(map[string]interface{}{"taskDefinition": e.taskDefinitions[taskDefinitionArn]})
+}
+
+func (e *Ecs) updateService(r *Request) (interface{}, error) {
+	input := struct {
+		Cluster            string `json:"cluster"`
+		Service            string `json:"service"`
+		TaskDefinition     string `json:"taskDefinition"`
+		DesiredCount       *int64 `json:"desiredCount"`
+		ForceNewDeployment bool   `json:"forceNewDeployment"`
+	}{}
+	if err := r.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, ok := e.cluster(input.Cluster)
+	if !ok {
+		return nil, Errorf("ClusterNotFoundException", "Cluster not found.")
+	}
+	service, ok := cluster.services[input.Service[strings.LastIndex(input.Service, "/")+1:]]
+	if !ok {
+		return nil, Errorf("ServiceNotFoundException", "Service not found.")
+	}
+
+	if input.DesiredCount != nil {
+		service.DesiredCount = *input.DesiredCount
+		service.Deployments[0].DesiredCount = *input.DesiredCount
+	}
+
+	newDeployment := input.ForceNewDeployment
+	if input.TaskDefinition != "" {
+		definition, ok := e.taskDefinition(input.TaskDefinition)
+		if !ok {
+			return nil, Errorf("InvalidParameterException", "TaskDefinition not found.")
+		}
+		taskDefinitionArn := definition["taskDefinitionArn"].(string)
+		newDeployment = newDeployment || taskDefinitionArn != service.TaskDefinition
+		service.TaskDefinition = taskDefinitionArn
+	}
+
+	// The previous deployments keep running until the new deployment completes
+	if newDeployment {
+		for _, deployment := range service.Deployments {
+			deployment.Status = "ACTIVE"
+		}
+		service.Deployments = append([]*ecsDeployment{e.newDeployment(service)}, service.Deployments...)
+		service.checks = 0
+	}
+	return encode(map[string]interface{}{"service": service})
+}
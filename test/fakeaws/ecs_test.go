@@ -0,0 +1,141 @@
+package fakeaws
+
+import (
+	"testing"
+
+	aws_sdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEcs(t *testing.T) (*Ecs, *ecs.ECS) {
+	s := NewServer(t, "us-east-1")
+	fake := NewEcs(s)
+	fake.AddCluster("cluster", 1)
+	fake.AddService("cluster", "service", fake.AddTaskDefinition("service", "nginx:1"), 2)
+	return fake, ecs.New(s.Session())
+}
+
+func describeService(t *testing.T, client *ecs.ECS) *ecs.Service {
+	out, err := client.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws_sdk.String("cluster"),
+		Services: []*string{aws_sdk.String("service")},
+	})
+	require.NoError(t, err)
+	require.Len(t, out.Services, 1)
+	return out.Services[0]
+}
+
+func TestEcsDescribe(t *testing.T) {
+	_, client := newEcs(t)
+
+	clusters, err := client.DescribeClusters(&ecs.DescribeClustersInput{
+		Clusters: []*string{aws_sdk.String("cluster"), aws_sdk.String("missing")},
+	})
+	require.NoError(t, err)
+	require.Len(t, clusters.Clusters, 1)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:cluster/cluster", *clusters.Clusters[0].ClusterArn)
+	assert.Equal(t, "ACTIVE", *clusters.Clusters[0].Status)
+	assert.Equal(t, int64(1), *clusters.Clusters[0].RegisteredContainerInstancesCount)
+	require.Len(t, clusters.Failures, 1)
+	assert.Equal(t, "MISSING", *clusters.Failures[0].Reason)
+
+	service := describeService(t, client)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/service:1", *service.TaskDefinition)
+	assert.Equal(t, int64(2), *service.RunningCount)
+	require.Len(t, service.Deployments, 1)
+	assert.Equal(t, ecs.DeploymentRolloutStateCompleted, *service.Deployments[0].RolloutState)
+
+	services, err := client.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws_sdk.String("cluster"),
+		Services: []*string{aws_sdk.String("missing")},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, services.Services)
+	assert.Len(t, services.Failures, 1)
+
+	_, err = client.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws_sdk.String("missing"),
+		Services: []*string{aws_sdk.String("service")},
+	})
+	require.Error(t, err)
+	assert.Equal(t, ecs.ErrCodeClusterNotFoundException, err.(awserr.Error).Code())
+}
+
+func TestEcsRegisterTaskDefinition(t *testing.T) {
+	_, client := newEcs(t)
+
+	latest, err := client.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{TaskDefinition: aws_sdk.String("service")})
+	require.NoError(t, err)
+
+	// A task definition that was described registers as the next revision
+	latest.TaskDefinition.ContainerDefinitions[0].Image = aws_sdk.String("nginx:2")
+	registered, err := client.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:               latest.TaskDefinition.Family,
+		ContainerDefinitions: latest.TaskDefinition.ContainerDefinitions,
+		Memory:               aws_sdk.String("512"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *registered.TaskDefinition.Revision)
+	assert.Equal(t, "512", *registered.TaskDefinition.Memory)
+
+	for _, id := range []string{"service", "service:2", *registered.TaskDefinition.TaskDefinitionArn} {
+		out, err := client.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{TaskDefinition: aws_sdk.String(id)})
+		require.NoError(t, err)
+		assert.Equal(t, "nginx:2", *out.TaskDefinition.ContainerDefinitions[0].Image, id)
+	}
+
+	_, err = client.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{TaskDefinition: aws_sdk.String("service:3")})
+	require.Error(t, err)
+	assert.Equal(t, ecs.ErrCodeClientException, err.(awserr.Error).Code())
+}
+
+func TestEcsRollout(t *testing.T) {
+	fake, client := newEcs(t)
+	taskDefinitionArn := fake.AddTaskDefinition("service", "nginx:2")
+
+	_, err := client.UpdateService(&ecs.UpdateServiceInput{
+		Cluster:        aws_sdk.String("cluster"),
+		Service:        aws_sdk.String("service"),
+		TaskDefinition: aws_sdk.String("service:2"),
+	})
+	require.NoError(t, err)
+
+	// The new deployment is in progress next to the previous one until the service
+	// was described RolloutChecks times
+	service := describeService(t, client)
+	require.Len(t, service.Deployments, 2)
+	assert.Equal(t, "PRIMARY", *service.Deployments[0].Status)
+	assert.Equal(t, ecs.DeploymentRolloutStateInProgress, *service.Deployments[0].RolloutState)
+	assert.Equal(t, taskDefinitionArn, *service.Deployments[0].TaskDefinition)
+	assert.Equal(t, "ACTIVE", *service.Deployments[1].Status)
+
+	service = describeService(t, client)
+	require.Len(t, service.Deployments, 1)
+	assert.Equal(t, ecs.DeploymentRolloutStateCompleted, *service.Deployments[0].RolloutState)
+	assert.Equal(t, int64(2), *service.Deployments[0].RunningCount)
+
+	// A failed rollout leaves the failed deployment
+	fake.FailRollout("cluster", "service", "ECS deployment circuit breaker: tasks failed to start.")
+	_, err = client.UpdateService(&ecs.UpdateServiceInput{
+		Cluster:            aws_sdk.String("cluster"),
+		Service:            aws_sdk.String("service"),
+		ForceNewDeployment: aws_sdk.Bool(true),
+	})
+	require.NoError(t, err)
+
+	describeService(t, client)
+	service = describeService(t, client)
+	require.Len(t, service.Deployments, 1)
+	assert.Equal(t, ecs.DeploymentRolloutStateFailed, *service.Deployments[0].RolloutState)
+	assert.Equal(t, "ECS deployment circuit breaker: tasks failed to start.", *service.Deployments[0].RolloutStateReason)
+
+	_, err = client.UpdateService(&ecs.UpdateServiceInput{
+		Cluster: aws_sdk.String("cluster"),
+		Service: aws_sdk.String("missing"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, ecs.ErrCodeServiceNotFoundException, err.(awserr.Error).Code())
+}
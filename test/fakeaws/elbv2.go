@@ -0,0 +1,215 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Target is a target of a target group with its health, the state is one of the ELBv2
+// target health states (initial, healthy, unhealthy, unused, draining, unavailable)
+type Target struct {
+	Id          string `xml:"-"`
+	Port        int    `xml:"-"`
+	State       string `xml:"State"`
+	Reason      string `xml:"Reason,omitempty"`
+	Description string `xml:"Description,omitempty"`
+}
+
+// Elbv2 is an in-memory ELBv2 API that serves the load balancers and the target health
+// of the target groups that the test set up
+type Elbv2 struct {
+	server *Server
+
+	mu            sync.Mutex
+	loadBalancers map[string]elbv2LoadBalancer
+	targetGroups  map[string][]Target
+}
+
+type elbv2LoadBalancer struct {
+	LoadBalancerArn  string `xml:"LoadBalancerArn"`
+	LoadBalancerName string `xml:"LoadBalancerName"`
+	DNSName          string `xml:"DNSName"`
+	Scheme           string `xml:"Scheme"`
+	Type             string `xml:"Type"`
+	State            struct {
+		Code string `xml:"Code"`
+	} `xml:"State"`
+}
+
+type describeLoadBalancersResponse struct {
+	XMLName          xml.Name            `xml:"http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/ DescribeLoadBalancersResponse"`
+	LoadBalancers    []elbv2LoadBalancer `xml:"DescribeLoadBalancersResult>LoadBalancers>member"`
+	ResponseMetadata ResponseMetadata    `xml:"ResponseMetadata"`
+}
+
+type describeTargetHealthResponse struct {
+	XMLName                  xml.Name                  `xml:"http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/ DescribeTargetHealthResponse"`
+	TargetHealthDescriptions []targetHealthDescription `xml:"DescribeTargetHealthResult>TargetHealthDescriptions>member"`
+	ResponseMetadata         ResponseMetadata          `xml:"ResponseMetadata"`
+}
+
+type targetHealthDescription struct {
+	Id              string `xml:"Target>Id"`
+	Port            int    `xml:"Target>Port"`
+	HealthCheckPort string `xml:"HealthCheckPort"`
+	TargetHealth    Target `xml:"TargetHealth"`
+}
+
+// NewElbv2 registers an ELBv2 API without load balancers on the server
+func NewElbv2(s *Server) *Elbv2 {
+	e := &Elbv2{
+		server:        s,
+		loadBalancers: map[string]elbv2LoadBalancer{},
+		targetGroups:  map[string][]Target{},
+	}
+
+	s.Handle("elasticloadbalancing", "DescribeLoadBalancers", e.describeLoadBalancers)
+	s.Handle("elasticloadbalancing", "DescribeTargetHealth", e.describeTargetHealth)
+	return e
+}
+
+func (e *Elbv2) arn(resource string) string {
+	return fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:%s", e.server.Region, AccountId, resource)
+}
+
+// AddLoadBalancer adds an active application load balancer that resolves to the DNS
+// name and returns its ARN. A host:port DNS name, i.e. of a MockContainer, sends the
+// requests made to the load balancer to a local server.
+func (e *Elbv2) AddLoadBalancer(name string, dnsName string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	loadBalancer := elbv2LoadBalancer{
+		LoadBalancerArn:  e.arn(fmt.Sprintf("loadbalancer/app/%s/%016d", name, len(e.loadBalancers)+1)),
+		LoadBalancerName: name,
+		DNSName:          dnsName,
+		Scheme:           "internet-facing",
+		Type:             "application",
+	}
+	loadBalancer.State.Code = "active"
+	e.loadBalancers[name] = loadBalancer
+	return loadBalancer.LoadBalancerArn
+}
+
+// AddTargetGroup adds a target group with the targets and returns its ARN
+func (e *Elbv2) AddTargetGroup(name string, targets ...Target) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	targetGroupArn := e.arn(fmt.Sprintf("targetgroup/%s/%016d", name, len(e.targetGroups)+1))
+	e.targetGroups[targetGroupArn] = targets
+	return targetGroupArn
+}
+
+// SetTargets replaces the targets of the target group
+func (e *Elbv2) SetTargets(targetGroupArn string, targets ...Target) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.targetGroups[targetGroupArn] = targets
+}
+
+// members returns the values of a query protocol list parameter, i.e. Names.member.1
+func members(r *Request, name string) []string {
+	values := []string{}
+	for i := 1; r.Form.Has(fmt.Sprintf("%s.member.%d", name, i)); i++ {
+		values = append(values, r.Form.Get(fmt.Sprintf("%s.member.%d", name, i)))
+	}
+	return values
+}
+
+func (e *Elbv2) describeLoadBalancers(r *Request) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := describeLoadBalancersResponse{ResponseMetadata: ResponseMetadata{RequestId: requestId}}
+	names := members(r, "Names")
+	arns := members(r, "LoadBalancerArns")
+	if len(names) == 0 && len(arns) == 0 {
+		for _, loadBalancer := range e.loadBalancers {
+			res.LoadBalancers = append(res.LoadBalancers, loadBalancer)
+		}
+		return res, nil
+	}
+
+	for _, name := range names {
+		loadBalancer, ok := e.loadBalancers[name]
+		if !ok {
+			return nil, Errorf("LoadBalancerNotFound", "Load balancers '[%s]' not found", name)
+		}
+		res.LoadBalancers = append(res.LoadBalancers, loadBalancer)
+	}
+	for _, arn := range arns {
+		found := false
+		for _, loadBalancer := range e.loadBalancers {
+			if loadBalancer.LoadBalancerArn == arn {
+				res.LoadBalancers = append(res.LoadBalancers, loadBalancer)
+				found = true
+			}
+		}
+		if !found {
+			return nil, Errorf("LoadBalancerNotFound", "One or more load balancers not found")
+		}
+	}
+	return res, nil
+}
+
+func (e *Elbv2) describeTargetHealth(r *Request) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	targetGroupArn := r.Form.Get("TargetGroupArn")
+	targets, ok := e.targetGroups[targetGroupArn]
+	if !ok {
+		return nil, Errorf("TargetGroupNotFound", "Target groups '[%s]' not found", targetGroupArn)
+	}
+
+	res := describeTargetHealthResponse{ResponseMetadata: ResponseMetadata{RequestId: requestId}}
+	for _, target := range targets {
+		res.TargetHealthDescriptions = append(res.TargetHealthDescriptions, targetHealthDescription{
+			Id:              target.Id,
+			Port:            target.Port,
+			HealthCheckPort: strconv.Itoa(target.Port),
+			TargetHealth:    target,
+		})
+	}
+	return res, nil
+}
+
+// MockContainer is a local server that answers like the cyber4all/mock-container-image
+// that the examples deploy, with the API message at the root and the secret that the
+// container reads from secrets manager at /test/env
+type MockContainer struct {
+	*httptest.Server
+}
+
+// NewMockContainer starts a mock container that is shutdown when the test completes
+func NewMockContainer(t *testing.T) *MockContainer {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"message":"Mock Container Image API"}`)
+	})
+	mux.HandleFunc("/test/env", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Secret: SUPER_SECRET_VALUE")
+	})
+
+	c := &MockContainer{Server: httptest.NewServer(mux)}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// DNSName returns the host:port that the load balancers of the mock container resolve to
+func (c *MockContainer) DNSName() string {
+	return strings.TrimPrefix(c.URL, "http://")
+}
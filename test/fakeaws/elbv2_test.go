@@ -0,0 +1,57 @@
+package fakeaws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElbv2(t *testing.T) {
+	s := NewServer(t, "us-east-1")
+	fake := NewElbv2(s)
+	client := elasticloadbalancingv2.NewFromConfig(s.Config())
+
+	container := NewMockContainer(t)
+	loadBalancerArn := fake.AddLoadBalancer("alb", container.DNSName())
+	targetGroupArn := fake.AddTargetGroup("service", Target{Id: "i-0123456789abcdef0", Port: 32768, State: "initial", Reason: "Elb.RegistrationInProgress"})
+
+	loadBalancers, err := client.DescribeLoadBalancers(context.TODO(), &elasticloadbalancingv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []string{loadBalancerArn},
+	})
+	require.NoError(t, err)
+	require.Len(t, loadBalancers.LoadBalancers, 1)
+	assert.Equal(t, "alb", *loadBalancers.LoadBalancers[0].LoadBalancerName)
+	assert.Equal(t, types.LoadBalancerStateEnumActive, loadBalancers.LoadBalancers[0].State.Code)
+
+	// The load balancer resolves to the mock container
+	res, err := http.Get("http://" + *loadBalancers.LoadBalancers[0].DNSName + "/test/env")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Secret: SUPER_SECRET_VALUE", string(body))
+
+	// The targets can change their health
+	health, err := client.DescribeTargetHealth(context.TODO(), &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: &targetGroupArn})
+	require.NoError(t, err)
+	require.Len(t, health.TargetHealthDescriptions, 1)
+	assert.Equal(t, "i-0123456789abcdef0", *health.TargetHealthDescriptions[0].Target.Id)
+	assert.Equal(t, int32(32768), *health.TargetHealthDescriptions[0].Target.Port)
+	assert.Equal(t, types.TargetHealthStateEnumInitial, health.TargetHealthDescriptions[0].TargetHealth.State)
+	assert.Equal(t, types.TargetHealthReasonEnumRegistrationInProgress, health.TargetHealthDescriptions[0].TargetHealth.Reason)
+
+	fake.SetTargets(targetGroupArn, Target{Id: "i-0123456789abcdef0", Port: 32768, State: "healthy"})
+	health, err = client.DescribeTargetHealth(context.TODO(), &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: &targetGroupArn})
+	require.NoError(t, err)
+	assert.Equal(t, types.TargetHealthStateEnumHealthy, health.TargetHealthDescriptions[0].TargetHealth.State)
+
+	_, err = client.DescribeTargetHealth(context.TODO(), &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: &loadBalancerArn})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TargetGroupNotFound")
+}
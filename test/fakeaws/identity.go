@@ -0,0 +1,53 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// CanonicalUserId is the S3 canonical user of the fake account
+const CanonicalUserId = "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"
+
+type getCallerIdentityResponse struct {
+	XMLName          xml.Name                `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetCallerIdentityResponse"`
+	Result           getCallerIdentityResult `xml:"GetCallerIdentityResult"`
+	ResponseMetadata ResponseMetadata        `xml:"ResponseMetadata"`
+}
+
+type getCallerIdentityResult struct {
+	Arn     string `xml:"Arn"`
+	UserId  string `xml:"UserId"`
+	Account string `xml:"Account"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   struct {
+		ID          string `xml:"ID"`
+		DisplayName string `xml:"DisplayName"`
+	} `xml:"Owner"`
+	Buckets []struct{} `xml:"Buckets>Bucket"`
+}
+
+// registerIdentityOperations answers the calls made to identify the caller,
+// the AWS provider validates its credentials with sts:GetCallerIdentity and
+// the aws_canonical_user_id data source reads the owner from s3:ListBuckets.
+func registerIdentityOperations(s *Server) {
+	s.Handle("sts", "GetCallerIdentity", func(r *Request) (interface{}, error) {
+		return getCallerIdentityResponse{
+			Result: getCallerIdentityResult{
+				Arn:     fmt.Sprintf("arn:aws:iam::%s:user/terratest", AccountId),
+				UserId:  "AIDAFAKEAWSTERRATEST",
+				Account: AccountId,
+			},
+			ResponseMetadata: ResponseMetadata{RequestId: requestId},
+		}, nil
+	})
+
+	s.Handle("s3", "GET /", func(r *Request) (interface{}, error) {
+		res := listAllMyBucketsResult{}
+		res.Owner.ID = CanonicalUserId
+		res.Owner.DisplayName = "terratest"
+		return res, nil
+	})
+}
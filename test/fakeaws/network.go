@@ -0,0 +1,882 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Vpc is a VPC of a Topology
+type Vpc struct {
+	Id        string
+	CidrBlock string
+	Name      string
+}
+
+// Subnet is a subnet of a Topology
+type Subnet struct {
+	Id               string
+	VpcId            string
+	CidrBlock        string
+	AvailabilityZone string
+	Name             string
+}
+
+// InternetGateway is an internet gateway of a Topology, a gateway without a VPC is detached
+type InternetGateway struct {
+	Id    string
+	VpcId string
+	Name  string
+}
+
+// NatGateway is a NAT gateway of a Topology in one of the EC2 NAT gateway states
+// (pending, failed, available, deleting, deleted)
+type NatGateway struct {
+	Id           string
+	VpcId        string
+	SubnetId     string
+	State        string
+	AllocationId string
+	PublicIp     string
+	Name         string
+}
+
+// Route is a route of a route table to an internet gateway or a NAT gateway
+type Route struct {
+	DestinationCidrBlock string
+	GatewayId            string
+	NatGatewayId         string
+}
+
+// RouteTable is a route table of a Topology with the subnets that it is associated with.
+// The local route of the VPC is added by the fake.
+type RouteTable struct {
+	Id        string
+	VpcId     string
+	Routes    []Route
+	SubnetIds []string
+	Name      string
+}
+
+// NetworkAclEntry is a rule of a network ACL
+type NetworkAclEntry struct {
+	RuleNumber int
+	Protocol   string
+	RuleAction string
+	Egress     bool
+	CidrBlock  string
+}
+
+// NetworkAcl is a network ACL of a Topology with the subnets that it is associated with
+type NetworkAcl struct {
+	Id        string
+	VpcId     string
+	Entries   []NetworkAclEntry
+	SubnetIds []string
+	Name      string
+}
+
+// Topology is the network that the fake EC2 API describes. Tests seed it from the state
+// or plan of the vpc module and break it to check that the validators notice.
+type Topology struct {
+	Vpcs             []*Vpc
+	Subnets          []*Subnet
+	InternetGateways []*InternetGateway
+	NatGateways      []*NatGateway
+	RouteTables      []*RouteTable
+	NetworkAcls      []*NetworkAcl
+}
+
+// Vpc returns the VPC by id or name
+func (t *Topology) Vpc(idOrName string) *Vpc {
+	for _, vpc := range t.Vpcs {
+		if vpc.Id == idOrName || vpc.Name == idOrName {
+			return vpc
+		}
+	}
+	return nil
+}
+
+// RouteTable returns the route table by id or name
+func (t *Topology) RouteTable(idOrName string) *RouteTable {
+	for _, routeTable := range t.RouteTables {
+		if routeTable.Id == idOrName || routeTable.Name == idOrName {
+			return routeTable
+		}
+	}
+	return nil
+}
+
+// Network is an in-memory EC2 API that describes the VPCs, subnets, gateways, route
+// tables and network ACLs of a topology
+type Network struct {
+	mu       sync.Mutex
+	topology *Topology
+}
+
+// NewNetwork registers an EC2 API that describes the topology on the server
+func NewNetwork(s *Server, topology *Topology) *Network {
+	n := &Network{topology: topology}
+
+	s.Handle("ec2", "DescribeVpcs", n.describeVpcs)
+	s.Handle("ec2", "DescribeSubnets", n.describeSubnets)
+	s.Handle("ec2", "DescribeInternetGateways", n.describeInternetGateways)
+	s.Handle("ec2", "DescribeNatGateways", n.describeNatGateways)
+	s.Handle("ec2", "DescribeRouteTables", n.describeRouteTables)
+	s.Handle("ec2", "DescribeNetworkAcls", n.describeNetworkAcls)
+	return n
+}
+
+// Update changes the topology while the network serves requests
+func (n *Network) Update(update func(topology *Topology)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	update(n.topology)
+}
+
+// TopologyFromState returns the network of the resources in the state, as written by
+// terraform show -json
+func TopologyFromState(state *tfjson.State) (*Topology, error) {
+	if state.Values == nil {
+		return &Topology{}, nil
+	}
+	return newTopologyBuilder(state.Values, nil).build()
+}
+
+// TopologyFromPlan returns the network that the plan creates, as written by terraform
+// show -json. The ids that are only known after the apply are made up, and the
+// references between the resources are resolved through the configuration of the plan.
+func TopologyFromPlan(plan *tfjson.Plan) (*Topology, error) {
+	if plan.PlannedValues == nil {
+		return &Topology{}, nil
+	}
+	return newTopologyBuilder(plan.PlannedValues, plan.Config).build()
+}
+
+// idPrefixes are the prefixes of the ids that the builder makes up for planned resources
+var idPrefixes = map[string]string{
+	"aws_vpc":              "vpc",
+	"aws_subnet":           "subnet",
+	"aws_internet_gateway": "igw",
+	"aws_nat_gateway":      "nat",
+	"aws_eip":              "eipalloc",
+	"aws_route_table":      "rtb",
+	"aws_network_acl":      "acl",
+}
+
+// reference matches a resource reference of an expression, i.e. aws_subnet.public[0].id
+var reference = regexp.MustCompile(`^(aws_[a-z0-9_]+\.[A-Za-z0-9_-]+)(?:\[(\d+)\])?`)
+
+// topologyBuilder resolves the attributes of the resources of the state values that
+// refer to other resources, to the ids of the other resources
+type topologyBuilder struct {
+	config    *tfjson.Config
+	resources []*tfjson.StateResource
+	// instances are the addresses of the instances of a resource by module and resource
+	// address, i.e. module.vpc.aws_subnet.public
+	instances map[string][]string
+	ids       map[string]string
+	// modules are the addresses of the modules of the resources
+	modules map[*tfjson.StateResource]string
+}
+
+func newTopologyBuilder(values *tfjson.StateValues, config *tfjson.Config) *topologyBuilder {
+	b := &topologyBuilder{
+		config:    config,
+		instances: map[string][]string{},
+		ids:       map[string]string{},
+		modules:   map[*tfjson.StateResource]string{},
+	}
+
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		for _, resource := range module.Resources {
+			if resource.Mode != tfjson.ManagedResourceMode {
+				continue
+			}
+			b.resources = append(b.resources, resource)
+			b.modules[resource] = module.Address
+
+			base := b.resourceBase(resource)
+			b.instances[base] = append(b.instances[base], resource.Address)
+
+			id, _ := resource.AttributeValues["id"].(string)
+			if prefix, ok := idPrefixes[resource.Type]; ok && id == "" {
+				id = fmt.Sprintf("%s-%017x", prefix, len(b.ids)+1)
+			}
+			b.ids[resource.Address] = id
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	if values.RootModule != nil {
+		walk(values.RootModule)
+	}
+	return b
+}
+
+// resourceBase returns the address of the resource without the index of the instance
+func (b *topologyBuilder) resourceBase(resource *tfjson.StateResource) string {
+	if b.modules[resource] == "" {
+		return fmt.Sprintf("%s.%s", resource.Type, resource.Name)
+	}
+	return fmt.Sprintf("%s.%s.%s", b.modules[resource], resource.Type, resource.Name)
+}
+
+// configResource returns the configuration of the resource, the module calls of the
+// module address are followed from the root module of the configuration
+func (b *topologyBuilder) configResource(resource *tfjson.StateResource) *tfjson.ConfigResource {
+	if b.config == nil || b.config.RootModule == nil {
+		return nil
+	}
+
+	module := b.config.RootModule
+	if b.modules[resource] != "" {
+		for _, part := range strings.Split(b.modules[resource], ".") {
+			if part == "module" {
+				continue
+			}
+			call, ok := module.ModuleCalls[strings.SplitN(part, "[", 2)[0]]
+			if !ok || call.Module == nil {
+				return nil
+			}
+			module = call.Module
+		}
+	}
+
+	for _, configResource := range module.Resources {
+		if configResource.Type == resource.Type && configResource.Name == resource.Name {
+			return configResource
+		}
+	}
+	return nil
+}
+
+// refs returns the ids of the resources that the attribute of the resource refers to.
+// Known values are used as is, unknown values are resolved with the references of the
+// expression of the attribute in the configuration: an index in the reference selects
+// the instance, a reference that is indexed with count.index selects the instance with
+// the index of the resource, and a splat reference selects every instance.
+func (b *topologyBuilder) refs(resource *tfjson.StateResource, attribute string) []string {
+	switch value := resource.AttributeValues[attribute].(type) {
+	case string:
+		if value != "" {
+			return []string{value}
+		}
+	case []interface{}:
+		if len(value) > 0 {
+			ids := []string{}
+			for _, v := range value {
+				if id, ok := v.(string); ok {
+					ids = append(ids, id)
+				}
+			}
+			return ids
+		}
+	}
+
+	configResource := b.configResource(resource)
+	if configResource == nil {
+		return nil
+	}
+	expression, ok := configResource.Expressions[attribute]
+	if !ok || expression.ExpressionData == nil {
+		return nil
+	}
+
+	countIndex := false
+	for _, ref := range expression.References {
+		if ref == "count.index" {
+			countIndex = true
+		}
+	}
+
+	prefix := ""
+	if b.modules[resource] != "" {
+		prefix = b.modules[resource] + "."
+	}
+	for _, ref := range expression.References {
+		match := reference.FindStringSubmatch(ref)
+		if match == nil {
+			continue
+		}
+		instances := b.instances[prefix+match[1]]
+		if len(instances) == 0 {
+			continue
+		}
+
+		ids := []string{}
+		for _, address := range instances {
+			switch {
+			case match[2] != "":
+				if strings.HasSuffix(address, "["+match[2]+"]") {
+					ids = append(ids, b.ids[address])
+				}
+			case countIndex:
+				if strings.HasSuffix(address, fmt.Sprintf("[%v]", resource.Index)) {
+					ids = append(ids, b.ids[address])
+				}
+			default:
+				ids = append(ids, b.ids[address])
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// ref returns the id of the resource that the attribute of the resource refers to
+func (b *topologyBuilder) ref(resource *tfjson.StateResource, attribute string) string {
+	if ids := b.refs(resource, attribute); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// nameTag returns the Name tag of the resource
+func nameTag(resource *tfjson.StateResource) string {
+	tags, _ := resource.AttributeValues["tags"].(map[string]interface{})
+	return stringValue(tags, "Name")
+}
+
+func stringAttribute(resource *tfjson.StateResource, attribute string) string {
+	return stringValue(resource.AttributeValues, attribute)
+}
+
+func stringValue(values map[string]interface{}, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+func (b *topologyBuilder) build() (*Topology, error) {
+	topology := &Topology{}
+	publicIps := map[string]string{}
+
+	// The resources that others refer to are added first
+	for _, resource := range b.resources {
+		id := b.ids[resource.Address]
+		switch resource.Type {
+		case "aws_vpc":
+			topology.Vpcs = append(topology.Vpcs, &Vpc{Id: id, CidrBlock: stringAttribute(resource, "cidr_block"), Name: nameTag(resource)})
+		case "aws_subnet":
+			topology.Subnets = append(topology.Subnets, &Subnet{
+				Id:               id,
+				VpcId:            b.ref(resource, "vpc_id"),
+				CidrBlock:        stringAttribute(resource, "cidr_block"),
+				AvailabilityZone: stringAttribute(resource, "availability_zone"),
+				Name:             nameTag(resource),
+			})
+		case "aws_internet_gateway":
+			topology.InternetGateways = append(topology.InternetGateways, &InternetGateway{Id: id, VpcId: b.ref(resource, "vpc_id"), Name: nameTag(resource)})
+		case "aws_eip":
+			publicIp := stringAttribute(resource, "public_ip")
+			if publicIp == "" {
+				publicIp = fmt.Sprintf("198.51.100.%d", len(publicIps)+1)
+			}
+			publicIps[id] = publicIp
+		case "aws_route_table":
+			routeTable := &RouteTable{Id: id, VpcId: b.ref(resource, "vpc_id"), Name: nameTag(resource)}
+			routes, _ := resource.AttributeValues["route"].([]interface{})
+			for _, r := range routes {
+				route, _ := r.(map[string]interface{})
+				routeTable.Routes = append(routeTable.Routes, Route{
+					DestinationCidrBlock: stringValue(route, "cidr_block"),
+					GatewayId:            stringValue(route, "gateway_id"),
+					NatGatewayId:         stringValue(route, "nat_gateway_id"),
+				})
+			}
+			topology.RouteTables = append(topology.RouteTables, routeTable)
+		case "aws_network_acl":
+			topology.NetworkAcls = append(topology.NetworkAcls, &NetworkAcl{
+				Id:        id,
+				VpcId:     b.ref(resource, "vpc_id"),
+				SubnetIds: b.refs(resource, "subnet_ids"),
+				Name:      nameTag(resource),
+			})
+		}
+	}
+
+	for _, resource := range b.resources {
+		id := b.ids[resource.Address]
+		switch resource.Type {
+		case "aws_nat_gateway":
+			natGateway := &NatGateway{
+				Id:           id,
+				SubnetId:     b.ref(resource, "subnet_id"),
+				State:        "available",
+				AllocationId: b.ref(resource, "allocation_id"),
+				PublicIp:     stringAttribute(resource, "public_ip"),
+				Name:         nameTag(resource),
+			}
+			if natGateway.PublicIp == "" {
+				natGateway.PublicIp = publicIps[natGateway.AllocationId]
+			}
+			for _, subnet := range topology.Subnets {
+				if subnet.Id == natGateway.SubnetId {
+					natGateway.VpcId = subnet.VpcId
+				}
+			}
+			topology.NatGateways = append(topology.NatGateways, natGateway)
+		case "aws_route":
+			routeTable := topology.RouteTable(b.ref(resource, "route_table_id"))
+			if routeTable == nil {
+				return nil, fmt.Errorf("%s routes a route table that is not in the topology", resource.Address)
+			}
+			route := Route{
+				DestinationCidrBlock: stringAttribute(resource, "destination_cidr_block"),
+				GatewayId:            b.ref(resource, "gateway_id"),
+				NatGatewayId:         b.ref(resource, "nat_gateway_id"),
+			}
+			routeTable.Routes = addRoute(routeTable.Routes, route)
+		case "aws_route_table_association":
+			routeTable := topology.RouteTable(b.ref(resource, "route_table_id"))
+			if routeTable == nil {
+				return nil, fmt.Errorf("%s associates a route table that is not in the topology", resource.Address)
+			}
+			routeTable.SubnetIds = append(routeTable.SubnetIds, b.ref(resource, "subnet_id"))
+		case "aws_network_acl_rule":
+			networkAclId := b.ref(resource, "network_acl_id")
+			var networkAcl *NetworkAcl
+			for _, acl := range topology.NetworkAcls {
+				if acl.Id == networkAclId {
+					networkAcl = acl
+				}
+			}
+			if networkAcl == nil {
+				return nil, fmt.Errorf("%s is a rule of a network ACL that is not in the topology", resource.Address)
+			}
+			ruleNumber, _ := resource.AttributeValues["rule_number"].(float64)
+			egress, _ := resource.AttributeValues["egress"].(bool)
+			networkAcl.Entries = append(networkAcl.Entries, NetworkAclEntry{
+				RuleNumber: int(ruleNumber),
+				Protocol:   stringAttribute(resource, "protocol"),
+				RuleAction: stringAttribute(resource, "rule_action"),
+				Egress:     egress,
+				CidrBlock:  stringAttribute(resource, "cidr_block"),
+			})
+		}
+	}
+	return topology, nil
+}
+
+// addRoute adds the route unless the route table already has a route to the destination,
+// the route attribute of a refreshed route table includes the routes of aws_route resources
+func addRoute(routes []Route, route Route) []Route {
+	for _, r := range routes {
+		if r.DestinationCidrBlock == route.DestinationCidrBlock {
+			return routes
+		}
+	}
+	return append(routes, route)
+}
+
+// ec2Filters returns the ids and the filters of an EC2 describe request, i.e.
+// VpcId.1=vpc-1 and Filter.1.Name=vpc-id with Filter.1.Value.1=vpc-1
+func ec2Filters(r *Request, idParameter string) ([]string, map[string][]string) {
+	ids := []string{}
+	for i := 1; r.Form.Has(fmt.Sprintf("%s.%d", idParameter, i)); i++ {
+		ids = append(ids, r.Form.Get(fmt.Sprintf("%s.%d", idParameter, i)))
+	}
+
+	filters := map[string][]string{}
+	for i := 1; r.Form.Has(fmt.Sprintf("Filter.%d.Name", i)); i++ {
+		name := r.Form.Get(fmt.Sprintf("Filter.%d.Name", i))
+		for j := 1; r.Form.Has(fmt.Sprintf("Filter.%d.Value.%d", i, j)); j++ {
+			filters[name] = append(filters[name], r.Form.Get(fmt.Sprintf("Filter.%d.Value.%d", i, j)))
+		}
+	}
+	return ids, filters
+}
+
+// matches returns true if the resource has one of the ids and every filter matches one
+// of the values that the resource has for the filter
+func matches(id string, values map[string][]string, ids []string, filters map[string][]string) bool {
+	if len(ids) > 0 && !contains(ids, id) {
+		return false
+	}
+	for name, filterValues := range filters {
+		found := false
+		for _, value := range values[name] {
+			if contains(filterValues, value) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// notFound returns the error of EC2 for the ids that are not in the topology
+func notFound(code string, ids []string, found map[string]bool) error {
+	missing := []string{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return Errorf(code, "The ID '%s' does not exist", strings.Join(missing, ","))
+}
+
+type ec2Tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+func nameTags(name string) []ec2Tag {
+	if name == "" {
+		return nil
+	}
+	return []ec2Tag{{Key: "Name", Value: name}}
+}
+
+type describeVpcsResponse struct {
+	XMLName   xml.Name `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeVpcsResponse"`
+	RequestId string   `xml:"requestId"`
+	Vpcs      []ec2Vpc `xml:"vpcSet>item"`
+}
+
+type ec2Vpc struct {
+	VpcId     string   `xml:"vpcId"`
+	State     string   `xml:"state"`
+	CidrBlock string   `xml:"cidrBlock"`
+	IsDefault bool     `xml:"isDefault"`
+	Tags      []ec2Tag `xml:"tagSet>item"`
+}
+
+func (n *Network) describeVpcs(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "VpcId")
+	res := describeVpcsResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, vpc := range n.topology.Vpcs {
+		values := map[string][]string{"vpc-id": {vpc.Id}, "cidr-block": {vpc.CidrBlock}, "tag:Name": {vpc.Name}}
+		if matches(vpc.Id, values, ids, filters) {
+			found[vpc.Id] = true
+			res.Vpcs = append(res.Vpcs, ec2Vpc{VpcId: vpc.Id, State: "available", CidrBlock: vpc.CidrBlock, Tags: nameTags(vpc.Name)})
+		}
+	}
+	if err := notFound("InvalidVpcID.NotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type describeSubnetsResponse struct {
+	XMLName   xml.Name    `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeSubnetsResponse"`
+	RequestId string      `xml:"requestId"`
+	Subnets   []ec2Subnet `xml:"subnetSet>item"`
+}
+
+type ec2Subnet struct {
+	SubnetId         string   `xml:"subnetId"`
+	VpcId            string   `xml:"vpcId"`
+	State            string   `xml:"state"`
+	CidrBlock        string   `xml:"cidrBlock"`
+	AvailabilityZone string   `xml:"availabilityZone"`
+	Tags             []ec2Tag `xml:"tagSet>item"`
+}
+
+func (n *Network) describeSubnets(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "SubnetId")
+	res := describeSubnetsResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, subnet := range n.topology.Subnets {
+		values := map[string][]string{
+			"subnet-id":         {subnet.Id},
+			"vpc-id":            {subnet.VpcId},
+			"cidr-block":        {subnet.CidrBlock},
+			"availability-zone": {subnet.AvailabilityZone},
+			"tag:Name":          {subnet.Name},
+		}
+		if matches(subnet.Id, values, ids, filters) {
+			found[subnet.Id] = true
+			res.Subnets = append(res.Subnets, ec2Subnet{
+				SubnetId:         subnet.Id,
+				VpcId:            subnet.VpcId,
+				State:            "available",
+				CidrBlock:        subnet.CidrBlock,
+				AvailabilityZone: subnet.AvailabilityZone,
+				Tags:             nameTags(subnet.Name),
+			})
+		}
+	}
+	if err := notFound("InvalidSubnetID.NotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type describeInternetGatewaysResponse struct {
+	XMLName          xml.Name             `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeInternetGatewaysResponse"`
+	RequestId        string               `xml:"requestId"`
+	InternetGateways []ec2InternetGateway `xml:"internetGatewaySet>item"`
+}
+
+type ec2InternetGateway struct {
+	InternetGatewayId string          `xml:"internetGatewayId"`
+	Attachments       []ec2Attachment `xml:"attachmentSet>item"`
+	Tags              []ec2Tag        `xml:"tagSet>item"`
+}
+
+type ec2Attachment struct {
+	VpcId string `xml:"vpcId"`
+	State string `xml:"state"`
+}
+
+func (n *Network) describeInternetGateways(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "InternetGatewayId")
+	res := describeInternetGatewaysResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, internetGateway := range n.topology.InternetGateways {
+		values := map[string][]string{
+			"internet-gateway-id": {internetGateway.Id},
+			"attachment.vpc-id":   {internetGateway.VpcId},
+			"tag:Name":            {internetGateway.Name},
+		}
+		if !matches(internetGateway.Id, values, ids, filters) {
+			continue
+		}
+		found[internetGateway.Id] = true
+
+		item := ec2InternetGateway{InternetGatewayId: internetGateway.Id, Tags: nameTags(internetGateway.Name)}
+		if internetGateway.VpcId != "" {
+			item.Attachments = []ec2Attachment{{VpcId: internetGateway.VpcId, State: "available"}}
+		}
+		res.InternetGateways = append(res.InternetGateways, item)
+	}
+	if err := notFound("InvalidInternetGatewayID.NotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type describeNatGatewaysResponse struct {
+	XMLName     xml.Name        `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeNatGatewaysResponse"`
+	RequestId   string          `xml:"requestId"`
+	NatGateways []ec2NatGateway `xml:"natGatewaySet>item"`
+}
+
+type ec2NatGateway struct {
+	NatGatewayId     string                 `xml:"natGatewayId"`
+	VpcId            string                 `xml:"vpcId"`
+	SubnetId         string                 `xml:"subnetId"`
+	State            string                 `xml:"state"`
+	ConnectivityType string                 `xml:"connectivityType"`
+	Addresses        []ec2NatGatewayAddress `xml:"natGatewayAddressSet>item"`
+	Tags             []ec2Tag               `xml:"tagSet>item"`
+}
+
+type ec2NatGatewayAddress struct {
+	AllocationId string `xml:"allocationId"`
+	PublicIp     string `xml:"publicIp"`
+}
+
+func (n *Network) describeNatGateways(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "NatGatewayId")
+	res := describeNatGatewaysResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, natGateway := range n.topology.NatGateways {
+		values := map[string][]string{
+			"nat-gateway-id": {natGateway.Id},
+			"vpc-id":         {natGateway.VpcId},
+			"subnet-id":      {natGateway.SubnetId},
+			"state":          {natGateway.State},
+			"tag:Name":       {natGateway.Name},
+		}
+		if !matches(natGateway.Id, values, ids, filters) {
+			continue
+		}
+		found[natGateway.Id] = true
+		res.NatGateways = append(res.NatGateways, ec2NatGateway{
+			NatGatewayId:     natGateway.Id,
+			VpcId:            natGateway.VpcId,
+			SubnetId:         natGateway.SubnetId,
+			State:            natGateway.State,
+			ConnectivityType: "public",
+			Addresses:        []ec2NatGatewayAddress{{AllocationId: natGateway.AllocationId, PublicIp: natGateway.PublicIp}},
+			Tags:             nameTags(natGateway.Name),
+		})
+	}
+	if err := notFound("NatGatewayNotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type describeRouteTablesResponse struct {
+	XMLName     xml.Name        `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeRouteTablesResponse"`
+	RequestId   string          `xml:"requestId"`
+	RouteTables []ec2RouteTable `xml:"routeTableSet>item"`
+}
+
+type ec2RouteTable struct {
+	RouteTableId string                     `xml:"routeTableId"`
+	VpcId        string                     `xml:"vpcId"`
+	Routes       []ec2Route                 `xml:"routeSet>item"`
+	Associations []ec2RouteTableAssociation `xml:"associationSet>item"`
+	Tags         []ec2Tag                   `xml:"tagSet>item"`
+}
+
+type ec2Route struct {
+	DestinationCidrBlock string `xml:"destinationCidrBlock"`
+	GatewayId            string `xml:"gatewayId,omitempty"`
+	NatGatewayId         string `xml:"natGatewayId,omitempty"`
+	State                string `xml:"state"`
+	Origin               string `xml:"origin"`
+}
+
+type ec2RouteTableAssociation struct {
+	RouteTableAssociationId string `xml:"routeTableAssociationId"`
+	RouteTableId            string `xml:"routeTableId"`
+	SubnetId                string `xml:"subnetId"`
+	Main                    bool   `xml:"main"`
+	State                   string `xml:"associationState>state"`
+}
+
+func (n *Network) describeRouteTables(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "RouteTableId")
+	res := describeRouteTablesResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, routeTable := range n.topology.RouteTables {
+		values := map[string][]string{
+			"route-table-id":        {routeTable.Id},
+			"vpc-id":                {routeTable.VpcId},
+			"association.subnet-id": routeTable.SubnetIds,
+			"tag:Name":              {routeTable.Name},
+		}
+		if !matches(routeTable.Id, values, ids, filters) {
+			continue
+		}
+		found[routeTable.Id] = true
+
+		item := ec2RouteTable{RouteTableId: routeTable.Id, VpcId: routeTable.VpcId, Tags: nameTags(routeTable.Name)}
+		if vpc := n.topology.Vpc(routeTable.VpcId); vpc != nil {
+			item.Routes = append(item.Routes, ec2Route{DestinationCidrBlock: vpc.CidrBlock, GatewayId: "local", State: "active", Origin: "CreateRouteTable"})
+		}
+		for _, route := range routeTable.Routes {
+			item.Routes = append(item.Routes, ec2Route{
+				DestinationCidrBlock: route.DestinationCidrBlock,
+				GatewayId:            route.GatewayId,
+				NatGatewayId:         route.NatGatewayId,
+				State:                "active",
+				Origin:               "CreateRoute",
+			})
+		}
+		for i, subnetId := range routeTable.SubnetIds {
+			item.Associations = append(item.Associations, ec2RouteTableAssociation{
+				RouteTableAssociationId: fmt.Sprintf("rtbassoc-%s%d", strings.TrimPrefix(routeTable.Id, "rtb-"), i),
+				RouteTableId:            routeTable.Id,
+				SubnetId:                subnetId,
+				State:                   "associated",
+			})
+		}
+		res.RouteTables = append(res.RouteTables, item)
+	}
+	if err := notFound("InvalidRouteTableID.NotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type describeNetworkAclsResponse struct {
+	XMLName     xml.Name        `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeNetworkAclsResponse"`
+	RequestId   string          `xml:"requestId"`
+	NetworkAcls []ec2NetworkAcl `xml:"networkAclSet>item"`
+}
+
+type ec2NetworkAcl struct {
+	NetworkAclId string                     `xml:"networkAclId"`
+	VpcId        string                     `xml:"vpcId"`
+	IsDefault    bool                       `xml:"default"`
+	Entries      []ec2NetworkAclEntry       `xml:"entrySet>item"`
+	Associations []ec2NetworkAclAssociation `xml:"associationSet>item"`
+	Tags         []ec2Tag                   `xml:"tagSet>item"`
+}
+
+type ec2NetworkAclEntry struct {
+	RuleNumber int    `xml:"ruleNumber"`
+	Protocol   string `xml:"protocol"`
+	RuleAction string `xml:"ruleAction"`
+	Egress     bool   `xml:"egress"`
+	CidrBlock  string `xml:"cidrBlock"`
+}
+
+type ec2NetworkAclAssociation struct {
+	NetworkAclAssociationId string `xml:"networkAclAssociationId"`
+	NetworkAclId            string `xml:"networkAclId"`
+	SubnetId                string `xml:"subnetId"`
+}
+
+func (n *Network) describeNetworkAcls(r *Request) (interface{}, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids, filters := ec2Filters(r, "NetworkAclId")
+	res := describeNetworkAclsResponse{RequestId: requestId}
+	found := map[string]bool{}
+	for _, networkAcl := range n.topology.NetworkAcls {
+		values := map[string][]string{
+			"network-acl-id":        {networkAcl.Id},
+			"vpc-id":                {networkAcl.VpcId},
+			"association.subnet-id": networkAcl.SubnetIds,
+			"tag:Name":              {networkAcl.Name},
+		}
+		if !matches(networkAcl.Id, values, ids, filters) {
+			continue
+		}
+		found[networkAcl.Id] = true
+
+		item := ec2NetworkAcl{NetworkAclId: networkAcl.Id, VpcId: networkAcl.VpcId, Tags: nameTags(networkAcl.Name)}
+		for _, entry := range networkAcl.Entries {
+			item.Entries = append(item.Entries, ec2NetworkAclEntry(entry))
+		}
+		for i, subnetId := range networkAcl.SubnetIds {
+			item.Associations = append(item.Associations, ec2NetworkAclAssociation{
+				NetworkAclAssociationId: fmt.Sprintf("aclassoc-%s%d", strings.TrimPrefix(networkAcl.Id, "acl-"), i),
+				NetworkAclId:            networkAcl.Id,
+				SubnetId:                subnetId,
+			})
+		}
+		res.NetworkAcls = append(res.NetworkAcls, item)
+	}
+	if err := notFound("InvalidNetworkAclID.NotFound", ids, found); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
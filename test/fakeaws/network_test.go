@@ -0,0 +1,201 @@
+package fakeaws
+
+import (
+	"testing"
+
+	aws_sdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyFromState(t *testing.T) {
+	state := &tfjson.State{Values: &tfjson.StateValues{RootModule: &tfjson.StateModule{
+		ChildModules: []*tfjson.StateModule{{
+			Address: "module.net",
+			Resources: []*tfjson.StateResource{
+				{Address: "module.net.aws_vpc.this", Mode: tfjson.ManagedResourceMode, Type: "aws_vpc", Name: "this", AttributeValues: map[string]interface{}{
+					"id": "vpc-1", "cidr_block": "10.0.0.0/16", "tags": map[string]interface{}{"Name": "net"},
+				}},
+				{Address: "module.net.aws_subnet.public[0]", Mode: tfjson.ManagedResourceMode, Type: "aws_subnet", Name: "public", Index: float64(0), AttributeValues: map[string]interface{}{
+					"id": "subnet-1", "vpc_id": "vpc-1", "cidr_block": "10.0.1.0/24", "availability_zone": "us-east-1a",
+				}},
+				{Address: "module.net.aws_internet_gateway.this", Mode: tfjson.ManagedResourceMode, Type: "aws_internet_gateway", Name: "this", AttributeValues: map[string]interface{}{
+					"id": "igw-1", "vpc_id": "vpc-1",
+				}},
+				{Address: "module.net.aws_route_table.public", Mode: tfjson.ManagedResourceMode, Type: "aws_route_table", Name: "public", AttributeValues: map[string]interface{}{
+					"id": "rtb-1", "vpc_id": "vpc-1", "route": []interface{}{map[string]interface{}{"cidr_block": "0.0.0.0/0", "gateway_id": "igw-1", "nat_gateway_id": ""}},
+				}},
+				// The route of the refreshed route table is not added twice
+				{Address: "module.net.aws_route.public", Mode: tfjson.ManagedResourceMode, Type: "aws_route", Name: "public", AttributeValues: map[string]interface{}{
+					"route_table_id": "rtb-1", "destination_cidr_block": "0.0.0.0/0", "gateway_id": "igw-1",
+				}},
+				{Address: "module.net.aws_route_table_association.public[0]", Mode: tfjson.ManagedResourceMode, Type: "aws_route_table_association", Name: "public", Index: float64(0), AttributeValues: map[string]interface{}{
+					"route_table_id": "rtb-1", "subnet_id": "subnet-1",
+				}},
+				{Address: "module.net.aws_network_acl.public", Mode: tfjson.ManagedResourceMode, Type: "aws_network_acl", Name: "public", AttributeValues: map[string]interface{}{
+					"id": "acl-1", "vpc_id": "vpc-1", "subnet_ids": []interface{}{"subnet-1"},
+				}},
+				{Address: "module.net.aws_network_acl_rule.ingress", Mode: tfjson.ManagedResourceMode, Type: "aws_network_acl_rule", Name: "ingress", AttributeValues: map[string]interface{}{
+					"network_acl_id": "acl-1", "rule_number": float64(100), "protocol": "-1", "rule_action": "allow", "egress": false, "cidr_block": "0.0.0.0/0",
+				}},
+				{Address: "module.net.data.aws_region.current", Mode: tfjson.DataResourceMode, Type: "aws_region", Name: "current"},
+			},
+		}},
+	}}}
+
+	topology, err := TopologyFromState(state)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*Vpc{{Id: "vpc-1", CidrBlock: "10.0.0.0/16", Name: "net"}}, topology.Vpcs)
+	assert.Equal(t, []*Subnet{{Id: "subnet-1", VpcId: "vpc-1", CidrBlock: "10.0.1.0/24", AvailabilityZone: "us-east-1a"}}, topology.Subnets)
+	assert.Equal(t, []*InternetGateway{{Id: "igw-1", VpcId: "vpc-1"}}, topology.InternetGateways)
+	assert.Equal(t, []*RouteTable{{Id: "rtb-1", VpcId: "vpc-1", Routes: []Route{{DestinationCidrBlock: "0.0.0.0/0", GatewayId: "igw-1"}}, SubnetIds: []string{"subnet-1"}}}, topology.RouteTables)
+	assert.Equal(t, []*NetworkAcl{{Id: "acl-1", VpcId: "vpc-1", SubnetIds: []string{"subnet-1"}, Entries: []NetworkAclEntry{{RuleNumber: 100, Protocol: "-1", RuleAction: "allow", CidrBlock: "0.0.0.0/0"}}}}, topology.NetworkAcls)
+}
+
+func TestTopologyFromPlan(t *testing.T) {
+	references := func(references ...string) *tfjson.Expression {
+		return &tfjson.Expression{ExpressionData: &tfjson.ExpressionData{References: references}}
+	}
+	plan := &tfjson.Plan{
+		PlannedValues: &tfjson.StateValues{RootModule: &tfjson.StateModule{
+			ChildModules: []*tfjson.StateModule{{
+				Address: "module.net",
+				Resources: []*tfjson.StateResource{
+					{Address: "module.net.aws_vpc.this", Mode: tfjson.ManagedResourceMode, Type: "aws_vpc", Name: "this", AttributeValues: map[string]interface{}{"cidr_block": "10.0.0.0/16"}},
+					{Address: "module.net.aws_subnet.public[0]", Mode: tfjson.ManagedResourceMode, Type: "aws_subnet", Name: "public", Index: float64(0), AttributeValues: map[string]interface{}{"cidr_block": "10.0.1.0/24"}},
+					{Address: "module.net.aws_subnet.public[1]", Mode: tfjson.ManagedResourceMode, Type: "aws_subnet", Name: "public", Index: float64(1), AttributeValues: map[string]interface{}{"cidr_block": "10.0.2.0/24"}},
+					{Address: "module.net.aws_eip.nat", Mode: tfjson.ManagedResourceMode, Type: "aws_eip", Name: "nat", AttributeValues: map[string]interface{}{}},
+					{Address: "module.net.aws_nat_gateway.this", Mode: tfjson.ManagedResourceMode, Type: "aws_nat_gateway", Name: "this", AttributeValues: map[string]interface{}{}},
+					{Address: "module.net.aws_route_table.public", Mode: tfjson.ManagedResourceMode, Type: "aws_route_table", Name: "public", AttributeValues: map[string]interface{}{}},
+					{Address: "module.net.aws_route_table_association.public[0]", Mode: tfjson.ManagedResourceMode, Type: "aws_route_table_association", Name: "public", Index: float64(0), AttributeValues: map[string]interface{}{}},
+					{Address: "module.net.aws_route_table_association.public[1]", Mode: tfjson.ManagedResourceMode, Type: "aws_route_table_association", Name: "public", Index: float64(1), AttributeValues: map[string]interface{}{}},
+					{Address: "module.net.aws_network_acl.public", Mode: tfjson.ManagedResourceMode, Type: "aws_network_acl", Name: "public", AttributeValues: map[string]interface{}{}},
+				},
+			}},
+		}},
+		Config: &tfjson.Config{RootModule: &tfjson.ConfigModule{
+			ModuleCalls: map[string]*tfjson.ModuleCall{"net": {Module: &tfjson.ConfigModule{
+				Resources: []*tfjson.ConfigResource{
+					{Type: "aws_subnet", Name: "public", Expressions: map[string]*tfjson.Expression{"vpc_id": references("aws_vpc.this.id", "aws_vpc.this")}},
+					{Type: "aws_nat_gateway", Name: "this", Expressions: map[string]*tfjson.Expression{
+						"allocation_id": references("aws_eip.nat.id", "aws_eip.nat"),
+						"subnet_id":     references("aws_subnet.public[1].id", "aws_subnet.public[1]", "aws_subnet.public"),
+					}},
+					{Type: "aws_route_table", Name: "public", Expressions: map[string]*tfjson.Expression{"vpc_id": references("aws_vpc.this.id", "aws_vpc.this")}},
+					{Type: "aws_route_table_association", Name: "public", Expressions: map[string]*tfjson.Expression{
+						"route_table_id": references("aws_route_table.public.id", "aws_route_table.public"),
+						"subnet_id":      references("aws_subnet.public", "count.index"),
+					}},
+					{Type: "aws_network_acl", Name: "public", Expressions: map[string]*tfjson.Expression{
+						"vpc_id":     references("aws_vpc.this.id", "aws_vpc.this"),
+						"subnet_ids": references("aws_subnet.public"),
+					}},
+				},
+			}}},
+		}},
+	}
+
+	topology, err := TopologyFromPlan(plan)
+	require.NoError(t, err)
+
+	// The ids are made up in the order of the resources
+	vpcId, publicSubnetIds := "vpc-00000000000000001", []string{"subnet-00000000000000002", "subnet-00000000000000003"}
+	assert.Equal(t, vpcId, topology.Vpcs[0].Id)
+	require.Len(t, topology.Subnets, 2)
+	for i, subnet := range topology.Subnets {
+		assert.Equal(t, publicSubnetIds[i], subnet.Id)
+		assert.Equal(t, vpcId, subnet.VpcId)
+	}
+
+	// An indexed reference selects the instance and the VPC of the NAT gateway is the VPC of its subnet
+	require.Len(t, topology.NatGateways, 1)
+	assert.Equal(t, NatGateway{
+		Id:           "nat-00000000000000005",
+		VpcId:        vpcId,
+		SubnetId:     publicSubnetIds[1],
+		State:        "available",
+		AllocationId: "eipalloc-00000000000000004",
+		PublicIp:     "198.51.100.1",
+	}, *topology.NatGateways[0])
+
+	// A reference indexed with count.index selects the instance with the same index
+	require.Len(t, topology.RouteTables, 1)
+	assert.Equal(t, vpcId, topology.RouteTables[0].VpcId)
+	assert.Equal(t, publicSubnetIds, topology.RouteTables[0].SubnetIds)
+
+	// A splat reference selects every instance
+	require.Len(t, topology.NetworkAcls, 1)
+	assert.Equal(t, publicSubnetIds, topology.NetworkAcls[0].SubnetIds)
+}
+
+func TestNetwork(t *testing.T) {
+	s := NewServer(t, "us-east-1")
+	network := NewNetwork(s, &Topology{
+		Vpcs:             []*Vpc{{Id: "vpc-1", CidrBlock: "10.0.0.0/16", Name: "net"}, {Id: "vpc-2", CidrBlock: "10.1.0.0/16"}},
+		Subnets:          []*Subnet{{Id: "subnet-1", VpcId: "vpc-1", CidrBlock: "10.0.1.0/24"}, {Id: "subnet-2", VpcId: "vpc-2", CidrBlock: "10.1.1.0/24"}},
+		InternetGateways: []*InternetGateway{{Id: "igw-1", VpcId: "vpc-1"}, {Id: "igw-2"}},
+		NatGateways:      []*NatGateway{{Id: "nat-1", VpcId: "vpc-1", SubnetId: "subnet-1", State: "available"}},
+		RouteTables:      []*RouteTable{{Id: "rtb-1", VpcId: "vpc-1", Routes: []Route{{DestinationCidrBlock: "0.0.0.0/0", GatewayId: "igw-1"}}, SubnetIds: []string{"subnet-1"}}},
+		NetworkAcls:      []*NetworkAcl{{Id: "acl-1", VpcId: "vpc-1", SubnetIds: []string{"subnet-1"}, Entries: []NetworkAclEntry{{RuleNumber: 100, Protocol: "-1", RuleAction: "allow", Egress: true, CidrBlock: "0.0.0.0/0"}}}},
+	})
+	client := ec2.New(s.Session())
+
+	vpcs, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws_sdk.String("vpc-1")}})
+	require.NoError(t, err)
+	require.Len(t, vpcs.Vpcs, 1)
+	assert.Equal(t, "10.0.0.0/16", *vpcs.Vpcs[0].CidrBlock)
+	assert.Equal(t, "net", *vpcs.Vpcs[0].Tags[0].Value)
+
+	_, err = client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws_sdk.String("vpc-3")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InvalidVpcID.NotFound")
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: []*ec2.Filter{{Name: aws_sdk.String("vpc-id"), Values: []*string{aws_sdk.String("vpc-2")}}}})
+	require.NoError(t, err)
+	require.Len(t, subnets.Subnets, 1)
+	assert.Equal(t, "subnet-2", *subnets.Subnets[0].SubnetId)
+
+	// A detached internet gateway has no attachments
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{})
+	require.NoError(t, err)
+	require.Len(t, igws.InternetGateways, 2)
+	assert.Equal(t, "vpc-1", *igws.InternetGateways[0].Attachments[0].VpcId)
+	assert.Empty(t, igws.InternetGateways[1].Attachments)
+
+	igws, err = client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{Filters: []*ec2.Filter{{Name: aws_sdk.String("attachment.vpc-id"), Values: []*string{aws_sdk.String("vpc-2")}}}})
+	require.NoError(t, err)
+	assert.Empty(t, igws.InternetGateways)
+
+	natGateways, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{Filter: []*ec2.Filter{{Name: aws_sdk.String("state"), Values: []*string{aws_sdk.String("available")}}}})
+	require.NoError(t, err)
+	require.Len(t, natGateways.NatGateways, 1)
+	assert.Equal(t, "subnet-1", *natGateways.NatGateways[0].SubnetId)
+
+	// The route table has the local route of its VPC
+	routeTables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{RouteTableIds: []*string{aws_sdk.String("rtb-1")}})
+	require.NoError(t, err)
+	require.Len(t, routeTables.RouteTables, 1)
+	require.Len(t, routeTables.RouteTables[0].Routes, 2)
+	assert.Equal(t, "local", *routeTables.RouteTables[0].Routes[0].GatewayId)
+	assert.Equal(t, "igw-1", *routeTables.RouteTables[0].Routes[1].GatewayId)
+	assert.Nil(t, routeTables.RouteTables[0].Routes[1].NatGatewayId)
+	require.Len(t, routeTables.RouteTables[0].Associations, 1)
+	assert.Equal(t, "subnet-1", *routeTables.RouteTables[0].Associations[0].SubnetId)
+
+	networkAcls, err := client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{Filters: []*ec2.Filter{{Name: aws_sdk.String("association.subnet-id"), Values: []*string{aws_sdk.String("subnet-1")}}}})
+	require.NoError(t, err)
+	require.Len(t, networkAcls.NetworkAcls, 1)
+	assert.True(t, *networkAcls.NetworkAcls[0].Entries[0].Egress)
+	assert.Equal(t, int64(100), *networkAcls.NetworkAcls[0].Entries[0].RuleNumber)
+
+	// The topology can be broken while the network serves requests
+	network.Update(func(topology *Topology) {
+		topology.RouteTable("rtb-1").SubnetIds = nil
+	})
+	routeTables, err = client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: []*ec2.Filter{{Name: aws_sdk.String("association.subnet-id"), Values: []*string{aws_sdk.String("subnet-1")}}}})
+	require.NoError(t, err)
+	assert.Empty(t, routeTables.RouteTables)
+}
@@ -0,0 +1,331 @@
+package fakeaws
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_sdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	// AccountId is the account that every request made to the
+	// fake server is considered to be authenticated as.
+	AccountId = "123456789012"
+
+	// AccessKeyId and SecretAccessKey are the mocked credentials
+	// handed to Terraform and the AWS SDKs. They are never checked.
+	AccessKeyId     = "mock_access_key"
+	SecretAccessKey = "mock_secret_key"
+)
+
+// credentialScope pulls the signing service out of a SigV4 Authorization
+// header, i.e. Credential=AKID/20231001/us-east-1/ec2/aws4_request
+var credentialScope = regexp.MustCompile(`Credential=[^/]+/[^/]+/[^/]+/([^/]+)/aws4_request`)
+
+// Operation handles a single AWS API action. The returned value is encoded
+// using the protocol of the incoming request (JSON for X-Amz-Target based
+// services, XML for query and REST services). Return an *Error to have the
+// fake respond with an AWS style error.
+type Operation func(r *Request) (interface{}, error)
+
+// Request is the decoded form of an AWS API call made to the fake server.
+type Request struct {
+	// Service is the signing name of the service being called (ec2, sts, s3, ecs...)
+	Service string
+
+	// Action is the API action being called (i.e. DescribeAvailabilityZones).
+	// For REST services (S3) this is the method and path, i.e. "GET /".
+	Action string
+
+	// Form contains the parameters of query protocol requests (EC2, STS, ELBv2...)
+	Form url.Values
+
+	// Body is the raw request body
+	Body []byte
+
+	HTTP *http.Request
+}
+
+// Decode unmarshals the JSON body of the request into v
+func (r *Request) Decode(v interface{}) error {
+	if len(r.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Body, v)
+}
+
+// Error is an AWS API error returned by an Operation
+type Error struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Errorf builds a client (400) error with the given code
+func Errorf(code string, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), Status: http.StatusBadRequest}
+}
+
+// Server is an in-process stand-in for the AWS APIs. Requests are routed to
+// the Operation registered for the signing service and action of the request,
+// which allows a single endpoint (AWS_ENDPOINT_URL) to serve every service.
+type Server struct {
+	*httptest.Server
+
+	// Region is the region that the fake server reports resources in
+	Region string
+
+	mu         sync.Mutex
+	operations map[string]Operation
+	calls      map[string]int
+}
+
+// NewServer starts a fake AWS server that is shutdown when the test completes.
+// The server answers the identity calls made by the AWS provider and SDKs
+// when they are configured (sts:GetCallerIdentity, s3:ListBuckets) and the
+// describe calls that the modules read through data sources.
+func NewServer(t *testing.T, region string) *Server {
+	s := &Server{
+		Region:     region,
+		operations: map[string]Operation{},
+		calls:      map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	registerIdentityOperations(s)
+	registerAvailabilityZoneOperations(s)
+
+	return s
+}
+
+// Handle registers the operation to be called for the service and action.
+// Registering an action a second time replaces the previous operation, which
+// allows tests to override the default behaviour of the fake.
+func (s *Server) Handle(service string, action string, op Operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations[service+":"+action] = op
+}
+
+// Calls returns the number of times the service action has been called
+func (s *Server) Calls(service string, action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[service+":"+action]
+}
+
+// EnvVars returns the environment variables that point Terraform and the AWS
+// SDKs at the fake server using mocked credentials.
+func (s *Server) EnvVars() map[string]string {
+	return map[string]string{
+		"AWS_ACCESS_KEY_ID":         AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY":     SecretAccessKey,
+		"AWS_SESSION_TOKEN":         "",
+		"AWS_PROFILE":               "",
+		"AWS_REGION":                s.Region,
+		"AWS_DEFAULT_REGION":        s.Region,
+		"AWS_ENDPOINT_URL":          s.URL,
+		"AWS_EC2_METADATA_DISABLED": "true",
+	}
+}
+
+// Session returns an aws-sdk-go session that sends every request to the fake
+// server using the mocked credentials
+func (s *Server) Session() *session.Session {
+	return session.Must(session.NewSession(&aws_sdk.Config{
+		Region:      aws_sdk.String(s.Region),
+		Endpoint:    aws_sdk.String(s.URL),
+		Credentials: credentials.NewStaticCredentials(AccessKeyId, SecretAccessKey, ""),
+	}))
+}
+
+// Config returns an aws-sdk-go-v2 config that sends every request to the fake server
+// using the mocked credentials
+func (s *Server) Config() aws.Config {
+	return aws.Config{
+		Region:      s.Region,
+		Credentials: aws.CredentialsProviderFunc(staticCredentials),
+		EndpointResolverWithOptions: aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: s.URL, SigningRegion: region, HostnameImmutable: true}, nil
+		}),
+	}
+}
+
+func staticCredentials(ctx context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: AccessKeyId, SecretAccessKey: SecretAccessKey}, nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &Request{
+		Service: signingService(r),
+		Body:    body,
+		HTTP:    r,
+	}
+
+	// Identify the action from the protocol being used
+	// by the client. JSON services use the X-Amz-Target
+	// header, query services use the Action parameter and
+	// REST services are identified by method and path.
+	isJSON := false
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		isJSON = true
+		req.Action = target[strings.LastIndex(target, ".")+1:]
+	} else if form, err := url.ParseQuery(string(body)); err == nil && form.Get("Action") != "" {
+		req.Form = form
+		req.Action = form.Get("Action")
+	} else if action := r.URL.Query().Get("Action"); action != "" {
+		req.Form = r.URL.Query()
+		req.Action = action
+	} else {
+		req.Action = r.Method + " " + r.URL.Path
+	}
+
+	s.mu.Lock()
+	op, ok := s.operations[req.Service+":"+req.Action]
+	s.calls[req.Service+":"+req.Action]++
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, req, isJSON, &Error{
+			Code:    "NotImplemented",
+			Message: fmt.Sprintf("fakeaws does not implement %s:%s", req.Service, req.Action),
+			Status:  http.StatusNotImplemented,
+		})
+		return
+	}
+
+	out, err := op(req)
+	if err != nil {
+		awsErr, ok := err.(*Error)
+		if !ok {
+			awsErr = &Error{Code: "InternalFailure", Message: err.Error(), Status: http.StatusInternalServerError}
+		}
+		writeError(w, req, isJSON, awsErr)
+		return
+	}
+
+	if isJSON {
+		writeJSON(w, http.StatusOK, out)
+	} else {
+		writeXML(w, http.StatusOK, out)
+	}
+}
+
+// signingService returns the service from the SigV4 credential scope of the
+// request, falling back to the first label of the host for unsigned requests.
+func signingService(r *http.Request) string {
+	if match := credentialScope.FindStringSubmatch(r.Header.Get("Authorization")); match != nil {
+		return match[1]
+	}
+	return strings.Split(r.Host, ".")[0]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if v == nil {
+		v = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	if v == nil {
+		return
+	}
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, req *Request, isJSON bool, err *Error) {
+	if err.Status == 0 {
+		err.Status = http.StatusBadRequest
+	}
+
+	switch {
+	case isJSON:
+		writeJSON(w, err.Status, map[string]string{
+			"__type":  err.Code,
+			"message": err.Message,
+		})
+	case req.Service == "ec2":
+		writeXML(w, err.Status, ec2ErrorResponse{
+			Errors:    []ec2Error{{Code: err.Code, Message: err.Message}},
+			RequestId: requestId,
+		})
+	case req.Form == nil:
+		// REST services (S3) return the error at the root
+		writeXML(w, err.Status, restError{Code: err.Code, Message: err.Message, RequestId: requestId})
+	default:
+		writeXML(w, err.Status, queryErrorResponse{
+			Error:     queryError{Type: "Sender", Code: err.Code, Message: err.Message},
+			RequestId: requestId,
+		})
+	}
+}
+
+// requestId is returned on every response, the SDKs only require it to be present
+const requestId = "00000000-0000-0000-0000-000000000000"
+
+// ResponseMetadata is embedded by query protocol responses
+type ResponseMetadata struct {
+	RequestId string `xml:"RequestId"`
+}
+
+type queryErrorResponse struct {
+	XMLName   xml.Name   `xml:"ErrorResponse"`
+	Error     queryError `xml:"Error"`
+	RequestId string     `xml:"RequestId"`
+}
+
+type queryError struct {
+	Type    string `xml:"Type"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type ec2ErrorResponse struct {
+	XMLName   xml.Name   `xml:"Response"`
+	Errors    []ec2Error `xml:"Errors>Error"`
+	RequestId string     `xml:"RequestID"`
+}
+
+type ec2Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type restError struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	RequestId string   `xml:"RequestId"`
+}
@@ -0,0 +1,63 @@
+package fakeaws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCallerIdentity(t *testing.T) {
+	s := NewServer(t, "us-east-1")
+
+	out, err := sts.New(s.Session()).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+
+	assert.Equal(t, AccountId, *out.Account)
+	assert.Equal(t, 1, s.Calls("sts", "GetCallerIdentity"))
+}
+
+func TestDescribeAvailabilityZones(t *testing.T) {
+	s := NewServer(t, "us-east-2")
+
+	out, err := ec2.New(s.Session()).DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{})
+	require.NoError(t, err)
+
+	zones := []string{}
+	for _, zone := range out.AvailabilityZones {
+		zones = append(zones, *zone.ZoneName)
+	}
+	assert.Equal(t, []string{"us-east-2a", "us-east-2b", "us-east-2c"}, zones)
+}
+
+func TestListBucketsOwner(t *testing.T) {
+	s := NewServer(t, "us-east-1")
+
+	client := s3.New(s3.Options{
+		Region:       s.Region,
+		Credentials:  aws.CredentialsProviderFunc(staticCredentials),
+		UsePathStyle: true,
+		EndpointResolver: s3.EndpointResolverFunc(func(region string, options s3.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: s.URL, SigningRegion: region}, nil
+		}),
+	})
+
+	out, err := client.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	require.NoError(t, err)
+
+	assert.Equal(t, CanonicalUserId, *out.Owner.ID)
+	assert.Empty(t, out.Buckets)
+}
+
+func TestUnimplementedOperation(t *testing.T) {
+	s := NewServer(t, "us-east-1")
+
+	_, err := ec2.New(s.Session()).DescribeVpcs(&ec2.DescribeVpcsInput{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NotImplemented")
+}
@@ -0,0 +1,54 @@
+# ------------------------------------------------------------------------------
+# SHARED ECS CLUSTER FIXTURE
+#
+# An ECS cluster in the shared VPC fixture that the tests deploy once per region
+# and pass to the examples that declare the fixture. The state of each region is
+# kept in its own backend path.
+# ------------------------------------------------------------------------------
+
+
+# -------------------------------------------
+# SET TERRAFORM REQUIREMENTS TO RUN MODULE
+# -------------------------------------------
+
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+
+  backend "local" {}
+}
+
+
+# -------------------------------------------
+# AWS PROVIDER CONFIGURATION
+# -------------------------------------------
+
+provider "aws" {
+  region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
+}
+
+
+# -------------------------------------------
+# CREATE THE SHARED ECS CLUSTER
+# -------------------------------------------
+
+module "cluster" {
+  source = "../../../modules/ecs-cluster"
+
+  cluster_name = "fixture-test${var.random_id}"
+
+  cluster_instance_ami = var.cluster_instance_ami
+
+  vpc_id         = var.vpc_id
+  vpc_subnet_ids = var.private_subnet_ids
+
+  tags = var.tags
+}
@@ -0,0 +1,6 @@
+# The outputs are passed to the examples as variables of the same name
+
+output "ecs_cluster_name" {
+  description = "The name of the shared ECS cluster."
+  value       = module.cluster.ecs_cluster_name
+}
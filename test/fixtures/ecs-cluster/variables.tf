@@ -0,0 +1,56 @@
+# --------------------------------------------------------------------
+
+# REQUIRED PARAMETERS
+
+# These values are set by the tests from the outputs of the VPC fixture
+
+# --------------------------------------------------------------------
+
+variable "private_subnet_ids" {
+  description = "The IDs of the private subnets of the shared VPC to place the cluster instances in."
+  type        = list(string)
+}
+
+variable "vpc_id" {
+  description = "The ID of the shared VPC."
+  type        = string
+}
+
+
+# --------------------------------------------------------------------
+
+# OPTIONAL PARAMETERS
+
+# These values are optional and have default values
+
+# --------------------------------------------------------------------
+
+variable "cluster_instance_ami" {
+  type        = string
+  description = "The AMI to run on each instance in the ECS cluster."
+  default     = "ami-0e692fe1bae5ca24c"
+}
+
+variable "public_subnet_ids" {
+  description = "The IDs of the public subnets of the shared VPC, unused but passed with the other outputs of the VPC fixture."
+  type        = list(string)
+  default     = []
+}
+
+variable "random_id" {
+  description = "Random id generated for the purpose of testing"
+  type        = string
+  default     = ""
+}
+
+variable "region" {
+  description = "The AWS region to provision resources to."
+  type        = string
+  default     = "us-east-1"
+}
+
+variable "tags" {
+  description = "Tags to apply to the resources of the fixture, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
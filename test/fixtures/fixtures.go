@@ -0,0 +1,100 @@
+// Package fixtures deploys the stacks that several examples share, i.e. a VPC or an ECS
+// cluster, once per region instead of once per test. A test declares the fixtures it
+// needs, the fixtures are deployed when the first test that needs them applies, their
+// outputs are passed to the tests as Terraform variables, and each fixture is destroyed
+// once the last test that needs it in its region is released.
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/scheduler"
+	"github.com/gruntwork-io/terratest/modules/aws"
+)
+
+// Fixture is a Terraform stack in Dir that is shared by the tests
+type Fixture struct {
+	Name string
+
+	// Dir is the Terraform stack of the fixture, relative to the tests
+	Dir string
+
+	// Resources are the quota limited resources that the fixture deploys to each region
+	Resources scheduler.Resources
+
+	// Needs are the fixtures whose outputs are passed to the fixture as variables
+	Needs []*Fixture
+
+	// Vars returns the variables of the fixture in the region, other than the outputs
+	// of its needs
+	Vars func(t *testing.T, region string) (map[string]interface{}, error)
+}
+
+var (
+	// Vpc is a VPC with public and private subnets and a NAT gateway
+	Vpc = &Fixture{
+		Name:      "vpc",
+		Dir:       "fixtures/vpc",
+		Resources: scheduler.Resources{Vpcs: 1, Eips: 1, NatGateways: 1},
+	}
+
+	// EcsCluster is an ECS cluster in the private subnets of Vpc
+	EcsCluster = &Fixture{
+		Name:  "ecs-cluster",
+		Dir:   "fixtures/ecs-cluster",
+		Needs: []*Fixture{Vpc},
+		Vars: func(t *testing.T, region string) (map[string]interface{}, error) {
+			amiId, err := aws.GetEcsOptimizedAmazonLinuxAmiE(t, region)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"cluster_instance_ami": amiId}, nil
+		},
+	}
+)
+
+// ConsumerLayer is the teardown layer of the tests, they are destroyed before the
+// fixtures they need
+var ConsumerLayer = max(Layer(Vpc), Layer(EcsCluster)) + 1
+
+// Layer returns the teardown layer of the fixture, a fixture is destroyed before the
+// fixtures it needs
+func Layer(f *Fixture) int {
+	layer := 0
+	for _, need := range f.Needs {
+		layer = max(layer, Layer(need)+1)
+	}
+	return layer
+}
+
+// closure returns the fixtures and the fixtures they need, the needs of a fixture
+// before it
+func closure(fixtures []*Fixture) []*Fixture {
+	seen := map[*Fixture]bool{}
+	ordered := []*Fixture{}
+	var visit func(f *Fixture)
+	visit = func(f *Fixture) {
+		if seen[f] {
+			return
+		}
+		seen[f] = true
+		for _, need := range f.Needs {
+			visit(need)
+		}
+		ordered = append(ordered, f)
+	}
+	for _, f := range fixtures {
+		visit(f)
+	}
+	return ordered
+}
+
+// Reserved returns the quota limited resources that the fixtures, and the fixtures they
+// need, deploy to a region
+func Reserved(fixtures []*Fixture) scheduler.Resources {
+	reserved := scheduler.Resources{}
+	for _, f := range closure(fixtures) {
+		reserved = reserved.Add(f.Resources)
+	}
+	return reserved
+}
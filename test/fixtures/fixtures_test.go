@@ -0,0 +1,193 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/scheduler"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/teardown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeployer records the deploys and destroys of the fixtures
+type fakeDeployer struct {
+	mu       sync.Mutex
+	events   []string
+	deployed map[string]bool
+	failures map[string]error
+}
+
+func newFakeDeployer() *fakeDeployer {
+	return &fakeDeployer{deployed: map[string]bool{}, failures: map[string]error{}}
+}
+
+func (d *fakeDeployer) Deploy(t *testing.T, f *Fixture, region string, vars map[string]interface{}) (map[string]interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := fmt.Sprintf("%s in %s", f.Name, region)
+	d.events = append(d.events, "deploy "+key)
+	d.deployed[key] = true
+	if err := d.failures["deploy "+key]; err != nil {
+		return nil, err
+	}
+
+	switch f {
+	case Vpc:
+		return map[string]interface{}{"vpc_id": "vpc-" + region}, nil
+	case EcsCluster:
+		// The cluster is deployed to the VPC
+		return map[string]interface{}{"ecs_cluster_name": fmt.Sprintf("cluster-%s", vars["vpc_id"])}, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (d *fakeDeployer) Destroy(t *testing.T, f *Fixture, region string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := fmt.Sprintf("%s in %s", f.Name, region)
+	d.events = append(d.events, "destroy "+key)
+	if err := d.failures["destroy "+key]; err != nil {
+		return err
+	}
+	delete(d.deployed, key)
+	return nil
+}
+
+func (d *fakeDeployer) Deployed(f *Fixture, region string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deployed[fmt.Sprintf("%s in %s", f.Name, region)]
+}
+
+func (d *fakeDeployer) Events() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.events...)
+}
+
+func newTestManager(t *testing.T, deployer Deployer) (*Manager, *teardown.Teardown) {
+	td := teardown.New(t.Logf)
+	return NewManager(deployer, td), td
+}
+
+func TestFixturesAreSharedAndDestroyedAfterTheLastConsumer(t *testing.T) {
+	deployer := newFakeDeployer()
+	m, td := newTestManager(t, deployer)
+
+	m.Expect("alb", []*Fixture{Vpc}, "us-east-1")
+	m.Expect("ecs service", []*Fixture{EcsCluster}, "us-east-1")
+	m.Expect("ecs-scheduled-task", []*Fixture{EcsCluster}, "us-east-1")
+
+	outputs, err := m.Acquire(t, "ecs service")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"vpc_id":           "vpc-us-east-1",
+		"ecs_cluster_name": "cluster-vpc-us-east-1",
+	}, outputs)
+
+	outputs, err = m.Acquire(t, "alb")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-us-east-1"}, outputs)
+
+	_, err = m.Acquire(t, "ecs-scheduled-task")
+	require.NoError(t, err)
+
+	// Each fixture is deployed once, after the fixtures it needs
+	assert.Equal(t, []string{"deploy vpc in us-east-1", "deploy ecs-cluster in us-east-1"}, deployer.Events())
+	assert.Len(t, td.Live(), 2)
+
+	require.NoError(t, m.Release(t, "ecs service"))
+	require.NoError(t, m.Release(t, "ecs-scheduled-task"))
+	assert.Equal(t, "destroy ecs-cluster in us-east-1", deployer.Events()[2])
+	assert.Len(t, deployer.Events(), 3, "Expected the VPC to be kept for the alb test")
+
+	require.NoError(t, m.Release(t, "alb"))
+	assert.Equal(t, "destroy vpc in us-east-1", deployer.Events()[3])
+	assert.Empty(t, td.Live())
+
+	// A test is only released once
+	require.NoError(t, m.Release(t, "alb"))
+	assert.Len(t, deployer.Events(), 4)
+}
+
+func TestFixturesArePerRegion(t *testing.T) {
+	deployer := newFakeDeployer()
+	m, _ := newTestManager(t, deployer)
+
+	m.Expect("alb", []*Fixture{Vpc}, "us-east-1")
+	m.Expect("ecs-cluster", []*Fixture{Vpc}, "us-east-2")
+
+	_, err := m.Acquire(t, "alb")
+	require.NoError(t, err)
+	outputs, err := m.Acquire(t, "ecs-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, "vpc-us-east-2", outputs["vpc_id"])
+
+	require.NoError(t, m.Release(t, "alb"))
+	assert.Equal(t, []string{"deploy vpc in us-east-1", "deploy vpc in us-east-2", "destroy vpc in us-east-1"}, deployer.Events())
+}
+
+func TestReleaseWithoutAcquire(t *testing.T) {
+	deployer := newFakeDeployer()
+	m, _ := newTestManager(t, deployer)
+
+	// Nothing is destroyed when the tests were skipped before they applied
+	m.Expect("alb", []*Fixture{Vpc}, "us-east-1")
+	require.NoError(t, m.Release(t, "alb"))
+	assert.Empty(t, deployer.Events())
+
+	// A fixture left by an interrupted run is destroyed by the cleanup
+	deployer.deployed["vpc in us-east-2"] = true
+	m.Expect("ecs-cluster", []*Fixture{Vpc}, "us-east-2")
+	require.NoError(t, m.Release(t, "ecs-cluster"))
+	assert.Equal(t, []string{"destroy vpc in us-east-2"}, deployer.Events())
+}
+
+func TestFailedDeployIsDestroyed(t *testing.T) {
+	deployer := newFakeDeployer()
+	deployer.failures["deploy ecs-cluster in us-east-1"] = errors.New("InvalidParameterException")
+	m, td := newTestManager(t, deployer)
+
+	m.Expect("ecs service", []*Fixture{EcsCluster}, "us-east-1")
+	_, err := m.Acquire(t, "ecs service")
+	assert.ErrorContains(t, err, "unable to deploy the ecs-cluster fixture to us-east-1: InvalidParameterException")
+
+	// The partially deployed fixtures are live until the test is released
+	assert.Len(t, td.Live(), 2)
+	require.NoError(t, m.Release(t, "ecs service"))
+	assert.Equal(t, []string{
+		"deploy vpc in us-east-1",
+		"deploy ecs-cluster in us-east-1",
+		"destroy ecs-cluster in us-east-1",
+		"destroy vpc in us-east-1",
+	}, deployer.Events())
+}
+
+func TestFailedDestroyIsReported(t *testing.T) {
+	deployer := newFakeDeployer()
+	deployer.failures["destroy vpc in us-east-1"] = errors.New("DependencyViolation")
+	m, td := newTestManager(t, deployer)
+
+	m.Expect("alb", []*Fixture{Vpc}, "us-east-1")
+	_, err := m.Acquire(t, "alb")
+	require.NoError(t, err)
+
+	err = m.Release(t, "alb")
+	assert.EqualError(t, err, "unable to destroy the vpc fixture in us-east-1: DependencyViolation")
+	assert.Len(t, td.Live(), 1)
+}
+
+func TestLayersAndReserved(t *testing.T) {
+	assert.Equal(t, 0, Layer(Vpc))
+	assert.Equal(t, 1, Layer(EcsCluster))
+	assert.Equal(t, 2, ConsumerLayer)
+
+	// The VPC that the cluster needs is only reserved once
+	assert.Equal(t, scheduler.Resources{Vpcs: 1, Eips: 1, NatGateways: 1}, Reserved([]*Fixture{Vpc, EcsCluster}))
+	assert.Equal(t, scheduler.Resources{}, Reserved(nil))
+}
@@ -0,0 +1,212 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/teardown"
+)
+
+// Deployer deploys and destroys the fixtures in a region
+type Deployer interface {
+	// Deploy deploys the fixture with the outputs of its needs and returns its outputs
+	Deploy(t *testing.T, f *Fixture, region string, vars map[string]interface{}) (map[string]interface{}, error)
+
+	// Destroy destroys the fixture
+	Destroy(t *testing.T, f *Fixture, region string) error
+
+	// Deployed returns true if the fixture may have resources in the region, i.e. an
+	// interrupted run deployed it
+	Deployed(f *Fixture, region string) bool
+}
+
+// instance is a fixture in a region
+type instance struct {
+	fixture *Fixture
+	region  string
+
+	// mu serializes the deploy and the destroy of the instance
+	mu sync.Mutex
+
+	// consumers are the tests that need the instance and were not released yet
+	consumers map[string]bool
+
+	outputs    map[string]interface{}
+	deployment *teardown.Deployment
+}
+
+// consumer is a test that needs fixtures in a region
+type consumer struct {
+	fixtures []*Fixture
+	region   string
+}
+
+type instanceKey struct {
+	fixture *Fixture
+	region  string
+}
+
+// Manager counts the tests that need each fixture in each region
+type Manager struct {
+	deployer Deployer
+	td       *teardown.Teardown
+
+	mu        sync.Mutex
+	instances map[instanceKey]*instance
+	consumers map[string]consumer
+}
+
+// NewManager creates a manager that deploys the fixtures with the deployer and
+// registers them with the teardown
+func NewManager(deployer Deployer, td *teardown.Teardown) *Manager {
+	return &Manager{
+		deployer:  deployer,
+		td:        td,
+		instances: map[instanceKey]*instance{},
+		consumers: map[string]consumer{},
+	}
+}
+
+// Expect records that the test needs the fixtures in the region. Every test that is
+// expected must be released, whether it acquired its fixtures or not, so the fixtures
+// are destroyed after the last test that needs them.
+func (m *Manager) Expect(name string, fixtures []*Fixture, region string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := consumer{fixtures: closure(fixtures), region: region}
+	m.consumers[name] = c
+	for _, f := range c.fixtures {
+		m.instance(f, region).consumers[name] = true
+	}
+}
+
+func (m *Manager) instance(f *Fixture, region string) *instance {
+	key := instanceKey{fixture: f, region: region}
+	inst, ok := m.instances[key]
+	if !ok {
+		inst = &instance{fixture: f, region: region, consumers: map[string]bool{}}
+		m.instances[key] = inst
+	}
+	return inst
+}
+
+// Acquire deploys the fixtures that the test needs, unless an earlier test deployed
+// them, and returns their outputs
+func (m *Manager) Acquire(t *testing.T, name string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	c, ok := m.consumers[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("test %s does not expect any fixtures", name)
+	}
+
+	outputs := map[string]interface{}{}
+	for _, f := range c.fixtures {
+		m.mu.Lock()
+		inst := m.instance(f, c.region)
+		m.mu.Unlock()
+
+		fixtureOutputs, err := m.deploy(t, inst)
+		if err != nil {
+			return nil, fmt.Errorf("unable to deploy the %s fixture to %s: %w", f.Name, c.region, err)
+		}
+		for key, value := range fixtureOutputs {
+			outputs[key] = value
+		}
+	}
+	return outputs, nil
+}
+
+// deploy deploys the instance once, the needs of its fixture are deployed before it
+func (m *Manager) deploy(t *testing.T, inst *instance) (map[string]interface{}, error) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if inst.outputs != nil {
+		return inst.outputs, nil
+	}
+
+	vars := map[string]interface{}{}
+	for _, need := range inst.fixture.Needs {
+		m.mu.Lock()
+		needed := m.instance(need, inst.region)
+		m.mu.Unlock()
+
+		needed.mu.Lock()
+		for key, value := range needed.outputs {
+			vars[key] = value
+		}
+		needed.mu.Unlock()
+	}
+
+	// The fixture is destroyed by the teardown if the run is stopped while it is deployed
+	m.register(t, inst)
+
+	outputs, err := m.deployer.Deploy(t, inst.fixture, inst.region, vars)
+	if err != nil {
+		return nil, err
+	}
+	inst.outputs = outputs
+	return outputs, nil
+}
+
+// register registers the instance with the teardown, the caller holds inst.mu
+func (m *Manager) register(t *testing.T, inst *instance) {
+	if inst.deployment != nil {
+		return
+	}
+	f := inst.fixture
+	region := inst.region
+	inst.deployment = m.td.Register(fmt.Sprintf("fixture/%s in %s", f.Name, region), f.Dir, Layer(f), func() error {
+		return m.deployer.Destroy(t, f, region)
+	})
+}
+
+// Release records that the test no longer needs its fixtures, and destroys each fixture
+// that no other test in its region needs. The fixtures are destroyed before the
+// fixtures they need.
+func (m *Manager) Release(t *testing.T, name string) error {
+	m.mu.Lock()
+	c, ok := m.consumers[name]
+	delete(m.consumers, name)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	errs := []error{}
+	for i := len(c.fixtures) - 1; i >= 0; i-- {
+		m.mu.Lock()
+		inst := m.instance(c.fixtures[i], c.region)
+		m.mu.Unlock()
+
+		if err := m.release(t, inst, name); err != nil {
+			errs = append(errs, fmt.Errorf("unable to destroy the %s fixture in %s: %w", inst.fixture.Name, inst.region, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) release(t *testing.T, inst *instance, name string) error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	delete(inst.consumers, name)
+	if len(inst.consumers) > 0 {
+		return nil
+	}
+
+	// An interrupted run can leave a fixture that this run did not deploy
+	if inst.deployment == nil {
+		if !m.deployer.Deployed(inst.fixture, inst.region) {
+			return nil
+		}
+		m.register(t, inst)
+	}
+
+	inst.outputs = nil
+	return inst.deployment.Destroy()
+}
@@ -0,0 +1,179 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/modules"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+// TerraformDeployer deploys the fixtures with Terraform. The regions of a fixture share
+// its dir, so each region has its own state file and data dir, and its options are saved
+// in .test-data so a resumed run or a cleanup reuses the random_id of the fixture.
+type TerraformDeployer struct {
+	mu sync.Mutex
+
+	// initLocks serialize terraform init per dir, the regions share the dependency lock file
+	initLocks map[string]*sync.Mutex
+}
+
+// NewTerraformDeployer creates a deployer that runs Terraform in the dirs of the fixtures
+func NewTerraformDeployer() *TerraformDeployer {
+	return &TerraformDeployer{initLocks: map[string]*sync.Mutex{}}
+}
+
+func optionsPath(f *Fixture, region string) string {
+	return test_structure.FormatTestDataPath(f.Dir, fmt.Sprintf("TerraformOptions-%s.json", region))
+}
+
+// Deploy applies the fixture in the region
+func (d *TerraformDeployer) Deploy(t *testing.T, f *Fixture, region string, vars map[string]interface{}) (map[string]interface{}, error) {
+	options, err := loadOptions(f, region)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options, err = newOptions(t, f, region)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range vars {
+		options.Vars[key] = value
+	}
+
+	// Save the options before the apply, so an interrupted apply can still be destroyed
+	if err := saveOptions(f, region, options); err != nil {
+		return nil, err
+	}
+
+	if err := d.init(t, f, options); err != nil {
+		return nil, err
+	}
+	if _, err := terraform.ApplyE(t, options); err != nil {
+		return nil, err
+	}
+	return terraform.OutputAllE(t, options)
+}
+
+// newOptions returns the options of the fixture in the region. The resources are tagged
+// like the resources of a test named after the fixture.
+func newOptions(t *testing.T, f *Fixture, region string) (*terraform.Options, error) {
+	tags := modules.TestTags(t)
+	tags[util.TestNameTagKey] = "fixture/" + f.Name
+
+	vars := map[string]interface{}{
+		"random_id": random.UniqueId(),
+		"region":    region,
+		"tags":      tags,
+	}
+	if f.Vars != nil {
+		fixtureVars, err := f.Vars(t, region)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fixtureVars {
+			vars[key] = value
+		}
+	}
+
+	return terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: f.Dir,
+		Vars:         vars,
+		BackendConfig: map[string]interface{}{
+			"path": fmt.Sprintf("terraform-%s.tfstate", region),
+		},
+		EnvVars: map[string]string{
+			"TF_DATA_DIR": fmt.Sprintf(".terraform-%s", region),
+		},
+	}), nil
+}
+
+func (d *TerraformDeployer) init(t *testing.T, f *Fixture, options *terraform.Options) error {
+	d.mu.Lock()
+	lock, ok := d.initLocks[f.Dir]
+	if !ok {
+		lock = &sync.Mutex{}
+		d.initLocks[f.Dir] = lock
+	}
+	d.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	_, err := terraform.InitE(t, options)
+	return err
+}
+
+// Destroy destroys the fixture in the region and removes its options and state
+func (d *TerraformDeployer) Destroy(t *testing.T, f *Fixture, region string) error {
+	options, err := loadOptions(f, region)
+	if err != nil || options == nil {
+		return err
+	}
+
+	// A cleanup destroys a fixture that this run did not initialize
+	if err := d.init(t, f, options); err != nil {
+		return err
+	}
+
+	options.Lock = true
+	options.LockTimeout = "10m"
+	if _, err := terraform.DestroyE(t, options); err != nil {
+		return err
+	}
+
+	state := filepath.Join(f.Dir, fmt.Sprintf("terraform-%s.tfstate", region))
+	for _, path := range []string{optionsPath(f, region), state, state + ".backup"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deployed returns true if the options of the fixture in the region were saved, they
+// are saved before the fixture is applied and removed once it is destroyed
+func (d *TerraformDeployer) Deployed(f *Fixture, region string) bool {
+	_, err := os.Stat(optionsPath(f, region))
+	return err == nil
+}
+
+// loadOptions returns the saved options of the fixture in the region, or nil
+func loadOptions(f *Fixture, region string) (*terraform.Options, error) {
+	data, err := os.ReadFile(optionsPath(f, region))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	options := &terraform.Options{}
+	if err := json.Unmarshal(data, options); err != nil {
+		return nil, fmt.Errorf("unable to read the options of the %s fixture in %s: %w", f.Name, region, err)
+	}
+	return options, nil
+}
+
+// saveOptions writes the options, the tests save them with test_structure but it fails
+// the test instead of returning an error
+func saveOptions(f *Fixture, region string, options *terraform.Options) error {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	path := optionsPath(f, region)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,48 @@
+# ------------------------------------------------------------------------------
+# SHARED VPC FIXTURE
+#
+# A VPC that the tests deploy once per region and pass to the examples that
+# declare the fixture, instead of each example creating its own VPC and NAT
+# gateway. The state of each region is kept in its own backend path.
+# ------------------------------------------------------------------------------
+
+
+# -------------------------------------------
+# SET TERRAFORM REQUIREMENTS TO RUN MODULE
+# -------------------------------------------
+
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+
+  backend "local" {}
+}
+
+
+# -------------------------------------------
+# AWS PROVIDER CONFIGURATION
+# -------------------------------------------
+
+provider "aws" {
+  region = var.region
+
+  default_tags {
+    tags = var.tags
+  }
+}
+
+
+# -------------------------------------------
+# CREATE THE SHARED VPC
+# -------------------------------------------
+
+module "vpc" {
+  source = "../../../modules/vpc"
+
+  vpc_name               = "fixture-test${var.random_id}"
+  num_availability_zones = 3
+}
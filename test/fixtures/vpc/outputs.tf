@@ -0,0 +1,16 @@
+# The outputs are passed to the examples as variables of the same name
+
+output "private_subnet_ids" {
+  description = "The IDs of the private subnets of the shared VPC."
+  value       = module.vpc.private_subnet_ids
+}
+
+output "public_subnet_ids" {
+  description = "The IDs of the public subnets of the shared VPC."
+  value       = module.vpc.public_subnet_ids
+}
+
+output "vpc_id" {
+  description = "The ID of the shared VPC."
+  value       = module.vpc.vpc_id
+}
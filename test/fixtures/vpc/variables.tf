@@ -0,0 +1,17 @@
+variable "random_id" {
+  description = "Random id generated for the purpose of testing"
+  type        = string
+  default     = ""
+}
+
+variable "region" {
+  description = "The AWS region to provision resources to."
+  type        = string
+  default     = "us-east-1"
+}
+
+variable "tags" {
+  description = "Tags to apply to the resources of the fixture, set by the tests to identify the test run that deployed them"
+  type        = map(string)
+  default     = {}
+}
@@ -0,0 +1,147 @@
+// Package idempotency checks that a deployed example has no changes left to apply. A
+// module that keeps producing diffs (i.e. an attribute that the API normalizes, or a
+// data source that is read back after the apply) breaks the pipelines of its consumers,
+// so the tests plan the example again after the apply and fail on any change that the
+// example does not allow with a reason.
+package idempotency
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Stage plans the deployed example again after the apply stage
+const Stage = "idempotency"
+
+// AllowedDiff is a change that the plan of a deployed example is expected to keep having
+type AllowedDiff struct {
+	// Address of the resource, i.e. module.mongodb.mongodbatlas_cluster.cluster. The
+	// change is allowed for every instance of the resource.
+	Address string
+
+	// Attributes that are allowed to change, any change of the resource is allowed when empty
+	Attributes []string
+
+	// Reason explains why the diff cannot be fixed in the module
+	Reason string
+}
+
+// matches returns true if the allowed diff covers the change of the resource at the address
+func (a AllowedDiff) matches(address string, attributes []string) bool {
+	if address != a.Address && !strings.HasPrefix(address, a.Address+"[") {
+		return false
+	}
+	if len(a.Attributes) == 0 {
+		return true
+	}
+	if len(attributes) == 0 {
+		return false
+	}
+	for _, attribute := range attributes {
+		allowed := false
+		for _, a := range a.Attributes {
+			allowed = allowed || a == attribute
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff is a change of a managed resource in the plan
+type Diff struct {
+	Address string
+	Actions tfjson.Actions
+
+	// Attributes are the top level attributes that change, empty when the resource is
+	// created or destroyed
+	Attributes []string
+
+	// Allowed is the allowed diff that covers the change, nil when it is unexpected
+	Allowed *AllowedDiff
+}
+
+func (d Diff) String() string {
+	actions := []string{}
+	for _, action := range d.Actions {
+		actions = append(actions, string(action))
+	}
+	s := fmt.Sprintf("%s: %s", d.Address, strings.Join(actions, ", "))
+	if len(d.Attributes) > 0 {
+		s += fmt.Sprintf(" (%s)", strings.Join(d.Attributes, ", "))
+	}
+	return s
+}
+
+// Diffs returns the changes of the managed resources in the plan, sorted by address,
+// and matches them with the allowlist
+func Diffs(changes map[string]*tfjson.ResourceChange, allowlist []AllowedDiff) []Diff {
+	diffs := []Diff{}
+	for address, change := range changes {
+		if change.Mode != tfjson.ManagedResourceMode || change.Change == nil || change.Change.Actions.NoOp() {
+			continue
+		}
+
+		d := Diff{Address: address, Actions: change.Change.Actions}
+		if change.Change.Actions.Update() {
+			d.Attributes = changedAttributes(change.Change)
+		}
+		for i := range allowlist {
+			if allowlist[i].matches(address, d.Attributes) {
+				d.Allowed = &allowlist[i]
+				break
+			}
+		}
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address < diffs[j].Address
+	})
+	return diffs
+}
+
+// Unexpected returns the diffs that the allowlist does not cover
+func Unexpected(diffs []Diff) []Diff {
+	unexpected := []Diff{}
+	for _, d := range diffs {
+		if d.Allowed == nil {
+			unexpected = append(unexpected, d)
+		}
+	}
+	return unexpected
+}
+
+// changedAttributes returns the top level attributes whose planned value differs from
+// their current value or is only known after the apply
+func changedAttributes(change *tfjson.Change) []string {
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+	afterUnknown, _ := change.AfterUnknown.(map[string]interface{})
+
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	for name := range afterUnknown {
+		names[name] = true
+	}
+
+	changed := []string{}
+	for name := range names {
+		unknown, _ := afterUnknown[name].(bool)
+		if unknown || !reflect.DeepEqual(before[name], after[name]) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,85 @@
+package idempotency
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffs(t *testing.T) {
+	changes := map[string]*tfjson.ResourceChange{
+		"module.vpc.aws_vpc.this": {
+			Mode:   tfjson.ManagedResourceMode,
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}},
+		},
+		"data.aws_ecs_task_definition.task": {
+			Mode:   tfjson.DataResourceMode,
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}},
+		},
+		"module.mongodb.mongodbatlas_cluster.cluster": {
+			Mode: tfjson.ManagedResourceMode,
+			Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionUpdate},
+				Before:  map[string]interface{}{"name": "cluster", "provider_instance_size_name": "M20"},
+				After:   map[string]interface{}{"name": "cluster", "provider_instance_size_name": "M10"},
+			},
+		},
+		"module.service.aws_ecs_service.service[0]": {
+			Mode: tfjson.ManagedResourceMode,
+			Change: &tfjson.Change{
+				Actions:      tfjson.Actions{tfjson.ActionUpdate},
+				Before:       map[string]interface{}{"task_definition": "task:2", "desired_count": float64(1)},
+				After:        map[string]interface{}{"desired_count": float64(1)},
+				AfterUnknown: map[string]interface{}{"task_definition": true},
+			},
+		},
+		"module.service.aws_ecs_task_definition.task": {
+			Mode:   tfjson.ManagedResourceMode,
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate, tfjson.ActionDelete}},
+		},
+	}
+	allowlist := []AllowedDiff{
+		{
+			Address:    "module.mongodb.mongodbatlas_cluster.cluster",
+			Attributes: []string{"provider_instance_size_name", "disk_size_gb"},
+			Reason:     "Atlas auto scaling",
+		},
+		{
+			// Only another attribute of the service is allowed to change
+			Address:    "module.service.aws_ecs_service.service",
+			Attributes: []string{"force_new_deployment"},
+			Reason:     "triggers a deployment",
+		},
+	}
+
+	diffs := Diffs(changes, allowlist)
+	require.Len(t, diffs, 3)
+
+	assert.Equal(t, "module.mongodb.mongodbatlas_cluster.cluster", diffs[0].Address)
+	assert.Equal(t, []string{"provider_instance_size_name"}, diffs[0].Attributes)
+	require.NotNil(t, diffs[0].Allowed)
+	assert.Equal(t, "Atlas auto scaling", diffs[0].Allowed.Reason)
+
+	assert.Equal(t, "module.service.aws_ecs_service.service[0]: update (task_definition)", diffs[1].String())
+	assert.Nil(t, diffs[1].Allowed)
+
+	assert.Equal(t, "module.service.aws_ecs_task_definition.task: create, delete", diffs[2].String())
+	assert.Nil(t, diffs[2].Allowed)
+
+	assert.Equal(t, []Diff{diffs[1], diffs[2]}, Unexpected(diffs))
+}
+
+func TestAllowedDiffMatches(t *testing.T) {
+	anyChange := AllowedDiff{Address: "module.service.aws_ecs_service.service"}
+	assert.True(t, anyChange.matches("module.service.aws_ecs_service.service", nil))
+	assert.True(t, anyChange.matches(`module.service.aws_ecs_service.service["external"]`, []string{"task_definition"}))
+	assert.False(t, anyChange.matches("module.service.aws_ecs_service.service_discovery", nil))
+
+	// An allowed attribute does not allow the resource to be replaced
+	attributes := AllowedDiff{Address: "module.service.aws_ecs_service.service", Attributes: []string{"task_definition"}}
+	assert.True(t, attributes.matches("module.service.aws_ecs_service.service", []string{"task_definition"}))
+	assert.False(t, attributes.matches("module.service.aws_ecs_service.service", nil))
+	assert.False(t, attributes.matches("module.service.aws_ecs_service.service", []string{"task_definition", "cluster"}))
+}
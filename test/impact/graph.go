@@ -0,0 +1,120 @@
+// Package impact selects the tests whose examples are affected by the changes since a
+// git base ref. The examples call the modules with local sources, i.e.
+// source = "../../modules/vpc", so an example is affected when its own files or the
+// files of any module it calls, directly or through other modules, change.
+package impact
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Graph is the local module dependencies of the examples and modules of the repo.
+// Dirs are relative to the root of the repo and separated by slashes.
+type Graph struct {
+	deps map[string][]string
+}
+
+// LoadGraph parses the module sources of the dirs in examples and modules
+func LoadGraph(root string) (*Graph, error) {
+	g := &Graph{deps: map[string][]string{}}
+
+	for _, parent := range []string{"examples", "modules"} {
+		entries, err := os.ReadDir(filepath.Join(root, parent))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			dir := path.Join(parent, entry.Name())
+			deps, err := moduleSources(root, dir)
+			if err != nil {
+				return nil, err
+			}
+			g.deps[dir] = deps
+		}
+	}
+	return g, nil
+}
+
+// moduleSources returns the local dirs that the module blocks of the dir call
+func moduleSources(root string, dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(dir), "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	parser := hclparse.NewParser()
+	sources := map[string]bool{}
+	for _, file := range files {
+		f, diags := parser.ParseHCLFile(file)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to parse %s: %s", file, diags.Error())
+		}
+
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "module" {
+				continue
+			}
+			attr, ok := block.Body.Attributes["source"]
+			if !ok {
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !value.IsKnown() || value.Type() != cty.String {
+				continue
+			}
+			source := value.AsString()
+
+			// Only local paths are part of the repo, registry modules are versioned
+			if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+				sources[path.Join(dir, source)] = true
+			}
+		}
+	}
+
+	deps := []string{}
+	for source := range sources {
+		deps = append(deps, source)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// Dependencies returns the dir and the local modules that it calls, directly or
+// through other modules, sorted
+func (g *Graph) Dependencies(dir string) []string {
+	seen := map[string]bool{}
+	var visit func(dir string)
+	visit = func(dir string) {
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		for _, dep := range g.deps[dir] {
+			visit(dep)
+		}
+	}
+	visit(dir)
+
+	deps := []string{}
+	for dep := range seen {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps
+}
@@ -0,0 +1,129 @@
+package impact
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadGraphOfRepo(t *testing.T) {
+	g, err := LoadGraph("../..")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"examples/deploy-ecs-service",
+		"modules/alb",
+		"modules/ecs-cluster",
+		"modules/ecs-service",
+		"modules/secrets-manager",
+		"modules/vpc",
+	}, g.Dependencies("examples/deploy-ecs-service"))
+
+	// Registry modules are not part of the graph
+	assert.Equal(t, []string{"examples/deploy-alb", "modules/alb"}, g.Dependencies("examples/deploy-alb"))
+}
+
+func TestDependenciesAreTransitive(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "examples/deploy-app/main.tf", `
+module "app" {
+  source = "../../modules/app"
+}
+
+module "registry" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+`)
+	writeFile(t, root, "modules/app/main.tf", `
+module "network" {
+  source = "../network"
+}
+`)
+	writeFile(t, root, "modules/network/main.tf", `
+resource "aws_vpc" "vpc" {
+  cidr_block = "10.0.0.0/16"
+}
+`)
+
+	g, err := LoadGraph(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"examples/deploy-app", "modules/app", "modules/network"}, g.Dependencies("examples/deploy-app"))
+}
+
+func TestSelect(t *testing.T) {
+	g := &Graph{deps: map[string][]string{
+		"examples/deploy-vpc":         {"modules/vpc"},
+		"examples/deploy-ecs-service": {"modules/vpc", "modules/ecs-service"},
+		"examples/deploy-alb":         {"modules/alb"},
+		"modules/ecs-service":         {},
+	}}
+	tests := map[string]string{
+		"vpc":         "examples/deploy-vpc",
+		"ecs service": "examples/deploy-ecs-service",
+		"alb":         "examples/deploy-alb",
+	}
+
+	decisions := Select(g, tests, []string{
+		"modules/ecs-service/main.tf",
+		"modules/alb/README.md",
+		"README.md",
+	})
+	require.Len(t, decisions, 3)
+
+	assert.Equal(t, "alb", decisions[0].Test)
+	assert.False(t, decisions[0].Selected)
+	assert.Equal(t, "none of examples/deploy-alb, modules/alb changed", decisions[0].Reason)
+
+	assert.Equal(t, "ecs service", decisions[1].Test)
+	assert.True(t, decisions[1].Selected)
+	assert.Equal(t, "modules/ecs-service changed (modules/ecs-service/main.tf)", decisions[1].Reason)
+
+	assert.Equal(t, "vpc", decisions[2].Test)
+	assert.False(t, decisions[2].Selected)
+
+	// A change to the harness selects every test
+	for _, d := range Select(g, tests, []string{"test/modules/vpc.go"}) {
+		assert.True(t, d.Selected, d.Test)
+		assert.Equal(t, "the test harness changed (test/modules/vpc.go)", d.Reason)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	run("init", "-q", "-b", "main")
+	writeFile(t, root, "modules/vpc/main.tf", "")
+	writeFile(t, root, "modules/alb/main.tf", "")
+	run("add", "-A")
+	run("commit", "-q", "-m", "base")
+
+	run("checkout", "-q", "-b", "feature")
+	writeFile(t, root, "modules/vpc/main.tf", "# committed")
+	run("commit", "-q", "-am", "change vpc")
+	writeFile(t, root, "modules/alb/main.tf", "# uncommitted")
+	writeFile(t, root, "modules/s3/main.tf", "# untracked")
+
+	files, err := ChangedFiles(root, "main")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modules/alb/main.tf", "modules/s3/main.tf", "modules/vpc/main.tf"}, files)
+
+	_, err = ChangedFiles(root, "does-not-exist")
+	assert.Error(t, err)
+}
+
+func writeFile(t *testing.T, root string, name string, content string) {
+	file := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+}
@@ -0,0 +1,164 @@
+package impact
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// BaseRefEnvVar is the git ref to select the tests against, all tests run when unset
+	BaseRefEnvVar = "TERRATEST_BASE_REF"
+
+	// ExplainEnvVar prints why each test is selected or skipped without running the tests
+	ExplainEnvVar = "TERRATEST_EXPLAIN"
+)
+
+// harnessDir holds the test harness, a change to it can affect any test
+const harnessDir = "test"
+
+// RepoRoot returns the root of the git repo of the working dir
+func RepoRoot() (string, error) {
+	out, err := git("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ChangedFiles returns the files that changed since the merge base of the ref and HEAD,
+// including the uncommitted and untracked files. The paths are relative to the root.
+func ChangedFiles(root string, baseRef string) ([]string, error) {
+	mergeBase, err := git(root, "merge-base", baseRef, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := git(root, "diff", "--name-only", strings.TrimSpace(mergeBase))
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	files := []string{}
+	for _, file := range strings.Fields(diff + "\n" + untracked) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Decision is whether a test is selected and why
+type Decision struct {
+	Test     string
+	Dir      string
+	Selected bool
+	Reason   string
+}
+
+// Select decides for each test, by name, whether the changed files affect its example dir
+func Select(g *Graph, tests map[string]string, changed []string) []Decision {
+	// Documentation does not change what is deployed
+	relevant := []string{}
+	for _, file := range changed {
+		if path.Ext(file) != ".md" {
+			relevant = append(relevant, file)
+		}
+	}
+
+	harness := []string{}
+	for _, file := range relevant {
+		if strings.HasPrefix(file, harnessDir+"/") {
+			harness = append(harness, file)
+		}
+	}
+
+	names := []string{}
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	decisions := []Decision{}
+	for _, name := range names {
+		dir := tests[name]
+		deps := g.Dependencies(dir)
+		d := Decision{Test: name, Dir: dir}
+
+		if len(harness) > 0 {
+			d.Selected = true
+			d.Reason = fmt.Sprintf("the test harness changed (%s)", summarize(harness))
+			decisions = append(decisions, d)
+			continue
+		}
+
+		for _, dep := range deps {
+			files := filesIn(relevant, dep)
+			if len(files) > 0 {
+				d.Selected = true
+				d.Reason = fmt.Sprintf("%s changed (%s)", dep, summarize(files))
+				break
+			}
+		}
+		if !d.Selected {
+			d.Reason = fmt.Sprintf("none of %s changed", strings.Join(deps, ", "))
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// filesIn returns the files in the dir
+func filesIn(files []string, dir string) []string {
+	in := []string{}
+	for _, file := range files {
+		if strings.HasPrefix(file, dir+"/") {
+			in = append(in, file)
+		}
+	}
+	return in
+}
+
+// summarize lists the first files and the number of the others
+func summarize(files []string) string {
+	const max = 3
+	if len(files) <= max {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:max], ", "), len(files)-max)
+}
+
+// Explain formats the decisions, one test per line
+func Explain(baseRef string, decisions []Decision) string {
+	lines := []string{fmt.Sprintf("Tests affected by the changes since %s:", baseRef)}
+	for _, d := range decisions {
+		verdict := "skip"
+		if d.Selected {
+			verdict = "run "
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s: %s", verdict, d.Test, d.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,246 @@
+// Package journal records the progress of each test in its working dir, so a test run
+// that is killed before its deferred destroy stage runs (i.e. by go test -timeout) can
+// be resumed or cleaned up by a later run. The journal is kept in .test-data next to
+// the saved Terraform options once the test starts to deploy, and is removed once the
+// destroy stage completes.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+const (
+	// ModeEnvVar selects how the tests treat the journals of earlier runs
+	ModeEnvVar = "TERRATEST_JOURNAL_MODE"
+
+	// ApplyStage deploys the resources of the test
+	ApplyStage = "apply"
+
+	// DestroyStage removes the resources of the test, the journal is removed when it completes
+	DestroyStage = "destroy"
+
+	fileName = "Journal.json"
+)
+
+// Mode is how the tests treat the journals of earlier runs
+type Mode string
+
+const (
+	// ModeNormal runs every stage
+	ModeNormal Mode = ""
+
+	// ModeResume skips the stages that an earlier run completed and always destroys
+	ModeResume Mode = "resume"
+
+	// ModeCleanupOnly only destroys the tests that an earlier run left a journal for
+	ModeCleanupOnly Mode = "cleanup-only"
+)
+
+// ModeFromEnv returns the mode set by ModeEnvVar
+func ModeFromEnv() (Mode, error) {
+	mode := Mode(os.Getenv(ModeEnvVar))
+	switch mode {
+	case ModeNormal, ModeResume, ModeCleanupOnly:
+		return mode, nil
+	}
+	return ModeNormal, fmt.Errorf("unknown %s %q, expected %q or %q", ModeEnvVar, mode, ModeResume, ModeCleanupOnly)
+}
+
+// Stage is the progress of a test stage
+type Stage struct {
+	Started   time.Time  `json:"started"`
+	Completed *time.Time `json:"completed,omitempty"`
+}
+
+// Journal is the progress of a test in its working dir
+type Journal struct {
+	Test       string `json:"test"`
+	WorkingDir string `json:"working_dir"`
+	RunId      string `json:"run_id,omitempty"`
+	Region     string `json:"region,omitempty"`
+
+	// UniqueId is the random_id that the resources of the test are named with
+	UniqueId string `json:"unique_id,omitempty"`
+
+	// StateFile is the local Terraform state of the deployed resources
+	StateFile string `json:"state_file"`
+
+	Stages  map[string]*Stage `json:"stages"`
+	Updated time.Time         `json:"updated"`
+
+	path    string
+	found   bool
+	removed bool
+
+	// deployed is true once the apply stage started, the stages before it (i.e. the plan
+	// stage) deploy nothing and are only kept in memory
+	deployed bool
+
+	// mu guards the journal, the teardown destroys the test from another goroutine
+	mu sync.Mutex
+}
+
+// Path returns the path of the journal of the working dir
+func Path(workingDir string) string {
+	return test_structure.FormatTestDataPath(workingDir, fileName)
+}
+
+// Open returns the journal that an earlier run left in the working dir, or a new
+// journal for the test that is only written once the deployment starts
+func Open(test string, workingDir string) (*Journal, error) {
+	path := Path(workingDir)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		stateFile, err := filepath.Abs(filepath.Join(workingDir, "terraform.tfstate"))
+		if err != nil {
+			return nil, err
+		}
+		return &Journal{
+			Test:       test,
+			WorkingDir: workingDir,
+			StateFile:  stateFile,
+			Stages:     map[string]*Stage{},
+			path:       path,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("unable to read the journal %s: %w", path, err)
+	}
+	if j.Stages == nil {
+		j.Stages = map[string]*Stage{}
+	}
+	j.path = path
+	j.found = true
+	j.deployed = true
+	return j, nil
+}
+
+// Found returns true if the journal was left by an earlier run that did not complete
+// its destroy stage
+func (j *Journal) Found() bool {
+	return j.found
+}
+
+// Started returns true if the stage was started
+func (j *Journal) Started(stage string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, ok := j.Stages[stage]
+	return ok
+}
+
+// Completed returns true if the stage completed
+func (j *Journal) Completed(stage string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	s, ok := j.Stages[stage]
+	return ok && s.Completed != nil
+}
+
+// ShouldRun returns true if the stage runs in the mode
+func (j *Journal) ShouldRun(mode Mode, stage string) bool {
+	switch mode {
+	case ModeResume:
+		// Destroy is never skipped, a completed destroy removes the journal
+		return stage == DestroyStage || !j.Completed(stage)
+	case ModeCleanupOnly:
+		return stage == DestroyStage && j.found
+	}
+	return true
+}
+
+// SetDeployment records where the resources of the test are deployed
+func (j *Journal) SetDeployment(region string, uniqueId string, runId string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Region = region
+	j.UniqueId = uniqueId
+	j.RunId = runId
+	j.deployed = true
+	return j.save()
+}
+
+// StartStage records that the stage started. Starting the apply stage starts the
+// deployment, from then on the journal is written to the working dir.
+func (j *Journal) StartStage(stage string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Stages[stage] = &Stage{Started: time.Now().UTC()}
+	if stage == ApplyStage {
+		j.deployed = true
+	}
+	return j.save()
+}
+
+// CompleteStage records that the stage completed. Completing the destroy stage
+// removes the journal, there is nothing left to resume.
+func (j *Journal) CompleteStage(stage string) error {
+	if stage == DestroyStage {
+		return j.Remove()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	s, ok := j.Stages[stage]
+	if !ok {
+		return fmt.Errorf("stage %s completed before it started", stage)
+	}
+	completed := time.Now().UTC()
+	s.Completed = &completed
+	return j.save()
+}
+
+// Remove removes the journal from the working dir, it is not written again
+func (j *Journal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.removed = true
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// save writes the journal to a temporary file and renames it, so a run that is killed
+// while the journal is written leaves the previous journal intact. Nothing is written
+// before the deployment starts, there is nothing to resume or clean up.
+func (j *Journal) save() error {
+	if j.removed || !j.deployed {
+		return nil
+	}
+	j.Updated = time.Now().UTC()
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
@@ -0,0 +1,128 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalSurvivesInterruptedRun(t *testing.T) {
+	workingDir := t.TempDir()
+
+	j, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+	assert.False(t, j.Found())
+
+	// Nothing is written until the deployment starts
+	require.NoError(t, j.StartStage("plan"))
+	require.NoError(t, j.CompleteStage("plan"))
+	_, err = os.Stat(Path(workingDir))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, j.StartStage(ApplyStage))
+	require.NoError(t, j.SetDeployment("us-east-2", "abc123", "local-xyz"))
+
+	// The run is killed during the apply stage
+	resumed, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+	assert.True(t, resumed.Found())
+	assert.Equal(t, "TestExamples/vpc", resumed.Test)
+	assert.Equal(t, "us-east-2", resumed.Region)
+	assert.Equal(t, "abc123", resumed.UniqueId)
+	assert.Equal(t, "local-xyz", resumed.RunId)
+	assert.Equal(t, filepath.Join(workingDir, "terraform.tfstate"), resumed.StateFile)
+	assert.True(t, resumed.Completed("plan"))
+	assert.True(t, resumed.Started(ApplyStage))
+	assert.False(t, resumed.Completed(ApplyStage))
+	assert.False(t, resumed.Started("validate"))
+}
+
+func TestCompletingDestroyRemovesJournal(t *testing.T) {
+	workingDir := t.TempDir()
+
+	j, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+	require.NoError(t, j.StartStage(DestroyStage))
+
+	// The destroy stage can remove .test-data itself before it completes
+	require.NoError(t, os.RemoveAll(filepath.Dir(Path(workingDir))))
+	require.NoError(t, j.CompleteStage(DestroyStage))
+
+	j, err = Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+	assert.False(t, j.Found())
+}
+
+func TestPlanOnlyRunLeavesNoJournal(t *testing.T) {
+	workingDir := t.TempDir()
+
+	j, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+	require.NoError(t, j.StartStage("plan"))
+	require.NoError(t, j.CompleteStage("plan"))
+	require.NoError(t, j.StartStage(DestroyStage))
+
+	_, err = os.Stat(filepath.Dir(Path(workingDir)))
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, j.CompleteStage(DestroyStage))
+}
+
+func TestShouldRun(t *testing.T) {
+	workingDir := t.TempDir()
+
+	fresh, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+
+	require.NoError(t, fresh.StartStage("plan"))
+	require.NoError(t, fresh.CompleteStage("plan"))
+	require.NoError(t, fresh.StartStage(ApplyStage))
+	require.NoError(t, fresh.CompleteStage(ApplyStage))
+	require.NoError(t, fresh.StartStage("validate"))
+
+	interrupted, err := Open("TestExamples/vpc", workingDir)
+	require.NoError(t, err)
+
+	other, err := Open("TestExamples/alb", t.TempDir())
+	require.NoError(t, err)
+
+	stages := []string{"plan", ApplyStage, "validate", DestroyStage}
+	tests := []struct {
+		name    string
+		journal *Journal
+		mode    Mode
+		want    []bool
+	}{
+		{"normal", interrupted, ModeNormal, []bool{true, true, true, true}},
+		{"resume", interrupted, ModeResume, []bool{false, false, true, true}},
+		{"resume without journal", other, ModeResume, []bool{true, true, true, true}},
+		{"cleanup only", interrupted, ModeCleanupOnly, []bool{false, false, false, true}},
+		{"cleanup only without journal", other, ModeCleanupOnly, []bool{false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, stage := range stages {
+				assert.Equal(t, tt.want[i], tt.journal.ShouldRun(tt.mode, stage), stage)
+			}
+		})
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	t.Setenv(ModeEnvVar, "resume")
+	mode, err := ModeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ModeResume, mode)
+
+	t.Setenv(ModeEnvVar, "")
+	mode, err = ModeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ModeNormal, mode)
+
+	t.Setenv(ModeEnvVar, "destroy")
+	_, err = ModeFromEnv()
+	assert.Error(t, err)
+}
@@ -1,17 +1,16 @@
 package modules
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 	"testing"
 	"time"
 
-	aws_sdk "github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/elbv2"
-	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
@@ -22,9 +21,8 @@ func DeployAlb(t *testing.T, workingDir string) {
 	// Generate a unique ID
 	uniqueId := strings.ToLower(random.UniqueId())
 
-	// Get a random AWS region
-	awsRegion := aws.GetRandomStableRegion(t, []string{"us-east-1", "us-east-2"}, nil)
-	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
 
 	// Construct the terraform options with default retryable errors to handle the most common retryable errors in
 	// terraform testing.
@@ -41,24 +39,15 @@ func DeployAlb(t *testing.T, workingDir string) {
 	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
 }
 
-func ValidateAlbNoHttps(t *testing.T, workingDir string) {
-	// Connect to aws using aws sdk
-	session, err := session.NewSession()
-	if err != nil {
-		t.Fatal(err)
-	}
-
+func ValidateAlbNoHttps(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	// Load the Terraform Options saved by the earlier deploy_terraform stage
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
 
 	// Get the random id
 	expectedAlbName := terraform.Output(t, terraformOptions, "alb_name")
 
-	elb := elbv2.New(session, &aws_sdk.Config{Region: aws_sdk.String(awsRegion)})
-
 	// Check that the alb exists
-	lb := assertAlbExists(t, elb, awsRegion, expectedAlbName)
+	lb := assertAlbExists(t, clients.Elbv2(), expectedAlbName)
 
 	// Check that the alb returns a 404 when we try to access it
 	dnsName := terraform.Output(t, terraformOptions, "alb_dns_name")
@@ -68,23 +57,14 @@ func ValidateAlbNoHttps(t *testing.T, workingDir string) {
 	assertAlbOutputs(t, terraformOptions, lb, false)
 }
 
-func ValidateAlbHttps(t *testing.T, workingDir string) {
-	// Connect to aws using aws sdk
-	session, err := session.NewSession()
-	if err != nil {
-		t.Fatal(err)
-	}
-
+func ValidateAlbHttps(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	// Load the Terraform Options saved by the earlier deploy_terraform stage
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
 
 	expectedAlbName := terraform.Output(t, terraformOptions, "alb_name")
 
-	elb := elbv2.New(session, &aws_sdk.Config{Region: aws_sdk.String(awsRegion)})
-
 	// Check that the alb exists
-	lb := assertAlbExists(t, elb, awsRegion, expectedAlbName)
+	lb := assertAlbExists(t, clients.Elbv2(), expectedAlbName)
 
 	// Check that the alb returns a 404 when we try to access it
 	dnsRecName := terraform.Output(t, terraformOptions, "alb_dns_record_name")
@@ -94,7 +74,7 @@ func ValidateAlbHttps(t *testing.T, workingDir string) {
 	assertAlbOutputs(t, terraformOptions, lb, true)
 }
 
-func assertAlbOutputs(t *testing.T, terraformOptions *terraform.Options, lb *elbv2.LoadBalancer, isHttps bool) {
+func assertAlbOutputs(t *testing.T, terraformOptions *terraform.Options, lb *types.LoadBalancer, isHttps bool) {
 	// Check that the alb arn is the same as the output
 	albArn := terraform.Output(t, terraformOptions, "alb_arn")
 	assert.Equal(t, albArn, *lb.LoadBalancerArn, "Expected alb arn to be %s, got %s", albArn, *lb.LoadBalancerArn)
@@ -110,7 +90,7 @@ func assertAlbOutputs(t *testing.T, terraformOptions *terraform.Options, lb *elb
 	// Check the alb security group id
 	assert.True(t, lb.SecurityGroups != nil, "Expected alb security group id to not be nil")
 	assert.True(t, len(lb.SecurityGroups) == 1, "Expected alb security group id to have 1 security group")
-	assert.Equal(t, terraform.Output(t, terraformOptions, "alb_security_group_id"), *lb.SecurityGroups[0], "Expected alb security group id to be %s, got %s", terraform.Output(t, terraformOptions, "alb_security_group_id"), *lb.SecurityGroups[0])
+	assert.Equal(t, terraform.Output(t, terraformOptions, "alb_security_group_id"), lb.SecurityGroups[0], "Expected alb security group id to be %s, got %s", terraform.Output(t, terraformOptions, "alb_security_group_id"), lb.SecurityGroups[0])
 
 	if isHttps {
 		// Check alb zone id
@@ -124,48 +104,30 @@ func assertAlbOutputs(t *testing.T, terraformOptions *terraform.Options, lb *elb
 }
 
 func assertAlbReturns404(t *testing.T, route string) {
-	// Wait a minute for the alb to be ready
-	time.Sleep(1 * time.Minute)
-	// Hit the alb
-	res, err := http.Get(route)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Check that the status code is 404
-	if res.StatusCode != 404 {
-		t.Fatalf("Expected status code 404, got %d", res.StatusCode)
-	}
-
-	// Check that the message body is "404 not found"
-	if res.Body == nil {
-		t.Fatal("Expected body to not be nil")
-	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
+	// Wait for the alb to be ready, its DNS name takes a while to resolve
+	err := waitForHttpGet(t, route, 5*time.Minute, waiter.DefaultBackoff, func(statusCode int, body string) error {
+		// Check that the status code is 404 and the message body is "404 Not Found"
+		if statusCode != 404 || body != "404 Not Found" {
+			return fmt.Errorf("expected status code 404 and body '404 Not Found', got %d and '%s'", statusCode, body)
+		}
+		return nil
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if string(body[:]) != "404 Not Found" {
-		t.Fatalf("Expected body to be '404 Not Found', got %s", string(body[:]))
-	}
 }
 
-func assertAlbExists(t *testing.T, elb *elbv2.ELBV2, awsRegion string, expectedAlbName string) *elbv2.LoadBalancer {
-	output, err := elb.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
-		Names: []*string{
-			aws_sdk.String(expectedAlbName),
-		},
+func assertAlbExists(t *testing.T, client elbv2API, expectedAlbName string) *types.LoadBalancer {
+	output, err := client.DescribeLoadBalancers(context.TODO(), &elasticloadbalancingv2.DescribeLoadBalancersInput{
+		Names: []string{expectedAlbName},
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(output)
-
 	if len(output.LoadBalancers) != 1 {
 		t.Fatalf("Expected 1 alb, got %d", len(output.LoadBalancers))
 	}
+	t.Logf("The alb is: %s", *output.LoadBalancers[0].LoadBalancerArn)
 
-	return output.LoadBalancers[0]
+	return &output.LoadBalancers[0]
 }
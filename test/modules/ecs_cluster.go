@@ -1,11 +1,16 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -16,9 +21,8 @@ import (
 func DeployEcsClusterUsingTerraform(t *testing.T, workingDir string) {
 	// Generate a unique ID
 	uniqueId := random.UniqueId()
-	// Get a random AWS region
-	awsRegion := aws.GetRandomStableRegion(t, []string{"us-east-1", "us-east-2"}, nil)
-	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
 	// Get a ECS AMI
 	amiId := aws.GetEcsOptimizedAmazonLinuxAmi(t, awsRegion)
 	// Construct the terraform options with default retryable errors to handle the most common retryable errors in
@@ -37,10 +41,10 @@ func DeployEcsClusterUsingTerraform(t *testing.T, workingDir string) {
 	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
 }
 
-func ValidateEcsCluster(t *testing.T, workingDir string) {
+func ValidateEcsCluster(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	// Load the Terraform Options saved by the earlier deploy_terraform stage
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
+	client := clients.Ecs()
 
 	// Get the random id
 	randomId := terraformOptions.Vars["random_id"].(string)
@@ -48,10 +52,10 @@ func ValidateEcsCluster(t *testing.T, workingDir string) {
 	expectedClusterName := terraform.Output(t, terraformOptions, "ecs_cluster_name")
 
 	// Check that the cluster exists
-	cluster := assertClusterExists(t, awsRegion, expectedClusterName)
+	cluster := assertClusterExists(t, client, expectedClusterName)
 
 	// Check the status of the cluster
-	assertClusterStatusIsActive(t, cluster, expectedClusterName, awsRegion)
+	assertClusterStatusIsActive(t, client, cluster, expectedClusterName)
 
 	// Check the capacity providers
 	assertCapacityProvidersExist(t, cluster)
@@ -60,75 +64,124 @@ func ValidateEcsCluster(t *testing.T, workingDir string) {
 	assertDefaultCapacityProviderStrategyIsClusterName(t, cluster, randomId)
 
 	// Check Registered Container Instances
-	assertRegsiteredContainerInstancesIsGreaterThanZero(t, cluster, awsRegion, expectedClusterName)
+	assertRegsiteredContainerInstancesIsGreaterThanZero(t, client, cluster, expectedClusterName)
 }
 
-func assertClusterExists(t *testing.T, awsRegion string, expectedClusterName string) *ecs.Cluster {
+// ValidateEcsClusterPlan validates the plan of the ECS cluster example without
+// deploying it. The cluster is expected to use an EC2 capacity provider backed
+// by an auto scaling group alongside FARGATE.
+func ValidateEcsClusterPlan(t *testing.T, workingDir string) {
+	plan := planUsingTerraform(t, workingDir, map[string]interface{}{
+		"random_id":            "plan",
+		"region":               planRegion,
+		"cluster_instance_ami": "ami-00000000000000000",
+	})
+
+	assertPlanOnlyCreates(t, plan)
+
+	// Check the cluster name
+	assertPlannedAttribute(t, plan, "module.cluster.aws_ecs_cluster.cluster", "name", "cluster-testplan")
+
+	// Check the capacity providers
+	capacityProviders := plannedAttribute(t, plan, "module.cluster.aws_ecs_cluster_capacity_providers.cluster", "capacity_providers")
+	assert.ElementsMatch(t, []interface{}{"FARGATE", "cluster-testplan-cp"}, capacityProviders, "Capacity providers do not contain FARGATE and the cluster capacity provider")
+
+	// Check the auto scaling group uses the example's max size
+	assertPlannedAttribute(t, plan, "module.cluster.aws_autoscaling_group.cluster", "max_size", float64(2))
+
+	// Check that no auto scaling notifications are planned without sns topics
+	assertResourceCount(t, plan, "module.cluster.aws_autoscaling_notification.cluster", 0)
+}
+
+func assertClusterExists(t *testing.T, client ecsAPI, expectedClusterName string) *types.Cluster {
 	// Get the cluster
-	cluster := aws.GetEcsCluster(t, awsRegion, expectedClusterName)
-	// Assert that it exists
-	assert.NotNil(t, cluster, "Cluster recieved from AWS with name: %s is nil", expectedClusterName)
+	cluster, err := describeEcsCluster(client, expectedClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// Print the cluster
-	t.Logf("The cluster is: %s", cluster.String())
+	t.Logf("The cluster is: %s", aws_sdk.ToString(cluster.ClusterArn))
 
 	return cluster
 }
 
-func assertClusterStatusIsActive(t *testing.T, cluster *ecs.Cluster, expectedClusterName string, awsRegion string) {
-	status := cluster.Status
-	t.Logf("The cluster status is: %s", *status)
-	startTime := time.Now()
-	timeout := 5 * time.Minute
-	// Wait for the cluster status to no longer be PROVISIONING
-	for *status == "PROVISIONING" && time.Since(startTime) < timeout {
-		cluster = aws.GetEcsCluster(t, awsRegion, expectedClusterName)
-		status = cluster.Status
-		// Sleep for 5 seconds
-		t.Logf("Waiting for cluster to be ACTIVE, currently: %s", *status)
-		time.Sleep(5 * time.Second)
+// describeEcsCluster returns the cluster, like GetEcsClusterE from terratest but with
+// the client that the validators were given
+func describeEcsCluster(client ecsAPI, clusterName string) (*types.Cluster, error) {
+	output, err := client.DescribeClusters(context.TODO(), &ecs.DescribeClustersInput{
+		Clusters: []string{clusterName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Clusters) != 1 {
+		return nil, fmt.Errorf("expected 1 cluster %s, found %d", clusterName, len(output.Clusters))
 	}
+	return &output.Clusters[0], nil
+}
+
+func assertClusterStatusIsActive(t *testing.T, client ecsAPI, cluster *types.Cluster, expectedClusterName string) {
+	status := aws_sdk.ToString(cluster.Status)
+	t.Logf("The cluster status is: %s", status)
+
+	// Wait for the cluster status to no longer be PROVISIONING
+	err := waiter.For(t, fmt.Sprintf("cluster %s to be ACTIVE", expectedClusterName), 5*time.Minute, func(ctx context.Context) error {
+		cluster, err := describeEcsCluster(client, expectedClusterName)
+		if err != nil {
+			return err
+		}
+		status = aws_sdk.ToString(cluster.Status)
+
+		switch status {
+		case "ACTIVE":
+			return nil
+		case "PROVISIONING":
+			return fmt.Errorf("cluster status is %s", status)
+		}
+		return waiter.Stop(fmt.Errorf("cluster status is %s", status))
+	})
+
 	// Assert that the cluster is active
-	assert.Equal(t, "ACTIVE", *status, "Cluster status is not ACTIVE, currently: %s", *status)
+	assert.NoError(t, err, "Cluster status is not ACTIVE, currently: %s", status)
 }
 
-func assertCapacityProvidersExist(t *testing.T, cluster *ecs.Cluster) {
+func assertCapacityProvidersExist(t *testing.T, cluster *types.Cluster) {
 	capacityProviders := cluster.CapacityProviders
 	containsFargate := false
 	for _, cp := range capacityProviders {
-		t.Logf("Capacity provider: %s", *cp)
-		if *cp == "FARGATE" {
+		t.Logf("Capacity provider: %s", cp)
+		if cp == "FARGATE" {
 			containsFargate = true
 		}
 	}
 	assert.True(t, containsFargate, "Capacity providers does not contain FARGATE")
 }
 
-func assertDefaultCapacityProviderStrategyIsClusterName(t *testing.T, cluster *ecs.Cluster, randomId string) {
+func assertDefaultCapacityProviderStrategyIsClusterName(t *testing.T, cluster *types.Cluster, randomId string) {
 	defaultCapacityProviderStrategy := cluster.DefaultCapacityProviderStrategy
 	expectedDcps := fmt.Sprintf("cluster-test%s-cp", randomId)
 	assert.Equal(t, 1, len(defaultCapacityProviderStrategy), "Default capacity provider strategy does not have length 1")
 	assert.Equal(t, expectedDcps, *defaultCapacityProviderStrategy[0].CapacityProvider, "Default capacity provider strategy does not have the expected capacity provider")
 }
 
-func assertRegsiteredContainerInstancesIsGreaterThanZero(t *testing.T, cluster *ecs.Cluster, awsRegion string, expectedClusterName string) {
-	// Every 30 seconds, check the number of registered container instances, fail after 10 minutes
-	// If its not greater than 0, fail the test
-	startTime := time.Now()
-	timeout := 10 * time.Minute
-
-	// Get the number of registered container instances
+func assertRegsiteredContainerInstancesIsGreaterThanZero(t *testing.T, client ecsAPI, cluster *types.Cluster, expectedClusterName string) {
 	registeredContainerInstances := cluster.RegisteredContainerInstancesCount
-	for *registeredContainerInstances < 1 {
-		t.Logf("The number of registered container instances is: %d. Sleeping for 30 seconds...", *registeredContainerInstances)
-		time.Sleep(30 * time.Second)
-		cluster = aws.GetEcsCluster(t, awsRegion, expectedClusterName)
-		registeredContainerInstances = cluster.RegisteredContainerInstancesCount
-		t.Logf("Current registered container instances: %d", *registeredContainerInstances)
+	t.Logf("The number of registered container instances is: %d", registeredContainerInstances)
 
-		if time.Since(startTime) > timeout {
-			t.Fatalf("Timed out waiting for registered container instances to be greater than 0")
+	// Wait up to 10 minutes for the auto scaling group to register an instance
+	err := waiter.For(t, fmt.Sprintf("container instances to register with %s", expectedClusterName), 10*time.Minute, func(ctx context.Context) error {
+		cluster, err := describeEcsCluster(client, expectedClusterName)
+		if err != nil {
+			return err
 		}
+		registeredContainerInstances = cluster.RegisteredContainerInstancesCount
+		if registeredContainerInstances < 1 {
+			return fmt.Errorf("%d registered container instances", registeredContainerInstances)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Timed out waiting for registered container instances to be greater than 0: %s", err)
 	}
-
-	assert.True(t, *registeredContainerInstances > 0, "Number of registered container instances is not greater than 0, currently: %d", *registeredContainerInstances)
+	t.Logf("Current registered container instances: %d", registeredContainerInstances)
 }
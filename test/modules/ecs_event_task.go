@@ -0,0 +1,240 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ValidateEcsEventTask validates the ECS service module deployed as an
+// event driven task with the following assertions:
+// - The EventBridge rule is enabled with an event pattern
+// - The rule targets the cluster with a FARGATE task in the public subnets
+// - The rule assumes a role that allows EventBridge to run the task
+// - An event built from the pattern matches the pattern locally
+// - Publishing the event launches a task from the deployed task definition revision
+// - The task stops with an exit code of 0
+//
+// The example is deployed with DeployEcsScheduledTaskUsingTerraform.
+func ValidateEcsEventTask(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	// Load the Terraform Options saved by the earlier deploy_terraform stage
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+	eventbridgeClient := clients.EventBridge()
+	ecsClient := clients.Ecs()
+
+	// Get outputs for assertions
+	clusterArn := terraform.Output(t, terraformOptions, "ecs_cluster_arn")
+	clusterName := terraform.Output(t, terraformOptions, "ecs_cluster_name")
+	subnetIds := terraform.OutputList(t, terraformOptions, "public_subnet_ids")
+	ruleName := terraform.Output(t, terraformOptions, "ecs_task_event_rule_name")
+	taskDefinitionArn := terraform.Output(t, terraformOptions, "ecs_task_definition_arn")
+
+	// Check the rule and its target
+	rule := assertEventRuleIsEnabled(t, eventbridgeClient, ruleName)
+	require.NotEmpty(t, awssdk.ToString(rule.EventPattern), "Expected rule %s to have an event pattern", ruleName)
+	assert.Empty(t, awssdk.ToString(rule.ScheduleExpression), "Expected rule %s to not be scheduled", ruleName)
+
+	target := assertEcsScheduledTaskTarget(t, eventbridgeClient, ruleName, clusterArn, taskDefinitionArn, subnetIds)
+	assertEcsScheduledTaskRoleCanRunTask(t, clients.Iam(), awssdk.ToString(target.RoleArn), taskDefinitionArn)
+
+	// Build an event that matches the pattern and check it
+	// locally before publishing it to the default event bus
+	entry := buildEventFromRulePattern(t, clients.Sts(), clients.Region(), ruleName, awssdk.ToString(rule.EventPattern))
+	publishedAt := putEvent(t, eventbridgeClient, entry)
+
+	// Check that the event launches the deployed task definition revision
+	task := waitForEcsTaskToLaunch(t, ecsClient, clusterName, taskDefinitionArn, publishedAt)
+	assert.Equal(t, taskDefinitionArn, awssdk.ToString(task.TaskDefinitionArn), "Expected the event to launch task definition %s", taskDefinitionArn)
+
+	// Check that the task launched by the event runs successfully
+	task = waitForEcsTaskArnToStop(t, ecsClient, clusterName, awssdk.ToString(task.TaskArn))
+	assertEcsTaskExitedSuccessfully(t, task)
+}
+
+// buildEventFromRulePattern builds a PutEvents entry for an event that matches the
+// event pattern of the rule. The event is matched against the pattern locally with
+// the fields that EventBridge sets on published events, so an event that the rule
+// would not deliver fails the test with the fields that do not match.
+func buildEventFromRulePattern(t *testing.T, stsClient stsAPI, awsRegion string, ruleName string, pattern string) *eventbridgetypes.PutEventsRequestEntry {
+	event, err := util.BuildEventFromPattern(pattern)
+	require.NoError(t, err, "Unable to build an event from the pattern of rule %s: %s", ruleName, pattern)
+
+	// PutEvents requires the source, detail type and detail
+	source, ok := eventStringField(event, "source", "terraform-test")
+	require.True(t, ok, "Expected the source of rule %s to be a string, got %v", ruleName, event["source"])
+	require.False(t, strings.HasPrefix(source, "aws."), "Events with the source %s cannot be published, rule %s can only be triggered by AWS", source, ruleName)
+
+	detailType, ok := eventStringField(event, "detail-type", "terraform-test")
+	require.True(t, ok, "Expected the detail-type of rule %s to be a string, got %v", ruleName, event["detail-type"])
+
+	detail, ok := event["detail"]
+	if !ok {
+		detail = map[string]interface{}{}
+	}
+	detailJSON, err := json.Marshal(detail)
+	require.NoError(t, err)
+
+	resources := []string{}
+	if values, ok := event["resources"].([]interface{}); ok {
+		for _, value := range values {
+			resources = append(resources, fmt.Sprint(value))
+		}
+	} else if value, ok := event["resources"]; ok {
+		resources = append(resources, fmt.Sprint(value))
+	}
+
+	// The events are published to the account of the caller
+	identity, err := stsClient.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	require.NoError(t, err, "Error getting the caller identity")
+
+	// The envelope of the event that EventBridge matches against the rule
+	envelope, err := json.Marshal(map[string]interface{}{
+		"version":     "0",
+		"id":          random.UniqueId(),
+		"source":      source,
+		"detail-type": detailType,
+		"account":     awssdk.ToString(identity.Account),
+		"region":      awsRegion,
+		"time":        time.Now().UTC().Format(time.RFC3339),
+		"resources":   resources,
+		"detail":      detail,
+	})
+	require.NoError(t, err)
+
+	mismatches, err := util.MatchEventPattern(pattern, string(envelope))
+	require.NoError(t, err, "Invalid event pattern for rule %s: %s", ruleName, pattern)
+	if len(mismatches) > 0 {
+		t.Fatalf("Event does not match the pattern of rule %s\npattern: %s\nevent:   %s\n%s", ruleName, pattern, envelope, strings.Join(mismatches, "\n"))
+	}
+
+	return &eventbridgetypes.PutEventsRequestEntry{
+		Source:     &source,
+		DetailType: &detailType,
+		Detail:     awssdk.String(string(detailJSON)),
+		Resources:  resources,
+	}
+}
+
+// eventStringField returns the string field of the event or the default when the
+// pattern does not filter the field
+func eventStringField(event map[string]interface{}, key string, defaultValue string) (string, bool) {
+	value, ok := event[key]
+	if !ok {
+		return defaultValue, true
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// putEvent publishes the event to the default event bus and returns when it was published
+func putEvent(t *testing.T, client eventbridgeAPI, entry *eventbridgetypes.PutEventsRequestEntry) time.Time {
+	publishedAt := time.Now()
+	output, err := client.PutEvents(context.TODO(), &eventbridge.PutEventsInput{
+		Entries: []eventbridgetypes.PutEventsRequestEntry{*entry},
+	})
+	require.NoError(t, err, "Error publishing event")
+
+	if output.FailedEntryCount > 0 {
+		result := output.Entries[0]
+		t.Fatalf("Failed to publish event: %s: %s", awssdk.ToString(result.ErrorCode), awssdk.ToString(result.ErrorMessage))
+	}
+
+	t.Logf("Published %s event %s", awssdk.ToString(entry.DetailType), awssdk.ToString(output.Entries[0].EventId))
+	return publishedAt
+}
+
+// waitForEcsTaskToLaunch waits for an EventBridge rule to launch a task of the task
+// definition's family after the time and returns it. Tasks of any revision of the
+// family are returned, so a rule that runs a stale revision can be detected.
+func waitForEcsTaskToLaunch(t *testing.T, client ecsAPI, clusterName string, taskDefinitionArn string, after time.Time) *ecstypes.Task {
+	taskDefinition, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: &taskDefinitionArn,
+	})
+	require.NoError(t, err, "Error describing task definition %s", taskDefinitionArn)
+	family := taskDefinition.TaskDefinition.Family
+
+	// Allow for clock skew between the test and ECS
+	after = after.Add(-1 * time.Minute)
+
+	var launched *ecstypes.Task
+	err = waiter.For(t, fmt.Sprintf("a task of %s to be launched by the event", *family), 5*time.Minute, func(ctx context.Context) error {
+		taskArns := []string{}
+		for _, desiredStatus := range []ecstypes.DesiredStatus{ecstypes.DesiredStatusRunning, ecstypes.DesiredStatusStopped} {
+			tasks, err := client.ListTasks(ctx, &ecs.ListTasksInput{
+				Cluster:       &clusterName,
+				Family:        family,
+				DesiredStatus: desiredStatus,
+			})
+			if err != nil {
+				return err
+			}
+			taskArns = append(taskArns, tasks.TaskArns...)
+		}
+		if len(taskArns) == 0 {
+			return fmt.Errorf("no tasks of %s have launched yet", *family)
+		}
+
+		described, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterName,
+			Tasks:   taskArns,
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, task := range described.Tasks {
+			if strings.HasPrefix(awssdk.ToString(task.StartedBy), "events-rule/") && task.CreatedAt != nil && task.CreatedAt.After(after) {
+				launched = &described.Tasks[i]
+				return nil
+			}
+		}
+
+		return fmt.Errorf("no tasks of %s have been launched by the event yet", *family)
+	})
+	require.NoError(t, err)
+	return launched
+}
+
+// waitForEcsTaskArnToStop waits up to 10 minutes for the task to stop and returns it
+func waitForEcsTaskArnToStop(t *testing.T, client ecsAPI, clusterName string, taskArn string) *ecstypes.Task {
+	var stopped *ecstypes.Task
+	err := waiter.For(t, fmt.Sprintf("task %s to stop", taskArn), 10*time.Minute, func(ctx context.Context) error {
+		described, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterName,
+			Tasks:   []string{taskArn},
+		})
+		if err != nil {
+			return err
+		}
+		if len(described.Tasks) != 1 {
+			return waiter.Stop(fmt.Errorf("expected task %s in cluster %s, found %d tasks", taskArn, clusterName, len(described.Tasks)))
+		}
+
+		task := described.Tasks[0]
+		if status := awssdk.ToString(task.LastStatus); status != string(ecstypes.DesiredStatusStopped) {
+			return fmt.Errorf("task is %s", status)
+		}
+		stopped = &task
+		return nil
+	})
+	require.NoError(t, err)
+	return stopped
+}
@@ -0,0 +1,352 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func DeployEcsScheduledTaskUsingTerraform(t *testing.T, workingDir string) {
+	// Generate unique ID
+	uniqueId := strings.ToLower(random.UniqueId())
+
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
+
+	// Get a ECS AMI
+	amiId := aws.GetEcsOptimizedAmazonLinuxAmi(t, awsRegion)
+
+	// Construct the terraform options with default retryable errors to handle the most common retryable errors in
+	// terraform testing.
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: workingDir,
+		Vars: map[string]interface{}{
+			"random_id":            uniqueId,
+			"region":               awsRegion,
+			"cluster_instance_ami": amiId,
+		},
+	})
+
+	// Save the options so later test stages can use them
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// ValidateEcsScheduledTask validates the ECS service module deployed as
+// scheduled tasks with the following assertions:
+// - The EventBridge rules are enabled with the rate and cron expressions
+// - The rules target the cluster with a FARGATE task in the public subnets
+// - The rules assume a role that allows EventBridge to run the task
+// - The rules invoke RunTask at least once
+// - The tasks are placed, run and stop with an exit code of 0
+func ValidateEcsScheduledTask(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	wg := &sync.WaitGroup{}
+
+	// Load the Terraform Options saved by the earlier deploy_terraform stage
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+	eventbridgeClient := clients.EventBridge()
+	ecsClient := clients.Ecs()
+	iamClient := clients.Iam()
+	cloudwatchClient := clients.CloudWatch()
+
+	// Get outputs for assertions
+	clusterArn := terraform.Output(t, terraformOptions, "ecs_cluster_arn")
+	clusterName := terraform.Output(t, terraformOptions, "ecs_cluster_name")
+	subnetIds := terraform.OutputList(t, terraformOptions, "public_subnet_ids")
+
+	scheduledTasks := map[string]string{
+		"expression": "rate(2 minutes)",
+		"cron":       "cron(0/2 * * * ? *)",
+	}
+
+	// The scheduled tasks run every 2 minutes,
+	// so they are waited on in parallel
+	wg.Add(len(scheduledTasks))
+	for prefix, scheduleExpression := range scheduledTasks {
+		ruleName := terraform.Output(t, terraformOptions, prefix+"_ecs_task_event_rule_name")
+		taskDefinitionArn := terraform.Output(t, terraformOptions, prefix+"_ecs_task_definition_arn")
+
+		go func(ruleName string, taskDefinitionArn string, scheduleExpression string) {
+			defer wg.Done()
+
+			// Check the rule and its target
+			rule := assertEventRuleIsEnabled(t, eventbridgeClient, ruleName)
+			assert.Equal(t, scheduleExpression, awssdk.ToString(rule.ScheduleExpression), "Expected rule %s to be scheduled by %s", ruleName, scheduleExpression)
+
+			target := assertEcsScheduledTaskTarget(t, eventbridgeClient, ruleName, clusterArn, taskDefinitionArn, subnetIds)
+			assertEcsScheduledTaskRoleCanRunTask(t, iamClient, awssdk.ToString(target.RoleArn), taskDefinitionArn)
+
+			// Check that the rule runs the task
+			assertEventRuleIsInvoked(t, cloudwatchClient, ruleName)
+			task := waitForEcsTaskToStop(t, ecsClient, clusterName, taskDefinitionArn)
+			assertEcsTaskExitedSuccessfully(t, task)
+		}(ruleName, taskDefinitionArn, scheduleExpression)
+	}
+
+	wg.Wait()
+}
+
+// assertEventRuleIsEnabled asserts that the EventBridge rule exists and is enabled
+func assertEventRuleIsEnabled(t *testing.T, client eventbridgeAPI, ruleName string) *eventbridge.DescribeRuleOutput {
+	rule, err := client.DescribeRule(context.TODO(), &eventbridge.DescribeRuleInput{
+		Name: &ruleName,
+	})
+	require.NoError(t, err, "Error describing rule %s", ruleName)
+
+	assert.Equal(t, eventbridgetypes.RuleStateEnabled, rule.State, "Expected rule %s to be ENABLED", ruleName)
+	return rule
+}
+
+// assertEcsScheduledTaskTarget asserts that the rule has a single target that runs the task
+// definition on FARGATE in the cluster with the awsvpc network configuration of the module
+func assertEcsScheduledTaskTarget(t *testing.T, client eventbridgeAPI, ruleName string, clusterArn string, taskDefinitionArn string, subnetIds []string) *eventbridgetypes.Target {
+	targets, err := client.ListTargetsByRule(context.TODO(), &eventbridge.ListTargetsByRuleInput{
+		Rule: &ruleName,
+	})
+	require.NoError(t, err, "Error listing the targets of rule %s", ruleName)
+	require.Equal(t, 1, len(targets.Targets), "Expected rule %s to have 1 target, got %d", ruleName, len(targets.Targets))
+
+	target := &targets.Targets[0]
+	assert.Equal(t, clusterArn, awssdk.ToString(target.Arn), "Expected rule %s to target cluster %s", ruleName, clusterArn)
+	require.NotNil(t, target.EcsParameters, "Expected rule %s to target an ECS task", ruleName)
+
+	parameters := target.EcsParameters
+	assert.Equal(t, eventbridgetypes.LaunchTypeFargate, parameters.LaunchType, "Expected rule %s to launch FARGATE tasks", ruleName)
+	assert.Equal(t, taskDefinitionArn, awssdk.ToString(parameters.TaskDefinitionArn), "Expected rule %s to run %s", ruleName, taskDefinitionArn)
+	assert.Equal(t, int32(1), awssdk.ToInt32(parameters.TaskCount), "Expected rule %s to run 1 task", ruleName)
+
+	// FARGATE tasks require the awsvpc network mode
+	require.NotNil(t, parameters.NetworkConfiguration, "Expected rule %s to have a network configuration", ruleName)
+	require.NotNil(t, parameters.NetworkConfiguration.AwsvpcConfiguration, "Expected rule %s to have an awsvpc configuration", ruleName)
+
+	awsvpc := parameters.NetworkConfiguration.AwsvpcConfiguration
+	assert.ElementsMatch(t, subnetIds, awsvpc.Subnets, "Expected rule %s to place tasks in the public subnets", ruleName)
+	assert.Equal(t, eventbridgetypes.AssignPublicIpEnabled, awsvpc.AssignPublicIp, "Expected rule %s to assign public IPs", ruleName)
+
+	return target
+}
+
+// assertEcsScheduledTaskRoleCanRunTask asserts that the role of the target can be assumed by
+// EventBridge and that its policies allow running the task definition and passing its roles
+func assertEcsScheduledTaskRoleCanRunTask(t *testing.T, client iamAPI, roleArn string, taskDefinitionArn string) {
+	parsed, err := arn.Parse(roleArn)
+	require.NoError(t, err, "Expected the target role %s to be an ARN", roleArn)
+	roleName := strings.TrimPrefix(parsed.Resource, "role/")
+
+	// Check the trust policy
+	role, err := client.GetRole(context.TODO(), &iam.GetRoleInput{
+		RoleName: &roleName,
+	})
+	require.NoError(t, err, "Error getting role %s", roleName)
+
+	trustPolicy := parsePolicyDocument(t, awssdk.ToString(role.Role.AssumeRolePolicyDocument))
+	assert.True(t, trustPolicy.allows("sts:AssumeRole", ""), "Expected role %s to be assumable", roleName)
+	assert.Contains(t, awssdk.ToString(role.Role.AssumeRolePolicyDocument), "events.amazonaws.com", "Expected role %s to trust EventBridge", roleName)
+
+	// Check the inline policies
+	policies, err := client.ListRolePolicies(context.TODO(), &iam.ListRolePoliciesInput{
+		RoleName: &roleName,
+	})
+	require.NoError(t, err, "Error listing the policies of role %s", roleName)
+
+	canRunTask, canPassRole := false, false
+	for _, policyName := range policies.PolicyNames {
+		policy, err := client.GetRolePolicy(context.TODO(), &iam.GetRolePolicyInput{
+			RoleName:   &roleName,
+			PolicyName: awssdk.String(policyName),
+		})
+		require.NoError(t, err, "Error getting policy %s of role %s", policyName, roleName)
+
+		document := parsePolicyDocument(t, awssdk.ToString(policy.PolicyDocument))
+		canRunTask = canRunTask || document.allows("ecs:RunTask", taskDefinitionArn)
+		canPassRole = canPassRole || document.allows("iam:PassRole", "")
+	}
+
+	assert.True(t, canRunTask, "Expected role %s to allow ecs:RunTask on %s", roleName, taskDefinitionArn)
+	assert.True(t, canPassRole, "Expected role %s to allow iam:PassRole", roleName)
+}
+
+// assertEventRuleIsInvoked asserts that the rule invokes its target at least once
+// and that none of the invocations fail
+func assertEventRuleIsInvoked(t *testing.T, client cloudwatchAPI, ruleName string) {
+	startTime := time.Now().Add(-30 * time.Minute)
+
+	sumRuleMetric := func(ctx context.Context, metricName string) (float64, error) {
+		statistics, err := client.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  awssdk.String("AWS/Events"),
+			MetricName: &metricName,
+			Dimensions: []cloudwatchtypes.Dimension{
+				{Name: awssdk.String("RuleName"), Value: &ruleName},
+			},
+			StartTime:  &startTime,
+			EndTime:    awssdk.Time(time.Now()),
+			Period:     awssdk.Int32(60),
+			Statistics: []cloudwatchtypes.Statistic{cloudwatchtypes.StatisticSum},
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		sum := 0.0
+		for _, datapoint := range statistics.Datapoints {
+			sum += awssdk.ToFloat64(datapoint.Sum)
+		}
+		return sum, nil
+	}
+
+	err := waiter.For(t, fmt.Sprintf("rule %s to invoke its target", ruleName), 10*time.Minute, func(ctx context.Context) error {
+		failed, err := sumRuleMetric(ctx, "FailedInvocations")
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return waiter.Stop(fmt.Errorf("rule %s failed to invoke its target %.0f times", ruleName, failed))
+		}
+
+		invocations, err := sumRuleMetric(ctx, "Invocations")
+		if err != nil {
+			return err
+		}
+		if invocations == 0 {
+			return fmt.Errorf("rule %s has not been invoked yet", ruleName)
+		}
+
+		t.Logf("Rule %s was invoked %.0f times", ruleName, invocations)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// waitForEcsTaskToStop waits for a task of the task definition that was started by an
+// EventBridge rule to stop and returns it
+func waitForEcsTaskToStop(t *testing.T, client ecsAPI, clusterName string, taskDefinitionArn string) *ecstypes.Task {
+	taskDefinition, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: &taskDefinitionArn,
+	})
+	require.NoError(t, err, "Error describing task definition %s", taskDefinitionArn)
+	family := taskDefinition.TaskDefinition.Family
+
+	var stopped *ecstypes.Task
+	err = waiter.For(t, fmt.Sprintf("a task of %s started by a rule to stop", *family), 10*time.Minute, func(ctx context.Context) error {
+		tasks, err := client.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster:       &clusterName,
+			Family:        family,
+			DesiredStatus: ecstypes.DesiredStatusStopped,
+		})
+		if err != nil {
+			return err
+		}
+		if len(tasks.TaskArns) == 0 {
+			return fmt.Errorf("no tasks of %s have stopped yet", *family)
+		}
+
+		described, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterName,
+			Tasks:   tasks.TaskArns,
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, task := range described.Tasks {
+			// Tasks started by EventBridge are started by events-rule/<rule name>
+			if !strings.HasPrefix(awssdk.ToString(task.StartedBy), "events-rule/") {
+				continue
+			}
+			if awssdk.ToString(task.TaskDefinitionArn) == taskDefinitionArn && awssdk.ToString(task.LastStatus) == string(ecstypes.DesiredStatusStopped) {
+				stopped = &described.Tasks[i]
+				return nil
+			}
+		}
+
+		return fmt.Errorf("no tasks of %s started by a rule have stopped yet", taskDefinitionArn)
+	})
+	require.NoError(t, err)
+	return stopped
+}
+
+// assertEcsTaskExitedSuccessfully asserts that the essential container of the task exited
+// with an exit code of 0 rather than being stopped by ECS (i.e. failing to be placed)
+func assertEcsTaskExitedSuccessfully(t *testing.T, task *ecstypes.Task) {
+	taskArn := awssdk.ToString(task.TaskArn)
+
+	assert.Equal(t, ecstypes.TaskStopCodeEssentialContainerExited, task.StopCode, "Expected task %s to stop because its container exited, got %s: %s", taskArn, task.StopCode, awssdk.ToString(task.StoppedReason))
+
+	for _, container := range task.Containers {
+		if assert.NotNil(t, container.ExitCode, "Expected container %s of task %s to have an exit code: %s", awssdk.ToString(container.Name), taskArn, awssdk.ToString(container.Reason)) {
+			assert.Equal(t, int32(0), *container.ExitCode, "Expected container %s of task %s to exit with 0", awssdk.ToString(container.Name), taskArn)
+		}
+	}
+}
+
+// policyDocument is an IAM policy document. The Action and Resource of a
+// statement can either be a string or a list of strings.
+type policyDocument struct {
+	Statement []struct {
+		Effect   string
+		Action   interface{}
+		Resource interface{}
+	}
+}
+
+// parsePolicyDocument parses the URL encoded policy document returned by IAM
+func parsePolicyDocument(t *testing.T, encoded string) *policyDocument {
+	decoded, err := url.QueryUnescape(encoded)
+	require.NoError(t, err, "Error decoding policy document")
+
+	document := &policyDocument{}
+	require.NoError(t, json.Unmarshal([]byte(decoded), document), "Error parsing policy document %s", decoded)
+	return document
+}
+
+// allows returns true if a statement allows the action on the resource. An empty
+// resource matches any resource of the statement.
+func (d *policyDocument) allows(action string, resource string) bool {
+	for _, statement := range d.Statement {
+		if statement.Effect != "Allow" || !containsPolicyValue(statement.Action, action) {
+			continue
+		}
+		if resource == "" || statement.Resource == nil || containsPolicyValue(statement.Resource, resource) || containsPolicyValue(statement.Resource, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPolicyValue returns true if the string or list of strings contains the value
+func containsPolicyValue(values interface{}, value string) bool {
+	switch v := values.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, item := range v {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,23 +2,25 @@ package modules
 
 import (
 	"context"
-	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
-	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/gruntwork-io/terratest/modules/aws"
-	http_helper "github.com/gruntwork-io/terratest/modules/http-helper"
 	"github.com/gruntwork-io/terratest/modules/random"
-	"github.com/gruntwork-io/terratest/modules/retry"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/assert"
@@ -28,9 +30,8 @@ func DeployEcsServiceUsingTerraform(t *testing.T, workingDir string) {
 	// Generate unique ID
 	uniqueId := strings.ToLower(random.UniqueId())
 
-	// Get a random AWS region
-	awsRegion := aws.GetRandomStableRegion(t, []string{"us-east-1", "us-east-2"}, nil)
-	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
 
 	// Get a ECS AMI with the latest ECS agent
 	filters := map[string][]string{
@@ -65,12 +66,12 @@ func DeployEcsServiceUsingTerraform(t *testing.T, workingDir string) {
 // - The ECS service can retrieve a secret from secrets manager
 // - The ECS service can be deployed using the deploy-ecs-service.py script
 // - The ECS service can be scaled out
-func ValidateEcsService(t *testing.T, workingDir string) {
+func ValidateEcsService(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	wg := &sync.WaitGroup{}
 
 	// Load the Terraform Options saved by the earlier deploy_terraform stage
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	regionName := test_structure.LoadString(t, workingDir, "awsRegion")
+	ecsClient := clients.Ecs()
 
 	// Get outputs for assertions
 	ecsClusterName := terraform.Output(t, terraformOptions, "ecs_cluster_name")
@@ -83,7 +84,7 @@ func ValidateEcsService(t *testing.T, workingDir string) {
 	// Check that the services exist and
 	// are in a stable state...
 	wg.Add(1)
-	go assertEcsServiceIsStable(t, wg, regionName, ecsClusterName, externalServiceName)
+	go assertEcsServiceIsStable(t, wg, ecsClient, ecsClusterName, externalServiceName, waiter.DefaultBackoff)
 	wg.Wait()
 
 	// The following assertions can be run in parallel
@@ -92,120 +93,182 @@ func ValidateEcsService(t *testing.T, workingDir string) {
 
 	// Check that the load balancer attached service
 	// recieves traffic
-	go assertEcsServiceReceivesTraffic(t, wg, regionName, loadbalancerName, externalTargetGroupArn)
+	go assertEcsServiceReceivesTraffic(t, wg, clients.Elbv2(), loadbalancerName, externalTargetGroupArn)
 
 	// Check that the a service can retrieve a secret
 	// from secrets manager
-	go assertEcsServiceCanRetrieveSecret(t, wg, loadbalancerDnsName)
+	go assertEcsServiceCanRetrieveSecret(t, wg, loadbalancerDnsName, waiter.DefaultBackoff)
 
 	// Wait for all the above assertions to complete
 	wg.Wait()
 
 	// Check that deployments updating the container image
 	// externally do not override the image specified in the
-	assertEcsServiceExternalDeployment(t, terraformOptions, regionName, ecsClusterName, externalServiceName)
+	assertEcsServiceExternalDeployment(t, terraformOptions, ecsClient, ecsClusterName, externalServiceName)
 
 	// Check that the service can be scaled out
-	assertEcsServiceAutoScaling(t, regionName, ecsClusterName, externalServiceName, externalServiceAutoScalingAlarmArns)
+	assertEcsServiceAutoScaling(t, clients.CloudWatch(), ecsClient, ecsClusterName, externalServiceName, externalServiceAutoScalingAlarmArns, waiter.DefaultBackoff)
+}
+
+// ValidateEcsServicePlan validates the plan of the ECS service example without
+// deploying it. The external service is attached to the load balancer and
+// auto scaled, so none of the scheduled task resources should be planned.
+func ValidateEcsServicePlan(t *testing.T, workingDir string) {
+	plan := planUsingTerraform(t, workingDir, map[string]interface{}{
+		"random_id":                "plan",
+		"region":                   planRegion,
+		"cluster_instance_ami":     "ami-00000000000000000",
+		"external_container_image": "cyber4all/mock-container-image:latest",
+	})
+
+	assertPlanOnlyCreates(t, plan)
+
+	service := "module.external-ecs-service"
+
+	// The service is deployed to EC2 rather than as a scheduled task
+	assertResourceCount(t, plan, service+".aws_ecs_service.service", 1)
+	assertResourceCount(t, plan, service+".aws_cloudwatch_event_rule.scheduled", 0)
+	assertResourceCount(t, plan, service+".aws_cloudwatch_event_target.scheduled", 0)
+	assertPlannedAttribute(t, plan, service+".aws_ecs_task_definition.task", "network_mode", "bridge")
+	assertPlannedAttribute(t, plan, service+".aws_ecs_task_definition.task", "requires_compatibilities", []interface{}{"EC2"})
+
+	// The service is attached to the load balancer
+	assertResourceCount(t, plan, service+".aws_lb_target_group.alb", 1)
+	assertResourceCount(t, plan, service+".aws_lb_listener_rule.alb", 1)
+	assertPlannedAttribute(t, plan, indexedAddress(service+".aws_lb_target_group.alb", 0), "port", float64(8080))
+
+	// The service is auto scaled on memory utilization
+	assertResourceCount(t, plan, service+".aws_appautoscaling_target.service", 1)
+	assertResourceCount(t, plan, service+".aws_appautoscaling_policy.memory", 1)
+	assertPlannedAttribute(t, plan, indexedAddress(service+".aws_appautoscaling_policy.memory", 0), "policy_type", "TargetTrackingScaling")
+
+	// The task execution role can read the secret
+	assertResourceCount(t, plan, service+".aws_iam_policy.secrets_manager", 1)
+	assertResourceCount(t, plan, "module.secrets-manager.aws_secretsmanager_secret.secret", 1)
 }
 
 // assertEcsServiceIsStable asserts that the ECS service is in a stable state
 // (i.e. not updating or draining) and that the service exists. This function
 // supports running in parallel with other tests.
-func assertEcsServiceIsStable(t *testing.T, wg *sync.WaitGroup, awsRegion string, clusterName string, serviceName string) {
+func assertEcsServiceIsStable(t *testing.T, wg *sync.WaitGroup, client ecsAPI, clusterName string, serviceName string, backoff waiter.Backoff) {
 	defer wg.Done()
 
-	message := retry.DoWithRetry(
-		t,
-		fmt.Sprintf("%s stability:", serviceName),
-		28,                            // maxRetries
-		time.Duration(15*time.Second), // sleepBetweenRetries
-		func() (string, error) {
-			// Get the service
-			service := aws.GetEcsService(t, awsRegion, clusterName, serviceName)
-
-			// Check that the service exists
-			assert.NotNil(t, service, "Service %s does not exist", serviceName)
-
-			// The service is considered stable if it has a single deployment
-			// and that deployment is in the completed state and the service
-			// has reached its desired count.
-			if len(service.Deployments) == 1 {
-				deployment := service.Deployments[0]
-
-				if *deployment.RolloutState == ecs.DeploymentRolloutStateCompleted &&
-					*service.DesiredCount == *service.RunningCount {
-					return fmt.Sprintf("Service %s is stable", serviceName), nil
-
-				} else if *deployment.RolloutState == ecs.DeploymentRolloutStateFailed {
-					return "", retry.FatalError{Underlying: fmt.Errorf(*deployment.RolloutStateReason, serviceName)}
-				}
+	// Check that the service exists and is stable
+	err := waitForEcsServiceToBeStable(t, client, clusterName, serviceName, backoff)
+	assert.NoError(t, err, "Service %s is not stable", serviceName)
+}
+
+// waitForEcsServiceToBeStable waits up to 7 minutes for the service to be stable with the
+// backoff and stops waiting as soon as the rollout of its deployment fails
+func waitForEcsServiceToBeStable(t *testing.T, client ecsAPI, clusterName string, serviceName string, backoff waiter.Backoff) error {
+	return waiter.ForWithBackoff(t, fmt.Sprintf("service %s to be stable", serviceName), 7*time.Minute, backoff, func(ctx context.Context) error {
+		// Get the service
+		service, err := describeEcsService(client, clusterName, serviceName)
+		if err != nil {
+			return err
+		}
+
+		// The service is considered stable if it has a single deployment
+		// and that deployment is in the completed state and the service
+		// has reached its desired count.
+		if len(service.Deployments) == 1 {
+			deployment := service.Deployments[0]
+
+			if deployment.RolloutState == ecstypes.DeploymentRolloutStateCompleted &&
+				service.DesiredCount == service.RunningCount {
+				return nil
+
+			} else if deployment.RolloutState == ecstypes.DeploymentRolloutStateFailed {
+				return waiter.Stop(fmt.Errorf("service %s failed to roll out: %s", serviceName, aws_sdk.ToString(deployment.RolloutStateReason)))
 			}
+		}
 
-			return "", fmt.Errorf("service %s is not stable yet", serviceName)
-		},
-	)
+		return fmt.Errorf("service %s has %d deployments and %d of %d tasks running", serviceName, len(service.Deployments), service.RunningCount, service.DesiredCount)
+	})
+}
 
-	t.Log(message)
+// describeEcsService returns the service of the cluster, like GetEcsServiceE from
+// terratest but with the client that the validators were given
+func describeEcsService(client ecsAPI, clusterName string, serviceName string) (*ecstypes.Service, error) {
+	output, err := client.DescribeServices(context.TODO(), &ecs.DescribeServicesInput{
+		Cluster:  aws_sdk.String(clusterName),
+		Services: []string{serviceName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Services) != 1 {
+		return nil, fmt.Errorf("expected 1 service %s in cluster %s, found %d", serviceName, clusterName, len(output.Services))
+	}
+	return &output.Services[0], nil
 }
 
 // assertEcsServiceReceivesTraffic asserts that the ECS service is receiving traffic
 // from the load balancer. This function supports running in parallel with other tests.
-func assertEcsServiceReceivesTraffic(t *testing.T, wg *sync.WaitGroup, awsRegion string, loadBalancerName string, targetGroupArn string) {
+func assertEcsServiceReceivesTraffic(t *testing.T, wg *sync.WaitGroup, client elbv2API, loadBalancerName string, targetGroupArn string) {
 	defer wg.Done()
 
-	// Connect to aws using aws sdk
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	assert.NoError(t, err)
-
-	client := elasticloadbalancingv2.NewFromConfig(cfg, func(o *elasticloadbalancingv2.Options) {
-		o.Region = awsRegion
-	})
+	err := checkEcsServiceReceivesTraffic(t, client, loadBalancerName, targetGroupArn, 2*time.Minute, waiter.DefaultBackoff)
+	assert.NoError(t, err, "Service behind %s does not receive traffic", loadBalancerName)
+}
 
+// checkEcsServiceReceivesTraffic checks that the target group has healthy targets and
+// waits up to the timeout for the load balancer to answer with the mock container image
+// API, checking with the backoff. Every target that is not healthy is reported in the
+// returned error.
+func checkEcsServiceReceivesTraffic(t *testing.T, client elbv2API, loadBalancerName string, targetGroupArn string, timeout time.Duration, backoff waiter.Backoff) error {
 	// Get the target health
 	resp, err := client.DescribeTargetHealth(context.TODO(), &elasticloadbalancingv2.DescribeTargetHealthInput{
 		TargetGroupArn: &targetGroupArn,
 	})
-	assert.NoError(t, err)
+	if err != nil {
+		return err
+	}
 
 	// Check that there is at least one target
-	assert.NotEmpty(t, resp.TargetHealthDescriptions, "Expected at least one target for %s", loadBalancerName)
+	if len(resp.TargetHealthDescriptions) == 0 {
+		return fmt.Errorf("expected at least one target for %s", loadBalancerName)
+	}
 
 	// Check that each target is healthy. We assume
 	// since the service is stable that the target
 	// is healthy hence retries are not necessary
+	unhealthy := []error{}
 	for _, target := range resp.TargetHealthDescriptions {
-		assert.Equal(t,
-			types.TargetHealthStateEnumHealthy, // expected
-			target.TargetHealth.State,          // actual
-			"Target is not in healthy state: (%s) %s - %s", target.TargetHealth.State, target.TargetHealth.Reason, target.TargetHealth.Description,
-		)
+		if target.TargetHealth.State != types.TargetHealthStateEnumHealthy {
+			unhealthy = append(unhealthy, fmt.Errorf("target %s is not in healthy state: (%s) %s - %s", aws_sdk.ToString(target.Target.Id), target.TargetHealth.State, target.TargetHealth.Reason, aws_sdk.ToString(target.TargetHealth.Description)))
+		}
+	}
+	if len(unhealthy) > 0 {
+		return errors.Join(unhealthy...)
 	}
 
 	// Get loadbalancer DNS name
 	loadBalancers, err := client.DescribeLoadBalancers(context.TODO(), &elasticloadbalancingv2.DescribeLoadBalancersInput{
 		Names: []string{loadBalancerName},
 	})
-	assert.NoError(t, err)
-
-	// Check that there is one load balancer
-	assert.Equal(t, 1, len(loadBalancers.LoadBalancers), "Expected one load balancer for %s, recieved ", loadBalancerName, len(loadBalancers.LoadBalancers))
+	if err != nil {
+		return err
+	}
 
-	// Check that the load balancer has a DNS name
-	assert.NotEmpty(t, loadBalancers.LoadBalancers[0].DNSName, "Expected load balancer %s to have a DNS name", loadBalancerName)
+	// Check that there is one load balancer with a DNS name
+	if len(loadBalancers.LoadBalancers) != 1 {
+		return fmt.Errorf("expected one load balancer for %s, recieved %d", loadBalancerName, len(loadBalancers.LoadBalancers))
+	}
+	dnsName := aws_sdk.ToString(loadBalancers.LoadBalancers[0].DNSName)
+	if dnsName == "" {
+		return fmt.Errorf("expected load balancer %s to have a DNS name", loadBalancerName)
+	}
 
 	// Check that the load balancer DNS name resolves
 	// to the load balancer target
-	http_helper.HttpGetWithRetryWithCustomValidation(t,
-		fmt.Sprintf("http://%s", *loadBalancers.LoadBalancers[0].DNSName),
-		&tls.Config{},
-		5,             // retries
-		5*time.Second, // sleepBetweenRetries
-		func(statusCode int, body string) bool {
-			// Check that the body.message is "Mock Container Image API"
-			return statusCode == 200 && strings.Contains(body, "Mock Container Image API")
-		},
-	)
+	return waitForHttpGet(t, fmt.Sprintf("http://%s", dnsName), timeout, backoff, func(statusCode int, body string) error {
+		// Check that the body.message is "Mock Container Image API"
+		if statusCode != 200 || !strings.Contains(body, "Mock Container Image API") {
+			return fmt.Errorf("expected the mock container image API, got %d: %s", statusCode, body)
+		}
+		return nil
+	})
 }
 
 // assertEcsServiceCanRetrieveSecret asserts that the ECS service can retrieve
@@ -219,29 +282,27 @@ func assertEcsServiceReceivesTraffic(t *testing.T, wg *sync.WaitGroup, awsRegion
 //     environment variable SECRET.
 //  2. The ECS service module set the SECRET environment variable using
 //     the secrets manager secret.
-func assertEcsServiceCanRetrieveSecret(t *testing.T, wg *sync.WaitGroup, dnsName string) {
+func assertEcsServiceCanRetrieveSecret(t *testing.T, wg *sync.WaitGroup, dnsName string, backoff waiter.Backoff) {
 	defer wg.Done()
 
-	http_helper.HttpGetWithRetryWithCustomValidation(t,
-		fmt.Sprintf("http://%s/test/env", dnsName),
-		&tls.Config{},
-		5,             // retries
-		5*time.Second, // sleepBetweenRetries
-		func(statusCode int, body string) bool {
-			// Check that the body.message is "SUPER_SECRET_VALUE"
-			return statusCode == 200 && strings.Contains(body, "Secret: SUPER_SECRET_VALUE")
-		},
-	)
+	err := waitForHttpGet(t, fmt.Sprintf("http://%s/test/env", dnsName), 2*time.Minute, backoff, func(statusCode int, body string) error {
+		// Check that the body.message is "SUPER_SECRET_VALUE"
+		if statusCode != 200 || !strings.Contains(body, "Secret: SUPER_SECRET_VALUE") {
+			return fmt.Errorf("expected the secret, got %d: %s", statusCode, body)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
 }
 
 // assertEcsServiceDeploymentScript asserts that the ECS service can be deployed
 // externally without being overriden with the container image specified in the
 // terraform configuration
-func assertEcsServiceExternalDeployment(t *testing.T, terraformOptions *terraform.Options, regionName string, clusterName string, serviceName string) {
+func assertEcsServiceExternalDeployment(t *testing.T, terraformOptions *terraform.Options, client ecsAPI, clusterName string, serviceName string) {
 	expectedContainerImage := "cyber4all/mock-container-image:1.0.0"
 
 	// Deploy the service externally
-	deployEcsService(t, regionName, clusterName, serviceName, expectedContainerImage)
+	deployEcsService(t, client, clusterName, serviceName, expectedContainerImage, waiter.DefaultBackoff)
 
 	// Check that the service will use the externally deployed
 	// image on new terraform apply (rather than overriding)
@@ -258,7 +319,7 @@ func assertEcsServiceExternalDeployment(t *testing.T, terraformOptions *terrafor
 	// Wait for the service to reach a stable state
 	inner_wg := &sync.WaitGroup{}
 	inner_wg.Add(1)
-	go assertEcsServiceIsStable(t, inner_wg, regionName, clusterName, serviceName)
+	go assertEcsServiceIsStable(t, inner_wg, client, clusterName, serviceName, waiter.DefaultBackoff)
 	inner_wg.Wait()
 
 	// Check that the outputs reflect the expected container image
@@ -266,22 +327,42 @@ func assertEcsServiceExternalDeployment(t *testing.T, terraformOptions *terrafor
 	assert.Equal(t, expectedContainerImage, outputContainerImage, "Expected service to use container image %s, recieved %s", expectedContainerImage, outputContainerImage)
 
 	// Check that the latest deployment is using the expected container image
-	taskDefinition := aws.GetEcsService(t, regionName, clusterName, serviceName).Deployments[0].TaskDefinition
-	actualContainerImage := aws.GetEcsTaskDefinition(t, regionName, *taskDefinition).ContainerDefinitions[0].Image
-	assert.Equal(t, expectedContainerImage, *actualContainerImage, "Expected service to use container image %s, recieved %s", expectedContainerImage, *actualContainerImage)
+	assertEcsServiceUsesImage(t, client, clusterName, serviceName, expectedContainerImage)
 }
 
-// deployEcsService deploys the ECS service using the specified container image.
-func deployEcsService(t *testing.T, regionName string, clusterName string, serviceName string, containerImage string) *string {
-	// Get the task definition arn
-	taskDefinitionArn := aws.GetEcsService(t, regionName, clusterName, serviceName).Deployments[0].TaskDefinition
+// assertEcsServiceUsesImage asserts that the essential container of the task definition
+// of the latest deployment of the service runs the expected container image
+func assertEcsServiceUsesImage(t *testing.T, client ecsAPI, clusterName string, serviceName string, expectedContainerImage string) {
+	service, err := describeEcsService(client, clusterName, serviceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskDefinitionOutput, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: service.Deployments[0].TaskDefinition,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualContainerImage := aws_sdk.ToString(taskDefinitionOutput.TaskDefinition.ContainerDefinitions[0].Image)
+	assert.Equal(t, expectedContainerImage, actualContainerImage, "Expected service to use container image %s, recieved %s", expectedContainerImage, actualContainerImage)
+}
 
-	client := aws.NewEcsClient(t, regionName)
+// deployEcsService deploys the ECS service using the specified container image and
+// waits with the backoff for the service to be stable.
+func deployEcsService(t *testing.T, client ecsAPI, clusterName string, serviceName string, containerImage string, backoff waiter.Backoff) *string {
+	// Get the task definition arn
+	service, err := describeEcsService(client, clusterName, serviceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskDefinitionArn := service.Deployments[0].TaskDefinition
 
 	// Get the task definition, can't use GetEcsTaskDefinition from terratest
 	// because it doesn't support the latest version of the ecs sdk which includes
 	// service connect compatibility
-	taskDefinitionOutput, err := client.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+	taskDefinitionOutput, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: taskDefinitionArn,
 	})
 	if err != nil {
@@ -293,7 +374,7 @@ func deployEcsService(t *testing.T, regionName string, clusterName string, servi
 	taskDefinition.ContainerDefinitions[0].Image = &containerImage
 
 	// Register the new task definition
-	registerTaskDefinitionOutput, err := client.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+	registerTaskDefinitionOutput, err := client.RegisterTaskDefinition(context.TODO(), &ecs.RegisterTaskDefinitionInput{
 		ContainerDefinitions:    taskDefinition.ContainerDefinitions,
 		Cpu:                     taskDefinition.Cpu,
 		EphemeralStorage:        taskDefinition.EphemeralStorage,
@@ -316,7 +397,7 @@ func deployEcsService(t *testing.T, regionName string, clusterName string, servi
 	}
 
 	// Update the service to use the new task definition
-	_, err = client.UpdateService(&ecs.UpdateServiceInput{
+	_, err = client.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
 		Cluster:        &clusterName,
 		Service:        &serviceName,
 		TaskDefinition: registerTaskDefinitionOutput.TaskDefinition.TaskDefinitionArn,
@@ -328,21 +409,21 @@ func deployEcsService(t *testing.T, regionName string, clusterName string, servi
 	// Wait for the service to reach a stable state
 	inner_wg := &sync.WaitGroup{}
 	inner_wg.Add(1)
-	go assertEcsServiceIsStable(t, inner_wg, regionName, clusterName, serviceName)
+	go assertEcsServiceIsStable(t, inner_wg, client, clusterName, serviceName, backoff)
 	inner_wg.Wait()
 
 	return registerTaskDefinitionOutput.TaskDefinition.TaskDefinitionArn
 }
 
-// assertEcsServiceAutoScaling asserts that the ECS service can be scaled out
-// and in. This function assumes the following:
+// assertEcsServiceAutoScaling asserts that the ECS service can be scaled out.
+// This function assumes the following:
 // 1. The ECS service is using TargetTrackingScaling
 // 2. The ECS service has a scale out alarm
 // 3. The ECS service has a 50 threshold for 3 datapoints over a 180 period
-func assertEcsServiceAutoScaling(t *testing.T, regionName string, clusterName string, serviceName string, alarmNames []string) {
+func assertEcsServiceAutoScaling(t *testing.T, cloudwatchClient cloudwatchAPI, ecsClient ecsAPI, clusterName string, serviceName string, alarmArns []string, backoff waiter.Backoff) {
 	// Parse the alarm ARNs into alarm names
 	var scaleOutAlarmName string
-	for _, alarmArn := range alarmNames {
+	for _, alarmArn := range alarmArns {
 		splitAlarmArn := strings.Split(alarmArn, ":")
 		alarmName := splitAlarmArn[len(splitAlarmArn)-1]
 
@@ -352,65 +433,83 @@ func assertEcsServiceAutoScaling(t *testing.T, regionName string, clusterName st
 	}
 
 	// Check that the scale out alarm name is set
-	assert.NotNil(t, scaleOutAlarmName, "Expected scale out alarm name to be set")
+	if scaleOutAlarmName == "" {
+		t.Fatalf("Expected a scale out alarm in %v", alarmArns)
+	}
+
+	// Test Scale Out
+	currentDesiredCount, updatedDesiredCount, err := triggerEcsServiceScaling(t, cloudwatchClient, ecsClient, clusterName, serviceName, scaleOutAlarmName, []float64{100, 100, 100}, 3*time.Minute, backoff)
+
+	// Check that the updated desired count is greater than the current desired count
+	assert.NoError(t, err, "Expected desired count to be greater than %d, recieved %d", currentDesiredCount, updatedDesiredCount)
+	assert.Greater(t, updatedDesiredCount, currentDesiredCount, "Expected service %s to scale out", serviceName)
+}
 
-	// Connect to aws using aws sdk
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// triggerEcsServiceScaling sets the scaling alarm of the service to the ALARM state with
+// the datapoints and waits up to the timeout, checking with the backoff, for the alarm to
+// execute its scaling action and for the desired count of the service to change. It
+// returns the desired count before and after the alarm.
+func triggerEcsServiceScaling(t *testing.T, cloudwatchClient cloudwatchAPI, ecsClient ecsAPI, clusterName string, serviceName string, alarmName string, datapoints []float64, timeout time.Duration, backoff waiter.Backoff) (int32, int32, error) {
+	// Get the current desired count
+	service, err := describeEcsService(ecsClient, clusterName, serviceName)
 	if err != nil {
-		t.Fatal(err)
+		return 0, 0, err
 	}
-	cloudwatchClient := cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) {
-		o.Region = regionName
+	currentDesiredCount := service.DesiredCount
+	t.Logf("Current desired count: %d", currentDesiredCount)
+
+	stateReasonData, err := json.Marshal(map[string]interface{}{
+		"version":          "1.0",
+		"statistic":        "Average",
+		"period":           60,
+		"recentDatapoints": datapoints,
 	})
-
-	// Get the current desired count
-	currentDesiredCount := aws.GetEcsService(t, regionName, clusterName, serviceName).DesiredCount
-	t.Logf("Current desired count: %d", *currentDesiredCount)
-
-	// Test Scale Out
-	stateReasonData := `{
-		"version": "1.0",
-		"statistic": "Average",
-        "period": 60,
-        "recentDatapoints": [
-            100,
-			100,
-			100
-        ],
-        "threshold": 50
-	}`
+	if err != nil {
+		return currentDesiredCount, currentDesiredCount, err
+	}
 	var maxRecords int32 = 1
 	stateReason := "Setting alarm to ALARM state for testing"
 
-	// Set the scale out alarm to ALARM state
-	cloudwatchClient.SetAlarmState(context.TODO(), &cloudwatch.SetAlarmStateInput{
-		AlarmName:       &scaleOutAlarmName,
+	// Set the alarm to ALARM state
+	_, err = cloudwatchClient.SetAlarmState(context.TODO(), &cloudwatch.SetAlarmStateInput{
+		AlarmName:       &alarmName,
 		StateValue:      cloudwatchtypes.StateValueAlarm,
 		StateReason:     &stateReason,
-		StateReasonData: &stateReasonData,
-	})
-
-	t.Log("Waiting 15 seconds for scale out alarm to trigger...")
-	time.Sleep(15 * time.Second)
-
-	// Get the latest alarm history
-	alarmHistory, err := cloudwatchClient.DescribeAlarmHistory(context.TODO(), &cloudwatch.DescribeAlarmHistoryInput{
-		AlarmName:  &scaleOutAlarmName,
-		MaxRecords: &maxRecords,
+		StateReasonData: aws_sdk.String(string(stateReasonData)),
 	})
 	if err != nil {
-		t.Fatal(err)
+		return currentDesiredCount, currentDesiredCount, err
 	}
 
-	// Check that there is one alarm history item
-	assert.Equal(t, 1, len(alarmHistory.AlarmHistoryItems), "Expected one alarm history item, recieved %d", len(alarmHistory.AlarmHistoryItems))
-
-	// Check that the latest alarm history is Successfully executed action
-	assert.Contains(t, *alarmHistory.AlarmHistoryItems[0].HistorySummary, "Successfully executed action", "Expected alarm history to be Successfully executed action, recieved %s", *alarmHistory.AlarmHistoryItems[0].HistorySummary)
-
-	// Get the updated desired count
-	updatedDesiredCount := aws.GetEcsService(t, regionName, clusterName, serviceName).DesiredCount
+	// Wait for the alarm to trigger the scaling action and for the service to scale
+	updatedDesiredCount := currentDesiredCount
+	err = waiter.ForWithBackoff(t, fmt.Sprintf("alarm %s to scale service %s", alarmName, serviceName), timeout, backoff, func(ctx context.Context) error {
+		// Get the latest alarm history
+		alarmHistory, err := cloudwatchClient.DescribeAlarmHistory(ctx, &cloudwatch.DescribeAlarmHistoryInput{
+			AlarmName:  &alarmName,
+			MaxRecords: &maxRecords,
+		})
+		if err != nil {
+			return err
+		}
+		if len(alarmHistory.AlarmHistoryItems) != 1 {
+			return fmt.Errorf("alarm %s has no history", alarmName)
+		}
+		historySummary := aws_sdk.ToString(alarmHistory.AlarmHistoryItems[0].HistorySummary)
+		if !strings.Contains(historySummary, "Successfully executed action") {
+			return fmt.Errorf("latest alarm history is: %s", historySummary)
+		}
 
-	// Check that the updated desired count is greater than the current desired count
-	assert.Greater(t, *updatedDesiredCount, *currentDesiredCount, "Expected desired count to be greater than %d, recieved %d", *currentDesiredCount, *updatedDesiredCount)
+		// Get the updated desired count
+		service, err := describeEcsService(ecsClient, clusterName, serviceName)
+		if err != nil {
+			return err
+		}
+		updatedDesiredCount = service.DesiredCount
+		if updatedDesiredCount == currentDesiredCount {
+			return fmt.Errorf("desired count is still %d", updatedDesiredCount)
+		}
+		return nil
+	})
+	return currentDesiredCount, updatedDesiredCount, err
 }
@@ -0,0 +1,209 @@
+package modules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noBackoff makes the validators check the fakes without waiting between the checks
+var noBackoff = waiter.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+
+// newFakeEcs returns a fake ECS API with a service that runs the image and a client of it
+func newFakeEcs(t *testing.T, image string) (*fakeaws.Ecs, *ecs.Client) {
+	s := fakeaws.NewServer(t, "us-east-1")
+	fake := fakeaws.NewEcs(s)
+	fake.AddCluster("cluster", 1)
+	fake.AddService("cluster", "service", fake.AddTaskDefinition("service", image), 2)
+	return fake, awsclients.FromConfig(s.Config()).Ecs()
+}
+
+func TestAssertEcsServiceIsStable(t *testing.T) {
+	_, client := newFakeEcs(t, "cyber4all/mock-container-image:latest")
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go assertEcsServiceIsStable(t, wg, client, "cluster", "service", noBackoff)
+	wg.Wait()
+}
+
+func TestWaitForEcsServiceToBeStable(t *testing.T) {
+	fake, client := newFakeEcs(t, "cyber4all/mock-container-image:latest")
+	fake.AddTaskDefinition("service", "cyber4all/mock-container-image:1.0.0")
+
+	// The service is stable once the rollout of the new deployment completes
+	_, err := client.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
+		Cluster:        aws_sdk.String("cluster"),
+		Service:        aws_sdk.String("service"),
+		TaskDefinition: aws_sdk.String("service"),
+	})
+	require.NoError(t, err)
+	assert.NoError(t, waitForEcsServiceToBeStable(t, client, "cluster", "service", noBackoff))
+
+	// A failed rollout stops the wait instead of waiting for the timeout
+	fake.RolloutChecks = 3
+	fake.FailRollout("cluster", "service", "ECS deployment circuit breaker: tasks failed to start.")
+	_, err = client.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
+		Cluster:            aws_sdk.String("cluster"),
+		Service:            aws_sdk.String("service"),
+		ForceNewDeployment: true,
+	})
+	require.NoError(t, err)
+
+	err = waitForEcsServiceToBeStable(t, client, "cluster", "service", noBackoff)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, waiter.ErrTimeout)
+	assert.Contains(t, err.Error(), "service service failed to roll out: ECS deployment circuit breaker: tasks failed to start.")
+
+	// A service that does not exist is never stable
+	_, err = describeEcsService(client, "cluster", "missing")
+	assert.EqualError(t, err, "expected 1 service missing in cluster cluster, found 0")
+}
+
+func TestDeployEcsService(t *testing.T) {
+	_, client := newFakeEcs(t, "cyber4all/mock-container-image:latest")
+
+	taskDefinitionArn := deployEcsService(t, client, "cluster", "service", "cyber4all/mock-container-image:1.0.0", noBackoff)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/service:2", aws_sdk.ToString(taskDefinitionArn))
+
+	// The external deployment is the only deployment of the service
+	service, err := describeEcsService(client, "cluster", "service")
+	require.NoError(t, err)
+	assert.Len(t, service.Deployments, 1)
+	assert.Equal(t, taskDefinitionArn, service.TaskDefinition)
+
+	assertEcsServiceUsesImage(t, client, "cluster", "service", "cyber4all/mock-container-image:1.0.0")
+}
+
+func TestCheckEcsServiceReceivesTraffic(t *testing.T) {
+	s := fakeaws.NewServer(t, "us-east-1")
+	fake := fakeaws.NewElbv2(s)
+	client := awsclients.FromConfig(s.Config()).Elbv2()
+
+	container := fakeaws.NewMockContainer(t)
+	fake.AddLoadBalancer("alb", container.DNSName())
+
+	// A load balancer that answers with another API than the mock container image
+	wrongApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(wrongApi.Close)
+	fake.AddLoadBalancer("wrong-api", strings.TrimPrefix(wrongApi.URL, "http://"))
+
+	healthy := fakeaws.Target{Id: "i-0123456789abcdef0", Port: 32768, State: "healthy"}
+	unhealthy := fakeaws.Target{Id: "i-0123456789abcdef1", Port: 32769, State: "unhealthy", Reason: "Target.ResponseCodeMismatch", Description: "Health checks failed with these codes: [502]"}
+
+	tests := []struct {
+		name             string
+		loadBalancerName string
+		targets          []fakeaws.Target
+		expectedErr      string
+	}{
+		{name: "healthy", loadBalancerName: "alb", targets: []fakeaws.Target{healthy, healthy}},
+		{name: "unhealthy target", loadBalancerName: "alb", targets: []fakeaws.Target{healthy, unhealthy}, expectedErr: "target i-0123456789abcdef1 is not in healthy state: (unhealthy) Target.ResponseCodeMismatch - Health checks failed with these codes: [502]"},
+		{name: "zero targets", loadBalancerName: "alb", expectedErr: "expected at least one target for alb"},
+		{name: "wrong body", loadBalancerName: "wrong-api", targets: []fakeaws.Target{healthy}, expectedErr: "expected the mock container image API, got 503"},
+		{name: "missing load balancer", loadBalancerName: "missing", targets: []fakeaws.Target{healthy}, expectedErr: "LoadBalancerNotFound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetGroupArn := fake.AddTargetGroup(tt.name, tt.targets...)
+
+			err := checkEcsServiceReceivesTraffic(t, client, tt.loadBalancerName, targetGroupArn, 50*time.Millisecond, noBackoff)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestAssertEcsServiceCanRetrieveSecret(t *testing.T) {
+	container := fakeaws.NewMockContainer(t)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go assertEcsServiceCanRetrieveSecret(t, wg, container.DNSName(), noBackoff)
+	wg.Wait()
+}
+
+// newFakeAutoScaling returns the clients of a service of 2 tasks that the module's
+// target tracking policy scales between 1 and 4 tasks at 50% memory utilization, and the
+// names of the AlarmHigh and AlarmLow alarms of the policy. Each check of the alarms
+// passes 20 seconds on the clock of the cooldowns.
+func newFakeAutoScaling(t *testing.T) (cloudwatchAPI, ecsAPI, []string, []string) {
+	s := fakeaws.NewServer(t, "us-east-1")
+	fakeEcs := fakeaws.NewEcs(s)
+	fakeEcs.AddCluster("cluster", 1)
+	fakeEcs.AddService("cluster", "service", fakeEcs.AddTaskDefinition("service", "cyber4all/mock-container-image:latest"), 2)
+
+	autoScaling := fakeaws.NewAutoScaling(s, fakeEcs)
+	now := time.Now()
+	autoScaling.Now = func() time.Time {
+		now = now.Add(20 * time.Second)
+		return now
+	}
+	alarmArns := autoScaling.AddTargetTrackingPolicy("cluster", "service", fakeaws.ModulePolicy(50, 1, 4))
+
+	alarmNames := []string{}
+	for _, alarmArn := range alarmArns {
+		alarmNames = append(alarmNames, alarmArn[strings.LastIndex(alarmArn, ":")+1:])
+	}
+	clients := awsclients.FromConfig(s.Config())
+	return clients.CloudWatch(), clients.Ecs(), alarmArns, alarmNames
+}
+
+func TestAssertEcsServiceAutoScaling(t *testing.T) {
+	cloudwatchClient, ecsClient, alarmArns, _ := newFakeAutoScaling(t)
+
+	assertEcsServiceAutoScaling(t, cloudwatchClient, ecsClient, "cluster", "service", alarmArns, noBackoff)
+
+	service, err := describeEcsService(ecsClient, "cluster", "service")
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), service.DesiredCount)
+}
+
+func TestTriggerEcsServiceScaling(t *testing.T) {
+	cloudwatchClient, ecsClient, _, alarmNames := newFakeAutoScaling(t)
+	high, low := alarmNames[0], alarmNames[1]
+
+	tests := []struct {
+		name                 string
+		alarmName            string
+		datapoints           []float64
+		expectedDesiredCount int32
+		expectedErr          error
+	}{
+		{name: "scale out", alarmName: high, datapoints: []float64{75, 75, 75}, expectedDesiredCount: 3},
+		{name: "scale out clamped at max", alarmName: high, datapoints: []float64{200, 200, 200}, expectedDesiredCount: 4},
+		{name: "at max", alarmName: high, datapoints: []float64{200, 200, 200}, expectedDesiredCount: 4, expectedErr: waiter.ErrTimeout},
+		{name: "scale in after the cooldown", alarmName: low, datapoints: []float64{25, 25, 25}, expectedDesiredCount: 2},
+		{name: "scale in clamped at min", alarmName: low, datapoints: []float64{1, 1, 1}, expectedDesiredCount: 1},
+		{name: "at min", alarmName: low, datapoints: []float64{1, 1, 1}, expectedDesiredCount: 1, expectedErr: waiter.ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, desiredCount, err := triggerEcsServiceScaling(t, cloudwatchClient, ecsClient, "cluster", "service", tt.alarmName, tt.datapoints, 100*time.Millisecond, noBackoff)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+			assert.Equal(t, tt.expectedDesiredCount, desiredCount)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+)
+
+// waitForHttpGet gets the url with the backoff until the validation accepts the response
+// or the timeout expires. The validation returns an error that describes the unexpected
+// response, the url is requested again until the load balancer and its targets are ready.
+func waitForHttpGet(t *testing.T, url string, timeout time.Duration, backoff waiter.Backoff, validate func(statusCode int, body string) error) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return waiter.ForWithBackoff(t, fmt.Sprintf("GET %s", url), timeout, backoff, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return waiter.Stop(err)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		return validate(res.StatusCode, string(body))
+	})
+}
@@ -1,11 +1,21 @@
 package modules
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/atlas"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func DeployMongoDBSecurityUsingTerraform(t *testing.T, workingDir string) {
@@ -23,7 +33,7 @@ func DeployMongoDBSecurityUsingTerraform(t *testing.T, workingDir string) {
 // It loads the Terraform options, gets the public and private keys from SecretsManager to connect to the MongoDB SDK,
 // creates an admin client, and validates the outputs and VPC peering configuration.
 // MONGODB_SECRET_ARN environment variable must be set to the ARN of the secret containing the MongoDB public and private keys.
-func ValidateMongoDBSecurity(t *testing.T, workingDir string) {
+func ValidateMongoDBSecurity(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
 
 	// CASE: MongoDB Security outputs are correct
@@ -38,3 +48,143 @@ func ValidateMongoDBSecurity(t *testing.T, workingDir string) {
 	assert.Equal(t, 1, len(authorizedIamRoles), "Expected 1 authorized IAM role, got %d", len(authorizedIamRoles))
 
 }
+
+func DeployMongoDBClusterUsingTerraform(t *testing.T, workingDir string) {
+	// Generate a unique ID
+	uniqueId := strings.ToLower(random.UniqueId())
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: workingDir,
+		Vars: map[string]interface{}{
+			"random_id": uniqueId,
+		},
+	})
+
+	// Save the options so later test stages can use them
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// mongoDBClusterInputs are the inputs of the mongodb-cluster module that are
+// observable through the Atlas Admin API.
+type mongoDBClusterInputs struct {
+	projectName                 string
+	clusterName                 string
+	mongoDBVersion              string
+	diskSizeGB                  float64
+	instanceName                string
+	region                      string
+	enableAutoScaling           bool
+	enableAutomatedPatches      bool
+	enableBackups               bool
+	enableTerminationProtection bool
+}
+
+// ValidateMongoDBCluster validates the MongoDB Cluster Terraform module.
+// It creates an Atlas admin client with the keys in the secret of MONGODB_SECRET_ARN and checks that the
+// cluster is idle and configured with the inputs of the deploy-mongodb-cluster example.
+// MONGODB_ATLAS_BASE_URL can be set to validate against an Atlas Admin API other than cloud.mongodb.com.
+func ValidateMongoDBCluster(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	// The inputs of examples/deploy-mongodb-cluster, the rest are the module defaults
+	expected := mongoDBClusterInputs{
+		projectName:                 "Sandbox",
+		clusterName:                 fmt.Sprintf("mongo-cluster-test%s", terraformOptions.Vars["random_id"]),
+		mongoDBVersion:              "5.0",
+		diskSizeGB:                  10,
+		instanceName:                "M10",
+		region:                      "us-east-1",
+		enableAutoScaling:           true,
+		enableAutomatedPatches:      true,
+		enableBackups:               true,
+		enableTerminationProtection: false,
+	}
+
+	// CASE: MongoDB Cluster outputs are correct
+	clusterState := terraform.Output(t, terraformOptions, "cluster_state")
+	assert.Equal(t, "IDLE", clusterState, "Expected cluster state to be IDLE, got %s", clusterState)
+
+	clusterVersion := terraform.Output(t, terraformOptions, "cluster_mongodb_version")
+	assert.True(t, strings.HasPrefix(clusterVersion, expected.mongoDBVersion+"."), "Expected cluster version %s to be a %s release", clusterVersion, expected.mongoDBVersion)
+
+	// CASE: MongoDB Cluster is configured with the module inputs
+	client := newAtlasClient(t, clients)
+	cluster, err := client.GetCluster(context.TODO(), expected.projectName, expected.clusterName)
+	require.NoError(t, err)
+
+	assertMongoDBClusterMatchesInputs(t, cluster, expected)
+}
+
+// newAtlasClient creates an Atlas admin client with the programmatic API keys stored in the
+// secret of MONGODB_SECRET_ARN. The secret is the one the mongodbatlas provider reads, it is
+// read from its own region rather than the region of the test.
+func newAtlasClient(t *testing.T, clients *awsclients.Clients) *atlas.Client {
+	secretArn := os.Getenv("MONGODB_SECRET_ARN")
+	require.NotEmpty(t, secretArn, "MONGODB_SECRET_ARN must be set to validate MongoDB modules")
+
+	parsed, err := arn.Parse(secretArn)
+	require.NoError(t, err, "MONGODB_SECRET_ARN must be a secret ARN")
+
+	keys := struct {
+		PublicKey  string `json:"public_key"`
+		PrivateKey string `json:"private_key"`
+	}{}
+	secretString := getSecretValue(t, clients.InRegion(parsed.Region).SecretsManager(), secretArn)
+	require.NoError(t, json.Unmarshal([]byte(secretString), &keys), "Expected MONGODB_SECRET_ARN to contain public_key and private_key")
+
+	client, err := atlas.NewClient(os.Getenv(atlas.BaseURLEnvVar), keys.PublicKey, keys.PrivateKey)
+	require.NoError(t, err)
+	return client
+}
+
+// assertMongoDBClusterMatchesInputs asserts that the cluster is configured with the module inputs
+func assertMongoDBClusterMatchesInputs(t *testing.T, cluster *atlas.Cluster, expected mongoDBClusterInputs) {
+	// Check the state and version of the cluster
+	assert.Equal(t, "IDLE", cluster.StateName, "Expected cluster state to be IDLE, got %s", cluster.StateName)
+	assert.Equal(t, "REPLICASET", cluster.ClusterType)
+	assert.Equal(t, expected.mongoDBVersion, cluster.MongoDBMajorVersion, "Expected MongoDB version %s, got %s", expected.mongoDBVersion, cluster.MongoDBMajorVersion)
+	if expected.enableAutomatedPatches {
+		assert.Equal(t, "LTS", cluster.VersionReleaseSystem, "Expected automated patches to use the LTS release system")
+	}
+
+	// Check the region of the cluster, i.e. us-east-1 is US_EAST_1
+	assert.Equal(t, "AWS", cluster.ProviderName)
+	assert.Equal(t, strings.ToUpper(strings.ReplaceAll(expected.region, "-", "_")), cluster.RegionName)
+	assert.Equal(t, 3, cluster.ElectableNodes, "Expected 3 electable nodes, got %d", cluster.ElectableNodes)
+	assert.Equal(t, 7, cluster.Priority, "Expected the region to have the highest priority, got %d", cluster.Priority)
+
+	// Check the backups and termination protection
+	assert.Equal(t, expected.enableBackups, cluster.BackupEnabled, "Expected cloud backups enabled to be %t", expected.enableBackups)
+	assert.Equal(t, expected.enableBackups, cluster.PitEnabled, "Expected point in time recovery enabled to be %t", expected.enableBackups)
+	assert.Equal(t, expected.enableTerminationProtection, cluster.TerminationProtectionEnabled, "Expected termination protection enabled to be %t", expected.enableTerminationProtection)
+
+	// Check the auto scaling of the cluster tier and storage
+	assert.Equal(t, expected.enableAutoScaling, cluster.ComputeAutoScalingEnabled, "Expected compute auto scaling enabled to be %t", expected.enableAutoScaling)
+	assert.Equal(t, expected.enableAutoScaling, cluster.ComputeScaleDownEnabled, "Expected compute scale down enabled to be %t", expected.enableAutoScaling)
+	assert.Equal(t, expected.enableAutoScaling, cluster.DiskAutoScalingEnabled, "Expected disk auto scaling enabled to be %t", expected.enableAutoScaling)
+
+	if !expected.enableAutoScaling {
+		// The disk and tier can only drift from the inputs when auto scaling is enabled
+		assert.Equal(t, expected.instanceName, cluster.InstanceSize, "Expected instance size %s, got %s", expected.instanceName, cluster.InstanceSize)
+		assert.Equal(t, expected.diskSizeGB, cluster.DiskSizeGB, "Expected disk size %.0fGB, got %.0fGB", expected.diskSizeGB, cluster.DiskSizeGB)
+		return
+	}
+
+	assert.Equal(t, "M10", cluster.MinInstanceSize, "Expected minimum instance size M10, got %s", cluster.MinInstanceSize)
+	assert.Equal(t, "M50", cluster.MaxInstanceSize, "Expected maximum instance size M50, got %s", cluster.MaxInstanceSize)
+	assertInstanceSizeIsBetween(t, cluster.InstanceSize, "M10", "M50")
+	assert.GreaterOrEqual(t, cluster.DiskSizeGB, expected.diskSizeGB, "Expected disk size of at least %.0fGB, got %.0fGB", expected.diskSizeGB, cluster.DiskSizeGB)
+}
+
+// assertInstanceSizeIsBetween asserts that the instance size is within the auto scaling bounds
+func assertInstanceSizeIsBetween(t *testing.T, instanceSize string, min string, max string) {
+	tier, err := atlas.InstanceSizeTier(instanceSize)
+	if !assert.NoError(t, err) {
+		return
+	}
+	minTier, _ := atlas.InstanceSizeTier(min)
+	maxTier, _ := atlas.InstanceSizeTier(max)
+
+	assert.True(t, tier >= minTier && tier <= maxTier, "Expected instance size %s to be between %s and %s", instanceSize, min, max)
+}
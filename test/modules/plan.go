@@ -0,0 +1,88 @@
+package modules
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planRegion is the region that offline plans are run against
+const planRegion = "us-east-1"
+
+// planUsingTerraform runs terraform init and plan for the example in the working dir
+// without access to an AWS account. The AWS provider is pointed at an in-process fake
+// of the AWS APIs using mocked credentials, so only the data sources that the fake
+// answers can be read. The plan is parsed from `terraform show -json` into a PlanStruct.
+func planUsingTerraform(t *testing.T, workingDir string, vars map[string]interface{}) *terraform.PlanStruct {
+	server := fakeaws.NewServer(t, planRegion)
+
+	terraformOptions := &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: workingDir,
+		Vars:         vars,
+		EnvVars:      server.EnvVars(),
+		PlanFilePath: filepath.Join(t.TempDir(), "plan.out"),
+	}
+
+	return terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+}
+
+// plannedResources returns the planned managed resources whose address is the given
+// address or an instance of it (i.e. module.vpc.aws_subnet.public[0]).
+func plannedResources(plan *terraform.PlanStruct, address string) []*tfjson.StateResource {
+	resources := []*tfjson.StateResource{}
+	for key, resource := range plan.ResourcePlannedValuesMap {
+		if resource.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		if key == address || strings.HasPrefix(key, address+"[") {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// plannedAttribute returns the planned value of the attribute for the resource at the
+// address. The test fails if the resource is not in the plan.
+func plannedAttribute(t *testing.T, plan *terraform.PlanStruct, address string, attribute string) interface{} {
+	terraform.RequirePlannedValuesMapKeyExists(t, plan, address)
+	return plan.ResourcePlannedValuesMap[address].AttributeValues[attribute]
+}
+
+// assertResourceCount asserts that the number of instances planned for the resource
+// address matches the expected count. This is used to assert count/for_each branches.
+func assertResourceCount(t *testing.T, plan *terraform.PlanStruct, address string, expected int) {
+	actual := len(plannedResources(plan, address))
+	assert.Equal(t, expected, actual, "Expected %d instances of %s, got %d", expected, address, actual)
+}
+
+// assertPlannedAttribute asserts that the planned attribute of the resource at the
+// address has the expected value.
+func assertPlannedAttribute(t *testing.T, plan *terraform.PlanStruct, address string, attribute string, expected interface{}) {
+	actual := plannedAttribute(t, plan, address, attribute)
+	assert.Equal(t, expected, actual, "Expected %s.%s to be %v, got %v", address, attribute, expected, actual)
+}
+
+// assertPlanOnlyCreates asserts that a plan of a fresh working dir only creates
+// resources, anything else implies that the plan is reading unexpected state.
+func assertPlanOnlyCreates(t *testing.T, plan *terraform.PlanStruct) {
+	for address, change := range plan.ResourceChangesMap {
+		if change.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		require.NotNil(t, change.Change, "Expected %s to have a planned change", address)
+		assert.True(t, change.Change.Actions.Create(), "Expected %s to be created, got %v", address, change.Change.Actions)
+	}
+}
+
+// indexedAddress returns the address of the count instance of the resource
+func indexedAddress(address string, index int) string {
+	return fmt.Sprintf("%s[%d]", address, index)
+}
@@ -0,0 +1,30 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/aws"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+// AwsRegions are the regions that the examples can be deployed to
+var AwsRegions = []string{"us-east-1", "us-east-2"}
+
+// SaveAwsRegion saves the region that the test was scheduled to deploy the example
+// in the working dir to, so the deploy functions use it instead of a random region.
+func SaveAwsRegion(t *testing.T, workingDir string, awsRegion string) {
+	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+}
+
+// getAwsRegion returns the region saved for the working dir by SaveAwsRegion. When the
+// test was not scheduled, a random stable region is picked and saved so later test
+// stages can use it.
+func getAwsRegion(t *testing.T, workingDir string) string {
+	if test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(workingDir, "awsRegion.json")) {
+		return test_structure.LoadString(t, workingDir, "awsRegion")
+	}
+
+	awsRegion := aws.GetRandomStableRegion(t, AwsRegions, nil)
+	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+	return awsRegion
+}
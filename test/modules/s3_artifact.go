@@ -0,0 +1,371 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The s3-artifact module does not expose its regions to the examples,
+// so the buckets are always deployed to the module's default regions.
+const (
+	s3ArtifactPrimaryRegion = "us-east-1"
+	s3ArtifactReplicaRegion = "us-east-2"
+)
+
+// DeployS3ArtifactUsingTerraform saves the Terraform options of the s3-artifact example in the given working dir
+func DeployS3ArtifactUsingTerraform(t *testing.T, workingDir string) {
+	// Generate a unique ID, bucket names must be lowercase
+	uniqueId := strings.ToLower(random.UniqueId())
+	test_structure.SaveString(t, workingDir, "awsRegion", s3ArtifactPrimaryRegion)
+
+	// Construct the terraform options with default retryable errors to handle the most common retryable errors in
+	// terraform testing.
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: workingDir,
+		Vars: map[string]interface{}{
+			"bucket_name": fmt.Sprintf("artifact-test%s", uniqueId),
+		},
+	})
+
+	// Save the options so later test stages can use them
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// ValidateS3Artifact validates the deploy-s3-artifact example, which
+// enables the storage class transitions of the bucket.
+func ValidateS3Artifact(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	validateS3Artifact(t, workingDir, clients, false, true)
+}
+
+// ValidateS3ArtifactPublicBucket validates the deploy-s3-artifact-public-bucket
+// example, which allows public reads of the bucket's objects.
+func ValidateS3ArtifactPublicBucket(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	validateS3Artifact(t, workingDir, clients, true, false)
+}
+
+// ValidateS3ArtifactWithoutStorageTransition validates the
+// deploy-s3-artifact-wo-storage-transition example, which uses the
+// module's defaults.
+func ValidateS3ArtifactWithoutStorageTransition(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	validateS3Artifact(t, workingDir, clients, false, false)
+}
+
+// validateS3Artifact validates the s3-artifact module with the
+// following assertions:
+// - The primary and replica buckets are versioned
+// - The primary and replica buckets are encrypted with KMS
+// - The public access block reflects enable_public_access
+// - The bucket policy and CORS configuration exist only when public
+// - The lifecycle rules reflect enable_storage_class_transition
+// - Objects put in the primary bucket are replicated to the replica bucket
+func validateS3Artifact(t *testing.T, workingDir string, clients *awsclients.Clients, enablePublicAccess bool, enableStorageClassTransition bool) {
+	// Load the Terraform Options saved by the earlier deploy_terraform stage
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	// Get outputs for assertions
+	primaryBucket := terraform.Output(t, terraformOptions, "primary_s3-artifact-id")
+	primaryArn := terraform.Output(t, terraformOptions, "primary_s3-artifact-arn")
+	replicaBuckets := terraform.OutputList(t, terraformOptions, "replica_s3-artifact-id")
+	replicaArns := terraform.OutputList(t, terraformOptions, "replica_s3-artifact-arn")
+
+	// The replica is enabled by default in every example
+	require.Equal(t, 1, len(replicaBuckets), "Expected 1 replica bucket, got %d", len(replicaBuckets))
+	require.Equal(t, 1, len(replicaArns), "Expected 1 replica bucket arn, got %d", len(replicaArns))
+	replicaBucket := replicaBuckets[0]
+	assert.Equal(t, "replica-"+primaryBucket, replicaBucket, "Expected replica bucket to be named after the primary bucket")
+
+	// The buckets are in the module's regions rather than the region of the test
+	primaryClient := clients.InRegion(s3ArtifactPrimaryRegion).S3()
+	replicaClient := clients.InRegion(s3ArtifactReplicaRegion).S3()
+
+	for _, bucket := range []struct {
+		client s3API
+		name   string
+	}{
+		{primaryClient, primaryBucket},
+		{replicaClient, replicaBucket},
+	} {
+		assertS3BucketVersioningIsEnabled(t, bucket.client, bucket.name)
+		assertS3BucketIsKmsEncrypted(t, bucket.client, bucket.name)
+		assertS3BucketPublicAccessBlock(t, bucket.client, bucket.name, enablePublicAccess)
+	}
+
+	// Check the policy and CORS configuration of public buckets
+	if enablePublicAccess {
+		assertS3BucketAllowsPublicReads(t, primaryClient, primaryBucket, primaryArn)
+		assertS3BucketCorsAllowsGet(t, primaryClient, primaryBucket)
+	} else {
+		assertS3BucketHasNoPolicy(t, primaryClient, primaryBucket)
+		assertS3BucketHasNoCors(t, primaryClient, primaryBucket)
+	}
+
+	// Check the lifecycle management of the primary bucket
+	assertS3BucketLifecycleRules(t, primaryClient, primaryBucket, enableStorageClassTransition)
+
+	// Check that objects are replicated to the replica bucket
+	assertS3BucketReplicationConfiguration(t, primaryClient, primaryBucket, replicaArns[0])
+	assertS3BucketReplicatesObjects(t, primaryClient, replicaClient, primaryBucket, replicaBucket)
+}
+
+// assertS3BucketVersioningIsEnabled asserts that object versioning is enabled for the bucket
+func assertS3BucketVersioningIsEnabled(t *testing.T, client s3API, bucket string) {
+	versioning, err := client.GetBucketVersioning(context.TODO(), &s3.GetBucketVersioningInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the versioning of %s", bucket)
+
+	assert.Equal(t, s3types.BucketVersioningStatusEnabled, versioning.Status, "Expected versioning of %s to be Enabled, got %s", bucket, versioning.Status)
+}
+
+// assertS3BucketIsKmsEncrypted asserts that the bucket is encrypted server side using KMS
+func assertS3BucketIsKmsEncrypted(t *testing.T, client s3API, bucket string) {
+	encryption, err := client.GetBucketEncryption(context.TODO(), &s3.GetBucketEncryptionInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the encryption of %s", bucket)
+
+	rules := encryption.ServerSideEncryptionConfiguration.Rules
+	require.Equal(t, 1, len(rules), "Expected 1 encryption rule for %s, got %d", bucket, len(rules))
+	require.NotNil(t, rules[0].ApplyServerSideEncryptionByDefault, "Expected %s to have default encryption", bucket)
+
+	algorithm := rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm
+	assert.Equal(t, s3types.ServerSideEncryptionAwsKms, algorithm, "Expected %s to be encrypted with aws:kms, got %s", bucket, algorithm)
+}
+
+// assertS3BucketPublicAccessBlock asserts that public ACLs are always blocked and that
+// public policies are only blocked when public access is not enabled
+func assertS3BucketPublicAccessBlock(t *testing.T, client s3API, bucket string, enablePublicAccess bool) {
+	block, err := client.GetPublicAccessBlock(context.TODO(), &s3.GetPublicAccessBlockInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the public access block of %s", bucket)
+
+	config := block.PublicAccessBlockConfiguration
+	assert.True(t, config.BlockPublicAcls, "Expected %s to block public ACLs", bucket)
+	assert.True(t, config.IgnorePublicAcls, "Expected %s to ignore public ACLs", bucket)
+	assert.True(t, config.RestrictPublicBuckets, "Expected %s to restrict public buckets", bucket)
+	assert.Equal(t, !enablePublicAccess, config.BlockPublicPolicy, "Expected block public policy of %s to be %t", bucket, !enablePublicAccess)
+}
+
+// assertS3BucketAllowsPublicReads asserts that the bucket policy allows anyone to get objects
+func assertS3BucketAllowsPublicReads(t *testing.T, client s3API, bucket string, bucketArn string) {
+	policy, err := client.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the policy of %s", bucket)
+
+	document := struct {
+		Statement []struct {
+			Effect    string
+			Principal interface{}
+			Action    interface{}
+			Resource  interface{}
+		}
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(*policy.Policy), &document), "Error parsing the policy of %s", bucket)
+
+	require.Equal(t, 1, len(document.Statement), "Expected 1 policy statement for %s, got %d", bucket, len(document.Statement))
+	statement := document.Statement[0]
+	assert.Equal(t, "Allow", statement.Effect)
+	assert.Equal(t, "*", statement.Principal)
+	assert.Equal(t, "s3:GetObject", statement.Action)
+	assert.Equal(t, bucketArn+"/*", statement.Resource)
+}
+
+// assertS3BucketCorsAllowsGet asserts that the CORS configuration allows GET requests from any origin
+func assertS3BucketCorsAllowsGet(t *testing.T, client s3API, bucket string) {
+	cors, err := client.GetBucketCors(context.TODO(), &s3.GetBucketCorsInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the CORS configuration of %s", bucket)
+
+	require.Equal(t, 1, len(cors.CORSRules), "Expected 1 CORS rule for %s, got %d", bucket, len(cors.CORSRules))
+	rule := cors.CORSRules[0]
+	assert.Equal(t, []string{"*"}, rule.AllowedHeaders)
+	assert.Equal(t, []string{"GET"}, rule.AllowedMethods)
+	assert.Equal(t, []string{"*"}, rule.AllowedOrigins)
+	assert.Equal(t, []string{"ETag"}, rule.ExposeHeaders)
+	assert.Equal(t, int32(3000), rule.MaxAgeSeconds)
+}
+
+// assertS3BucketHasNoPolicy asserts that a private bucket does not have a bucket policy
+func assertS3BucketHasNoPolicy(t *testing.T, client s3API, bucket string) {
+	_, err := client.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{
+		Bucket: &bucket,
+	})
+	assertS3ErrorCode(t, err, "NoSuchBucketPolicy")
+}
+
+// assertS3BucketHasNoCors asserts that a private bucket does not have a CORS configuration
+func assertS3BucketHasNoCors(t *testing.T, client s3API, bucket string) {
+	_, err := client.GetBucketCors(context.TODO(), &s3.GetBucketCorsInput{
+		Bucket: &bucket,
+	})
+	assertS3ErrorCode(t, err, "NoSuchCORSConfiguration")
+}
+
+// assertS3ErrorCode asserts that the error is an S3 API error with the code
+func assertS3ErrorCode(t *testing.T, err error, code string) {
+	var apiErr smithy.APIError
+	if assert.True(t, errors.As(err, &apiErr), "Expected %s error, got %v", code, err) {
+		assert.Equal(t, code, apiErr.ErrorCode())
+	}
+}
+
+// assertS3BucketLifecycleRules asserts that noncurrent versions always expire after 30 days
+// and that objects transition to STANDARD_IA after 30 days and to GLACIER after 90 days
+// when storage class transitions are enabled
+func assertS3BucketLifecycleRules(t *testing.T, client s3API, bucket string, enableStorageClassTransition bool) {
+	lifecycle, err := client.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the lifecycle configuration of %s", bucket)
+
+	rules := map[string]s3types.LifecycleRule{}
+	for _, rule := range lifecycle.Rules {
+		rules[*rule.ID] = rule
+	}
+
+	// Check the noncurrent version expiration
+	expire, ok := rules[bucket+"-expire-noncurrent-versions"]
+	if assert.True(t, ok, "Expected %s to have a noncurrent version expiration rule", bucket) {
+		assert.Equal(t, s3types.ExpirationStatusEnabled, expire.Status)
+		require.NotNil(t, expire.NoncurrentVersionExpiration)
+		assert.Equal(t, int32(30), expire.NoncurrentVersionExpiration.NoncurrentDays)
+		assert.Equal(t, int32(1), expire.NoncurrentVersionExpiration.NewerNoncurrentVersions)
+	}
+
+	// Check the storage class transitions
+	downgrade, ok := rules[bucket+"-downgrade-storage-class"]
+	if !enableStorageClassTransition {
+		assert.False(t, ok, "Expected %s to not have a storage class transition rule", bucket)
+		assert.Equal(t, 1, len(lifecycle.Rules), "Expected 1 lifecycle rule for %s, got %d", bucket, len(lifecycle.Rules))
+		return
+	}
+
+	if assert.True(t, ok, "Expected %s to have a storage class transition rule", bucket) {
+		assert.Equal(t, s3types.ExpirationStatusEnabled, downgrade.Status)
+		transitions := map[s3types.TransitionStorageClass]int32{}
+		for _, transition := range downgrade.Transitions {
+			transitions[transition.StorageClass] = transition.Days
+		}
+		assert.Equal(t, map[s3types.TransitionStorageClass]int32{
+			s3types.TransitionStorageClassStandardIa: 30,
+			s3types.TransitionStorageClassGlacier:    90,
+		}, transitions, "Expected %s to transition to STANDARD_IA after 30 days and GLACIER after 90 days", bucket)
+	}
+}
+
+// assertS3BucketReplicationConfiguration asserts that the bucket replicates to the replica bucket
+func assertS3BucketReplicationConfiguration(t *testing.T, client s3API, bucket string, replicaArn string) {
+	replication, err := client.GetBucketReplication(context.TODO(), &s3.GetBucketReplicationInput{
+		Bucket: &bucket,
+	})
+	require.NoError(t, err, "Error getting the replication configuration of %s", bucket)
+
+	rules := replication.ReplicationConfiguration.Rules
+	require.Equal(t, 1, len(rules), "Expected 1 replication rule for %s, got %d", bucket, len(rules))
+	assert.Equal(t, s3types.ReplicationRuleStatusEnabled, rules[0].Status)
+	assert.Equal(t, replicaArn, *rules[0].Destination.Bucket)
+	assert.Equal(t, s3types.StorageClassGlacier, rules[0].Destination.StorageClass)
+}
+
+// assertS3BucketReplicatesObjects puts an object in the primary bucket and asserts that
+// it is replicated to the replica bucket. The replica is stored in GLACIER and cannot be
+// read back, so the object's metadata and size are compared instead. Both buckets are
+// emptied afterwards so that terraform can destroy them.
+func assertS3BucketReplicatesObjects(t *testing.T, primaryClient s3API, replicaClient s3API, primaryBucket string, replicaBucket string) {
+	defer emptyS3Bucket(t, replicaClient, replicaBucket)
+	defer emptyS3Bucket(t, primaryClient, primaryBucket)
+
+	key := fmt.Sprintf("terratest/%s.txt", strings.ToLower(random.UniqueId()))
+	body := fmt.Sprintf("Replicated from %s", primaryBucket)
+	testId := random.UniqueId()
+
+	_, err := primaryClient.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:   &primaryBucket,
+		Key:      &key,
+		Body:     strings.NewReader(body),
+		Metadata: map[string]string{"test-id": testId},
+	})
+	require.NoError(t, err, "Error putting %s in %s", key, primaryBucket)
+
+	// Replication is asynchronous and usually completes within a few minutes
+	var replica *s3.HeadObjectOutput
+	err = waiter.For(t, fmt.Sprintf("%s to be replicated", key), 10*time.Minute, func(ctx context.Context) error {
+		head, err := replicaClient.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: &replicaBucket,
+			Key:    &key,
+		})
+		if err != nil {
+			return fmt.Errorf("object %s is not replicated yet: %w", key, err)
+		}
+		replica = head
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, s3types.ReplicationStatusReplica, replica.ReplicationStatus, "Expected %s to be a replica", key)
+	assert.Equal(t, s3types.StorageClassGlacier, replica.StorageClass, "Expected %s to be replicated to GLACIER", key)
+	assert.Equal(t, int64(len(body)), replica.ContentLength, "Expected the replica of %s to be %d bytes", key, len(body))
+	assert.Equal(t, testId, replica.Metadata["test-id"], "Expected the replica of %s to keep its metadata", key)
+
+	// The source object reports the replication as completed
+	primary, err := primaryClient.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: &primaryBucket,
+		Key:    &key,
+	})
+	require.NoError(t, err, "Error getting %s from %s", key, primaryBucket)
+	assert.Equal(t, s3types.ReplicationStatusComplete, primary.ReplicationStatus, "Expected replication of %s to be COMPLETED", key)
+}
+
+// emptyS3Bucket deletes every object version and delete marker in the bucket
+func emptyS3Bucket(t *testing.T, client s3API, bucket string) {
+	paginator := s3.NewListObjectVersionsPaginator(client, &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			t.Errorf("Error listing the object versions of %s: %s", bucket, err)
+			return
+		}
+
+		objects := []s3types.ObjectIdentifier{}
+		for _, version := range page.Versions {
+			objects = append(objects, s3types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, s3types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			continue
+		}
+
+		_, err = client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &s3types.Delete{Objects: objects},
+		})
+		if err != nil {
+			t.Errorf("Error deleting the object versions of %s: %s", bucket, err)
+		}
+	}
+}
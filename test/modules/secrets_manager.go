@@ -0,0 +1,202 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// DeploySecretsManagerUsingTerraform saves the Terraform options of the secrets-manager example with random secrets in the given working dir
+func DeploySecretsManagerUsingTerraform(t *testing.T, workingDir string) {
+	// Generate a unique ID
+	uniqueId := random.UniqueId()
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
+
+	// Generate secrets with random values so that the values read
+	// back from secrets manager can only come from this deployment
+	secrets := []map[string]interface{}{
+		{
+			"name":        fmt.Sprintf("testing/secrets-manager/test%s/app", uniqueId),
+			"description": "Application secrets generated by terratest",
+			"environment_variables": map[string]interface{}{
+				"DB_PASSWORD": random.UniqueId(),
+				"API_KEY":     random.UniqueId(),
+			},
+		},
+		{
+			"name": fmt.Sprintf("testing/secrets-manager/test%s/service", uniqueId),
+			"environment_variables": map[string]interface{}{
+				"TOKEN": random.UniqueId(),
+			},
+		},
+	}
+
+	// Construct the terraform options with default retryable errors to handle the most common retryable errors in
+	// terraform testing.
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// The path to where our Terraform code is located
+		TerraformDir: workingDir,
+		Vars: map[string]interface{}{
+			"region":  awsRegion,
+			"secrets": secrets,
+		},
+	})
+
+	// Save the options so later test stages can use them
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// ValidateSecretsManager validates the secrets-manager module with the
+// following assertions:
+// - Each secret in secret_names holds the JSON encoded environment variables
+// - Each secret_arn_references entry is a valid ECS valueFrom reference
+// - Each secret_arn_references entry resolves to an input environment variable
+func ValidateSecretsManager(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	// Load the Terraform Options saved by the earlier deploy_terraform stage
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+	awsRegion := clients.Region()
+	client := clients.SecretsManager()
+
+	// The options are loaded from JSON, so the secrets are decoded generically
+	secrets := expectedSecrets(t, terraformOptions)
+
+	// Get outputs for assertions
+	secretNames := terraform.OutputList(t, terraformOptions, "secret_names")
+	secretArns := terraform.OutputList(t, terraformOptions, "secret_arns")
+	secretArnReferences := terraform.OutputList(t, terraformOptions, "secret_arn_references")
+
+	require.Equal(t, len(secrets), len(secretNames), "Expected %d secret names, got %d", len(secrets), len(secretNames))
+	require.Equal(t, len(secrets), len(secretArns), "Expected %d secret arns, got %d", len(secrets), len(secretArns))
+
+	// Check that each secret round trips through secrets manager
+	secretValues := map[string]map[string]string{}
+	for i, secretName := range secretNames {
+		assert.Equal(t, secrets[i].name, secretName, "Expected secret %d to be named %s, got %s", i, secrets[i].name, secretName)
+
+		secretValues[secretArns[i]] = assertSecretValueMatches(t, client, secretName, secrets[i].environmentVariables)
+	}
+
+	// Check that each reference can be consumed by an ECS container definition
+	expectedReferences := 0
+	for _, secret := range secrets {
+		expectedReferences += len(secret.environmentVariables)
+	}
+	assert.Equal(t, expectedReferences, len(secretArnReferences), "Expected %d secret arn references, got %d", expectedReferences, len(secretArnReferences))
+
+	for _, reference := range secretArnReferences {
+		assertSecretArnReferenceResolves(t, reference, awsRegion, secretValues)
+	}
+}
+
+// expectedSecret is a secret passed to the module
+type expectedSecret struct {
+	name                 string
+	environmentVariables map[string]string
+}
+
+// expectedSecrets returns the secrets passed to the module through the terraform options
+func expectedSecrets(t *testing.T, terraformOptions *terraform.Options) []expectedSecret {
+	vars, ok := terraformOptions.Vars["secrets"].([]interface{})
+	require.True(t, ok, "Expected the secrets variable to be a list, got %T", terraformOptions.Vars["secrets"])
+
+	secrets := []expectedSecret{}
+	for _, v := range vars {
+		secret := v.(map[string]interface{})
+
+		environmentVariables := map[string]string{}
+		for key, value := range secret["environment_variables"].(map[string]interface{}) {
+			environmentVariables[key] = value.(string)
+		}
+
+		secrets = append(secrets, expectedSecret{
+			name:                 secret["name"].(string),
+			environmentVariables: environmentVariables,
+		})
+	}
+	return secrets
+}
+
+// assertSecretValueMatches reads the secret, decodes its JSON value and asserts that it
+// matches the environment variables passed to the module. The decoded value is returned.
+func assertSecretValueMatches(t *testing.T, client secretsManagerAPI, secretName string, expected map[string]string) map[string]string {
+	secretString := getSecretValue(t, client, secretName)
+
+	actual := map[string]string{}
+	err := json.Unmarshal([]byte(secretString), &actual)
+	require.NoError(t, err, "Expected secret %s to be a JSON object of strings", secretName)
+
+	assert.Equal(t, expected, actual, "Expected secret %s to contain the environment variables passed to the module", secretName)
+	return actual
+}
+
+// getSecretValue returns the string value of the secret, like GetSecretValue from
+// terratest but with the client that the validators were given
+func getSecretValue(t *testing.T, client secretsManagerAPI, secretId string) string {
+	output, err := client.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+		SecretId: &secretId,
+	})
+	require.NoError(t, err, "Error getting the value of secret %s", secretId)
+	return aws_sdk.ToString(output.SecretString)
+}
+
+// assertSecretArnReferenceResolves asserts that the reference is in the format ECS expects
+// for the valueFrom of a container secret and that it resolves to a key of a managed secret.
+func assertSecretArnReferenceResolves(t *testing.T, reference string, awsRegion string, secretValues map[string]map[string]string) {
+	secretArn, jsonKey, err := parseSecretArnReference(reference)
+	if !assert.NoError(t, err, "Expected %s to be a valid ECS valueFrom reference", reference) {
+		return
+	}
+
+	// ECS can only read secrets from the region the task runs in
+	parsed, _ := arn.Parse(secretArn)
+	assert.Equal(t, awsRegion, parsed.Region, "Expected %s to be in %s", reference, awsRegion)
+
+	values, ok := secretValues[secretArn]
+	if !assert.True(t, ok, "Expected %s to reference a secret managed by the module", reference) {
+		return
+	}
+	_, ok = values[jsonKey]
+	assert.True(t, ok, "Expected the key %s of %s to be in the secret", jsonKey, reference)
+}
+
+// parseSecretArnReference parses a Secrets Manager valueFrom reference of an ECS container
+// secret into the secret ARN and the JSON key. The reference is in the format
+// arn:aws:secretsmanager:region:aws_account_id:secret:secret-name:json-key:version-stage:version-id
+// where the version stage and id are left empty to use the current version of the secret.
+func parseSecretArnReference(reference string) (string, string, error) {
+	parsed, err := arn.Parse(reference)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Service != "secretsmanager" {
+		return "", "", fmt.Errorf("expected a secretsmanager ARN, got %s", parsed.Service)
+	}
+
+	// secret:secret-name:json-key:version-stage:version-id
+	resource := strings.Split(parsed.Resource, ":")
+	if len(resource) != 5 || resource[0] != "secret" {
+		return "", "", fmt.Errorf("expected resource secret:secret-name:json-key:version-stage:version-id, got %s", parsed.Resource)
+	}
+	if resource[2] == "" {
+		return "", "", fmt.Errorf("expected reference to a json key")
+	}
+	if resource[3] != "" || resource[4] != "" {
+		return "", "", fmt.Errorf("expected reference to the current version, got stage %q and id %q", resource[3], resource[4])
+	}
+
+	parsed.Resource = strings.Join(resource[:2], ":")
+	return parsed.String(), resource[2], nil
+}
@@ -0,0 +1,159 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// RunIdEnvVar overrides the id of the test run, the CircleCI workflow and job are used when it is not set
+	RunIdEnvVar = "TERRATEST_RUN_ID"
+
+	// TtlEnvVar overrides how long the deployed resources are expected to live
+	TtlEnvVar = "TERRATEST_TTL"
+
+	defaultTtl = 6 * time.Hour
+)
+
+var (
+	runIdOnce sync.Once
+	runId     string
+
+	gitShaOnce sync.Once
+	gitSha     string
+)
+
+// testRunId returns the id of the test run. Runs outside of CI get a random id
+// that is shared by all the tests of the run.
+func testRunId() string {
+	runIdOnce.Do(func() {
+		switch {
+		case os.Getenv(RunIdEnvVar) != "":
+			runId = os.Getenv(RunIdEnvVar)
+		case os.Getenv("CIRCLE_WORKFLOW_ID") != "":
+			runId = fmt.Sprintf("%s-%s", os.Getenv("CIRCLE_WORKFLOW_ID"), os.Getenv("CIRCLE_BUILD_NUM"))
+		default:
+			runId = "local-" + random.UniqueId()
+		}
+	})
+	return runId
+}
+
+// testGitSha returns the commit that the tests are run from
+func testGitSha() string {
+	gitShaOnce.Do(func() {
+		gitSha = os.Getenv("CIRCLE_SHA1")
+		if gitSha != "" {
+			return
+		}
+
+		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+		if err != nil {
+			gitSha = "unknown"
+			return
+		}
+		gitSha = strings.TrimSpace(string(out))
+	})
+	return gitSha
+}
+
+// TestTags returns the tags that identify the resources deployed by the test
+func TestTags(t *testing.T) map[string]string {
+	ttl := defaultTtl
+	if value := os.Getenv(TtlEnvVar); value != "" {
+		parsed, err := time.ParseDuration(value)
+		require.NoError(t, err, "Expected %s to be a duration, got %s", TtlEnvVar, value)
+		ttl = parsed
+	}
+
+	return map[string]string{
+		util.SuiteTagKey:     util.SuiteTagValue,
+		util.RunIdTagKey:     testRunId(),
+		util.TestNameTagKey:  t.Name(),
+		util.GitShaTagKey:    testGitSha(),
+		util.CreatedAtTagKey: time.Now().UTC().Format(time.RFC3339),
+		util.TtlTagKey:       ttl.String(),
+	}
+}
+
+// SaveTestTags adds the tags of the test to the variables of the Terraform Options saved
+// in the working dir. Every example passes its tags variable to the default_tags of the
+// AWS provider and to the modules that create resources the provider does not tag.
+func SaveTestTags(t *testing.T, workingDir string) {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+	if terraformOptions.Vars == nil {
+		terraformOptions.Vars = map[string]interface{}{}
+	}
+	terraformOptions.Vars["tags"] = TestTags(t)
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// AssertStateIsTagged walks the state of the example in the working dir and fails the
+// test if any taggable AWS resource is missing one of the tags of the test suite.
+func AssertStateIsTagged(t *testing.T, workingDir string) {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	state := &tfjson.State{}
+	err := json.Unmarshal([]byte(terraform.Show(t, terraformOptions)), state)
+	require.NoError(t, err, "Unable to parse the state of %s", workingDir)
+
+	missing := untaggedResources(state)
+	if len(missing) > 0 {
+		t.Fatalf("Expected all the taggable resources of %s to have the tags %s:\n%s", workingDir, util.TestTagKeys, strings.Join(missing, "\n"))
+	}
+}
+
+// untaggedResources returns the addresses and missing tags of the managed resources
+// in the state that have a tags_all attribute, i.e. the resources that the AWS
+// provider applies its default_tags to.
+func untaggedResources(state *tfjson.State) []string {
+	missing := []string{}
+	if state.Values == nil {
+		return missing
+	}
+
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		for _, resource := range module.Resources {
+			if resource.Mode != tfjson.ManagedResourceMode {
+				continue
+			}
+			tagsAll, ok := resource.AttributeValues["tags_all"]
+			if !ok {
+				continue
+			}
+
+			tags, _ := tagsAll.(map[string]interface{})
+			missingKeys := []string{}
+			for _, key := range util.TestTagKeys {
+				if _, ok := tags[key]; !ok {
+					missingKeys = append(missingKeys, key)
+				}
+			}
+			if len(missingKeys) > 0 {
+				missing = append(missing, fmt.Sprintf("  %s: missing %s", resource.Address, strings.Join(missingKeys, ", ")))
+			}
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(state.Values.RootModule)
+
+	sort.Strings(missing)
+	return missing
+}
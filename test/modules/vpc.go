@@ -1,26 +1,30 @@
 package modules
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"testing"
 
-	aws_sdk "github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	terratest_testing "github.com/gruntwork-io/terratest/modules/testing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // DeployVpcUsingTerraform deploys the Terraform code in the given working dir and returns the Terraform output
 func DeployVpcUsingTerraform(t *testing.T, workingDir string) {
-	// Get a random AWS region
-	awsRegion := aws.GetRandomStableRegion(t, []string{"us-east-1", "us-east-2"}, nil)
-	test_structure.SaveString(t, workingDir, "awsRegion", awsRegion)
+	// Get the AWS region the test was scheduled to
+	awsRegion := getAwsRegion(t, workingDir)
 
 	// Generate a unique ID to prevent a naming conflict
 	uniqueID := strings.ToLower(random.UniqueId())
@@ -41,257 +45,444 @@ func DeployVpcUsingTerraform(t *testing.T, workingDir string) {
 }
 
 // ValidateOnlyPublicSubnets validates the VPC has only public subnets
-func ValidateOnlyPublicSubnets(t *testing.T, workingDir string) {
+func ValidateOnlyPublicSubnets(t *testing.T, workingDir string, clients *awsclients.Clients) {
 	// Load the terraform options
 	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
 
-	// Create aws session
-	session, err := session.NewSession()
-	assert.NoError(t, err, "Error creating AWS session")
+	assertOnlyPublicSubnets(t, clients.Ec2(), loadVpcOutputs(t, terraformOptions))
+}
+
+// ValidateVpcNoNat validates the VPC has no NAT Gateway
+func ValidateVpcNoNat(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	// Load the terraform options
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	assertVpcNoNat(t, clients.Ec2(), loadVpcOutputs(t, terraformOptions))
+}
+
+// ValidateVpc validates the VPC
+func ValidateVpc(t *testing.T, workingDir string, clients *awsclients.Clients) {
+	// Load the terraform options
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
 
-	// Create Client
-	ec2Client := ec2.New(session, &aws_sdk.Config{Region: aws_sdk.String(awsRegion)})
+	assertVpc(t, clients.Ec2(), loadVpcOutputs(t, terraformOptions))
+}
 
+// assertOnlyPublicSubnets asserts that the VPC of the outputs has only public subnets
+// that route to the internet gateway
+func assertOnlyPublicSubnets(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
 	// Check that the VPC exists
-	vpcID := assertVpcExists(t, terraformOptions, awsRegion)
+	assertVpcExists(t, ec2Client, outputs.VpcId)
 
 	// Assert that the VPC has the correct number of subnets
-	numAzs, err := strconv.Atoi(terraform.Output(t, terraformOptions, "num_availability_zones"))
-	assert.NoError(t, err, "Error converting num_availability_zones to int")
-	assertVpcHasCorrectNumberOfSubnets(t, terraformOptions, awsRegion, "public_subnet_ids", numAzs)
+	assertVpcHasCorrectNumberOfSubnets(t, outputs.PublicSubnetIds, outputs.NumAvailabilityZones)
+
+	// Assert that the Public CIDR blocks are computed correctly
+	layout := expectedVpcSubnetLayout(t, outputs, true, false)
+	assertPublicCidrBlocksAreCorrect(t, outputs, layout)
 
-	// Get the vpc name
-	// vpcName := terraform.Output(t, terraformOptions, "vpc_name")
 	// Assert that the VPC has no private subnets
-	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{
-		Filters: []*ec2.Filter{
+	subnets, err := ec2Client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{
+		Filters: []types.Filter{
 			{
 				Name:   aws_sdk.String("vpc-id"),
-				Values: []*string{aws_sdk.String(vpcID)},
+				Values: []string{outputs.VpcId},
 			},
 		},
 	})
-	assert.NoError(t, err, "Error describing subnets")
-
-	// get the route table id
-	rtID := terraform.Output(t, terraformOptions, "public_subnet_route_table_id")
-	rt, err := ec2Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
-		RouteTableIds: []*string{
-			aws_sdk.String(rtID),
-		},
-	})
-	assert.NoError(t, err, "Error describing Route Tables")
-
-	// Assert the number of associations is equal the number of subnets
-	assert.Equal(t, len(subnets.Subnets), len(rt.RouteTables[0].Associations), "Expected %d Route Table Associations, got %d", len(subnets.Subnets), len(rt.RouteTables[0].Associations))
+	require.NoError(t, err, "Error describing subnets")
 
-	// Assert that the route table routes to the internet gateway
-	foundIgw := false
-	for _, route := range rt.RouteTables[0].Routes {
-		if strings.Contains(*route.GatewayId, "igw") {
-			foundIgw = true
-			break
-		}
+	subnetIds := []string{}
+	for _, subnet := range subnets.Subnets {
+		subnetIds = append(subnetIds, aws_sdk.ToString(subnet.SubnetId))
 	}
+	assert.ElementsMatch(t, outputs.PublicSubnetIds, subnetIds, "Expected only the public subnets in VPC %s", outputs.VpcId)
 
-	assert.True(t, foundIgw, "Expected Route Table %s to have a route to Internet Gateway", rtID)
+	// Assert that the Public Route table directs traffic to the Internet Gateway
+	assertPublicRouteTablesHaveCorrectRoutes(t, ec2Client, outputs)
 }
 
-// ValidateVpcNoNat validates the VPC has no NAT Gateway
-func ValidateVpcNoNat(t *testing.T, workingDir string) {
-	// Load the terraform options
-	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
-
-	// Create aws session
-	session, err := session.NewSession()
-	assert.NoError(t, err, "Error creating AWS session")
-
-	// Create Client
-	ec2Client := ec2.New(session, &aws_sdk.Config{Region: aws_sdk.String(awsRegion)})
-
+// assertVpcNoNat asserts that the VPC of the outputs has public subnets that route to
+// the internet gateway and private subnets
+func assertVpcNoNat(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
 	// Check that the VPC exists
-	vpcID := assertVpcExists(t, terraformOptions, awsRegion)
+	assertVpcExists(t, ec2Client, outputs.VpcId)
 
 	// Assert that the VPC has the correct number of subnets
-	numAzs, err := strconv.Atoi(terraform.Output(t, terraformOptions, "num_availability_zones"))
-	assert.NoError(t, err, "Error converting num_availability_zones to int")
-
-	assertVpcHasCorrectNumberOfSubnets(t, terraformOptions, awsRegion, "public_subnet_ids", numAzs)
+	assertVpcHasCorrectNumberOfSubnets(t, outputs.PublicSubnetIds, outputs.NumAvailabilityZones)
 
 	// Assert that the Public CIDR blocks are computed correctly
-	assertPublicCidrBlocksAreCorrect(t, terraformOptions, numAzs)
+	layout := expectedVpcSubnetLayout(t, outputs, true, true)
+	assertPublicCidrBlocksAreCorrect(t, outputs, layout)
 
 	// Assert that the Public Route tables direct traffic to the Internet Gateway
-	assertPublicRouteTablesHaveCorrectRoutes(t, terraformOptions, ec2Client, vpcID)
+	assertPublicRouteTablesHaveCorrectRoutes(t, ec2Client, outputs)
 
 	// Assert that the Public NACL is configured Correctly
-	acls, err := ec2Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{})
-	assert.NoError(t, err, "Error describing NACLs")
-
-	t.Log(acls)
+	assertPublicNetworkAclAllowsAllTraffic(t, ec2Client, outputs)
 
 	// Assert Number of Private Subnets is correct
-	assertVpcHasCorrectNumberOfSubnets(t, terraformOptions, awsRegion, "private_subnet_ids", numAzs)
+	assertVpcHasCorrectNumberOfSubnets(t, outputs.PrivateSubnetIds, outputs.NumAvailabilityZones)
 
 	// Assert that the Private CIDR blocks are computed correctly
-	assertPrivateCidrBlocksAreCorrect(t, terraformOptions, numAzs)
+	assertPrivateCidrBlocksAreCorrect(t, outputs, layout)
 }
 
-// ValidateVpc validates the VPC
-func ValidateVpc(t *testing.T, workingDir string) {
-	// Load the terraform options
-	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-	awsRegion := test_structure.LoadString(t, workingDir, "awsRegion")
-
-	// Create aws session
-	session, err := session.NewSession()
-	assert.NoError(t, err, "Error creating AWS session")
-
-	// Create Client
-	ec2Client := ec2.New(session, &aws_sdk.Config{Region: aws_sdk.String(awsRegion)})
-
+// assertVpc asserts that the VPC of the outputs has public subnets that route to the
+// internet gateway and private subnets that route to the NAT gateway
+func assertVpc(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
 	// Check that the VPC exists
-	vpcID := assertVpcExists(t, terraformOptions, awsRegion)
+	assertVpcExists(t, ec2Client, outputs.VpcId)
 
 	// Assert that the VPC has the correct number of subnets
-	numAzs, err := strconv.Atoi(terraform.Output(t, terraformOptions, "num_availability_zones"))
-	assert.NoError(t, err, "Error converting num_availability_zones to int")
-
-	assertVpcHasCorrectNumberOfSubnets(t, terraformOptions, awsRegion, "public_subnet_ids", numAzs)
+	assertVpcHasCorrectNumberOfSubnets(t, outputs.PublicSubnetIds, outputs.NumAvailabilityZones)
 
 	// Assert that the Public CIDR blocks are computed correctly
-	assertPublicCidrBlocksAreCorrect(t, terraformOptions, numAzs)
+	layout := expectedVpcSubnetLayout(t, outputs, true, true)
+	assertPublicCidrBlocksAreCorrect(t, outputs, layout)
 
 	// Assert that the Public Route tables direct traffic to the Internet Gateway
-	assertPublicRouteTablesHaveCorrectRoutes(t, terraformOptions, ec2Client, vpcID)
+	assertPublicRouteTablesHaveCorrectRoutes(t, ec2Client, outputs)
+
+	// Assert that the Public NACL is configured Correctly
+	assertPublicNetworkAclAllowsAllTraffic(t, ec2Client, outputs)
 
 	// Assert Number of Private Subnets is correct
-	assertVpcHasCorrectNumberOfSubnets(t, terraformOptions, awsRegion, "private_subnet_ids", numAzs)
+	assertVpcHasCorrectNumberOfSubnets(t, outputs.PrivateSubnetIds, outputs.NumAvailabilityZones)
 
 	// Assert that the Private CIDR blocks are computed correctly
-	assertPrivateCidrBlocksAreCorrect(t, terraformOptions, numAzs)
+	assertPrivateCidrBlocksAreCorrect(t, outputs, layout)
 
 	// Assert that the Private Route tables direct traffic to the NAT Gateway
-	assertPrivateRouteTableConfiguredCorrectly(t, terraformOptions, ec2Client, vpcID)
+	assertPrivateRouteTableConfiguredCorrectly(t, ec2Client, outputs)
+}
+
+// ValidateVpcPlan validates the plan of the VPC example without deploying
+// it. The example does not set num_availability_zones, so a subnet of each
+// type is planned in every availability zone of the region.
+func ValidateVpcPlan(t *testing.T, workingDir string) {
+	plan := planUsingTerraform(t, workingDir, map[string]interface{}{
+		"region":    planRegion,
+		"random_id": "plan",
+	})
+
+	assertPlanOnlyCreates(t, plan)
+
+	// Assert that the VPC is named after the random id
+	assertPlannedAttribute(t, plan, "module.vpc.aws_vpc.this", "tags", map[string]interface{}{"Name": "vpc-testplan"})
+
+	// Assert that a public and private subnet is planned in each availability zone
+	azs := fakeaws.AvailabilityZones(planRegion)
+	assertResourceCount(t, plan, "module.vpc.aws_subnet.public", len(azs))
+	assertResourceCount(t, plan, "module.vpc.aws_subnet.private", len(azs))
+	for i, az := range azs {
+		assertPlannedAttribute(t, plan, indexedAddress("module.vpc.aws_subnet.public", i), "availability_zone", az)
+		assertPlannedAttribute(t, plan, indexedAddress("module.vpc.aws_subnet.private", i), "availability_zone", az)
+	}
+
+	// Assert that the subnets are carved out of the default VPC CIDR block
+	vpcCidrBlock := plannedAttribute(t, plan, "module.vpc.aws_vpc.this", "cidr_block").(string)
+	assert.Equal(t, "10.0.0.0/18", vpcCidrBlock, "Expected the default VPC CIDR block, got %s", vpcCidrBlock)
+
+	layout, err := planVpcSubnetLayout(vpcCidrBlock, len(azs), true, true)
+	assert.NoError(t, err, "Error planning the VPC subnet layout")
+	for i := range azs {
+		assertPlannedAttribute(t, plan, indexedAddress("module.vpc.aws_subnet.public", i), "cidr_block", layout.PublicCidrBlocks[i])
+		assertPlannedAttribute(t, plan, indexedAddress("module.vpc.aws_subnet.private", i), "cidr_block", layout.PrivateCidrBlocks[i])
+	}
+
+	// Assert that each subnet is associated to its route table
+	assertResourceCount(t, plan, "module.vpc.aws_route_table_association.public", len(azs))
+	assertResourceCount(t, plan, "module.vpc.aws_route_table_association.private", len(azs))
+
+	// Assert that a single NAT gateway is planned for the private subnets
+	assertResourceCount(t, plan, "module.vpc.aws_eip.nat", 1)
+	assertResourceCount(t, plan, "module.vpc.aws_nat_gateway.this", 1)
+	assertResourceCount(t, plan, "module.vpc.aws_route.private_nat", 1)
+	assertResourceCount(t, plan, "module.vpc.aws_route.public_igw", 1)
+}
+
+// vpcOutputs are the outputs of the vpc module that the validators check the VPC against
+type vpcOutputs struct {
+	VpcId                     string
+	VpcCidrBlock              string
+	NumAvailabilityZones      int
+	PublicSubnetIds           []string
+	PublicSubnetCidrBlocks    []string
+	PublicSubnetRouteTableId  string
+	PublicSubnetsNetworkAclId string
+	PrivateSubnetIds          []string
+	PrivateSubnetCidrBlocks   []string
+	PrivateSubnetRouteTableId string
+}
+
+// newVpcOutputs reads the vpc module outputs from the decoded JSON output values, as
+// returned by terraform output -json or found in the state. The outputs that the
+// configuration of the module does not create are left empty.
+func newVpcOutputs(values map[string]interface{}) (*vpcOutputs, error) {
+	outputs := &vpcOutputs{}
+
+	var err error
+	stringOutput := func(name string) string {
+		value, ok := values[name].(string)
+		if !ok && values[name] != nil {
+			err = errors.Join(err, fmt.Errorf("expected output %s to be a string, got %T", name, values[name]))
+		}
+		return value
+	}
+	listOutput := func(name string) []string {
+		list := []string{}
+		value, ok := values[name].([]interface{})
+		if !ok && values[name] != nil {
+			err = errors.Join(err, fmt.Errorf("expected output %s to be a list, got %T", name, values[name]))
+		}
+		for _, v := range value {
+			list = append(list, fmt.Sprint(v))
+		}
+		return list
+	}
+
+	outputs.VpcId = stringOutput("vpc_id")
+	outputs.VpcCidrBlock = stringOutput("vpc_cidr_block")
+	outputs.PublicSubnetIds = listOutput("public_subnet_ids")
+	outputs.PublicSubnetCidrBlocks = listOutput("public_subnet_cidr_blocks")
+	outputs.PublicSubnetRouteTableId = stringOutput("public_subnet_route_table_id")
+	outputs.PublicSubnetsNetworkAclId = stringOutput("public_subnets_network_acl_id")
+	outputs.PrivateSubnetIds = listOutput("private_subnet_ids")
+	outputs.PrivateSubnetCidrBlocks = listOutput("private_subnet_cidr_blocks")
+	outputs.PrivateSubnetRouteTableId = stringOutput("private_subnet_route_table_id")
+
+	numAzs, ok := values["num_availability_zones"].(float64)
+	if !ok {
+		err = errors.Join(err, fmt.Errorf("expected output num_availability_zones to be a number, got %T", values["num_availability_zones"]))
+	}
+	outputs.NumAvailabilityZones = int(numAzs)
+
+	if outputs.VpcId == "" {
+		err = errors.Join(err, errors.New("expected output vpc_id"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// loadVpcOutputs reads the outputs of the deployed vpc module
+func loadVpcOutputs(t *testing.T, terraformOptions *terraform.Options) *vpcOutputs {
+	outputs, err := newVpcOutputs(terraform.OutputAll(t, terraformOptions))
+	if err != nil {
+		t.Fatalf("Error reading the outputs of the vpc module: %s", err)
+	}
+	return outputs
+}
+
+// describeRouteTable returns the route table with the id
+func describeRouteTable(t terratest_testing.TestingT, ec2Client ec2API, routeTableId string) *types.RouteTable {
+	rt, err := ec2Client.DescribeRouteTables(context.TODO(), &ec2.DescribeRouteTablesInput{
+		RouteTableIds: []string{routeTableId},
+	})
+	require.NoError(t, err, "Error describing Route Table %s", routeTableId)
+
+	// Assert a Route Table was returned
+	require.Equal(t, 1, len(rt.RouteTables), "Expected 1 Route Table, got %d", len(rt.RouteTables))
+	return &rt.RouteTables[0]
 }
 
 // assertPublicRouteTablesHaveCorrectRoutes asserts that the Public Route tables direct traffic to the Internet Gateway for the VPC
-func assertPublicRouteTablesHaveCorrectRoutes(t *testing.T, terraformOptions *terraform.Options, ec2Client *ec2.EC2, vpcID string) {
+func assertPublicRouteTablesHaveCorrectRoutes(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
 	// Get the Internet Gateway for the VPC
-	igtw, err := ec2Client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
-		Filters: []*ec2.Filter{
+	igtw, err := ec2Client.DescribeInternetGateways(context.TODO(), &ec2.DescribeInternetGatewaysInput{
+		Filters: []types.Filter{
 			{
 				Name:   aws_sdk.String("attachment.vpc-id"),
-				Values: []*string{aws_sdk.String(vpcID)},
+				Values: []string{outputs.VpcId},
 			},
 		},
 	})
-	assert.NoError(t, err, "Error describing Internet Gateways")
+	require.NoError(t, err, "Error describing Internet Gateways")
 
-	// Assert There are Internet Gateways
-	assert.NotEqual(t, 0, len(igtw.InternetGateways), "Expected at least 1 Internet Gateway, got 0")
+	// Assert that an Internet Gateway is attached to the VPC
+	require.NotEqual(t, 0, len(igtw.InternetGateways), "Expected an Internet Gateway attached to VPC %s, got 0", outputs.VpcId)
+	igtwID := aws_sdk.ToString(igtw.InternetGateways[0].InternetGatewayId)
 
-	// Assert that the Internet Gateway has attachements
-	assert.NotEqual(t, 0, len(igtw.InternetGateways[0].Attachments), "Expected at least 1 Internet Gateway Attachment, got 0")
+	rt := describeRouteTable(t, ec2Client, outputs.PublicSubnetRouteTableId)
 
-	// Assert that the Internet Gateway is attached to the VPC
-	assert.Equal(t, vpcID, *igtw.InternetGateways[0].Attachments[0].VpcId, "Expected Internet Gateway to be attached to VPC %s, got %s", vpcID, *igtw.InternetGateways[0].Attachments[0].VpcId)
-
-	pubrtID := terraform.Output(t, terraformOptions, "public_subnet_route_table_id")
-
-	// Get route table
-	rt, err := ec2Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
-		RouteTableIds: []*string{
-			aws_sdk.String(pubrtID),
-		},
-	})
-	assert.NoError(t, err, "Error describing Route Tables")
-
-	// Assert a Route Table was returned
-	assert.Equal(t, 1, len(rt.RouteTables), "Expected 1 Route Table, got %d", len(rt.RouteTables))
-	igtwID := *igtw.InternetGateways[0].InternetGatewayId
 	// Assert that the Public Route table has a route to the Internet Gateway
 	found := false
-	for _, route := range rt.RouteTables[0].Routes {
-		if *route.GatewayId == igtwID {
+	for _, route := range rt.Routes {
+		if aws_sdk.ToString(route.DestinationCidrBlock) == "0.0.0.0/0" && aws_sdk.ToString(route.GatewayId) == igtwID {
 			found = true
 			break
 		}
 	}
-	assert.True(t, found, "Expected Route Table %s to have a route to Internet Gateway %s", pubrtID, igtwID)
+	assert.True(t, found, "Expected Route Table %s to have a route to Internet Gateway %s", outputs.PublicSubnetRouteTableId, igtwID)
+
+	// Assert that the Public Route table is the route table of the public subnets
+	assertRouteTableIsAssociatedWithSubnets(t, rt, outputs.PublicSubnetIds)
 }
 
 // assertPrivateRouteTableConfiguredCorrectly asserts that the Private Route tables direct traffic to the NAT Gateway for the VPC and that the NAT Gateway exists
-func assertPrivateRouteTableConfiguredCorrectly(t *testing.T, terraformOptions *terraform.Options, ec2Client *ec2.EC2, vpcID string) {
-	prtID := terraform.Output(t, terraformOptions, "private_subnet_route_table_id")
-	natgw, err := ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{})
-	assert.NoError(t, err, "Error describing NAT Gateways")
-
-	// Assert There are NAT Gateways
-	assert.NotEqual(t, 0, len(natgw.NatGateways), "Expected at least 1 NAT Gateway, got 0")
-	natgwID := ""
-	for _, nat := range natgw.NatGateways {
-		if nat.State != nil && *nat.State == "available" && *nat.VpcId == vpcID {
-			natgwID = *nat.NatGatewayId
-			break
-		}
-	}
-	assert.NotEmpty(t, natgwID, "No NAT Gateway in available state")
-
-	prt, err := ec2Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
-		RouteTableIds: []*string{
-			aws_sdk.String(prtID),
+func assertPrivateRouteTableConfiguredCorrectly(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
+	natgw, err := ec2Client.DescribeNatGateways(context.TODO(), &ec2.DescribeNatGatewaysInput{
+		Filter: []types.Filter{
+			{
+				Name:   aws_sdk.String("vpc-id"),
+				Values: []string{outputs.VpcId},
+			},
+			{
+				Name:   aws_sdk.String("state"),
+				Values: []string{"available"},
+			},
 		},
 	})
-	assert.NoError(t, err, "Error describing Route Tables")
-	fmt.Println(prt)
-	// Assert a Route Table was returned
-	assert.Equal(t, 1, len(prt.RouteTables), "Expected 1 Route Table, got %d", len(prt.RouteTables))
+	require.NoError(t, err, "Error describing NAT Gateways")
+
+	// Assert that a NAT Gateway is available in the VPC
+	require.NotEqual(t, 0, len(natgw.NatGateways), "Expected an available NAT Gateway in VPC %s, got 0", outputs.VpcId)
+	natgwID := aws_sdk.ToString(natgw.NatGateways[0].NatGatewayId)
+
+	// Assert that the NAT Gateway is in a public subnet
+	natgwSubnetID := aws_sdk.ToString(natgw.NatGateways[0].SubnetId)
+	assert.Contains(t, outputs.PublicSubnetIds, natgwSubnetID, "Expected NAT Gateway %s in a public subnet, got %s", natgwID, natgwSubnetID)
+
+	prt := describeRouteTable(t, ec2Client, outputs.PrivateSubnetRouteTableId)
+
 	// Assert that the Private Route table has a route to the NAT Gateway
 	found := false
-	for _, route := range prt.RouteTables[0].Routes {
-		if route.NatGatewayId != nil && *route.NatGatewayId == natgwID {
+	for _, route := range prt.Routes {
+		if aws_sdk.ToString(route.DestinationCidrBlock) == "0.0.0.0/0" && aws_sdk.ToString(route.NatGatewayId) == natgwID {
 			found = true
 			break
 		}
 	}
-	assert.True(t, found, "Expected Route Table %s to have a route to NAT Gateway %s", prtID, natgwID)
+	assert.True(t, found, "Expected Route Table %s to have a route to NAT Gateway %s", outputs.PrivateSubnetRouteTableId, natgwID)
+
+	// Assert that the Private Route table is the route table of the private subnets
+	assertRouteTableIsAssociatedWithSubnets(t, prt, outputs.PrivateSubnetIds)
 }
 
-// assertPublicCidrBlocksAreCorrect asserts that the Public CIDR blocks are computed correctly for the VPC
-func assertPublicCidrBlocksAreCorrect(t *testing.T, terraformOptions *terraform.Options, numAzs int) {
-	publicCidrBlocks := terraform.OutputList(t, terraformOptions, "public_subnet_cidr_blocks")
-	assert.Equal(t, numAzs, len(publicCidrBlocks), "Expected %d Public CIDR Blocks, got %d", numAzs, (publicCidrBlocks))
+// assertRouteTableIsAssociatedWithSubnets asserts that the route table is associated with exactly the subnets
+func assertRouteTableIsAssociatedWithSubnets(t terratest_testing.TestingT, rt *types.RouteTable, subnetIds []string) {
+	associatedSubnetIds := []string{}
+	for _, association := range rt.Associations {
+		if association.SubnetId != nil {
+			associatedSubnetIds = append(associatedSubnetIds, *association.SubnetId)
+		}
+	}
+	assert.ElementsMatch(t, subnetIds, associatedSubnetIds, "Expected Route Table %s to be associated with subnets %v, got %v", aws_sdk.ToString(rt.RouteTableId), subnetIds, associatedSubnetIds)
+}
+
+// assertPublicNetworkAclAllowsAllTraffic asserts that the Public NACL of the public subnets allows all inbound and outbound traffic
+func assertPublicNetworkAclAllowsAllTraffic(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs) {
+	acls, err := ec2Client.DescribeNetworkAcls(context.TODO(), &ec2.DescribeNetworkAclsInput{
+		NetworkAclIds: []string{outputs.PublicSubnetsNetworkAclId},
+	})
+	require.NoError(t, err, "Error describing NACLs")
+	require.Equal(t, 1, len(acls.NetworkAcls), "Expected 1 NACL, got %d", len(acls.NetworkAcls))
+	acl := acls.NetworkAcls[0]
 
-	// Should have format 10.0.*.0/24
-	for i, cidr := range publicCidrBlocks {
-		assert.Equal(t, fmt.Sprintf("10.0.%d.0/24", i+1), cidr)
+	// Assert that the Public NACL is in the VPC
+	assert.Equal(t, outputs.VpcId, aws_sdk.ToString(acl.VpcId), "Expected NACL %s in VPC %s", outputs.PublicSubnetsNetworkAclId, outputs.VpcId)
+
+	// Assert that the Public NACL is the NACL of the public subnets
+	associatedSubnetIds := []string{}
+	for _, association := range acl.Associations {
+		associatedSubnetIds = append(associatedSubnetIds, aws_sdk.ToString(association.SubnetId))
+	}
+	assert.ElementsMatch(t, outputs.PublicSubnetIds, associatedSubnetIds, "Expected NACL %s to be associated with subnets %v, got %v", outputs.PublicSubnetsNetworkAclId, outputs.PublicSubnetIds, associatedSubnetIds)
+
+	// Assert that a rule allows all inbound and all outbound traffic
+	for _, egress := range []bool{false, true} {
+		found := false
+		for _, entry := range acl.Entries {
+			if aws_sdk.ToBool(entry.Egress) == egress &&
+				entry.RuleAction == types.RuleActionAllow &&
+				aws_sdk.ToString(entry.Protocol) == "-1" &&
+				aws_sdk.ToString(entry.CidrBlock) == "0.0.0.0/0" {
+				found = true
+				break
+			}
+		}
+		assert.True(t, found, "Expected NACL %s to allow all traffic (egress: %t)", outputs.PublicSubnetsNetworkAclId, egress)
 	}
 }
 
-// assertPrivateCidrBlocksAreCorrect asserts that the Private CIDR blocks are computed correctly for the VPC
-func assertPrivateCidrBlocksAreCorrect(t *testing.T, terraformOptions *terraform.Options, numAzs int) {
-	privateCidrBlocks := terraform.OutputList(t, terraformOptions, "private_subnet_cidr_blocks")
-	assert.Equal(t, numAzs, len(privateCidrBlocks), "Expected %d Private CIDR Blocks, got %d", numAzs, (privateCidrBlocks))
+// vpcSubnetNewBits is the number of bits the vpc module extends the VPC CIDR block
+// prefix by for each subnet, i.e. a /18 VPC is carved into /24 subnets.
+const vpcSubnetNewBits = 6
 
-	// Should have format 10.0.*.0/24 Picking up from the end of the private subnets
-	for i, cidr := range privateCidrBlocks {
-		assert.Equal(t, fmt.Sprintf("10.0.%d.0/24", numAzs+i+1), cidr)
+// vpcSubnetLayout is the CIDR blocks that the vpc module assigns to its subnets
+type vpcSubnetLayout struct {
+	PublicCidrBlocks  []string
+	PrivateCidrBlocks []string
+}
+
+// planVpcSubnetLayout reproduces the cidrsubnet math of the vpc module. Public subnets
+// are numbered from 1 and private subnets are numbered after the public subnets so
+// that the two never overlap.
+func planVpcSubnetLayout(vpcCidrBlock string, numAzs int, createPublicSubnets bool, createPrivateSubnets bool) (*vpcSubnetLayout, error) {
+	layout := &vpcSubnetLayout{
+		PublicCidrBlocks:  []string{},
+		PrivateCidrBlocks: []string{},
+	}
+
+	numPublicSubnets := 0
+	if createPublicSubnets {
+		numPublicSubnets = numAzs
 	}
+
+	for i := 0; i < numPublicSubnets; i++ {
+		cidr, err := util.CidrSubnet(vpcCidrBlock, vpcSubnetNewBits, i+1)
+		if err != nil {
+			return nil, err
+		}
+		layout.PublicCidrBlocks = append(layout.PublicCidrBlocks, cidr)
+	}
+
+	if !createPrivateSubnets {
+		return layout, nil
+	}
+
+	for i := 0; i < numAzs; i++ {
+		cidr, err := util.CidrSubnet(vpcCidrBlock, vpcSubnetNewBits, i+1+numPublicSubnets)
+		if err != nil {
+			return nil, err
+		}
+		layout.PrivateCidrBlocks = append(layout.PrivateCidrBlocks, cidr)
+	}
+
+	return layout, nil
+}
+
+// expectedVpcSubnetLayout plans the subnet layout for the deployed VPC's CIDR block
+func expectedVpcSubnetLayout(t terratest_testing.TestingT, outputs *vpcOutputs, createPublicSubnets bool, createPrivateSubnets bool) *vpcSubnetLayout {
+	layout, err := planVpcSubnetLayout(outputs.VpcCidrBlock, outputs.NumAvailabilityZones, createPublicSubnets, createPrivateSubnets)
+	if err != nil {
+		t.Fatalf("Error planning the subnet layout of %s: %s", outputs.VpcCidrBlock, err)
+	}
+	return layout
+}
+
+// assertPublicCidrBlocksAreCorrect asserts that the Public CIDR blocks are computed correctly for the VPC
+func assertPublicCidrBlocksAreCorrect(t terratest_testing.TestingT, outputs *vpcOutputs, layout *vpcSubnetLayout) {
+	assert.Equal(t, layout.PublicCidrBlocks, outputs.PublicSubnetCidrBlocks, "Expected Public CIDR Blocks %v, got %v", layout.PublicCidrBlocks, outputs.PublicSubnetCidrBlocks)
+}
+
+// assertPrivateCidrBlocksAreCorrect asserts that the Private CIDR blocks are computed correctly for the VPC
+func assertPrivateCidrBlocksAreCorrect(t terratest_testing.TestingT, outputs *vpcOutputs, layout *vpcSubnetLayout) {
+	assert.Equal(t, layout.PrivateCidrBlocks, outputs.PrivateSubnetCidrBlocks, "Expected Private CIDR Blocks %v, got %v", layout.PrivateCidrBlocks, outputs.PrivateSubnetCidrBlocks)
 }
 
 // assertVpcExists asserts that the VPC exists
-func assertVpcExists(t *testing.T, terraformOptions *terraform.Options, awsRegion string) string {
-	vpcID := terraform.Output(t, terraformOptions, "vpc_id")
-	vpc := aws.GetVpcById(t, vpcID, awsRegion)
-	assert.NotNil(t, vpc, "Expected VPC to exist")
-	return vpcID
+func assertVpcExists(t terratest_testing.TestingT, ec2Client ec2API, vpcID string) {
+	vpcs, err := ec2Client.DescribeVpcs(context.TODO(), &ec2.DescribeVpcsInput{
+		VpcIds: []string{vpcID},
+	})
+	require.NoError(t, err, "Expected VPC %s to exist", vpcID)
+	require.Equal(t, 1, len(vpcs.Vpcs), "Expected 1 VPC, got %d", len(vpcs.Vpcs))
 }
 
 // assertVpcHasCorrectNumberOfSubnets asserts that the VPC has the correct number of subnets
-func assertVpcHasCorrectNumberOfSubnets(t *testing.T, terraformOptions *terraform.Options, awsRegion string, subnetId string, numAzs int) {
-	subnets := terraform.OutputList(t, terraformOptions, subnetId)
-	assert.Equal(t, numAzs, len(subnets), "Expected %d Subnets, got %d", numAzs, len(subnets))
+func assertVpcHasCorrectNumberOfSubnets(t terratest_testing.TestingT, subnetIds []string, numAzs int) {
+	assert.Equal(t, numAzs, len(subnetIds), "Expected %d Subnets, got %d", numAzs, len(subnetIds))
 }
@@ -0,0 +1,318 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	terratest_testing "github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records the failures of a validator instead of failing the test, so that
+// the test can assert that a broken topology fails the validator
+type recordingT struct {
+	name string
+
+	mu       sync.Mutex
+	failed   bool
+	messages []string
+}
+
+func (r *recordingT) Fail() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = true
+}
+
+func (r *recordingT) FailNow() {
+	r.Fail()
+	runtime.Goexit()
+}
+
+func (r *recordingT) Fatal(args ...interface{}) {
+	r.Error(args...)
+	r.FailNow()
+}
+
+func (r *recordingT) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.FailNow()
+}
+
+func (r *recordingT) Error(args ...interface{}) {
+	r.Errorf("%s", fmt.Sprint(args...))
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+
+	r.Fail()
+}
+
+func (r *recordingT) Name() string {
+	return r.name
+}
+
+// run runs the validator in its own goroutine so that FailNow stops the validator and
+// not the test, and returns the recorded failures
+func (r *recordingT) run(validator func(t terratest_testing.TestingT)) (bool, string) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		validator(r)
+	}()
+	<-done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed, strings.Join(r.messages, "\n")
+}
+
+// loadVpcState returns the network and the outputs of the deploy-vpc example from its
+// terraform show -json state
+func loadVpcState(t *testing.T) (*fakeaws.Topology, *vpcOutputs) {
+	data, err := os.ReadFile("testdata/deploy-vpc.tfstate.json")
+	require.NoError(t, err)
+	state := &tfjson.State{}
+	require.NoError(t, json.Unmarshal(data, state))
+
+	topology, err := fakeaws.TopologyFromState(state)
+	require.NoError(t, err)
+
+	values := map[string]interface{}{}
+	for name, output := range state.Values.Outputs {
+		values[name] = output.Value
+	}
+	outputs, err := newVpcOutputs(values)
+	require.NoError(t, err)
+	return topology, outputs
+}
+
+// loadVpcPlan returns the network that the plan of the deploy-vpc example creates and
+// the outputs that the module would have after the apply. The ids are unknown in the
+// plan, so the outputs are read from the resources of the network by their names.
+func loadVpcPlan(t *testing.T) (*fakeaws.Topology, *vpcOutputs) {
+	data, err := os.ReadFile("testdata/deploy-vpc.tfplan.json")
+	require.NoError(t, err)
+	plan := &tfjson.Plan{}
+	require.NoError(t, json.Unmarshal(data, plan))
+
+	topology, err := fakeaws.TopologyFromPlan(plan)
+	require.NoError(t, err)
+
+	require.Len(t, topology.Vpcs, 1)
+	vpc := topology.Vpcs[0]
+	outputs := &vpcOutputs{VpcId: vpc.Id, VpcCidrBlock: vpc.CidrBlock}
+	for _, subnet := range topology.Subnets {
+		if strings.Contains(subnet.Name, "-public-") {
+			outputs.PublicSubnetIds = append(outputs.PublicSubnetIds, subnet.Id)
+			outputs.PublicSubnetCidrBlocks = append(outputs.PublicSubnetCidrBlocks, subnet.CidrBlock)
+			outputs.NumAvailabilityZones++
+		} else {
+			outputs.PrivateSubnetIds = append(outputs.PrivateSubnetIds, subnet.Id)
+			outputs.PrivateSubnetCidrBlocks = append(outputs.PrivateSubnetCidrBlocks, subnet.CidrBlock)
+		}
+	}
+	outputs.PublicSubnetRouteTableId = topology.RouteTable(vpc.Name + "-public-rt").Id
+	outputs.PrivateSubnetRouteTableId = topology.RouteTable(vpc.Name + "-private-rt").Id
+	for _, networkAcl := range topology.NetworkAcls {
+		if networkAcl.Name == vpc.Name+"-public-acl" {
+			outputs.PublicSubnetsNetworkAclId = networkAcl.Id
+		}
+	}
+	return topology, outputs
+}
+
+// withoutPrivateSubnets removes the private subnets and their NAT gateway from the
+// network and the outputs, as the module does when create_private_subnets is false
+func withoutPrivateSubnets(topology *fakeaws.Topology, outputs *vpcOutputs) {
+	isPrivate := map[string]bool{}
+	for _, subnetId := range outputs.PrivateSubnetIds {
+		isPrivate[subnetId] = true
+	}
+
+	subnets := []*fakeaws.Subnet{}
+	for _, subnet := range topology.Subnets {
+		if !isPrivate[subnet.Id] {
+			subnets = append(subnets, subnet)
+		}
+	}
+	topology.Subnets = subnets
+
+	routeTables := []*fakeaws.RouteTable{}
+	for _, routeTable := range topology.RouteTables {
+		if routeTable.Id != outputs.PrivateSubnetRouteTableId {
+			routeTables = append(routeTables, routeTable)
+		}
+	}
+	topology.RouteTables = routeTables
+	topology.NatGateways = nil
+
+	outputs.PrivateSubnetIds = []string{}
+	outputs.PrivateSubnetCidrBlocks = []string{}
+	outputs.PrivateSubnetRouteTableId = ""
+}
+
+func TestVpcValidators(t *testing.T) {
+	type validator func(t terratest_testing.TestingT, ec2Client ec2API, outputs *vpcOutputs)
+
+	tests := []struct {
+		name        string
+		validator   validator
+		publicOnly  bool
+		breakVpc    func(topology *fakeaws.Topology, outputs *vpcOutputs)
+		expectedErr string
+	}{
+		{name: "vpc", validator: assertVpc},
+		{name: "vpc without nat", validator: assertVpcNoNat},
+		{name: "only public subnets", validator: assertOnlyPublicSubnets, publicOnly: true},
+		{
+			name:      "vpc missing igw route",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PublicSubnetRouteTableId).Routes = nil
+			},
+			expectedErr: "to have a route to Internet Gateway",
+		},
+		{
+			name:      "vpc without nat missing igw route",
+			validator: assertVpcNoNat,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PublicSubnetRouteTableId).Routes = nil
+			},
+			expectedErr: "to have a route to Internet Gateway",
+		},
+		{
+			name:       "only public subnets missing igw route",
+			validator:  assertOnlyPublicSubnets,
+			publicOnly: true,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PublicSubnetRouteTableId).Routes = nil
+			},
+			expectedErr: "to have a route to Internet Gateway",
+		},
+		{
+			name:      "vpc with detached igw",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.InternetGateways[0].VpcId = ""
+			},
+			expectedErr: "Expected an Internet Gateway attached to VPC",
+		},
+		{
+			name:      "vpc with nat gateway in the wrong vpc",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.Vpcs = append(topology.Vpcs, &fakeaws.Vpc{Id: "vpc-0fedcba9876543210", CidrBlock: "10.1.0.0/18"})
+				topology.NatGateways[0].VpcId = "vpc-0fedcba9876543210"
+			},
+			expectedErr: "Expected an available NAT Gateway in VPC",
+		},
+		{
+			name:      "vpc with failed nat gateway",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.NatGateways[0].State = "failed"
+			},
+			expectedErr: "Expected an available NAT Gateway in VPC",
+		},
+		{
+			name:      "vpc with private route table with no associations",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PrivateSubnetRouteTableId).SubnetIds = nil
+			},
+			expectedErr: "to be associated with subnets",
+		},
+		{
+			name:      "vpc without nat with public route table with no associations",
+			validator: assertVpcNoNat,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PublicSubnetRouteTableId).SubnetIds = nil
+			},
+			expectedErr: "to be associated with subnets",
+		},
+		{
+			name:       "only public subnets with route table with no associations",
+			validator:  assertOnlyPublicSubnets,
+			publicOnly: true,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.RouteTable(outputs.PublicSubnetRouteTableId).SubnetIds = nil
+			},
+			expectedErr: "to be associated with subnets",
+		},
+		{
+			name:        "only public subnets with private subnets",
+			validator:   assertOnlyPublicSubnets,
+			expectedErr: "Expected only the public subnets",
+		},
+		{
+			name:      "vpc with public nacl denying egress",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				for _, networkAcl := range topology.NetworkAcls {
+					if networkAcl.Id == outputs.PublicSubnetsNetworkAclId {
+						networkAcl.Entries = networkAcl.Entries[:1]
+					}
+				}
+			},
+			expectedErr: "to allow all traffic (egress: true)",
+		},
+		{
+			name:      "vpc missing",
+			validator: assertVpc,
+			breakVpc: func(topology *fakeaws.Topology, outputs *vpcOutputs) {
+				topology.Vpcs = nil
+			},
+			expectedErr: "InvalidVpcID.NotFound",
+		},
+	}
+
+	seeds := []struct {
+		name string
+		load func(t *testing.T) (*fakeaws.Topology, *vpcOutputs)
+	}{
+		{name: "state", load: loadVpcState},
+		{name: "plan", load: loadVpcPlan},
+	}
+	for _, seed := range seeds {
+		for _, tt := range tests {
+			t.Run(seed.name+"/"+tt.name, func(t *testing.T) {
+				topology, outputs := seed.load(t)
+				if tt.publicOnly {
+					withoutPrivateSubnets(topology, outputs)
+				}
+				if tt.breakVpc != nil {
+					tt.breakVpc(topology, outputs)
+				}
+
+				s := fakeaws.NewServer(t, "us-east-1")
+				fakeaws.NewNetwork(s, topology)
+				client := awsclients.FromConfig(s.Config()).Ec2()
+
+				r := &recordingT{name: t.Name()}
+				failed, messages := r.run(func(rt terratest_testing.TestingT) {
+					tt.validator(rt, client, outputs)
+				})
+				if tt.expectedErr == "" {
+					assert.False(t, failed, messages)
+				} else {
+					assert.True(t, failed, "Expected the validator to fail")
+					assert.Contains(t, messages, tt.expectedErr)
+				}
+			})
+		}
+	}
+}
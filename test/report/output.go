@@ -0,0 +1,201 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// markerPrefix starts the lines that the report writes to the captured output to mark
+// where the stages of a test start and end in its log. They are not passed through.
+const markerPrefix = "##terratest-report## "
+
+// maxFailureLines is the number of lines of test output kept as the failure of a stage
+const maxFailureLines = 100
+
+// testLog is the output of a test
+type testLog struct {
+	file  *os.File
+	path  string
+	lines int
+
+	// messages are the lines logged through testing.T (i.e. t.Logf, t.Errorf and the
+	// failed assertions), which go test indents, by their line number in the log
+	messages []message
+
+	// marks are the line numbers of the stage markers
+	marks map[string]int
+}
+
+type message struct {
+	line int
+	text string
+}
+
+// demux splits the output of go test -v into a log per test. Parallel tests interleave
+// their output, go test prefixes the output of a test that follows the output of another
+// test with "=== NAME" and terratest prefixes its log lines with the name of the test.
+type demux struct {
+	dir  string
+	mu   sync.Mutex
+	logs map[string]*testLog
+
+	// current is the test that the unprefixed lines belong to
+	current string
+}
+
+func newDemux(dir string) *demux {
+	return &demux{dir: dir, logs: map[string]*testLog{}}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// log returns the log of the test, creating its file when the dir is set
+func (d *demux) log(name string) *testLog {
+	if l, ok := d.logs[name]; ok {
+		return l
+	}
+
+	l := &testLog{marks: map[string]int{}}
+	if d.dir != "" {
+		l.path = filepath.Join(d.dir, "logs", unsafeFileChars.ReplaceAllString(name, "_")+".log")
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err == nil {
+			l.file, _ = os.Create(l.path)
+		}
+	}
+	d.logs[name] = l
+	return l
+}
+
+// consume reads the output until EOF, passing all lines but the markers through to w
+func (d *demux) consume(r io.Reader, w io.Writer) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if !d.handle(line) {
+				io.WriteString(w, line)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle attributes the line to a test and returns true if the line is a marker
+func (d *demux) handle(line string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	text := strings.TrimRight(line, "\n")
+	if strings.HasPrefix(text, markerPrefix) {
+		// ##terratest-report## <mark> <test>
+		fields := strings.Fields(strings.TrimPrefix(text, markerPrefix))
+		if len(fields) == 2 {
+			l := d.log(fields[1])
+			l.marks[fields[0]] = l.lines
+		}
+		return true
+	}
+
+	name := d.testName(text)
+	if name == "" {
+		return false
+	}
+
+	l := d.log(name)
+	if l.file != nil {
+		io.WriteString(l.file, line)
+	}
+	if strings.HasPrefix(text, "    ") && !strings.HasPrefix(strings.TrimLeft(text, " "), "--- ") {
+		l.messages = append(l.messages, message{l.lines, strings.TrimPrefix(text, "    ")})
+	}
+	l.lines++
+	return false
+}
+
+// testName returns the test that the line belongs to
+func (d *demux) testName(text string) string {
+	trimmed := strings.TrimLeft(text, " ")
+	fields := strings.Fields(trimmed)
+
+	switch {
+	// === RUN   TestName/sub
+	case strings.HasPrefix(text, "=== ") && len(fields) >= 3:
+		d.current = fields[2]
+		return d.current
+
+	// --- FAIL: TestName/sub (0.00s)
+	case strings.HasPrefix(trimmed, "--- ") && len(fields) >= 3:
+		return fields[2]
+
+	// TestName/sub 2006-01-02T15:04:05Z file.go:10: message
+	case len(fields) >= 2 && d.logs[fields[0]] != nil && strings.HasPrefix(text, fields[0]+" "):
+		return fields[0]
+	}
+
+	return d.current
+}
+
+// mark returns the marker line that records the current position in the log of the test
+func mark(name string, test string) string {
+	return fmt.Sprintf("%s%s %s\n", markerPrefix, name, test)
+}
+
+// messages returns the messages that the test logged between the marks
+func (d *demux) messages(test string, start string, end string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	l, ok := d.logs[test]
+	if !ok {
+		return nil
+	}
+	from, ok := l.marks[start]
+	if !ok {
+		return nil
+	}
+	to, ok := l.marks[end]
+	if !ok {
+		to = l.lines
+	}
+
+	messages := []string{}
+	for _, m := range l.messages {
+		if m.line >= from && m.line < to {
+			messages = append(messages, m.text)
+		}
+	}
+	if len(messages) > maxFailureLines {
+		messages = messages[len(messages)-maxFailureLines:]
+	}
+	return messages
+}
+
+// path returns the log file of the test
+func (d *demux) path(test string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if l, ok := d.logs[test]; ok {
+		return l.path
+	}
+	return ""
+}
+
+func (d *demux) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, l := range d.logs {
+		if l.file != nil {
+			l.file.Close()
+		}
+	}
+}
@@ -0,0 +1,443 @@
+// Package report records the outcome of each test and test stage and writes them as
+// a JUnit XML report and a JSON summary, with a log file per test. CI systems such as
+// CircleCI read the JUnit report directly, so the interleaved output of the parallel
+// tests does not need to be split after the run.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+// DirEnvVar is the directory that the report is written to, no report is written when unset
+const DirEnvVar = "TERRATEST_REPORT_DIR"
+
+// Outcome is the result of a test or stage
+type Outcome string
+
+const (
+	Passed  Outcome = "passed"
+	Failed  Outcome = "failed"
+	Skipped Outcome = "skipped"
+)
+
+// Stage is the result of a test stage
+type Stage struct {
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_seconds"`
+	Outcome  Outcome   `json:"outcome"`
+
+	// Failure is the output of the test while the stage ran, i.e. the failed assertions
+	Failure string `json:"failure,omitempty"`
+
+	test      string
+	startMark string
+	endMark   string
+}
+
+// Test is the result of a test
+type Test struct {
+	Name       string                 `json:"name"`
+	WorkingDir string                 `json:"working_dir"`
+	Region     string                 `json:"region,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Duration   float64                `json:"duration_seconds"`
+	Outcome    Outcome                `json:"outcome"`
+	Stages     []*Stage               `json:"stages"`
+	Outputs    map[string]interface{} `json:"outputs,omitempty"`
+	LogFile    string                 `json:"log_file,omitempty"`
+
+	// PlanDiff is the plan of the upgrade of the test to the working tree
+	PlanDiff string `json:"plan_diff,omitempty"`
+
+	report *Report
+}
+
+// Report is the results of the tests of a test run
+type Report struct {
+	dir   string
+	start time.Time
+
+	mu    sync.Mutex
+	tests []*Test
+
+	demux   *demux
+	stdout  *os.File
+	pipe    *os.File
+	drained chan struct{}
+}
+
+// New creates a report that is written to the dir. The report only records the results
+// in memory when the dir is empty.
+func New(dir string) *Report {
+	return &Report{dir: dir, start: time.Now(), demux: newDemux(dir)}
+}
+
+// CaptureOutput splits the output of the tests into a log per test until the returned
+// function is called. The output is still written to stdout. It must be called before
+// testing.M.Run, which is when go test reads os.Stdout.
+func (r *Report) CaptureOutput() (func(), error) {
+	if r.dir == "" {
+		return func() {}, nil
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	r.stdout = os.Stdout
+	r.pipe = writer
+	r.drained = make(chan struct{})
+	os.Stdout = writer
+
+	go func() {
+		defer close(r.drained)
+		r.demux.consume(reader, r.stdout)
+	}()
+
+	return func() {
+		os.Stdout = r.stdout
+		writer.Close()
+		<-r.drained
+		r.demux.close()
+	}, nil
+}
+
+// mark records the current position in the log of the test
+func (r *Report) mark(name string, test string) {
+	if r.pipe != nil {
+		io.WriteString(r.pipe, mark(name, test))
+	}
+}
+
+// StartTest records the test, its outcome is recorded when the test and its cleanup finish
+func (r *Report) StartTest(t *testing.T, workingDir string) *Test {
+	result := &Test{
+		Name:       t.Name(),
+		WorkingDir: workingDir,
+		Start:      time.Now(),
+		Stages:     []*Stage{},
+		report:     r,
+	}
+
+	r.mu.Lock()
+	r.tests = append(r.tests, result)
+	r.mu.Unlock()
+
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		result.End = time.Now()
+		result.Duration = result.End.Sub(result.Start).Seconds()
+		switch {
+		case t.Failed():
+			result.Outcome = Failed
+		case t.Skipped():
+			result.Outcome = Skipped
+		default:
+			result.Outcome = Passed
+		}
+	})
+
+	return result
+}
+
+// RunStage runs the stage with test_structure.RunTestStage and records its outcome. A stage
+// fails when it stops the test (i.e. require or t.Fatal) or when it fails a test that had
+// not failed before.
+func (result *Test) RunStage(t *testing.T, stageName string, stage func()) {
+	r := result.report
+	s := &Stage{
+		Name:      stageName,
+		Start:     time.Now(),
+		test:      t.Name(),
+		startMark: stageName + ".start",
+		endMark:   stageName + ".end",
+	}
+
+	r.mu.Lock()
+	result.Stages = append(result.Stages, s)
+	r.mu.Unlock()
+
+	failedBefore := t.Failed()
+	completed := false
+	skipped := os.Getenv("SKIP_"+stageName) != ""
+
+	r.mark(s.startMark, s.test)
+	defer func() {
+		r.mark(s.endMark, s.test)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		s.End = time.Now()
+		s.Duration = s.End.Sub(s.Start).Seconds()
+		switch {
+		case skipped:
+			s.Outcome = Skipped
+		case !completed || (t.Failed() && !failedBefore):
+			s.Outcome = Failed
+		default:
+			s.Outcome = Passed
+		}
+	}()
+
+	test_structure.RunTestStage(t, stageName, stage)
+	completed = true
+}
+
+// SkipStage records that the stage was skipped for the reason, i.e. because an earlier
+// run already completed it
+func (result *Test) SkipStage(t *testing.T, stageName string, reason string) {
+	logger.Logf(t, "Skipping stage '%s': %s", stageName, reason)
+
+	now := time.Now()
+	result.report.mu.Lock()
+	defer result.report.mu.Unlock()
+	result.Stages = append(result.Stages, &Stage{Name: stageName, Start: now, End: now, Outcome: Skipped})
+}
+
+// SetRegion records the region that the test deployed to
+func (result *Test) SetRegion(region string) {
+	result.report.mu.Lock()
+	defer result.report.mu.Unlock()
+	result.Region = region
+}
+
+// SetOutputs records the Terraform outputs of the test
+func (result *Test) SetOutputs(outputs map[string]interface{}) {
+	result.report.mu.Lock()
+	defer result.report.mu.Unlock()
+	result.Outputs = outputs
+}
+
+// SetPlanDiff records the plan of the upgrade of the test
+func (result *Test) SetPlanDiff(diff string) {
+	result.report.mu.Lock()
+	defer result.report.mu.Unlock()
+	result.PlanDiff = diff
+}
+
+// summary is the JSON summary of the report
+type summary struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_seconds"`
+	Passed   int       `json:"passed"`
+	Failed   int       `json:"failed"`
+	Skipped  int       `json:"skipped"`
+	Tests    []*Test   `json:"tests"`
+}
+
+// Write writes the report to report.json and junit.xml in the dir of the report. The
+// output must no longer be captured when the report is written.
+func (r *Report) Write() error {
+	if r.dir == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tests := append([]*Test{}, r.tests...)
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Name < tests[j].Name
+	})
+
+	s := summary{Start: r.start, End: time.Now(), Tests: tests}
+	s.Duration = s.End.Sub(s.Start).Seconds()
+	for _, test := range tests {
+		test.LogFile = r.demux.path(test.Name)
+
+		// A test or stage without an outcome was interrupted, i.e. by the teardown
+		if test.Outcome == "" {
+			test.Outcome = Failed
+		}
+		for _, stage := range test.Stages {
+			if stage.Outcome == "" {
+				stage.Outcome = Failed
+				stage.Failure = "interrupted before the stage completed"
+			}
+		}
+
+		// The output is read asynchronously, so the failures are only known once it is drained
+		for _, stage := range test.Stages {
+			if stage.Outcome == Failed && stage.Failure == "" {
+				stage.Failure = strings.Join(r.demux.messages(stage.test, stage.startMark, stage.endMark), "\n")
+			}
+		}
+		switch test.Outcome {
+		case Failed:
+			s.Failed++
+		case Skipped:
+			s.Skipped++
+		default:
+			s.Passed++
+		}
+	}
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+
+	summaryJSON, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, "report.json"), summaryJSON, 0644); err != nil {
+		return err
+	}
+
+	junitXML, err := xml.MarshalIndent(toJUnit(s), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, "junit.xml"), append([]byte(xml.Header), junitXML...), 0644)
+}
+
+// The JUnit XML format as read by CircleCI store_test_results. Each test is a test suite
+// and each of its stages is a test case.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d float64) string {
+	return fmt.Sprintf("%.3f", d)
+}
+
+func toJUnit(s summary) junitTestSuites {
+	suites := junitTestSuites{Time: seconds(s.Duration)}
+
+	for _, test := range s.Tests {
+		suite := junitTestSuite{
+			Name:      test.Name,
+			Time:      seconds(test.Duration),
+			Timestamp: test.Start.UTC().Format("2006-01-02T15:04:05"),
+			Properties: []junitProperty{
+				{"working_dir", test.WorkingDir},
+				{"region", test.Region},
+				{"log_file", test.LogFile},
+			},
+			SystemOut: test.PlanDiff,
+		}
+
+		outputNames := []string{}
+		for name := range test.Outputs {
+			outputNames = append(outputNames, name)
+		}
+		sort.Strings(outputNames)
+		for _, name := range outputNames {
+			value, _ := json.Marshal(test.Outputs[name])
+			suite.Properties = append(suite.Properties, junitProperty{"output." + name, string(value)})
+		}
+
+		stageFailed := false
+		for _, stage := range test.Stages {
+			testCase := junitTestCase{
+				Classname: test.Name,
+				Name:      stage.Name,
+				Time:      seconds(stage.Duration),
+				File:      test.LogFile,
+			}
+			switch stage.Outcome {
+			case Failed:
+				stageFailed = true
+				testCase.Failure = &junitFailure{Message: failureMessage(stage.Failure), Text: stage.Failure}
+				suite.Failures++
+			case Skipped:
+				testCase.Skipped = &struct{}{}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		// A test can fail outside of its stages, i.e. while it is set up
+		if test.Outcome == Failed && !stageFailed {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Classname: test.Name,
+				Name:      "test",
+				Time:      seconds(test.Duration),
+				File:      test.LogFile,
+				Failure:   &junitFailure{Message: "test failed outside of its stages, see " + test.LogFile},
+			})
+			suite.Failures++
+		}
+
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return suites
+}
+
+// failureMessage returns the first line of the failure that describes it
+func failureMessage(failure string) string {
+	for _, line := range strings.Split(failure, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Error:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Error:"))
+		}
+	}
+	for _, line := range strings.Split(failure, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return "stage failed"
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemuxSplitsOutputByTest(t *testing.T) {
+	dir := t.TempDir()
+	d := newDemux(dir)
+
+	output := strings.Join([]string{
+		"=== RUN   TestExamples",
+		"=== RUN   TestExamples/vpc",
+		"=== PAUSE TestExamples/vpc",
+		"=== RUN   TestExamples/alb",
+		"=== PAUSE TestExamples/alb",
+		"=== CONT  TestExamples/vpc",
+		strings.TrimRight(mark("apply.start", "TestExamples/vpc"), "\n"),
+		"=== CONT  TestExamples/alb",
+		"TestExamples/vpc 2023-01-01T00:00:00Z logger.go:66: terraform apply",
+		"TestExamples/alb 2023-01-01T00:00:00Z logger.go:66: terraform plan",
+		"=== NAME  TestExamples/vpc",
+		"    vpc.go:10: ",
+		"        \tError Trace:\tvpc.go:10",
+		"        \tError:      \tShould be true",
+		strings.TrimRight(mark("apply.end", "TestExamples/vpc"), "\n"),
+		"    vpc.go:20: after the stage",
+		"    --- FAIL: TestExamples/vpc (1.00s)",
+		"    --- PASS: TestExamples/alb (1.00s)",
+		"--- FAIL: TestExamples (1.00s)",
+		"FAIL",
+	}, "\n") + "\n"
+
+	var passthrough bytes.Buffer
+	d.consume(strings.NewReader(output), &passthrough)
+	d.close()
+
+	assert.NotContains(t, passthrough.String(), markerPrefix)
+	assert.Equal(t, len(strings.Split(output, "\n"))-2, len(strings.Split(passthrough.String(), "\n")))
+
+	assert.Equal(t, []string{
+		"vpc.go:10: ",
+		"    \tError Trace:\tvpc.go:10",
+		"    \tError:      \tShould be true",
+	}, d.messages("TestExamples/vpc", "apply.start", "apply.end"))
+	assert.Empty(t, d.messages("TestExamples/alb", "apply.start", "apply.end"))
+
+	vpcLog, err := os.ReadFile(d.path("TestExamples/vpc"))
+	require.NoError(t, err)
+	assert.Contains(t, string(vpcLog), "terraform apply")
+	assert.Contains(t, string(vpcLog), "--- FAIL: TestExamples/vpc")
+	assert.NotContains(t, string(vpcLog), "terraform plan")
+
+	albLog, err := os.ReadFile(d.path("TestExamples/alb"))
+	require.NoError(t, err)
+	assert.Contains(t, string(albLog), "terraform plan")
+	assert.Contains(t, string(albLog), "--- PASS: TestExamples/alb")
+	assert.NotContains(t, string(albLog), "Should be true")
+
+	assert.Equal(t, filepath.Join(dir, "logs", "TestExamples_vpc.log"), d.path("TestExamples/vpc"))
+}
+
+func TestRunStageRecordsOutcomes(t *testing.T) {
+	r := New("")
+
+	t.Run("stages", func(t *testing.T) {
+		t.Setenv("SKIP_validate", "true")
+
+		result := r.StartTest(t, "../examples/vpc")
+		result.RunStage(t, "apply", func() {})
+		result.RunStage(t, "validate", func() {})
+		result.SkipStage(t, "destroy", "resumed")
+		result.SetRegion("us-east-2")
+		result.SetOutputs(map[string]interface{}{"vpc_id": "vpc-1"})
+	})
+
+	require.Len(t, r.tests, 1)
+	result := r.tests[0]
+	assert.Equal(t, "TestRunStageRecordsOutcomes/stages", result.Name)
+	assert.Equal(t, Passed, result.Outcome)
+	assert.Equal(t, "us-east-2", result.Region)
+	assert.Equal(t, "vpc-1", result.Outputs["vpc_id"])
+
+	require.Len(t, result.Stages, 3)
+	assert.Equal(t, "apply", result.Stages[0].Name)
+	assert.Equal(t, Passed, result.Stages[0].Outcome)
+	assert.Equal(t, "validate", result.Stages[1].Name)
+	assert.Equal(t, Skipped, result.Stages[1].Outcome)
+	assert.Equal(t, "destroy", result.Stages[2].Name)
+	assert.Equal(t, Skipped, result.Stages[2].Outcome)
+}
+
+func TestWriteReport(t *testing.T) {
+	dir := t.TempDir()
+	r := New(dir)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.tests = []*Test{
+		{
+			Name:     "TestExamples/vpc",
+			Region:   "us-east-1",
+			Start:    start,
+			Duration: 90,
+			Outcome:  Failed,
+			Outputs:  map[string]interface{}{"vpc_id": "vpc-1"},
+			PlanDiff: "No changes. Your infrastructure matches the configuration.",
+			Stages: []*Stage{
+				{Name: "apply", Duration: 60, Outcome: Passed},
+				{Name: "validate", Duration: 20, Outcome: Failed, Failure: "vpc.go:10:\n\tError:      \tShould be true"},
+				{Name: "destroy", Duration: 10, Outcome: Skipped},
+			},
+		},
+		{
+			Name:     "TestExamples/alb",
+			Start:    start,
+			Duration: 5,
+			Outcome:  Failed,
+			Stages:   []*Stage{},
+		},
+	}
+
+	require.NoError(t, r.Write())
+
+	summaryJSON, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	var s summary
+	require.NoError(t, json.Unmarshal(summaryJSON, &s))
+	assert.Equal(t, 2, s.Failed)
+	assert.Equal(t, 0, s.Passed)
+	require.Len(t, s.Tests, 2)
+	assert.Equal(t, "TestExamples/alb", s.Tests[0].Name)
+
+	junitXML, err := os.ReadFile(filepath.Join(dir, "junit.xml"))
+	require.NoError(t, err)
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(junitXML, &suites))
+	assert.Equal(t, 4, suites.Tests)
+	assert.Equal(t, 2, suites.Failures)
+	assert.Equal(t, 1, suites.Skipped)
+
+	require.Len(t, suites.Suites, 2)
+	alb, vpc := suites.Suites[0], suites.Suites[1]
+
+	// A test that failed outside of its stages is reported as a failed test case
+	require.Len(t, alb.Cases, 1)
+	assert.Equal(t, "test", alb.Cases[0].Name)
+	assert.NotNil(t, alb.Cases[0].Failure)
+
+	require.Len(t, vpc.Cases, 3)
+	assert.Nil(t, vpc.Cases[0].Failure)
+	require.NotNil(t, vpc.Cases[1].Failure)
+	assert.Equal(t, "Should be true", vpc.Cases[1].Failure.Message)
+	assert.NotNil(t, vpc.Cases[2].Skipped)
+	assert.Equal(t, "60.000", vpc.Cases[0].Time)
+	assert.Contains(t, vpc.Properties, junitProperty{"region", "us-east-1"})
+	assert.Contains(t, vpc.Properties, junitProperty{"output.vpc_id", `"vpc-1"`})
+	assert.Equal(t, "No changes. Your infrastructure matches the configuration.", vpc.SystemOut)
+	assert.Empty(t, alb.SystemOut)
+}
+
+func TestNoReportWithoutDir(t *testing.T) {
+	r := New("")
+
+	restore, err := r.CaptureOutput()
+	require.NoError(t, err)
+	restore()
+
+	assert.NoError(t, r.Write())
+}
+
+func TestWriteMarksInterruptedTestsFailed(t *testing.T) {
+	r := New(t.TempDir())
+	r.tests = []*Test{
+		{
+			Name: "TestExamples/vpc",
+			Stages: []*Stage{
+				{Name: "apply", Outcome: Passed},
+				{Name: "validate"},
+			},
+		},
+	}
+
+	require.NoError(t, r.Write())
+
+	assert.Equal(t, Failed, r.tests[0].Outcome)
+	assert.Equal(t, Passed, r.tests[0].Stages[0].Outcome)
+	assert.Equal(t, Failed, r.tests[0].Stages[1].Outcome)
+	assert.Equal(t, "interrupted before the stage completed", r.tests[0].Stages[1].Failure)
+}
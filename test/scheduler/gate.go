@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+)
+
+type gateState int
+
+const (
+	gatePending gateState = iota
+	gateAdmitted
+	gateDone
+)
+
+// Gate admits the jobs of a plan while they run. Runtimes are only estimates, so
+// the gate enforces the quota of each region with the resources of the jobs that
+// are actually deployed. Jobs are admitted as soon as their region has the resources
+// for them, whatever their order in the plan, as the parallel tests holding the slots
+// of go test do not start in the order of the plan.
+type Gate struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	plan  *Plan
+	state map[string]gateState
+	used  map[string]Resources
+}
+
+// NewGate creates a gate for the jobs of the plan
+func NewGate(plan *Plan) *Gate {
+	g := &Gate{
+		plan:  plan,
+		state: map[string]gateState{},
+		used:  map[string]Resources{},
+	}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// Acquire blocks until the job can deploy its resources to its region and returns the region
+func (g *Gate) Acquire(name string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	assignment, ok := g.find(name)
+	if !ok {
+		return "", fmt.Errorf("job %s is not in the plan", name)
+	}
+	if g.state[name] != gatePending {
+		return "", fmt.Errorf("job %s has already acquired the gate", name)
+	}
+
+	for !g.admissible(assignment) {
+		g.cond.Wait()
+	}
+
+	g.state[name] = gateAdmitted
+	g.used[assignment.Region] = g.used[assignment.Region].Add(assignment.Job.Resources)
+	g.cond.Broadcast()
+	return assignment.Region, nil
+}
+
+// Done releases the resources of the job. Jobs that finish without acquiring the
+// gate (i.e. a failed or skipped test) may also call Done, which then only marks
+// the job as finished.
+func (g *Gate) Done(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	assignment, ok := g.find(name)
+	if !ok || g.state[name] == gateDone {
+		return
+	}
+
+	if g.state[name] == gateAdmitted {
+		g.used[assignment.Region] = g.used[assignment.Region].Sub(assignment.Job.Resources)
+	}
+	g.state[name] = gateDone
+	g.cond.Broadcast()
+}
+
+// admissible returns true if the region of the job has the resources for the job
+func (g *Gate) admissible(assignment Assignment) bool {
+	return g.used[assignment.Region].Add(assignment.Job.Resources).Fits(g.plan.Quota)
+}
+
+func (g *Gate) find(name string) (Assignment, bool) {
+	for _, assignment := range g.plan.Assignments {
+		if assignment.Job.Name == name {
+			return assignment, true
+		}
+	}
+	return Assignment{}, false
+}
@@ -0,0 +1,243 @@
+// Package scheduler plans the order and region in which the example tests are
+// deployed so that the tests that run in parallel stay within the per-region
+// quotas of the AWS account, such as the 5 VPCs per region quota.
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Resources are the quota limited resources that a test deploys. When used as a
+// quota, they are the number of resources that can be deployed in a region.
+type Resources struct {
+	Vpcs        int
+	Eips        int
+	NatGateways int
+	Albs        int
+}
+
+// Add returns the sum of the resources
+func (r Resources) Add(other Resources) Resources {
+	return Resources{
+		Vpcs:        r.Vpcs + other.Vpcs,
+		Eips:        r.Eips + other.Eips,
+		NatGateways: r.NatGateways + other.NatGateways,
+		Albs:        r.Albs + other.Albs,
+	}
+}
+
+// Sub returns the difference of the resources
+func (r Resources) Sub(other Resources) Resources {
+	return Resources{
+		Vpcs:        r.Vpcs - other.Vpcs,
+		Eips:        r.Eips - other.Eips,
+		NatGateways: r.NatGateways - other.NatGateways,
+		Albs:        r.Albs - other.Albs,
+	}
+}
+
+// Fits returns true if none of the resources exceed the quota
+func (r Resources) Fits(quota Resources) bool {
+	return r.Vpcs <= quota.Vpcs &&
+		r.Eips <= quota.Eips &&
+		r.NatGateways <= quota.NatGateways &&
+		r.Albs <= quota.Albs
+}
+
+func (r Resources) String() string {
+	parts := []string{}
+	for _, resource := range []struct {
+		name  string
+		count int
+	}{
+		{"VPC", r.Vpcs},
+		{"EIP", r.Eips},
+		{"NAT", r.NatGateways},
+		{"ALB", r.Albs},
+	} {
+		if resource.count != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", resource.count, resource.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Job is a test to schedule
+type Job struct {
+	Name string
+
+	// Resources deployed by the test for its whole runtime
+	Resources Resources
+
+	// Regions the test can be deployed to, any region when empty
+	Regions []string
+
+	// Estimated runtime of the test
+	Runtime time.Duration
+}
+
+// Assignment is the region and estimated start of a job
+type Assignment struct {
+	Job    Job
+	Region string
+	Start  time.Duration
+	End    time.Duration
+}
+
+// Plan is the schedule of the jobs
+type Plan struct {
+	// Assignments ordered by their start
+	Assignments []Assignment
+
+	// Makespan is the estimated runtime of all the jobs
+	Makespan time.Duration
+
+	// Quota of each region
+	Quota Resources
+}
+
+// Schedule assigns each job to a region and a start so that the resources of the jobs
+// running at the same time stay within the quota of each region and at most slots jobs
+// run at the same time. Jobs are placed longest first as soon as a slot and a region
+// with enough resources are free, which keeps the makespan short. Shorter jobs are
+// backfilled while a longer job waits for resources.
+func Schedule(jobs []Job, regions []string, quota Resources, slots int) (*Plan, error) {
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("at least one region is required")
+	}
+	if slots < 1 {
+		return nil, fmt.Errorf("at least one slot is required, got %d", slots)
+	}
+
+	// Check that each job can run on its own
+	for _, job := range jobs {
+		if !job.Resources.Fits(quota) {
+			return nil, fmt.Errorf("job %s needs %s, which exceeds the quota of %s", job.Name, job.Resources, quota)
+		}
+		if len(allowedRegions(job, regions)) == 0 {
+			return nil, fmt.Errorf("job %s can only run in %s, which are not scheduled regions %s", job.Name, job.Regions, regions)
+		}
+	}
+
+	// Longest processing time first, ties are broken by name so plans are stable
+	pending := append([]Job{}, jobs...)
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Runtime != pending[j].Runtime {
+			return pending[i].Runtime > pending[j].Runtime
+		}
+		return pending[i].Name < pending[j].Name
+	})
+
+	used := map[string]Resources{}
+	running := []Assignment{}
+	plan := &Plan{Quota: quota}
+	now := time.Duration(0)
+
+	for len(pending) > 0 {
+		// Place every pending job that fits at the current time
+		remaining := []Job{}
+		for _, job := range pending {
+			region, ok := "", false
+			if len(running) < slots {
+				region, ok = pickRegion(job, regions, used, quota)
+			}
+			if !ok {
+				remaining = append(remaining, job)
+				continue
+			}
+
+			assignment := Assignment{Job: job, Region: region, Start: now, End: now + job.Runtime}
+			used[region] = used[region].Add(job.Resources)
+			running = append(running, assignment)
+			plan.Assignments = append(plan.Assignments, assignment)
+		}
+		pending = remaining
+
+		if len(pending) == 0 {
+			break
+		}
+
+		// Advance to the next job to finish and free its resources
+		if len(running) == 0 {
+			return nil, fmt.Errorf("unable to schedule %d jobs", len(pending))
+		}
+		sort.SliceStable(running, func(i, j int) bool {
+			return running[i].End < running[j].End
+		})
+		now = running[0].End
+		for len(running) > 0 && running[0].End == now {
+			used[running[0].Region] = used[running[0].Region].Sub(running[0].Job.Resources)
+			running = running[1:]
+		}
+	}
+
+	for _, assignment := range plan.Assignments {
+		if assignment.End > plan.Makespan {
+			plan.Makespan = assignment.End
+		}
+	}
+	sort.SliceStable(plan.Assignments, func(i, j int) bool {
+		return plan.Assignments[i].Start < plan.Assignments[j].Start
+	})
+
+	return plan, nil
+}
+
+// pickRegion returns the allowed region with the most free resources that the job fits in
+func pickRegion(job Job, regions []string, used map[string]Resources, quota Resources) (string, bool) {
+	best, bestFree, found := "", 0, false
+	for _, region := range allowedRegions(job, regions) {
+		if !used[region].Add(job.Resources).Fits(quota) {
+			continue
+		}
+
+		free := quota.Sub(used[region])
+		total := free.Vpcs + free.Eips + free.NatGateways + free.Albs
+		if !found || total > bestFree {
+			best, bestFree, found = region, total, true
+		}
+	}
+	return best, found
+}
+
+// allowedRegions returns the scheduled regions that the job can run in
+func allowedRegions(job Job, regions []string) []string {
+	if len(job.Regions) == 0 {
+		return regions
+	}
+
+	allowed := []string{}
+	for _, region := range regions {
+		for _, jobRegion := range job.Regions {
+			if region == jobRegion {
+				allowed = append(allowed, region)
+			}
+		}
+	}
+	return allowed
+}
+
+// Region returns the region the job is assigned to
+func (p *Plan) Region(name string) (string, bool) {
+	for _, assignment := range p.Assignments {
+		if assignment.Job.Name == name {
+			return assignment.Region, true
+		}
+	}
+	return "", false
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scheduled %d tests with an estimated runtime of %s (quota per region: %s)\n", len(p.Assignments), p.Makespan, p.Quota)
+	for _, assignment := range p.Assignments {
+		fmt.Fprintf(&b, "  %-10s %8s - %-8s %-40s %s\n", assignment.Region, assignment.Start, assignment.End, assignment.Job.Name, assignment.Job.Resources)
+	}
+	return b.String()
+}
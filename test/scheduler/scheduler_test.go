@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testQuota = Resources{Vpcs: 5, Eips: 5, NatGateways: 5, Albs: 50}
+
+// assertPlanWithinQuota asserts that the jobs running at any time fit the quota and slots
+func assertPlanWithinQuota(t *testing.T, plan *Plan, slots int) {
+	for _, at := range plan.Assignments {
+		used := map[string]Resources{}
+		running := 0
+		for _, other := range plan.Assignments {
+			if other.Start <= at.Start && at.Start < other.End {
+				used[other.Region] = used[other.Region].Add(other.Job.Resources)
+				running++
+			}
+		}
+
+		assert.LessOrEqual(t, running, slots, "Expected at most %d jobs running at %s", slots, at.Start)
+		for region, resources := range used {
+			assert.True(t, resources.Fits(plan.Quota), "Expected %s in %s at %s to fit %s", resources, region, at.Start, plan.Quota)
+		}
+	}
+}
+
+func TestScheduleSpreadsVpcsAcrossRegions(t *testing.T) {
+	jobs := []Job{}
+	for i := 0; i < 8; i++ {
+		jobs = append(jobs, Job{Name: fmt.Sprintf("vpc-%d", i), Resources: Resources{Vpcs: 1}, Runtime: 5 * time.Minute})
+	}
+
+	plan, err := Schedule(jobs, []string{"us-east-1", "us-east-2"}, testQuota, 10)
+	require.NoError(t, err)
+
+	// Eight VPCs fit in two regions at the same time
+	assert.Equal(t, 5*time.Minute, plan.Makespan)
+	regions := map[string]int{}
+	for _, assignment := range plan.Assignments {
+		regions[assignment.Region]++
+	}
+	assert.Equal(t, map[string]int{"us-east-1": 4, "us-east-2": 4}, regions)
+	assertPlanWithinQuota(t, plan, 10)
+}
+
+func TestScheduleWaitsForQuota(t *testing.T) {
+	jobs := []Job{}
+	for i := 0; i < 6; i++ {
+		jobs = append(jobs, Job{Name: fmt.Sprintf("nat-%d", i), Resources: Resources{Vpcs: 1, Eips: 1, NatGateways: 1}, Runtime: 10 * time.Minute})
+	}
+
+	plan, err := Schedule(jobs, []string{"us-east-1"}, testQuota, 10)
+	require.NoError(t, err)
+
+	// The sixth VPC waits for the first five
+	assert.Equal(t, 20*time.Minute, plan.Makespan)
+	assertPlanWithinQuota(t, plan, 10)
+}
+
+func TestScheduleLongestFirstWithBackfill(t *testing.T) {
+	jobs := []Job{
+		{Name: "short-vpc", Resources: Resources{Vpcs: 1}, Runtime: 2 * time.Minute},
+		{Name: "long-vpc", Resources: Resources{Vpcs: 4}, Runtime: 15 * time.Minute},
+		{Name: "medium-vpc", Resources: Resources{Vpcs: 4}, Runtime: 5 * time.Minute},
+		{Name: "s3", Runtime: 5 * time.Minute},
+	}
+
+	plan, err := Schedule(jobs, []string{"us-east-1"}, testQuota, 2)
+	require.NoError(t, err)
+
+	// The long job starts first and the medium job waits for its VPCs,
+	// so the s3 job is backfilled into the free slot and the short job
+	// takes the slot once the s3 job is done
+	starts := map[string]time.Duration{}
+	for _, assignment := range plan.Assignments {
+		starts[assignment.Job.Name] = assignment.Start
+	}
+	assert.Equal(t, map[string]time.Duration{
+		"long-vpc":   0,
+		"s3":         0,
+		"short-vpc":  5 * time.Minute,
+		"medium-vpc": 15 * time.Minute,
+	}, starts)
+	assert.Equal(t, 20*time.Minute, plan.Makespan)
+	assertPlanWithinQuota(t, plan, 2)
+}
+
+func TestScheduleRegionConstraints(t *testing.T) {
+	jobs := []Job{
+		{Name: "s3", Regions: []string{"us-east-1"}, Runtime: 5 * time.Minute},
+		{Name: "any", Runtime: 5 * time.Minute},
+	}
+
+	plan, err := Schedule(jobs, []string{"us-east-1", "us-east-2"}, testQuota, 10)
+	require.NoError(t, err)
+
+	region, ok := plan.Region("s3")
+	assert.True(t, ok)
+	assert.Equal(t, "us-east-1", region)
+
+	// A job that cannot run in any of the regions cannot be scheduled
+	_, err = Schedule([]Job{{Name: "s3", Regions: []string{"eu-west-1"}}}, []string{"us-east-1"}, testQuota, 10)
+	assert.Error(t, err)
+}
+
+func TestScheduleJobExceedsQuota(t *testing.T) {
+	_, err := Schedule([]Job{{Name: "vpcs", Resources: Resources{Vpcs: 6}}}, []string{"us-east-1"}, testQuota, 10)
+	assert.Error(t, err)
+}
+
+func TestGate(t *testing.T) {
+	jobs := []Job{
+		{Name: "first", Resources: Resources{Vpcs: 3}, Runtime: 10 * time.Minute},
+		{Name: "second", Resources: Resources{Vpcs: 3}, Runtime: 5 * time.Minute},
+	}
+	plan, err := Schedule(jobs, []string{"us-east-1"}, testQuota, 10)
+	require.NoError(t, err)
+
+	gate := NewGate(plan)
+
+	region, err := gate.Acquire("first")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region)
+
+	// The second job waits for the first job to release its VPCs
+	acquired := make(chan struct{})
+	go func() {
+		_, err := gate.Acquire("second")
+		assert.NoError(t, err)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected the second job to wait for the first job")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	gate.Done("first")
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second job to acquire the gate")
+	}
+	gate.Done("second")
+}
+
+func TestGateDoneWithoutAcquire(t *testing.T) {
+	jobs := []Job{
+		{Name: "first", Resources: Resources{Vpcs: 3}, Runtime: 10 * time.Minute},
+		{Name: "second", Resources: Resources{Vpcs: 3}, Runtime: 5 * time.Minute},
+	}
+	plan, err := Schedule(jobs, []string{"us-east-1"}, testQuota, 10)
+	require.NoError(t, err)
+
+	gate := NewGate(plan)
+
+	// A job that never acquired the gate holds no resources
+	gate.Done("first")
+	_, err = gate.Acquire("second")
+	require.NoError(t, err)
+	_, err = gate.Acquire("first")
+	assert.Error(t, err)
+	gate.Done("second")
+}
+
+// gateHelperEnvVar runs TestGateSubtests in the go test started by TestGateParallelBelowJobs
+const gateHelperEnvVar = "SCHEDULER_GATE_HELPER"
+
+// TestGateSubtests acquires the gate from parallel subtests that start in the reverse
+// order of the plan, like the tests of the examples when go test runs fewer tests
+// in parallel than there are jobs
+func TestGateSubtests(t *testing.T) {
+	if os.Getenv(gateHelperEnvVar) == "" {
+		t.Skip("Run by TestGateParallelBelowJobs")
+	}
+
+	jobs := []Job{}
+	for i := 0; i < 4; i++ {
+		jobs = append(jobs, Job{Name: fmt.Sprintf("vpcs-%d", i), Resources: Resources{Vpcs: 3}, Runtime: time.Duration(i+1) * time.Minute})
+	}
+	plan, err := Schedule(jobs, []string{"us-east-1"}, testQuota, 10)
+	require.NoError(t, err)
+
+	gate := NewGate(plan)
+	for i := len(plan.Assignments) - 1; i >= 0; i-- {
+		name := plan.Assignments[i].Job.Name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			defer gate.Done(name)
+
+			_, err := gate.Acquire(name)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGateParallelBelowJobs(t *testing.T) {
+	if os.Getenv(gateHelperEnvVar) != "" {
+		t.Skip("Running the subtests")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestGateSubtests$", "-test.parallel=1", "-test.v")
+	cmd.Env = append(os.Environ(), gateHelperEnvVar+"=1")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, ctx.Err(), "The subtests deadlocked in the gate:\n%s", out)
+	require.NoError(t, err, string(out))
+	assert.Equal(t, 4, strings.Count(string(out), "--- PASS: TestGateSubtests/"), string(out))
+}
@@ -0,0 +1,243 @@
+package survivors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+// cloudwatchLogsAPI is the part of the CloudWatch Logs API that the checker uses
+type cloudwatchLogsAPI interface {
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+}
+
+// ec2API is the part of the EC2 API that the checker uses
+type ec2API interface {
+	DescribeAddresses(ctx context.Context, params *ec2.DescribeAddressesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error)
+	DescribeNatGateways(ctx context.Context, params *ec2.DescribeNatGatewaysInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNatGatewaysOutput, error)
+	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
+	DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error)
+}
+
+// ecsAPI is the part of the ECS API that the checker uses
+type ecsAPI interface {
+	DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+}
+
+// elbv2API is the part of the Elastic Load Balancing v2 API that the checker uses
+type elbv2API interface {
+	DescribeLoadBalancers(ctx context.Context, params *elasticloadbalancingv2.DescribeLoadBalancersInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeLoadBalancersOutput, error)
+	DescribeTargetGroups(ctx context.Context, params *elasticloadbalancingv2.DescribeTargetGroupsInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeTargetGroupsOutput, error)
+}
+
+// iamAPI is the part of the IAM API that the checker uses
+type iamAPI interface {
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+}
+
+// s3API is the part of the S3 API that the checker uses
+type s3API interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+}
+
+// secretsManagerAPI is the part of the Secrets Manager API that the checker uses
+type secretsManagerAPI interface {
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+}
+
+// regionAPIs are the APIs of a region that the resources are looked up with
+type regionAPIs struct {
+	cloudwatchLogs cloudwatchLogsAPI
+	ec2            ec2API
+	ecs            ecsAPI
+	elbv2          elbv2API
+	iam            iamAPI
+	s3             s3API
+	secretsManager secretsManagerAPI
+}
+
+// AwsChecker looks up the resources with the AWS APIs of the region of the example
+type AwsChecker struct {
+	clients *awsclients.Clients
+
+	mu   sync.Mutex
+	apis map[string]*regionAPIs
+}
+
+// NewAwsChecker creates a checker that looks up the resources with the clients. The
+// resources of another region are looked up with the clients of that region.
+func NewAwsChecker(clients *awsclients.Clients) *AwsChecker {
+	return &AwsChecker{clients: clients, apis: map[string]*regionAPIs{}}
+}
+
+// regionAPIs returns the APIs of the region of the resource
+func (c *AwsChecker) regionAPIs(r Resource) *regionAPIs {
+	region := r.Region
+	if region == "" {
+		region = c.clients.Region()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if apis, ok := c.apis[region]; ok {
+		return apis
+	}
+	clients := c.clients.InRegion(region)
+	apis := &regionAPIs{
+		cloudwatchLogs: clients.CloudWatchLogs(),
+		ec2:            clients.Ec2(),
+		ecs:            clients.Ecs(),
+		elbv2:          clients.Elbv2(),
+		iam:            clients.Iam(),
+		s3:             clients.S3(),
+		secretsManager: clients.SecretsManager(),
+	}
+	c.apis[region] = apis
+	return apis
+}
+
+// Exists returns true if the resource is not deleted yet. Resources that AWS keeps
+// describing after their deletion (i.e. INACTIVE clusters) are reported as deleted.
+func (c *AwsChecker) Exists(r Resource) (bool, error) {
+	exists, err := c.exists(context.TODO(), c.regionAPIs(r), r)
+	if err != nil && isNotFound(err) {
+		return false, nil
+	}
+	return exists, err
+}
+
+func (c *AwsChecker) exists(ctx context.Context, apis *regionAPIs, r Resource) (bool, error) {
+	switch r.Type {
+	case "aws_vpc":
+		out, err := apis.ec2.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{VpcIds: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		return len(out.Vpcs) > 0, nil
+
+	case "aws_subnet":
+		out, err := apis.ec2.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		return len(out.Subnets) > 0, nil
+
+	case "aws_eip":
+		out, err := apis.ec2.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{AllocationIds: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		return len(out.Addresses) > 0, nil
+
+	case "aws_nat_gateway":
+		out, err := apis.ec2.DescribeNatGateways(ctx, &ec2.DescribeNatGatewaysInput{NatGatewayIds: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		for _, natGateway := range out.NatGateways {
+			if natGateway.State != ec2types.NatGatewayStateDeleted {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "aws_lb":
+		out, err := apis.elbv2.DescribeLoadBalancers(ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{LoadBalancerArns: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		return len(out.LoadBalancers) > 0, nil
+
+	case "aws_lb_target_group":
+		out, err := apis.elbv2.DescribeTargetGroups(ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{TargetGroupArns: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		return len(out.TargetGroups) > 0, nil
+
+	case "aws_ecs_cluster":
+		out, err := apis.ecs.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: []string{r.Id}})
+		if err != nil {
+			return false, err
+		}
+		for _, cluster := range out.Clusters {
+			if aws.ToString(cluster.Status) != "INACTIVE" {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "aws_ecs_service":
+		out, err := apis.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(r.Parent),
+			Services: []string{r.Id},
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, service := range out.Services {
+			if aws.ToString(service.Status) != "INACTIVE" {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "aws_cloudwatch_log_group":
+		out, err := apis.cloudwatchLogs.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(r.Id)})
+		if err != nil {
+			return false, err
+		}
+		for _, logGroup := range out.LogGroups {
+			if aws.ToString(logGroup.LogGroupName) == r.Id {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "aws_iam_role":
+		_, err := apis.iam.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(r.Id)})
+		return err == nil, err
+
+	case "aws_secretsmanager_secret":
+		out, err := apis.secretsManager.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(r.Id)})
+		if err != nil {
+			return false, err
+		}
+		// A secret that is scheduled for deletion can no longer be used
+		return out.DeletedDate == nil, nil
+
+	case "aws_s3_bucket":
+		_, err := apis.s3.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(r.Id)})
+		return err == nil, err
+	}
+
+	return false, fmt.Errorf("unknown type %s", r.Type)
+}
+
+// isNotFound returns true if the API reports that the resource does not exist. HeadBucket
+// has no body to read a code from, so a missing bucket is reported as NotFound.
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return strings.HasSuffix(code, "NotFound") || code == "ClusterNotFoundException" ||
+			code == "NoSuchEntity" || code == "ResourceNotFoundException" || code == "NoSuchBucket"
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package survivors
+
+import (
+	"testing"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fakeaws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAwsCheckerExists(t *testing.T) {
+	s := fakeaws.NewServer(t, "us-east-1")
+	ecs := fakeaws.NewEcs(s)
+	clusterArn := ecs.AddCluster("cluster", 0)
+	elbv2 := fakeaws.NewElbv2(s)
+	loadBalancerArn := elbv2.AddLoadBalancer("alb", "alb.us-east-1.elb.amazonaws.com")
+	s.Handle("iam", "GetRole", func(r *fakeaws.Request) (interface{}, error) {
+		return nil, fakeaws.Errorf("NoSuchEntity", "The role with name %s cannot be found.", r.Form.Get("RoleName"))
+	})
+
+	checker := NewAwsChecker(awsclients.FromConfig(s.Config()))
+
+	tests := []struct {
+		resource Resource
+		exists   bool
+	}{
+		{Resource{Type: "aws_ecs_cluster", Id: clusterArn}, true},
+		{Resource{Type: "aws_ecs_cluster", Id: "deleted"}, false},
+		{Resource{Type: "aws_ecs_service", Id: "service", Parent: "deleted"}, false},
+		{Resource{Type: "aws_lb", Id: loadBalancerArn}, true},
+		{Resource{Type: "aws_lb", Id: loadBalancerArn + "-deleted"}, false},
+		{Resource{Type: "aws_iam_role", Id: "task"}, false},
+	}
+	for _, tt := range tests {
+		exists, err := checker.Exists(tt.resource)
+		require.NoError(t, err, "Error checking %s", tt.resource)
+		assert.Equal(t, tt.exists, exists, "Expected %s to exist: %t", tt.resource, tt.exists)
+	}
+
+	// The resources of another region are looked up with the same endpoint
+	exists, err := checker.Exists(Resource{Type: "aws_ecs_cluster", Id: "cluster", Region: "us-west-2"})
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = checker.Exists(Resource{Type: "aws_instance", Id: "i-1"})
+	assert.EqualError(t, err, "unknown type aws_instance")
+}
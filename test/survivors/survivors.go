@@ -0,0 +1,146 @@
+// Package survivors checks that the resources of a destroyed example are gone. Terraform
+// can report a destroy as complete while AWS is still deleting a resource, or forget a
+// resource that a failed apply left out of the state, so the tests capture the ids of
+// the resources from the state before the destroy and poll the AWS APIs until each of
+// them is deleted.
+package survivors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Stage checks that the resources of the example are gone after the destroy stage
+const Stage = "verify_destroy"
+
+// Resource is a resource of the state that is checked after the destroy
+type Resource struct {
+	Type    string
+	Address string
+
+	// Id is the id of the resource in the state, i.e. the VPC id or the load balancer ARN
+	Id string
+
+	// Parent is the id of the resource that the resource is described with, i.e. the
+	// ECS cluster of a service
+	Parent string
+
+	// Region of the resource when it is not deployed to the region of the example
+	Region string
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s (%s)", r.Address, r.Id)
+}
+
+// parentAttributes are the attributes that hold the parent of the resource types
+// that are checked, the types without a parent map to an empty attribute
+var parentAttributes = map[string]string{
+	"aws_vpc":                   "",
+	"aws_subnet":                "",
+	"aws_eip":                   "",
+	"aws_nat_gateway":           "",
+	"aws_lb":                    "",
+	"aws_lb_target_group":       "",
+	"aws_ecs_cluster":           "",
+	"aws_ecs_service":           "cluster",
+	"aws_cloudwatch_log_group":  "",
+	"aws_iam_role":              "",
+	"aws_secretsmanager_secret": "",
+	"aws_s3_bucket":             "",
+}
+
+// Capture returns the managed resources of the state that are checked after the
+// destroy, sorted by address
+func Capture(state *tfjson.State) []Resource {
+	resources := []Resource{}
+	if state.Values == nil {
+		return resources
+	}
+
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		for _, resource := range module.Resources {
+			parentAttribute, ok := parentAttributes[resource.Type]
+			if resource.Mode != tfjson.ManagedResourceMode || !ok {
+				continue
+			}
+			id, _ := resource.AttributeValues["id"].(string)
+			if id == "" {
+				continue
+			}
+
+			r := Resource{Type: resource.Type, Address: resource.Address, Id: id}
+			if parentAttribute != "" {
+				r.Parent, _ = resource.AttributeValues[parentAttribute].(string)
+			}
+			// Buckets can be replicated to another region
+			if resource.Type == "aws_s3_bucket" {
+				r.Region, _ = resource.AttributeValues["region"].(string)
+			}
+			resources = append(resources, r)
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(state.Values.RootModule)
+
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+	return resources
+}
+
+// Checker looks up the resources in the cloud
+type Checker interface {
+	// Exists returns true if the resource is not deleted yet
+	Exists(r Resource) (bool, error)
+}
+
+// Survivor is a resource that still exists, or could not be checked, at the deadline
+type Survivor struct {
+	Resource
+
+	// Err is the error of the last check, nil when the resource was found
+	Err error
+}
+
+func (s Survivor) String() string {
+	if s.Err != nil {
+		return fmt.Sprintf("%s: %s", s.Resource, s.Err)
+	}
+	return s.Resource.String()
+}
+
+// Wait checks the resources with the waiter until all of them are deleted and returns
+// the resources that survive the deadline of the context. A check that fails is
+// retried, the APIs throttle the many describe calls of the tests that are destroyed
+// at the same time.
+func Wait(ctx context.Context, w *waiter.Waiter, checker Checker, resources []Resource) []Survivor {
+	survivors := []Survivor{}
+	for _, r := range resources {
+		survivors = append(survivors, Survivor{Resource: r})
+	}
+
+	w.Wait(ctx, func(ctx context.Context) error {
+		remaining := []Survivor{}
+		for _, s := range survivors {
+			exists, err := checker.Exists(s.Resource)
+			if exists || err != nil {
+				remaining = append(remaining, Survivor{Resource: s.Resource, Err: err})
+			}
+		}
+		survivors = remaining
+
+		if len(survivors) > 0 {
+			return fmt.Errorf("%d resources are not deleted yet, i.e. %s", len(survivors), survivors[0])
+		}
+		return nil
+	})
+	return survivors
+}
@@ -0,0 +1,128 @@
+package survivors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	state := &tfjson.State{
+		Values: &tfjson.StateValues{
+			RootModule: &tfjson.StateModule{
+				Resources: []*tfjson.StateResource{
+					{
+						Address:         "data.aws_ecs_cluster.shared[0]",
+						Mode:            tfjson.DataResourceMode,
+						Type:            "aws_ecs_cluster",
+						AttributeValues: map[string]interface{}{"id": "arn:aws:ecs:us-east-1:123456789012:cluster/shared"},
+					},
+				},
+				ChildModules: []*tfjson.StateModule{
+					{
+						Address: "module.service",
+						Resources: []*tfjson.StateResource{
+							{
+								Address: "module.service.aws_ecs_service.service",
+								Mode:    tfjson.ManagedResourceMode,
+								Type:    "aws_ecs_service",
+								AttributeValues: map[string]interface{}{
+									"id":      "arn:aws:ecs:us-east-1:123456789012:service/shared/service",
+									"cluster": "arn:aws:ecs:us-east-1:123456789012:cluster/shared",
+								},
+							},
+							{
+								Address:         "module.service.aws_ecs_task_definition.task",
+								Mode:            tfjson.ManagedResourceMode,
+								Type:            "aws_ecs_task_definition",
+								AttributeValues: map[string]interface{}{"id": "service"},
+							},
+						},
+					},
+					{
+						Address: "module.bucket",
+						Resources: []*tfjson.StateResource{
+							{
+								Address:         "module.bucket.aws_s3_bucket.replica[0]",
+								Mode:            tfjson.ManagedResourceMode,
+								Type:            "aws_s3_bucket",
+								AttributeValues: map[string]interface{}{"id": "replica", "region": "us-west-2"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []Resource{
+		{Type: "aws_s3_bucket", Address: "module.bucket.aws_s3_bucket.replica[0]", Id: "replica", Region: "us-west-2"},
+		{
+			Type:    "aws_ecs_service",
+			Address: "module.service.aws_ecs_service.service",
+			Id:      "arn:aws:ecs:us-east-1:123456789012:service/shared/service",
+			Parent:  "arn:aws:ecs:us-east-1:123456789012:cluster/shared",
+		},
+	}, Capture(state))
+
+	assert.Empty(t, Capture(&tfjson.State{}))
+}
+
+// fakeChecker reports a resource as deleted after it was checked a number of times
+type fakeChecker struct {
+	mu       sync.Mutex
+	checks   map[string]int
+	deleteAt map[string]int
+	errs     map[string]error
+}
+
+func (c *fakeChecker) Exists(r Resource) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[r.Id]++
+	if err := c.errs[r.Id]; err != nil {
+		return false, err
+	}
+	return c.checks[r.Id] < c.deleteAt[r.Id], nil
+}
+
+func newTestWaiter(t *testing.T) *waiter.Waiter {
+	w := waiter.New("the resources to be deleted", t.Logf)
+	w.Backoff = waiter.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	return w
+}
+
+func TestWait(t *testing.T) {
+	vpc := Resource{Type: "aws_vpc", Address: "module.vpc.aws_vpc.vpc", Id: "vpc-1"}
+	natGateway := Resource{Type: "aws_nat_gateway", Address: "module.vpc.aws_nat_gateway.nat", Id: "nat-1"}
+	role := Resource{Type: "aws_iam_role", Address: "module.service.aws_iam_role.task", Id: "task"}
+
+	checker := &fakeChecker{
+		checks:   map[string]int{},
+		deleteAt: map[string]int{"vpc-1": 1, "nat-1": 3},
+		errs:     map[string]error{},
+	}
+	assert.Empty(t, Wait(context.Background(), newTestWaiter(t), checker, []Resource{vpc, natGateway}))
+
+	// A deleted resource is not checked again
+	assert.Equal(t, 1, checker.checks["vpc-1"])
+	assert.Equal(t, 3, checker.checks["nat-1"])
+
+	// The resources that are left at the deadline are returned with the last error
+	checker.deleteAt["vpc-2"] = 1000
+	checker.errs["task"] = errors.New("Throttling: Rate exceeded")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	survivors := Wait(ctx, newTestWaiter(t), checker, []Resource{{Type: "aws_vpc", Address: "module.vpc.aws_vpc.vpc", Id: "vpc-2"}, role})
+	assert.Len(t, survivors, 2)
+	assert.Equal(t, "module.vpc.aws_vpc.vpc (vpc-2)", survivors[0].String())
+	assert.Equal(t, "module.service.aws_iam_role.task (task): Throttling: Rate exceeded", survivors[1].String())
+	assert.Greater(t, checker.checks["vpc-2"], 1)
+}
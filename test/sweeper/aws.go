@@ -0,0 +1,704 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	elbv2 "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// deletedWaitTimeout is how long a deletion is waited for before the next resource of
+// the plan is deleted
+const deletedWaitTimeout = 10 * time.Minute
+
+// autoScalingAPI is the part of the Auto Scaling API that the sweeper uses
+type autoScalingAPI interface {
+	autoscaling.DescribeAutoScalingGroupsAPIClient
+
+	DeleteAutoScalingGroup(ctx context.Context, params *autoscaling.DeleteAutoScalingGroupInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DeleteAutoScalingGroupOutput, error)
+}
+
+// ec2API is the part of the EC2 API that the sweeper uses
+type ec2API interface {
+	ec2.DescribeLaunchTemplatesAPIClient
+	ec2.DescribeNatGatewaysAPIClient
+	ec2.DescribeVpcsAPIClient
+
+	DeleteInternetGateway(ctx context.Context, params *ec2.DeleteInternetGatewayInput, optFns ...func(*ec2.Options)) (*ec2.DeleteInternetGatewayOutput, error)
+	DeleteLaunchTemplate(ctx context.Context, params *ec2.DeleteLaunchTemplateInput, optFns ...func(*ec2.Options)) (*ec2.DeleteLaunchTemplateOutput, error)
+	DeleteNatGateway(ctx context.Context, params *ec2.DeleteNatGatewayInput, optFns ...func(*ec2.Options)) (*ec2.DeleteNatGatewayOutput, error)
+	DeleteNetworkAcl(ctx context.Context, params *ec2.DeleteNetworkAclInput, optFns ...func(*ec2.Options)) (*ec2.DeleteNetworkAclOutput, error)
+	DeleteRouteTable(ctx context.Context, params *ec2.DeleteRouteTableInput, optFns ...func(*ec2.Options)) (*ec2.DeleteRouteTableOutput, error)
+	DeleteSecurityGroup(ctx context.Context, params *ec2.DeleteSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error)
+	DeleteSubnet(ctx context.Context, params *ec2.DeleteSubnetInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSubnetOutput, error)
+	DeleteVpc(ctx context.Context, params *ec2.DeleteVpcInput, optFns ...func(*ec2.Options)) (*ec2.DeleteVpcOutput, error)
+	DescribeAddresses(ctx context.Context, params *ec2.DescribeAddressesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error)
+	DescribeInternetGateways(ctx context.Context, params *ec2.DescribeInternetGatewaysInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInternetGatewaysOutput, error)
+	DescribeNetworkAcls(ctx context.Context, params *ec2.DescribeNetworkAclsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkAclsOutput, error)
+	DescribeRouteTables(ctx context.Context, params *ec2.DescribeRouteTablesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRouteTablesOutput, error)
+	DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
+	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
+	DetachInternetGateway(ctx context.Context, params *ec2.DetachInternetGatewayInput, optFns ...func(*ec2.Options)) (*ec2.DetachInternetGatewayOutput, error)
+	ReleaseAddress(ctx context.Context, params *ec2.ReleaseAddressInput, optFns ...func(*ec2.Options)) (*ec2.ReleaseAddressOutput, error)
+	RevokeSecurityGroupEgress(ctx context.Context, params *ec2.RevokeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error)
+	RevokeSecurityGroupIngress(ctx context.Context, params *ec2.RevokeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupIngressOutput, error)
+}
+
+// ecsAPI is the part of the ECS API that the sweeper uses
+type ecsAPI interface {
+	ecs.DescribeServicesAPIClient
+	ecs.ListClustersAPIClient
+	ecs.ListContainerInstancesAPIClient
+	ecs.ListServicesAPIClient
+
+	DeleteCapacityProvider(ctx context.Context, params *ecs.DeleteCapacityProviderInput, optFns ...func(*ecs.Options)) (*ecs.DeleteCapacityProviderOutput, error)
+	DeleteCluster(ctx context.Context, params *ecs.DeleteClusterInput, optFns ...func(*ecs.Options)) (*ecs.DeleteClusterOutput, error)
+	DeleteService(ctx context.Context, params *ecs.DeleteServiceInput, optFns ...func(*ecs.Options)) (*ecs.DeleteServiceOutput, error)
+	DeregisterContainerInstance(ctx context.Context, params *ecs.DeregisterContainerInstanceInput, optFns ...func(*ecs.Options)) (*ecs.DeregisterContainerInstanceOutput, error)
+	DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
+	PutClusterCapacityProviders(ctx context.Context, params *ecs.PutClusterCapacityProvidersInput, optFns ...func(*ecs.Options)) (*ecs.PutClusterCapacityProvidersOutput, error)
+}
+
+// elbv2API is the part of the Elastic Load Balancing v2 API that the sweeper uses
+type elbv2API interface {
+	elbv2.DescribeLoadBalancersAPIClient
+	elbv2.DescribeTargetGroupsAPIClient
+
+	DeleteLoadBalancer(ctx context.Context, params *elbv2.DeleteLoadBalancerInput, optFns ...func(*elbv2.Options)) (*elbv2.DeleteLoadBalancerOutput, error)
+	DeleteTargetGroup(ctx context.Context, params *elbv2.DeleteTargetGroupInput, optFns ...func(*elbv2.Options)) (*elbv2.DeleteTargetGroupOutput, error)
+	DescribeTags(ctx context.Context, params *elbv2.DescribeTagsInput, optFns ...func(*elbv2.Options)) (*elbv2.DescribeTagsOutput, error)
+}
+
+// Sweeper finds and deletes the resources of the test suite in a region
+type Sweeper struct {
+	Region string
+
+	// Logf logs the progress of the deletions that are retried
+	Logf func(format string, args ...interface{})
+
+	ec2         ec2API
+	ecs         ecsAPI
+	elbv2       elbv2API
+	autoscaling autoScalingAPI
+}
+
+// New creates a sweeper for the region of the clients
+func New(clients *awsclients.Clients) *Sweeper {
+	return &Sweeper{
+		Region:      clients.Region(),
+		Logf:        log.Printf,
+		ec2:         clients.Ec2(),
+		ecs:         clients.Ecs(),
+		elbv2:       clients.Elbv2(),
+		autoscaling: clients.AutoScaling(),
+	}
+}
+
+// match returns the deployment id of a resource with the name and tags, and whether
+// the resource looks like it was deployed by the test suite. Only the resources with
+// the suite tag are deleted, see Resource.Tagged.
+func match(name string, tags map[string]string) (string, bool) {
+	if deploymentId, ok := DeploymentId(name); ok {
+		return deploymentId, true
+	}
+	return "", tags[util.SuiteTagKey] == util.SuiteTagValue
+}
+
+// Find returns the resources of the test suite in the region
+func (s *Sweeper) Find() ([]Resource, error) {
+	resources := []Resource{}
+	for _, find := range []func(ctx context.Context) ([]Resource, error){
+		s.findEcsClusters,
+		s.findAutoScalingGroups,
+		s.findLaunchTemplates,
+		s.findLoadBalancers,
+		s.findTargetGroups,
+		s.findElasticIps,
+		s.findVpcs,
+	} {
+		found, err := find(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, found...)
+	}
+	return resources, nil
+}
+
+// resource creates a resource of the region. The creation time and TTL are read from
+// the tags that the test suite stamps, which are missing on older deployments.
+func (s *Sweeper) resource(kind Kind, id string, name string, deploymentId string, tags map[string]string) Resource {
+	r := Resource{Kind: kind, Region: s.Region, Id: id, Name: name, DeploymentId: deploymentId, Tagged: tags[util.SuiteTagKey] == util.SuiteTagValue}
+	if createdAt, err := time.Parse(time.RFC3339, tags[util.CreatedAtTagKey]); err == nil {
+		r.CreatedAt = createdAt
+	}
+	if ttl, err := time.ParseDuration(tags[util.TtlTagKey]); err == nil {
+		r.Ttl = ttl
+	}
+	return r
+}
+
+// findEcsClusters returns the clusters with their services and capacity providers
+func (s *Sweeper) findEcsClusters(ctx context.Context) ([]Resource, error) {
+	clusterArns := []string{}
+	paginator := ecs.NewListClustersPaginator(s.ecs, &ecs.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing ECS clusters: %w", err)
+		}
+		clusterArns = append(clusterArns, page.ClusterArns...)
+	}
+
+	resources := []Resource{}
+	for i := 0; i < len(clusterArns); i += 100 {
+		described, err := s.ecs.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+			Clusters: clusterArns[i:min(i+100, len(clusterArns))],
+			Include:  []ecstypes.ClusterField{ecstypes.ClusterFieldTags},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing ECS clusters: %w", err)
+		}
+
+		for _, cluster := range described.Clusters {
+			tags := map[string]string{}
+			for _, tag := range cluster.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			deploymentId, ok := match(aws.ToString(cluster.ClusterName), tags)
+			if !ok || aws.ToString(cluster.Status) == "INACTIVE" {
+				continue
+			}
+
+			clusterArn := aws.ToString(cluster.ClusterArn)
+			clusterResource := s.resource(KindEcsCluster, clusterArn, aws.ToString(cluster.ClusterName), deploymentId, tags)
+			resources = append(resources, clusterResource)
+
+			for _, capacityProvider := range cluster.CapacityProviders {
+				if strings.HasPrefix(capacityProvider, "FARGATE") {
+					continue
+				}
+				r := s.resource(KindEcsCapacityProvider, capacityProvider, capacityProvider, deploymentId, nil)
+				r.Parent = clusterArn
+				r.Tagged = clusterResource.Tagged
+				resources = append(resources, r)
+			}
+
+			services := ecs.NewListServicesPaginator(s.ecs, &ecs.ListServicesInput{Cluster: cluster.ClusterArn})
+			for services.HasMorePages() {
+				page, err := services.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("error listing services of ECS cluster %s: %w", clusterArn, err)
+				}
+				for _, serviceArn := range page.ServiceArns {
+					r := s.resource(KindEcsService, serviceArn, "", deploymentId, nil)
+					r.Parent = clusterArn
+					r.Tagged = clusterResource.Tagged
+					resources = append(resources, r)
+				}
+			}
+		}
+	}
+	return resources, nil
+}
+
+func (s *Sweeper) findAutoScalingGroups(ctx context.Context) ([]Resource, error) {
+	resources := []Resource{}
+	paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(s.autoscaling, &autoscaling.DescribeAutoScalingGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing auto scaling groups: %w", err)
+		}
+		for _, group := range page.AutoScalingGroups {
+			tags := map[string]string{}
+			for _, tag := range group.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			name := aws.ToString(group.AutoScalingGroupName)
+			if deploymentId, ok := match(name, tags); ok {
+				r := s.resource(KindAutoScalingGroup, name, name, deploymentId, tags)
+				if r.CreatedAt.IsZero() {
+					r.CreatedAt = aws.ToTime(group.CreatedTime)
+				}
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources, nil
+}
+
+func (s *Sweeper) findLaunchTemplates(ctx context.Context) ([]Resource, error) {
+	resources := []Resource{}
+	paginator := ec2.NewDescribeLaunchTemplatesPaginator(s.ec2, &ec2.DescribeLaunchTemplatesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing launch templates: %w", err)
+		}
+		for _, template := range page.LaunchTemplates {
+			name := aws.ToString(template.LaunchTemplateName)
+			tags := ec2Tags(template.Tags)
+			if deploymentId, ok := match(name, tags); ok {
+				r := s.resource(KindLaunchTemplate, aws.ToString(template.LaunchTemplateId), name, deploymentId, tags)
+				if r.CreatedAt.IsZero() {
+					r.CreatedAt = aws.ToTime(template.CreateTime)
+				}
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources, nil
+}
+
+// elbv2Tags returns the tags of the load balancers or target groups by ARN
+func (s *Sweeper) elbv2Tags(ctx context.Context, arns []string) (map[string]map[string]string, error) {
+	tags := map[string]map[string]string{}
+	for i := 0; i < len(arns); i += 20 {
+		described, err := s.elbv2.DescribeTags(ctx, &elbv2.DescribeTagsInput{
+			ResourceArns: arns[i:min(i+20, len(arns))],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing tags: %w", err)
+		}
+		for _, description := range described.TagDescriptions {
+			resourceTags := map[string]string{}
+			for _, tag := range description.Tags {
+				resourceTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			tags[aws.ToString(description.ResourceArn)] = resourceTags
+		}
+	}
+	return tags, nil
+}
+
+func (s *Sweeper) findLoadBalancers(ctx context.Context) ([]Resource, error) {
+	loadBalancers := []elbv2types.LoadBalancer{}
+	paginator := elbv2.NewDescribeLoadBalancersPaginator(s.elbv2, &elbv2.DescribeLoadBalancersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing load balancers: %w", err)
+		}
+		loadBalancers = append(loadBalancers, page.LoadBalancers...)
+	}
+
+	arns := []string{}
+	for _, loadBalancer := range loadBalancers {
+		arns = append(arns, aws.ToString(loadBalancer.LoadBalancerArn))
+	}
+	tags, err := s.elbv2Tags(ctx, arns)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, loadBalancer := range loadBalancers {
+		arn := aws.ToString(loadBalancer.LoadBalancerArn)
+		name := aws.ToString(loadBalancer.LoadBalancerName)
+		if deploymentId, ok := match(name, tags[arn]); ok {
+			r := s.resource(KindLoadBalancer, arn, name, deploymentId, tags[arn])
+			if r.CreatedAt.IsZero() {
+				r.CreatedAt = aws.ToTime(loadBalancer.CreatedTime)
+			}
+			resources = append(resources, r)
+		}
+	}
+	return resources, nil
+}
+
+func (s *Sweeper) findTargetGroups(ctx context.Context) ([]Resource, error) {
+	targetGroups := []elbv2types.TargetGroup{}
+	paginator := elbv2.NewDescribeTargetGroupsPaginator(s.elbv2, &elbv2.DescribeTargetGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing target groups: %w", err)
+		}
+		targetGroups = append(targetGroups, page.TargetGroups...)
+	}
+
+	arns := []string{}
+	for _, targetGroup := range targetGroups {
+		arns = append(arns, aws.ToString(targetGroup.TargetGroupArn))
+	}
+	tags, err := s.elbv2Tags(ctx, arns)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, targetGroup := range targetGroups {
+		arn := aws.ToString(targetGroup.TargetGroupArn)
+		name := aws.ToString(targetGroup.TargetGroupName)
+		if deploymentId, ok := match(name, tags[arn]); ok {
+			resources = append(resources, s.resource(KindTargetGroup, arn, name, deploymentId, tags[arn]))
+		}
+	}
+	return resources, nil
+}
+
+func (s *Sweeper) findElasticIps(ctx context.Context) ([]Resource, error) {
+	addresses, err := s.ec2.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error describing elastic IPs: %w", err)
+	}
+
+	resources := []Resource{}
+	for _, address := range addresses.Addresses {
+		tags := ec2Tags(address.Tags)
+		if deploymentId, ok := match(tags["Name"], tags); ok {
+			resources = append(resources, s.resource(KindElasticIp, aws.ToString(address.AllocationId), tags["Name"], deploymentId, tags))
+		}
+	}
+	return resources, nil
+}
+
+// findVpcs returns the VPCs with the resources in them that block their deletion
+func (s *Sweeper) findVpcs(ctx context.Context) ([]Resource, error) {
+	resources := []Resource{}
+	vpcs := []ec2types.Vpc{}
+	paginator := ec2.NewDescribeVpcsPaginator(s.ec2, &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing VPCs: %w", err)
+		}
+		vpcs = append(vpcs, page.Vpcs...)
+	}
+
+	for _, vpc := range vpcs {
+		tags := ec2Tags(vpc.Tags)
+		deploymentId, ok := match(tags["Name"], tags)
+		if !ok || aws.ToBool(vpc.IsDefault) {
+			continue
+		}
+
+		vpcId := aws.ToString(vpc.VpcId)
+		vpcResource := s.resource(KindVpc, vpcId, tags["Name"], deploymentId, tags)
+		resources = append(resources, vpcResource)
+
+		children, err := s.findVpcResources(ctx, vpcId, deploymentId, vpcResource.Tagged)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, children...)
+	}
+	return resources, nil
+}
+
+// findVpcResources returns the resources in the VPC, which are swept with the VPC
+// when the VPC is tagged
+func (s *Sweeper) findVpcResources(ctx context.Context, vpcId string, deploymentId string, tagged bool) ([]Resource, error) {
+	vpcFilter := []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcId}}}
+	resources := []Resource{}
+	add := func(kind Kind, id string, tags []ec2types.Tag, createdAt *time.Time) {
+		resourceTags := ec2Tags(tags)
+		r := s.resource(kind, id, resourceTags["Name"], deploymentId, resourceTags)
+		r.Parent = vpcId
+		r.Tagged = tagged
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = aws.ToTime(createdAt)
+		}
+		resources = append(resources, r)
+	}
+
+	natGateways, err := s.ec2.DescribeNatGateways(ctx, &ec2.DescribeNatGatewaysInput{Filter: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("error describing NAT gateways of %s: %w", vpcId, err)
+	}
+	for _, natGateway := range natGateways.NatGateways {
+		if natGateway.State != ec2types.NatGatewayStateDeleted {
+			add(KindNatGateway, aws.ToString(natGateway.NatGatewayId), natGateway.Tags, natGateway.CreateTime)
+		}
+	}
+
+	internetGateways, err := s.ec2.DescribeInternetGateways(ctx, &ec2.DescribeInternetGatewaysInput{
+		Filters: []ec2types.Filter{{Name: aws.String("attachment.vpc-id"), Values: []string{vpcId}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing internet gateways of %s: %w", vpcId, err)
+	}
+	for _, internetGateway := range internetGateways.InternetGateways {
+		add(KindInternetGateway, aws.ToString(internetGateway.InternetGatewayId), internetGateway.Tags, nil)
+	}
+
+	subnets, err := s.ec2.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("error describing subnets of %s: %w", vpcId, err)
+	}
+	for _, subnet := range subnets.Subnets {
+		add(KindSubnet, aws.ToString(subnet.SubnetId), subnet.Tags, nil)
+	}
+
+	routeTables, err := s.ec2.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("error describing route tables of %s: %w", vpcId, err)
+	}
+	for _, routeTable := range routeTables.RouteTables {
+		main := false
+		for _, association := range routeTable.Associations {
+			main = main || aws.ToBool(association.Main)
+		}
+		// The main route table is deleted with the VPC
+		if !main {
+			add(KindRouteTable, aws.ToString(routeTable.RouteTableId), routeTable.Tags, nil)
+		}
+	}
+
+	networkAcls, err := s.ec2.DescribeNetworkAcls(ctx, &ec2.DescribeNetworkAclsInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("error describing network ACLs of %s: %w", vpcId, err)
+	}
+	for _, networkAcl := range networkAcls.NetworkAcls {
+		// The default network ACL is deleted with the VPC
+		if !aws.ToBool(networkAcl.IsDefault) {
+			add(KindNetworkAcl, aws.ToString(networkAcl.NetworkAclId), networkAcl.Tags, nil)
+		}
+	}
+
+	securityGroups, err := s.ec2.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("error describing security groups of %s: %w", vpcId, err)
+	}
+	for _, securityGroup := range securityGroups.SecurityGroups {
+		// The default security group is deleted with the VPC
+		if aws.ToString(securityGroup.GroupName) != "default" {
+			add(KindSecurityGroup, aws.ToString(securityGroup.GroupId), securityGroup.Tags, nil)
+		}
+	}
+
+	return resources, nil
+}
+
+func ec2Tags(tags []ec2types.Tag) map[string]string {
+	m := map[string]string{}
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+// Delete deletes the resource and waits for it to be deleted when the resources
+// after it in a plan depend on it being gone. Resources that are being released
+// asynchronously by AWS (i.e. the network interfaces of a load balancer) are
+// retried until the timeout.
+func (s *Sweeper) Delete(r Resource, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	w := waiter.New(fmt.Sprintf("the deletion of %s", r), s.Logf)
+	w.Backoff.Initial = 5 * time.Second
+	return w.Wait(ctx, func(ctx context.Context) error {
+		err := s.delete(ctx, r)
+		if err == nil || isNotFound(err) {
+			return nil
+		}
+		if !isDependencyViolation(err) {
+			return waiter.Stop(err)
+		}
+		return err
+	})
+}
+
+func (s *Sweeper) delete(ctx context.Context, r Resource) error {
+	switch r.Kind {
+	case KindEcsService:
+		_, err := s.ecs.DeleteService(ctx, &ecs.DeleteServiceInput{
+			Cluster: aws.String(r.Parent),
+			Service: aws.String(r.Id),
+			Force:   aws.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+		return ecs.NewServicesInactiveWaiter(s.ecs).Wait(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(r.Parent),
+			Services: []string{r.Id},
+		}, deletedWaitTimeout)
+
+	case KindAutoScalingGroup:
+		_, err := s.autoscaling.DeleteAutoScalingGroup(ctx, &autoscaling.DeleteAutoScalingGroupInput{
+			AutoScalingGroupName: aws.String(r.Id),
+			ForceDelete:          aws.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+		return autoscaling.NewGroupNotExistsWaiter(s.autoscaling).Wait(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []string{r.Id},
+		}, deletedWaitTimeout)
+
+	case KindEcsCluster:
+		return s.deleteEcsCluster(ctx, r)
+
+	case KindEcsCapacityProvider:
+		_, err := s.ecs.DeleteCapacityProvider(ctx, &ecs.DeleteCapacityProviderInput{CapacityProvider: aws.String(r.Id)})
+		return err
+
+	case KindLaunchTemplate:
+		_, err := s.ec2.DeleteLaunchTemplate(ctx, &ec2.DeleteLaunchTemplateInput{LaunchTemplateId: aws.String(r.Id)})
+		return err
+
+	case KindLoadBalancer:
+		_, err := s.elbv2.DeleteLoadBalancer(ctx, &elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(r.Id)})
+		if err != nil {
+			return err
+		}
+		return elbv2.NewLoadBalancersDeletedWaiter(s.elbv2).Wait(ctx, &elbv2.DescribeLoadBalancersInput{
+			LoadBalancerArns: []string{r.Id},
+		}, deletedWaitTimeout)
+
+	case KindTargetGroup:
+		_, err := s.elbv2.DeleteTargetGroup(ctx, &elbv2.DeleteTargetGroupInput{TargetGroupArn: aws.String(r.Id)})
+		return err
+
+	case KindNatGateway:
+		_, err := s.ec2.DeleteNatGateway(ctx, &ec2.DeleteNatGatewayInput{NatGatewayId: aws.String(r.Id)})
+		if err != nil {
+			return err
+		}
+		// The elastic IP of the NAT gateway can only be released once it is deleted
+		return ec2.NewNatGatewayDeletedWaiter(s.ec2).Wait(ctx, &ec2.DescribeNatGatewaysInput{
+			NatGatewayIds: []string{r.Id},
+		}, deletedWaitTimeout)
+
+	case KindElasticIp:
+		_, err := s.ec2.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{AllocationId: aws.String(r.Id)})
+		return err
+
+	case KindInternetGateway:
+		_, err := s.ec2.DetachInternetGateway(ctx, &ec2.DetachInternetGatewayInput{
+			InternetGatewayId: aws.String(r.Id),
+			VpcId:             aws.String(r.Parent),
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		_, err = s.ec2.DeleteInternetGateway(ctx, &ec2.DeleteInternetGatewayInput{InternetGatewayId: aws.String(r.Id)})
+		return err
+
+	case KindSubnet:
+		_, err := s.ec2.DeleteSubnet(ctx, &ec2.DeleteSubnetInput{SubnetId: aws.String(r.Id)})
+		return err
+
+	case KindRouteTable:
+		_, err := s.ec2.DeleteRouteTable(ctx, &ec2.DeleteRouteTableInput{RouteTableId: aws.String(r.Id)})
+		return err
+
+	case KindNetworkAcl:
+		_, err := s.ec2.DeleteNetworkAcl(ctx, &ec2.DeleteNetworkAclInput{NetworkAclId: aws.String(r.Id)})
+		return err
+
+	case KindSecurityGroup:
+		return s.deleteSecurityGroup(ctx, r)
+
+	case KindVpc:
+		_, err := s.ec2.DeleteVpc(ctx, &ec2.DeleteVpcInput{VpcId: aws.String(r.Id)})
+		return err
+	}
+
+	return fmt.Errorf("unknown kind %s", r.Kind)
+}
+
+// deleteEcsCluster deregisters the container instances left by the auto scaling
+// group and detaches the capacity providers before deleting the cluster
+func (s *Sweeper) deleteEcsCluster(ctx context.Context, r Resource) error {
+	paginator := ecs.NewListContainerInstancesPaginator(s.ecs, &ecs.ListContainerInstancesInput{Cluster: aws.String(r.Id)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, containerInstanceArn := range page.ContainerInstanceArns {
+			// Instances that fail to deregister block the deletion of the cluster, which is retried
+			s.ecs.DeregisterContainerInstance(ctx, &ecs.DeregisterContainerInstanceInput{
+				Cluster:           aws.String(r.Id),
+				ContainerInstance: aws.String(containerInstanceArn),
+				Force:             aws.Bool(true),
+			})
+		}
+	}
+
+	_, err := s.ecs.PutClusterCapacityProviders(ctx, &ecs.PutClusterCapacityProvidersInput{
+		Cluster:                         aws.String(r.Id),
+		CapacityProviders:               []string{},
+		DefaultCapacityProviderStrategy: []ecstypes.CapacityProviderStrategyItem{},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.ecs.DeleteCluster(ctx, &ecs.DeleteClusterInput{Cluster: aws.String(r.Id)})
+	return err
+}
+
+// deleteSecurityGroup revokes the rules of the security group before deleting it,
+// security groups of the same VPC can reference each other which blocks their deletion
+func (s *Sweeper) deleteSecurityGroup(ctx context.Context, r Resource) error {
+	described, err := s.ec2.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: []string{r.Id}})
+	if err != nil {
+		return err
+	}
+
+	for _, securityGroup := range described.SecurityGroups {
+		if len(securityGroup.IpPermissions) > 0 {
+			_, err := s.ec2.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       securityGroup.GroupId,
+				IpPermissions: securityGroup.IpPermissions,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(securityGroup.IpPermissionsEgress) > 0 {
+			_, err := s.ec2.RevokeSecurityGroupEgress(ctx, &ec2.RevokeSecurityGroupEgressInput{
+				GroupId:       securityGroup.GroupId,
+				IpPermissions: securityGroup.IpPermissionsEgress,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = s.ec2.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(r.Id)})
+	return err
+}
+
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return strings.HasSuffix(code, "NotFound") || code == "ClusterNotFoundException" || code == "ServiceNotFoundException"
+	}
+	return false
+}
+
+func isDependencyViolation(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "DependencyViolation", "ResourceInUse", "ClusterContainsServicesException",
+			"ClusterContainsTasksException", "ClusterContainsContainerInstancesException",
+			"ResourceInUseException":
+			return true
+		}
+	}
+	return false
+}
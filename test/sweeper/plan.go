@@ -0,0 +1,210 @@
+// Package sweeper finds and deletes the resources that the example tests leak
+// when a test run is interrupted before its destroy stage.
+package sweeper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+)
+
+// Kind is the type of a swept resource
+type Kind string
+
+// The kinds are listed in the order they are deleted, a resource is only deleted
+// after the resources of the kinds before it that depend on it.
+const (
+	KindEcsService          Kind = "ecs-service"
+	KindAutoScalingGroup    Kind = "autoscaling-group"
+	KindEcsCluster          Kind = "ecs-cluster"
+	KindEcsCapacityProvider Kind = "ecs-capacity-provider"
+	KindLaunchTemplate      Kind = "launch-template"
+	KindLoadBalancer        Kind = "load-balancer"
+	KindTargetGroup         Kind = "target-group"
+	KindNatGateway          Kind = "nat-gateway"
+	KindElasticIp           Kind = "elastic-ip"
+	KindInternetGateway     Kind = "internet-gateway"
+	KindSubnet              Kind = "subnet"
+	KindRouteTable          Kind = "route-table"
+	KindNetworkAcl          Kind = "network-acl"
+	KindSecurityGroup       Kind = "security-group"
+	KindVpc                 Kind = "vpc"
+)
+
+// deletionOrder is the order the kinds of resources are deleted in
+var deletionOrder = []Kind{
+	KindEcsService,
+	KindAutoScalingGroup,
+	KindEcsCluster,
+	KindEcsCapacityProvider,
+	KindLaunchTemplate,
+	KindLoadBalancer,
+	KindTargetGroup,
+	KindNatGateway,
+	KindElasticIp,
+	KindInternetGateway,
+	KindSubnet,
+	KindRouteTable,
+	KindNetworkAcl,
+	KindSecurityGroup,
+	KindVpc,
+}
+
+func (k Kind) rank() int {
+	for i, kind := range deletionOrder {
+		if kind == k {
+			return i
+		}
+	}
+	return len(deletionOrder)
+}
+
+// Resource is a resource deployed by the test suite
+type Resource struct {
+	Kind   Kind
+	Region string
+
+	// Id is the identifier used to delete the resource, i.e. the VPC id or load balancer ARN
+	Id   string
+	Name string
+
+	// Parent is the identifier of the resource that the resource is swept with, i.e. the
+	// ECS cluster of a service or the VPC of a subnet
+	Parent string
+
+	// DeploymentId is the random id of the test that deployed the resource, empty when
+	// the resource was only matched by the suite tag
+	DeploymentId string
+
+	// Tagged is true when the resource, or the parent it is swept with, has the suite
+	// tag. Resources that are only matched by their name are reported but never deleted,
+	// as another project could use the same "-test<random_id>" suffix.
+	Tagged bool
+
+	// CreatedAt is when the resource was created, read from its creation time tag or
+	// from AWS. It is zero when neither is available.
+	CreatedAt time.Time
+
+	// Ttl is how long the test expected the resource to live, zero when it is not tagged
+	Ttl time.Duration
+}
+
+func (r Resource) String() string {
+	if r.Name != "" && r.Name != r.Id {
+		return fmt.Sprintf("%s %s (%s) in %s", r.Kind, r.Name, r.Id, r.Region)
+	}
+	return fmt.Sprintf("%s %s in %s", r.Kind, r.Id, r.Region)
+}
+
+// deploymentIdPattern matches the random.UniqueId that the examples append to
+// their names with a "-test" prefix, i.e. vpc-testAb12Cd or cluster-testAb12Cd-asg
+var deploymentIdPattern = regexp.MustCompile(`-test([A-Za-z0-9]{6})(?:[^A-Za-z0-9]|$)`)
+
+// DeploymentId returns the random id of the test that deployed a resource with the name
+func DeploymentId(name string) (string, bool) {
+	match := deploymentIdPattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// Skipped is a resource that is left out of the plan
+type Skipped struct {
+	Resource Resource
+	Reason   string
+}
+
+// Plan is the order the resources are deleted in
+type Plan struct {
+	Resources []Resource
+	Skipped   []Skipped
+}
+
+// NewPlan orders the resources so each resource is deleted after the resources that
+// depend on it. Only the tagged resources of deployments older than minAge and their
+// TTL tag are planned.
+//
+// AWS does not report the creation time of every resource (i.e. VPCs and subnets),
+// so the age of a resource is the age of the oldest resource of its deployment and
+// children are swept with their parent. Resources without a known age are skipped.
+func NewPlan(resources []Resource, now time.Time, minAge time.Duration) *Plan {
+	createdAt := map[string]time.Time{}
+	for _, r := range resources {
+		if r.CreatedAt.IsZero() {
+			continue
+		}
+		for _, key := range ageKeys(r) {
+			if t, ok := createdAt[key]; !ok || r.CreatedAt.Before(t) {
+				createdAt[key] = r.CreatedAt
+			}
+		}
+	}
+
+	plan := &Plan{}
+	for _, r := range resources {
+		var oldest time.Time
+		for _, key := range ageKeys(r) {
+			if t, ok := createdAt[key]; ok && (oldest.IsZero() || t.Before(oldest)) {
+				oldest = t
+			}
+		}
+
+		switch {
+		case !r.Tagged:
+			plan.Skipped = append(plan.Skipped, Skipped{r, fmt.Sprintf("only matched by name, not tagged %s=%s", util.SuiteTagKey, util.SuiteTagValue)})
+		case oldest.IsZero():
+			plan.Skipped = append(plan.Skipped, Skipped{r, "unknown age"})
+		case now.Sub(oldest) < r.Ttl:
+			plan.Skipped = append(plan.Skipped, Skipped{r, fmt.Sprintf("created %s ago with a TTL of %s", now.Sub(oldest).Round(time.Second), r.Ttl)})
+		case now.Sub(oldest) < minAge:
+			plan.Skipped = append(plan.Skipped, Skipped{r, fmt.Sprintf("created %s ago", now.Sub(oldest).Round(time.Second))})
+		default:
+			plan.Resources = append(plan.Resources, r)
+		}
+	}
+
+	sort.SliceStable(plan.Resources, func(i, j int) bool {
+		a, b := plan.Resources[i], plan.Resources[j]
+		if a.Kind.rank() != b.Kind.rank() {
+			return a.Kind.rank() < b.Kind.rank()
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Id < b.Id
+	})
+
+	return plan
+}
+
+// ageKeys are the keys of the groups of resources that share their age
+func ageKeys(r Resource) []string {
+	keys := []string{"resource/" + r.Region + "/" + r.Id}
+	if r.Parent != "" {
+		keys = append(keys, "resource/"+r.Region+"/"+r.Parent)
+	}
+	if r.DeploymentId != "" {
+		keys = append(keys, "deployment/"+r.Region+"/"+r.DeploymentId)
+	}
+	return keys
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Deleting %d resources:\n", len(p.Resources))
+	for _, r := range p.Resources {
+		fmt.Fprintf(&b, "  %s\n", r)
+	}
+	if len(p.Skipped) > 0 {
+		fmt.Fprintf(&b, "Skipping %d resources:\n", len(p.Skipped))
+		for _, s := range p.Skipped {
+			fmt.Fprintf(&b, "  %s: %s\n", s.Resource, s.Reason)
+		}
+	}
+	return b.String()
+}
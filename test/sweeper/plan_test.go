@@ -0,0 +1,103 @@
+package sweeper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentId(t *testing.T) {
+	for name, expected := range map[string]string{
+		"vpc-testAb12Cd":              "Ab12Cd",
+		"cluster-testAb12Cd-asg":      "Ab12Cd",
+		"service-testAb12Cd-eip-us-1": "Ab12Cd",
+		"artifact-testab12cd":         "ab12cd",
+		"vpc-testAb12Cde":             "",
+		"vpc-testAb12":                "",
+		"vpc-prod":                    "",
+		"testAb12Cd":                  "",
+	} {
+		deploymentId, ok := DeploymentId(name)
+		assert.Equal(t, expected != "", ok, name)
+		assert.Equal(t, expected, deploymentId, name)
+	}
+}
+
+func TestNewPlanOrdersByDependencies(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-24 * time.Hour)
+
+	resources := []Resource{
+		{Kind: KindVpc, Region: "us-east-1", Id: "vpc-1", Tagged: true, DeploymentId: "Ab12Cd"},
+		{Kind: KindSubnet, Region: "us-east-1", Id: "subnet-1", Tagged: true, Parent: "vpc-1", DeploymentId: "Ab12Cd"},
+		{Kind: KindNatGateway, Region: "us-east-1", Id: "nat-1", Tagged: true, Parent: "vpc-1", DeploymentId: "Ab12Cd", CreatedAt: old},
+		{Kind: KindElasticIp, Region: "us-east-1", Id: "eipalloc-1", Tagged: true, DeploymentId: "Ab12Cd"},
+		{Kind: KindEcsCluster, Region: "us-east-1", Id: "cluster-1", Tagged: true, DeploymentId: "Ab12Cd"},
+		{Kind: KindEcsService, Region: "us-east-1", Id: "service-1", Tagged: true, Parent: "cluster-1", DeploymentId: "Ab12Cd"},
+		{Kind: KindLoadBalancer, Region: "us-east-1", Id: "alb-1", Tagged: true, DeploymentId: "Ab12Cd", CreatedAt: old},
+	}
+
+	plan := NewPlan(resources, now, time.Hour)
+	assert.Empty(t, plan.Skipped)
+
+	kinds := []Kind{}
+	for _, r := range plan.Resources {
+		kinds = append(kinds, r.Kind)
+	}
+	assert.Equal(t, []Kind{
+		KindEcsService,
+		KindEcsCluster,
+		KindLoadBalancer,
+		KindNatGateway,
+		KindElasticIp,
+		KindSubnet,
+		KindVpc,
+	}, kinds)
+}
+
+func TestNewPlanSkipsYoungAndUnknownAge(t *testing.T) {
+	now := time.Now()
+
+	resources := []Resource{
+		// The VPC of a running test is as young as its NAT gateway
+		{Kind: KindVpc, Region: "us-east-1", Id: "vpc-young", Tagged: true, DeploymentId: "Young1"},
+		{Kind: KindNatGateway, Region: "us-east-1", Id: "nat-young", Tagged: true, Parent: "vpc-young", DeploymentId: "Young1", CreatedAt: now.Add(-10 * time.Minute)},
+
+		// AWS does not report when a VPC was created
+		{Kind: KindVpc, Region: "us-east-1", Id: "vpc-unknown", Tagged: true, DeploymentId: "Unkno1"},
+
+		// The same deployment id in another region is another deployment
+		{Kind: KindVpc, Region: "us-east-2", Id: "vpc-other", Tagged: true, DeploymentId: "Young1"},
+
+		// Resources only matched by tag use their own age
+		{Kind: KindLoadBalancer, Region: "us-east-1", Id: "alb-tagged", Tagged: true, CreatedAt: now.Add(-48 * time.Hour)},
+
+		// Resources are kept until their TTL expires
+		{Kind: KindLoadBalancer, Region: "us-east-1", Id: "alb-ttl", Tagged: true, CreatedAt: now.Add(-2 * time.Hour), Ttl: 3 * time.Hour},
+
+		// Resources only matched by their name are never deleted
+		{Kind: KindLoadBalancer, Region: "us-east-1", Id: "alb-name-only", DeploymentId: "Other1", CreatedAt: now.Add(-48 * time.Hour)},
+	}
+
+	plan := NewPlan(resources, now, time.Hour)
+
+	planned := []string{}
+	for _, r := range plan.Resources {
+		planned = append(planned, r.Id)
+	}
+	assert.Equal(t, []string{"alb-tagged"}, planned)
+
+	skipped := map[string]string{}
+	for _, s := range plan.Skipped {
+		skipped[s.Resource.Id] = s.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"vpc-young":     "created 10m0s ago",
+		"nat-young":     "created 10m0s ago",
+		"vpc-unknown":   "unknown age",
+		"vpc-other":     "unknown age",
+		"alb-ttl":       "created 2h0m0s ago with a TTL of 3h0m0s",
+		"alb-name-only": "only matched by name, not tagged TerratestSuite=terraform-cyber4all-catalog",
+	}, skipped)
+}
@@ -0,0 +1,283 @@
+// Package teardown destroys the deployments of the tests when the test run is stopped
+// before their deferred destroy stages can run. go test exits without running deferred
+// functions when it hits its -timeout, and CI cancels a job with SIGINT or SIGTERM, so
+// the deployments are destroyed when a signal is received or shortly before the
+// deadline of the tests.
+package teardown
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// MarginEnvVar overrides how long before the deadline of the tests the deployments are destroyed
+	MarginEnvVar = "TERRATEST_TEARDOWN_MARGIN"
+
+	// DefaultMargin leaves enough time to destroy an ECS service and its cluster
+	DefaultMargin = 15 * time.Minute
+)
+
+// MarginFromEnv returns the margin set by MarginEnvVar, or DefaultMargin
+func MarginFromEnv() (time.Duration, error) {
+	value := os.Getenv(MarginEnvVar)
+	if value == "" {
+		return DefaultMargin, nil
+	}
+	margin, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected %s to be a duration, got %s", MarginEnvVar, value)
+	}
+	return margin, nil
+}
+
+// Deployment is a working dir that has deployed or is deploying resources
+type Deployment struct {
+	Name       string
+	WorkingDir string
+
+	// Layer orders the teardown, the deployments of a higher layer are destroyed before
+	// the deployments of a lower layer that they depend on (i.e. a shared VPC)
+	Layer int
+
+	destroy  func() error
+	once     sync.Once
+	err      error
+	teardown *Teardown
+}
+
+// Destroy destroys the deployment once. Concurrent calls wait for the first call to
+// finish and return its error, so the deferred destroy stage of a test and the
+// teardown never destroy the same working dir at the same time.
+func (d *Deployment) Destroy() error {
+	d.once.Do(func() {
+		d.err = d.destroy()
+		if d.err == nil {
+			d.teardown.remove(d)
+		}
+	})
+	return d.err
+}
+
+// Failure is a deployment that could not be destroyed
+type Failure struct {
+	Deployment *Deployment
+	Err        error
+}
+
+// Teardown tracks the live deployments of the tests
+type Teardown struct {
+	logf func(format string, args ...interface{})
+
+	mu          sync.Mutex
+	deployments map[*Deployment]struct{}
+	stopping    bool
+}
+
+// New creates a teardown that logs with logf
+func New(logf func(format string, args ...interface{})) *Teardown {
+	return &Teardown{logf: logf, deployments: map[*Deployment]struct{}{}}
+}
+
+// Register tracks the deployment of the working dir in the layer until it is destroyed
+func (td *Teardown) Register(name string, workingDir string, layer int, destroy func() error) *Deployment {
+	d := &Deployment{Name: name, WorkingDir: workingDir, Layer: layer, destroy: destroy, teardown: td}
+
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.deployments[d] = struct{}{}
+	return d
+}
+
+func (td *Teardown) remove(d *Deployment) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	delete(td.deployments, d)
+}
+
+// Live returns the deployments that have not been destroyed, by name
+func (td *Teardown) Live() []*Deployment {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+
+	live := []*Deployment{}
+	for d := range td.deployments {
+		live = append(live, d)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].Name < live[j].Name
+	})
+	return live
+}
+
+// Stopping returns true once the teardown started, the tests should not start new stages
+func (td *Teardown) Stopping() bool {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	return td.stopping
+}
+
+// DestroyAll stops the tests and destroys the live deployments, layer by layer from the
+// highest, and the deployments of a layer in parallel. It returns the deployments that
+// could not be destroyed.
+func (td *Teardown) DestroyAll(reason string) []Failure {
+	td.mu.Lock()
+	td.stopping = true
+	td.mu.Unlock()
+
+	live := td.Live()
+	td.logf("%s, destroying %d live deployments", reason, len(live))
+
+	layers := map[int][]*Deployment{}
+	order := []int{}
+	for _, d := range live {
+		if _, ok := layers[d.Layer]; !ok {
+			order = append(order, d.Layer)
+		}
+		layers[d.Layer] = append(layers[d.Layer], d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+
+	failures := []Failure{}
+	for _, layer := range order {
+		failures = append(failures, td.destroyLayer(layers[layer])...)
+	}
+
+	if len(failures) == 0 {
+		td.logf("Destroyed all live deployments")
+	}
+	for _, f := range failures {
+		td.logf("Unable to destroy %s in %s, destroy it with -cleanup-only: %s", f.Deployment.Name, f.Deployment.WorkingDir, f.Err)
+	}
+	return failures
+}
+
+// destroyLayer destroys the deployments in parallel and returns the failures. The
+// lower layers are still destroyed after a failure, they may not depend on it.
+func (td *Teardown) destroyLayer(deployments []*Deployment) []Failure {
+	var wg sync.WaitGroup
+	errs := make([]error, len(deployments))
+	for i, d := range deployments {
+		wg.Add(1)
+		go func(i int, d *Deployment) {
+			defer wg.Done()
+			td.logf("Destroying %s in %s", d.Name, d.WorkingDir)
+			errs[i] = d.Destroy()
+		}(i, d)
+	}
+	wg.Wait()
+
+	failures := []Failure{}
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, Failure{Deployment: deployments[i], Err: err})
+		}
+	}
+	return failures
+}
+
+// Watch destroys the live deployments when the process receives SIGINT or SIGTERM, or
+// the margin before the deadline, and then calls exit. The returned function stops
+// watching.
+func (td *Teardown) Watch(deadline time.Time, hasDeadline bool, margin time.Duration, exit func()) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var timer <-chan time.Time
+	if hasDeadline {
+		timer = time.After(td.teardownIn(deadline, margin))
+	}
+
+	stop := td.watch(signals, timer, exit)
+	return func() {
+		signal.Stop(signals)
+		stop()
+	}
+}
+
+// teardownKey is a deadline and margin that the time of the teardown was computed for
+type teardownKey struct {
+	deadline int64
+	margin   time.Duration
+}
+
+var (
+	teardownAtMu sync.Mutex
+	teardownAt   = map[teardownKey]time.Time{}
+)
+
+// TeardownAt returns when the teardown starts. Runs with a deadline that is closer than
+// twice the margin keep half of their remaining time for the teardown. The time is only
+// computed the first time for a deadline and margin, so the waits of the tests end when
+// the teardown that Watch started for the deadline of the run fires.
+func TeardownAt(deadline time.Time, margin time.Duration) time.Time {
+	teardownAtMu.Lock()
+	defer teardownAtMu.Unlock()
+
+	key := teardownKey{deadline: deadline.UnixNano(), margin: margin}
+	if at, ok := teardownAt[key]; ok {
+		return at
+	}
+
+	now := time.Now()
+	remaining := deadline.Sub(now)
+	at := deadline.Add(-margin)
+	if remaining < 2*margin {
+		at = now.Add(remaining / 2)
+	}
+	teardownAt[key] = at
+	return at
+}
+
+// teardownIn returns how long until the teardown starts and logs when the deadline is
+// too close for the margin
+func (td *Teardown) teardownIn(deadline time.Time, margin time.Duration) time.Duration {
+	in := time.Until(TeardownAt(deadline, margin))
+	if remaining := time.Until(deadline); remaining < 2*margin {
+		td.logf("The deadline %s leaves less than twice the teardown margin of %s, tearing down after %s", deadline.Format(time.RFC3339), margin, in.Round(time.Second))
+	}
+	return in
+}
+
+func (td *Teardown) watch(signals <-chan os.Signal, timer <-chan time.Time, exit func()) func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		var reason string
+		select {
+		case sig := <-signals:
+			reason = fmt.Sprintf("Received %s", sig)
+		case <-timer:
+			reason = "The tests are about to reach their deadline"
+		case <-done:
+			return
+		}
+
+		// The watch can be stopped before the goroutine selects a trigger
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// The tests are stopped by exit, later signals only report the progress
+		go func() {
+			for sig := range signals {
+				td.logf("Received %s, still destroying %d live deployments", sig, len(td.Live()))
+			}
+		}()
+
+		td.DestroyAll(reason)
+		exit()
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,203 @@
+package teardown
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTeardown(t *testing.T) *Teardown {
+	return New(t.Logf)
+}
+
+func TestDeploymentIsDestroyedOnce(t *testing.T) {
+	td := newTestTeardown(t)
+
+	var calls int32
+	release := make(chan struct{})
+	d := td.Register("vpc", "../examples/deploy-vpc", 0, func() error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil
+	})
+	assert.Len(t, td.Live(), 1)
+
+	// The teardown and the deferred destroy stage destroy the deployment at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, d.Destroy())
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Empty(t, td.Live())
+}
+
+func TestDestroyAllReportsFailures(t *testing.T) {
+	td := newTestTeardown(t)
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	destroy := func(err error) func() error {
+		return func() error {
+			started <- struct{}{}
+			<-release
+			return err
+		}
+	}
+	td.Register("vpc", "../examples/deploy-vpc", 0, destroy(nil))
+	td.Register("alb", "../examples/deploy-alb", 0, destroy(errors.New("DependencyViolation")))
+	td.Register("ecs-cluster", "../examples/deploy-ecs-cluster", 0, destroy(nil))
+
+	var failures []Failure
+	done := make(chan struct{})
+	go func() {
+		failures = td.DestroyAll("Received interrupt")
+		close(done)
+	}()
+
+	// The deployments are destroyed in parallel
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	assert.True(t, td.Stopping())
+	close(release)
+	<-done
+
+	require.Len(t, failures, 1)
+	assert.Equal(t, "alb", failures[0].Deployment.Name)
+	assert.EqualError(t, failures[0].Err, "DependencyViolation")
+
+	// A deployment that could not be destroyed is still live
+	live := td.Live()
+	require.Len(t, live, 1)
+	assert.Equal(t, "alb", live[0].Name)
+}
+
+func TestDestroyAllDestroysHigherLayersFirst(t *testing.T) {
+	td := newTestTeardown(t)
+
+	var mu sync.Mutex
+	order := []string{}
+	destroy := func(name string) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	td.Register("fixture/vpc", "fixtures/vpc", 0, destroy("fixture/vpc"))
+	td.Register("ecs service", "../examples/deploy-ecs-service", 2, destroy("ecs service"))
+	td.Register("fixture/ecs-cluster", "fixtures/ecs-cluster", 1, destroy("fixture/ecs-cluster"))
+
+	assert.Empty(t, td.DestroyAll("Received interrupt"))
+	assert.Equal(t, []string{"ecs service", "fixture/ecs-cluster", "fixture/vpc"}, order)
+}
+
+func TestWatchTearsDownOnSignal(t *testing.T) {
+	td := newTestTeardown(t)
+
+	destroyed := make(chan string, 1)
+	td.Register("vpc", "../examples/deploy-vpc", 0, func() error {
+		destroyed <- "vpc"
+		return nil
+	})
+
+	signals := make(chan os.Signal, 1)
+	exited := make(chan struct{})
+	stop := td.watch(signals, nil, func() { close(exited) })
+	defer stop()
+
+	signals <- syscall.SIGTERM
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the teardown to exit after the signal")
+	}
+	assert.Equal(t, "vpc", <-destroyed)
+	assert.True(t, td.Stopping())
+}
+
+func TestWatchTearsDownBeforeDeadline(t *testing.T) {
+	td := newTestTeardown(t)
+
+	timer := make(chan time.Time, 1)
+	exited := make(chan struct{})
+	stop := td.watch(nil, timer, func() { close(exited) })
+	defer stop()
+
+	timer <- time.Now()
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the teardown to exit at the deadline")
+	}
+}
+
+func TestStoppedWatchDoesNotTearDown(t *testing.T) {
+	td := newTestTeardown(t)
+
+	timer := make(chan time.Time, 1)
+	stop := td.watch(nil, timer, func() { t.Error("Expected no teardown after the watch stopped") })
+	stop()
+	stop()
+
+	timer <- time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, td.Stopping())
+}
+
+func TestTeardownIn(t *testing.T) {
+	td := newTestTeardown(t)
+
+	in := td.teardownIn(time.Now().Add(2*time.Hour), 15*time.Minute)
+	assert.InDelta(t, (105 * time.Minute).Seconds(), in.Seconds(), 5)
+
+	// A short deadline keeps half of the remaining time for the teardown
+	in = td.teardownIn(time.Now().Add(20*time.Minute), 15*time.Minute)
+	assert.InDelta(t, (10 * time.Minute).Seconds(), in.Seconds(), 5)
+}
+
+func TestTeardownAtIsComputedOnce(t *testing.T) {
+	deadline := time.Now().Add(20 * time.Minute)
+	at := TeardownAt(deadline, 15*time.Minute)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), at, time.Second)
+
+	// A later call, with less time remaining, returns the same teardown time
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, at, TeardownAt(deadline, 15*time.Minute))
+
+	// The waits started after the teardown time was computed end at it
+	assert.True(t, at.Before(time.Now().Add(time.Until(deadline)/2)))
+}
+
+func TestMarginFromEnv(t *testing.T) {
+	t.Setenv(MarginEnvVar, "")
+	margin, err := MarginFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMargin, margin)
+
+	t.Setenv(MarginEnvVar, "5m")
+	margin, err = MarginFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, margin)
+
+	t.Setenv(MarginEnvVar, "soon")
+	_, err = MarginFromEnv()
+	assert.Error(t, err)
+}
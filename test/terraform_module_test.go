@@ -1,114 +1,554 @@
 package test
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/awsclients"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/fixtures"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/idempotency"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/impact"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/journal"
 	"github.com/Cyber4All/terraform-cyber4all-catalog/test/modules"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/report"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/scheduler"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/survivors"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/teardown"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/upgrade"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/util"
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/waiter"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
 )
 
+var (
+	// testReport records the outcome of each test stage, it is written to TERRATEST_REPORT_DIR
+	testReport *report.Report
+
+	// finishReport stops capturing the output and writes the report, the teardown
+	// calls it before it exits
+	finishReport func()
+)
+
+func TestMain(m *testing.M) {
+	testReport = report.New(os.Getenv(report.DirEnvVar))
+	restore, err := testReport.CaptureOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to capture the test output for the report: %s\n", err)
+		os.Exit(1)
+	}
+
+	finishReport = sync.OnceFunc(func() {
+		restore()
+		if err := testReport.Write(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the test report: %s\n", err)
+		}
+	})
+
+	code := m.Run()
+	finishReport()
+	os.Exit(code)
+}
+
 type TestCase struct {
-	name            string
-	workingDir      string
-	genTestDataFunc func(t *testing.T, workingDir string)
-	validateFunc    func(t *testing.T, workingDir string)
+	name             string
+	workingDir       string
+	genTestDataFunc  func(t *testing.T, workingDir string)
+	validateFunc     func(t *testing.T, workingDir string, clients *awsclients.Clients)
+	validatePlanFunc func(t *testing.T, workingDir string)
+
+	// resources are the quota limited resources that the example deploys, other than its fixtures
+	resources scheduler.Resources
+	// fixtures are the shared stacks that the example is deployed to, their outputs are passed as variables
+	fixtures []*fixtures.Fixture
+	// allowedDiffs are the changes that a plan of the deployed example is expected to keep having
+	allowedDiffs []idempotency.AllowedDiff
+	// regions the example can be deployed to, any of modules.AwsRegions when empty
+	regions []string
+	// runtime is the estimated runtime of the test
+	runtime time.Duration
 }
 
+// awsRegionQuota is the number of quota limited resources that the tests can deploy to a region. The default VPC
+// counts towards the quota of 5 VPCs per region.
+var awsRegionQuota = scheduler.Resources{Vpcs: 4, Eips: 5, NatGateways: 5, Albs: 50}
+
 // This test suite deploys the resource in the examples folder using Terraform, and then validates the deployed
 // The test is broken into "stages" so you can skip stages by setting environment variables (e.g.,
 // skip stage "apply" by setting the environment variable "SKIP_apply=true"), which speeds up iteration when
 // running this test over and over again locally.
+//
+// The "plan" stage runs terraform plan against a fake of the AWS APIs using mocked credentials and validates the
+// plan of the examples that register a validatePlanFunc. Running with "SKIP_apply=true SKIP_validate=true
+// SKIP_destroy=true" only runs the plan stage, which does not require an AWS account.
 func TestExamplesForTerraformModules(t *testing.T) {
 	/**
-	 * The TestCases are broken up into groups. Each group's tests will run in parallel, but the groups will run
-	 * sequentially. This is to prevent the tests exhausting the AWS quotas, notably the VPC quota (5 per region).
+	 * The TestCases are scheduled to run in parallel within the AWS quotas of each region, notably the VPC quota
+	 * (5 per region). Each TestCase declares the quota limited resources it deploys and its estimated runtime, and
+	 * the scheduler spreads the tests across modules.AwsRegions, starting the longest running tests first.
 	 *
-	 * To optimize the runtime of the tests, the tests should be sorted as follows:
-	 * 1. Tests that do not require a VPC (or any other resource that has a limited quota)
-	 * 2. Tests that require a VPC
-	 *   a. Longest running tests
-	 *   b. Shortest running tests
+	 * The estimated runtimes only order the tests, the quotas are enforced while the tests run so a test that runs
+	 * longer than estimated delays the tests that need its resources instead of exhausting the quota.
 	 *
-	 * A comment should be added that denotes the estimated runtime of the test and any limited resources that the test
-	 * requires to run.
+	 * The examples that only need a VPC or an ECS cluster to deploy to declare the shared fixtures instead of
+	 * creating their own. The fixtures are deployed once per region, when the first test that needs them applies,
+	 * and destroyed after the last one. Their resources are reserved from the quota of every region.
 	 */
-	tests := [][]TestCase{
+	tests := []TestCase{
+		// vpc: Deploy and validate a VPC. (~100s)
 		{
-			// vpc: Deploy and validate a VPC. (~100s)
-			// This test requires a VPC.
-			{
-				name:            "vpc",
-				workingDir:      "../examples/deploy-vpc",
-				genTestDataFunc: modules.DeployVpcUsingTerraform,
-				validateFunc:    modules.ValidateVpc,
-			},
-
-			// mongodb-security: Deploy and validate a MongoDB Security Terraform module. (~200s)
-			{
-				name:            "mongodb-security",
-				workingDir:      "../examples/deploy-mongodb-security",
-				genTestDataFunc: modules.DeployMongoDBSecurityUsingTerraform,
-				validateFunc:    modules.ValidateMongoDBSecurity,
-			},
-
-			// ecs-cluster: Deploy and validate an ECS cluster. (~313s)
-			// This test requires a VPC.
-			{
-				name:            "ecs-cluster",
-				workingDir:      "../examples/deploy-ecs-cluster",
-				genTestDataFunc: modules.DeployEcsClusterUsingTerraform,
-				validateFunc:    modules.ValidateEcsCluster,
-			},
+			name:             "vpc",
+			workingDir:       "../examples/deploy-vpc",
+			genTestDataFunc:  modules.DeployVpcUsingTerraform,
+			validateFunc:     modules.ValidateVpc,
+			validatePlanFunc: modules.ValidateVpcPlan,
+			resources:        scheduler.Resources{Vpcs: 1, Eips: 1, NatGateways: 1},
+			runtime:          100 * time.Second,
 		},
+
+		// mongodb-security: Deploy and validate a MongoDB Security Terraform module. (~200s)
+		// The MongoDB examples are deployed to us-east-1.
+		{
+			name:            "mongodb-security",
+			workingDir:      "../examples/deploy-mongodb-security",
+			genTestDataFunc: modules.DeployMongoDBSecurityUsingTerraform,
+			validateFunc:    modules.ValidateMongoDBSecurity,
+			regions:         []string{"us-east-1"},
+			runtime:         200 * time.Second,
+		},
+
+		// mongodb-cluster: Deploy and validate a MongoDB Atlas cluster. (~900s)
+		{
+			name:            "mongodb-cluster",
+			workingDir:      "../examples/deploy-mongodb-cluster",
+			genTestDataFunc: modules.DeployMongoDBClusterUsingTerraform,
+			validateFunc:    modules.ValidateMongoDBCluster,
+			regions:         []string{"us-east-1"},
+			runtime:         900 * time.Second,
+		},
+
+		// ecs-cluster: Deploy and validate an ECS cluster. (~313s)
+		{
+			name:             "ecs-cluster",
+			workingDir:       "../examples/deploy-ecs-cluster",
+			genTestDataFunc:  modules.DeployEcsClusterUsingTerraform,
+			validateFunc:     modules.ValidateEcsCluster,
+			validatePlanFunc: modules.ValidateEcsClusterPlan,
+			fixtures:         []*fixtures.Fixture{fixtures.Vpc},
+			runtime:          313 * time.Second,
+		},
+
+		// s3-artifact: Deploy and validate a replicated S3 bucket with storage class transitions. (~300s)
+		// The s3-artifact module always deploys to us-east-1 and replicates to us-east-2.
 		{
-			// ecs_service: Deploy and validate an ECS service. (~912s)
-			// This test requires a VPC.
-			{
-				name:            "ecs service",
-				workingDir:      "../examples/deploy-ecs-service",
-				genTestDataFunc: modules.DeployEcsServiceUsingTerraform,
-				validateFunc:    modules.ValidateEcsService,
-			},
-
-			// alb-https: Deploy and validate an Application Load Balancer with HTTPS. (~268s)
-			// This test requires a VPC.
-			{
-				name:            "alb",
-				workingDir:      "../examples/deploy-alb",
-				genTestDataFunc: modules.DeployAlb,
-				validateFunc:    modules.ValidateAlbHttps,
-			},
+			name:            "s3-artifact",
+			workingDir:      "../examples/deploy-s3-artifact",
+			genTestDataFunc: modules.DeployS3ArtifactUsingTerraform,
+			validateFunc:    modules.ValidateS3Artifact,
+			regions:         []string{"us-east-1"},
+			runtime:         300 * time.Second,
 		},
+
+		// s3-artifact-public-bucket: Deploy and validate a replicated S3 bucket with public reads. (~300s)
+		{
+			name:            "s3-artifact-public-bucket",
+			workingDir:      "../examples/deploy-s3-artifact-public-bucket",
+			genTestDataFunc: modules.DeployS3ArtifactUsingTerraform,
+			validateFunc:    modules.ValidateS3ArtifactPublicBucket,
+			regions:         []string{"us-east-1"},
+			runtime:         300 * time.Second,
+		},
+
+		// s3-artifact-wo-storage-transition: Deploy and validate a replicated S3 bucket without storage class
+		// transitions. (~300s)
+		{
+			name:            "s3-artifact-wo-storage-transition",
+			workingDir:      "../examples/deploy-s3-artifact-wo-storage-transition",
+			genTestDataFunc: modules.DeployS3ArtifactUsingTerraform,
+			validateFunc:    modules.ValidateS3ArtifactWithoutStorageTransition,
+			regions:         []string{"us-east-1"},
+			runtime:         300 * time.Second,
+		},
+
+		// secrets-manager: Deploy and validate Secrets Manager secrets. (~30s)
+		{
+			name:            "secrets-manager",
+			workingDir:      "../examples/deploy-secrets-manager",
+			genTestDataFunc: modules.DeploySecretsManagerUsingTerraform,
+			validateFunc:    modules.ValidateSecretsManager,
+			runtime:         30 * time.Second,
+		},
+
+		// ecs-event-task: Deploy and validate an ECS task triggered by an EventBridge event pattern. (~500s)
+		{
+			name:            "ecs-event-task",
+			workingDir:      "../examples/deploy-ecs-event-task",
+			genTestDataFunc: modules.DeployEcsScheduledTaskUsingTerraform,
+			validateFunc:    modules.ValidateEcsEventTask,
+			fixtures:        []*fixtures.Fixture{fixtures.EcsCluster},
+			runtime:         500 * time.Second,
+		},
+
+		// ecs_service: Deploy and validate an ECS service. (~912s)
+		{
+			name:             "ecs service",
+			workingDir:       "../examples/deploy-ecs-service",
+			genTestDataFunc:  modules.DeployEcsServiceUsingTerraform,
+			validateFunc:     modules.ValidateEcsService,
+			validatePlanFunc: modules.ValidateEcsServicePlan,
+			resources:        scheduler.Resources{Albs: 1},
+			fixtures:         []*fixtures.Fixture{fixtures.EcsCluster},
+			runtime:          912 * time.Second,
+		},
+
+		// alb-https: Deploy and validate an Application Load Balancer with HTTPS. (~268s)
+		{
+			name:            "alb",
+			workingDir:      "../examples/deploy-alb",
+			genTestDataFunc: modules.DeployAlb,
+			validateFunc:    modules.ValidateAlbHttps,
+			resources:       scheduler.Resources{Albs: 1},
+			fixtures:        []*fixtures.Fixture{fixtures.Vpc},
+			runtime:         268 * time.Second,
+		},
+
+		// ecs-scheduled-task: Deploy and validate ECS tasks scheduled by rate and cron expressions. (~600s)
+		{
+			name:            "ecs-scheduled-task",
+			workingDir:      "../examples/deploy-ecs-scheduled-task",
+			genTestDataFunc: modules.DeployEcsScheduledTaskUsingTerraform,
+			validateFunc:    modules.ValidateEcsScheduledTask,
+			fixtures:        []*fixtures.Fixture{fixtures.EcsCluster},
+			runtime:         600 * time.Second,
+		},
+	}
+
+	runTest(t, tests)
+}
+
+// scheduleTests plans the region and order of the tests within the quota of each region
+func scheduleTests(t *testing.T, tests []TestCase) *scheduler.Plan {
+	jobs := []scheduler.Job{}
+	for _, tt := range tests {
+		jobs = append(jobs, scheduler.Job{
+			Name:      tt.name,
+			Resources: tt.resources,
+			Regions:   tt.regions,
+			Runtime:   tt.runtime,
+		})
+	}
+
+	// The tests run in parallel up to the value of the -parallel flag
+	slots := runtime.GOMAXPROCS(0)
+	if f := flag.Lookup("test.parallel"); f != nil {
+		if parallel, err := strconv.Atoi(f.Value.String()); err == nil {
+			slots = parallel
+		}
+	}
+
+	// The fixtures can be deployed to any region
+	shared := []*fixtures.Fixture{}
+	for _, tt := range tests {
+		shared = append(shared, tt.fixtures...)
+	}
+	quota := awsRegionQuota.Sub(fixtures.Reserved(shared))
+
+	plan, err := scheduler.Schedule(jobs, modules.AwsRegions, quota, slots)
+	require.NoError(t, err, "Unable to schedule the tests")
+	t.Log(plan)
+	return plan
+}
+
+// selectTests returns the tests whose examples are affected by the changes since
+// TERRATEST_BASE_REF and skips the others, all tests are selected when it is unset.
+// With TERRATEST_EXPLAIN set, the selection is only logged.
+func selectTests(t *testing.T, tests []TestCase) []TestCase {
+	baseRef := os.Getenv(impact.BaseRefEnvVar)
+	explain := os.Getenv(impact.ExplainEnvVar) != ""
+	if baseRef == "" {
+		require.False(t, explain, "%s requires %s to be set", impact.ExplainEnvVar, impact.BaseRefEnvVar)
+		return tests
+	}
+
+	root, err := impact.RepoRoot()
+	require.NoError(t, err)
+	graph, err := impact.LoadGraph(root)
+	require.NoError(t, err)
+	changed, err := impact.ChangedFiles(root, baseRef)
+	require.NoError(t, err)
+
+	dirs := map[string]string{}
+	testCases := map[string]TestCase{}
+	for _, tt := range tests {
+		dirs[tt.name] = repoDir(t, root, tt.workingDir)
+		testCases[tt.name] = tt
 	}
 
-	for _, tests := range tests {
-		runTest(t, tests)
+	decisions := impact.Select(graph, dirs, changed)
+	logger.Log(t, impact.Explain(baseRef, decisions))
+	if explain {
+		t.Skipf("%s is set, the tests are not run", impact.ExplainEnvVar)
+	}
+
+	selected := []TestCase{}
+	for _, d := range decisions {
+		tt := testCases[d.Test]
+		if d.Selected {
+			selected = append(selected, tt)
+			continue
+		}
+
+		reason := d.Reason
+		t.Run(tt.name, func(t *testing.T) {
+			testReport.StartTest(t, tt.workingDir)
+			t.Skipf("Not affected by the changes since %s: %s", baseRef, reason)
+		})
 	}
+	return selected
+}
+
+// repoDir returns the working dir, which is relative to the tests, relative to the root of the repo
+func repoDir(t *testing.T, root string, workingDir string) string {
+	dir, err := filepath.Abs(workingDir)
+	require.NoError(t, err)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	dir, err = filepath.Rel(root, dir)
+	require.NoError(t, err)
+	return filepath.ToSlash(dir)
 }
 
 func runTest(t *testing.T, tests []TestCase) {
-	// Run tests in parallel
+	tests = selectTests(t, tests)
+
+	mode, err := journal.ModeFromEnv()
+	require.NoError(t, err)
+
+	// With TERRATEST_UPGRADE_FROM set, the examples are applied at a previous release and
+	// the upgrade to the working tree is planned instead of validated. The previous
+	// release deploys its own VPC and cluster, it does not use the fixtures.
+	upgradeTag := ""
+	root := ""
+	if from := os.Getenv(upgrade.FromEnvVar); from != "" {
+		root, err = impact.RepoRoot()
+		require.NoError(t, err)
+		upgradeTag, err = upgrade.ResolveTag(root, from)
+		require.NoError(t, err)
+		logger.Logf(t, "Testing the upgrade of the examples from %s to the working tree", upgradeTag)
+
+		for i, tt := range tests {
+			tests[i].resources = tt.resources.Add(fixtures.Reserved(tt.fixtures))
+			tests[i].fixtures = nil
+		}
+	}
+
+	// Open the journals that interrupted runs left in the working dirs
+	journals := map[string]*journal.Journal{}
+	for i, tt := range tests {
+		j, err := journal.Open(tt.name, tt.workingDir)
+		require.NoError(t, err)
+		journals[tt.name] = j
+
+		// The resources of an interrupted test are already deployed to its region
+		if j.Found() && j.Region != "" {
+			tests[i].regions = []string{j.Region}
+		}
+	}
+
+	plan := scheduleTests(t, tests)
+	gate := scheduler.NewGate(plan)
+
+	// Destroy the live deployments when the run is cancelled or is about to time out,
+	// the deferred destroy stages do not run when go test exits at its deadline
+	margin, err := teardown.MarginFromEnv()
+	require.NoError(t, err)
+	td := teardown.New(func(format string, args ...interface{}) {
+		logger.Logf(t, format, args...)
+	})
+	deadline, hasDeadline := t.Deadline()
+	stopWatching := td.Watch(deadline, hasDeadline, margin, func() {
+		finishReport()
+		os.Exit(1)
+	})
+
+	// The parallel tests run after runTest returns
+	t.Cleanup(stopWatching)
+
+	// Count the tests that need each fixture in their scheduled region
+	manager := fixtures.NewManager(fixtures.NewTerraformDeployer(), td)
+
+	testCases := map[string]TestCase{}
 	for _, tt := range tests {
+		testCases[tt.name] = tt
+	}
+
+	// Run tests in parallel in the order of the plan
+	for _, assignment := range plan.Assignments {
+		tt := testCases[assignment.Job.Name]
+		manager.Expect(tt.name, tt.fixtures, assignment.Region)
+		name := tt.name
 		workingDir := tt.workingDir
 		genTestDataFunc := tt.genTestDataFunc
 		validateFunc := tt.validateFunc
-		t.Run(tt.name, func(t *testing.T) {
+		validatePlanFunc := tt.validatePlanFunc
+		allowedDiffs := tt.allowedDiffs
+		j := journals[name]
+		exampleDir := ""
+		if upgradeTag != "" {
+			exampleDir = repoDir(t, root, workingDir)
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Release the resources of the test for the tests scheduled after it
+			defer gate.Done(name)
+
+			// Destroy the fixtures that no other test needs, after the test is destroyed
+			defer func() {
+				require.NoError(t, manager.Release(t, name))
+			}()
+
+			result := testReport.StartTest(t, workingDir)
+
+			if mode == journal.ModeCleanupOnly && !j.Found() {
+				t.Skip("No journal of an interrupted run, nothing to clean up")
+			}
+			if upgradeTag != "" {
+				released, err := upgrade.Released(root, upgradeTag, exampleDir)
+				require.NoError(t, err)
+				if !released {
+					t.Skipf("%s is not part of %s, there is nothing to upgrade", exampleDir, upgradeTag)
+				}
+			}
+			if j.Found() {
+				logger.Logf(t, "Found the journal of an interrupted run in %s, running in %q mode", journal.Path(workingDir), mode)
+				result.SetRegion(j.Region)
+			}
 
-			// At the end of the test, undeploy the resources using Terraform
-			defer test_structure.RunTestStage(t, "destroy", func() {
+			// runStage runs the stage unless the mode skips it and records its progress in the journal
+			runStage := func(stage string, fn func()) {
+				if td.Stopping() && stage != journal.DestroyStage {
+					result.SkipStage(t, stage, "the tests are being torn down")
+					return
+				}
+				if !j.ShouldRun(mode, stage) {
+					result.SkipStage(t, stage, fmt.Sprintf("not needed in %s mode", mode))
+					return
+				}
+				result.RunStage(t, stage, func() {
+					require.NoError(t, j.StartStage(stage))
+					fn()
+
+					// A stage that fails through assert cannot be told apart from the stages that
+					// failed before it, so no stage is completed once the test has failed and a
+					// resumed run repeats them. The destroy stage stops the test when it fails.
+					if !t.Failed() || stage == journal.DestroyStage {
+						require.NoError(t, j.CompleteStage(stage))
+					}
+				})
+			}
+
+			// The deployment of the working dir is destroyed by the destroy stage, or by the
+			// teardown when the run is stopped first
+			optionsPath := test_structure.FormatTestDataPath(workingDir, "TerraformOptions.json")
+			var deployment *teardown.Deployment
+			register := func() {
 				terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
-				terraform.Destroy(t, terraformOptions)
-				test_structure.CleanupTestDataFolder(t, workingDir)
-			})
+				deployment = td.Register(name, workingDir, fixtures.ConsumerLayer, func() error {
+					return destroyDeployment(t, workingDir, j, terraformOptions)
+				})
+			}
+			if test_structure.IsTestDataPresent(t, optionsPath) {
+				register()
+			}
+
+			// Validate the plan of the module without deploying it
+			if validatePlanFunc != nil && upgradeTag == "" {
+				runStage("plan", func() {
+					validatePlanFunc(t, workingDir)
+				})
+			}
+
+			// At the end of the test, undeploy the resources using Terraform and check
+			// that AWS deleted them
+			defer func() {
+				var clients *awsclients.Clients
+				destroyed := []survivors.Resource{}
+				runStage(journal.DestroyStage, func() {
+					// Nothing was deployed when the test stopped before its options were saved
+					if deployment != nil {
+						// The region is read from the test data before it is cleaned up
+						clients = modules.LoadAwsClients(t, workingDir)
+						destroyed = captureResources(t, workingDir)
+						require.NoError(t, deployment.Destroy(), "Unable to destroy %s", workingDir)
+					}
+					test_structure.CleanupTestDataFolder(t, workingDir)
+				})
+				if len(destroyed) > 0 {
+					runStage(survivors.Stage, func() {
+						assertDestroyed(t, workingDir, clients, destroyed)
+					})
+				}
+			}()
 
 			// Provision the secrets using Terraform
-			test_structure.RunTestStage(t, "apply", func() {
+			runStage(journal.ApplyStage, func() {
+				// Wait for the resources of the test to be available in its scheduled region
+				awsRegion, err := gate.Acquire(name)
+				require.NoError(t, err)
+				result.SetRegion(awsRegion)
+
+				// Deploy the fixtures of the test, unless an earlier test deployed them
+				fixtureOutputs, err := manager.Acquire(t, name)
+				require.NoError(t, err)
+
 				// Check if .test-data exists
 				// If it does not exist, generate the test data
 				if !test_structure.IsTestDataPresent(t, fmt.Sprintf("%s/.test-data/TerraformOptions.json", workingDir)) {
+					modules.SaveAwsRegion(t, workingDir, awsRegion)
 					genTestDataFunc(t, workingDir)
+
+					// Deploy the example to the fixtures
+					terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+					for key, value := range fixtureOutputs {
+						terraformOptions.Vars[key] = value
+					}
+					test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+
+					// Tag the resources so a leaked resource can be traced to the test run
+					modules.SaveTestTags(t, workingDir)
+
+					if upgradeTag != "" {
+						checkoutRelease(t, workingDir, root, upgradeTag, exampleDir)
+					}
+
+					// Record where the resources are deployed before they are, so an
+					// interrupted apply can still be destroyed
+					terraformOptions = test_structure.LoadTerraformOptions(t, workingDir)
+					uniqueId, _ := terraformOptions.Vars["random_id"].(string)
+					require.NoError(t, j.SetDeployment(
+						test_structure.LoadString(t, workingDir, "awsRegion"),
+						uniqueId,
+						modules.TestTags(t)[util.RunIdTagKey],
+					))
+				}
+
+				if deployment == nil {
+					register()
 				}
 
 				// Get the Terraform Options saved
@@ -116,12 +556,194 @@ func runTest(t *testing.T, tests []TestCase) {
 
 				// Deploy the cluster
 				terraform.InitAndApply(t, terraformOptions)
+
+				// Check that every deployed resource can be traced to the test run, the
+				// previous release may not tag all of them
+				if upgradeTag == "" {
+					modules.AssertStateIsTagged(t, workingDir)
+				}
+
+				// Record the outputs in the report, they identify the deployed resources
+				if outputs, err := terraform.OutputAllE(t, terraformOptions); err == nil {
+					result.SetOutputs(outputs)
+				}
 			})
 
+			// Check that the deployed example has no changes left to apply. There is nothing
+			// to plan again when the apply stage is skipped, i.e. in plan-only runs.
+			if upgradeTag == "" {
+				if os.Getenv("SKIP_"+journal.ApplyStage) != "" || !test_structure.IsTestDataPresent(t, optionsPath) {
+					result.SkipStage(t, idempotency.Stage, "the example was not deployed")
+				} else {
+					runStage(idempotency.Stage, func() {
+						assertIdempotent(t, workingDir, allowedDiffs)
+					})
+				}
+			}
+
+			// Check that the deployed release can be upgraded to the working tree
+			if upgradeTag != "" {
+				runStage(upgrade.Stage, func() {
+					planUpgrade(t, workingDir, root, upgradeTag, result)
+				})
+				return
+			}
+
 			// Validate that the secrets are configured properly
-			test_structure.RunTestStage(t, "validate", func() {
-				validateFunc(t, workingDir)
+			runStage("validate", func() {
+				validateFunc(t, workingDir, modules.LoadAwsClients(t, workingDir))
 			})
 		})
 	}
 }
+
+// destroyDeployment destroys the resources of the working dir and removes its test data.
+// It waits for the state lock, so the teardown can destroy a test that is still applying.
+func destroyDeployment(t *testing.T, workingDir string, j *journal.Journal, terraformOptions *terraform.Options) error {
+	if err := j.StartStage(journal.DestroyStage); err != nil {
+		return err
+	}
+
+	options, err := terraformOptions.Clone()
+	if err != nil {
+		return err
+	}
+	options.Lock = true
+	options.LockTimeout = "10m"
+
+	if _, err := terraform.DestroyE(t, options); err != nil {
+		return err
+	}
+
+	if err := j.Remove(); err != nil {
+		return err
+	}
+	return test_structure.CleanupTestDataFolderE(t, workingDir)
+}
+
+// checkoutRelease checks out the example in the working dir and the modules at the tag,
+// and points the saved Terraform options at the example of the release. The variables
+// that the release does not declare yet are not passed to it.
+func checkoutRelease(t *testing.T, workingDir string, root string, tag string, exampleDir string) {
+	releaseDir, err := upgrade.Checkout(root, tag, exampleDir, test_structure.FormatTestDataPath(workingDir, "upgrade-release"))
+	require.NoError(t, err)
+	declared, err := upgrade.DeclaredVariables(releaseDir)
+	require.NoError(t, err)
+
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+	for name := range terraformOptions.Vars {
+		if !declared[name] {
+			logger.Logf(t, "%s does not declare the variable %s at %s, it is not passed", exampleDir, name, tag)
+			delete(terraformOptions.Vars, name)
+		}
+	}
+	terraformOptions.TerraformDir = releaseDir
+	test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
+}
+
+// planUpgrade plans the deployed release with the modules of the working tree and fails
+// the test if the plan replaces or destroys stateful resources. The plan is recorded in
+// the report.
+func planUpgrade(t *testing.T, workingDir string, root string, tag string, result *report.Test) {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	upgradeDir := test_structure.FormatTestDataPath(workingDir, "upgrade-working-tree")
+	checkoutDir := test_structure.FormatTestDataPath(workingDir, "upgrade-release")
+	require.NoError(t, upgrade.Repoint(terraformOptions.TerraformDir, checkoutDir, root, upgradeDir))
+
+	options, err := terraformOptions.Clone()
+	require.NoError(t, err)
+	options.TerraformDir = upgradeDir
+	options.PlanFilePath = "upgrade.tfplan"
+
+	plan := terraform.InitAndPlanAndShowWithStruct(t, options)
+	diff, err := terraform.RunTerraformCommandAndGetStdoutE(t, options, "show", "-no-color", options.PlanFilePath)
+	require.NoError(t, err)
+	result.SetPlanDiff(diff)
+
+	destructive := upgrade.DestructiveChanges(plan.ResourceChangesMap)
+	if len(destructive) > 0 {
+		t.Errorf("Upgrading %s from %s replaces or destroys stateful resources:\n%s", workingDir, tag, strings.Join(destructive, "\n"))
+	}
+}
+
+// assertIdempotent plans the deployed example again and fails the test on any change
+// that is not in the allowed diffs of the example
+func assertIdempotent(t *testing.T, workingDir string, allowedDiffs []idempotency.AllowedDiff) {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	options, err := terraformOptions.Clone()
+	require.NoError(t, err)
+
+	// The plan holds the secrets of the example, it is kept in .test-data so the destroy
+	// stage removes it. Terraform runs in the working dir, so the path is absolute.
+	options.PlanFilePath, err = filepath.Abs(test_structure.FormatTestDataPath(workingDir, "idempotency.tfplan"))
+	require.NoError(t, err)
+
+	// 0 means no changes, 2 means changes and 1 is an error
+	out, err := terraform.RunTerraformCommandE(t, options, terraform.FormatArgs(options, "plan", "-input=false", "-detailed-exitcode")...)
+	if err == nil {
+		return
+	}
+	if fatal, ok := err.(retry.FatalError); ok {
+		err = fatal.Underlying
+	}
+	exitCode, exitCodeErr := shell.GetExitCodeForRunCommandError(err)
+	require.True(t, exitCodeErr == nil && exitCode == 2, "Unable to plan %s again:\n%s", workingDir, out)
+
+	plan, err := terraform.ShowWithStructE(t, options)
+	require.NoError(t, err)
+
+	diffs := idempotency.Diffs(plan.ResourceChangesMap, allowedDiffs)
+	for _, d := range diffs {
+		if d.Allowed != nil {
+			logger.Logf(t, "Allowed diff %s: %s", d, d.Allowed.Reason)
+		}
+	}
+
+	unexpected := idempotency.Unexpected(diffs)
+	if len(unexpected) == 0 {
+		return
+	}
+	lines := []string{}
+	for _, d := range unexpected {
+		lines = append(lines, d.String())
+	}
+	t.Errorf("Expected a plan of %s to have no changes after the apply, got:\n%s", workingDir, strings.Join(lines, "\n"))
+}
+
+// captureResources returns the resources in the state of the example in the working dir,
+// so they can be checked once the example is destroyed. The destroy is not blocked when
+// the state cannot be read.
+func captureResources(t *testing.T, workingDir string) []survivors.Resource {
+	terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+
+	out, err := terraform.RunTerraformCommandAndGetStdoutE(t, terraformOptions, "show", "-json", "-no-color")
+	state := &tfjson.State{}
+	if err == nil {
+		err = json.Unmarshal([]byte(out), state)
+	}
+	if err != nil {
+		logger.Logf(t, "Unable to read the state of %s, its resources are not checked after the destroy: %s", workingDir, err)
+		return []survivors.Resource{}
+	}
+	return survivors.Capture(state)
+}
+
+// assertDestroyed polls AWS until the resources of the destroyed example are deleted
+// and fails the test with the resources that survive
+func assertDestroyed(t *testing.T, workingDir string, clients *awsclients.Clients, resources []survivors.Resource) {
+	ctx, cancel := waiter.Context(t, 5*time.Minute)
+	defer cancel()
+	w := waiter.New(fmt.Sprintf("the resources of %s to be deleted", workingDir), t.Logf)
+
+	left := survivors.Wait(ctx, w, survivors.NewAwsChecker(clients), resources)
+	if len(left) == 0 {
+		return
+	}
+	lines := []string{}
+	for _, s := range left {
+		lines = append(lines, s.String())
+	}
+	t.Errorf("Expected the resources of %s to be deleted after the destroy, found in %s:\n%s", workingDir, clients.Region(), strings.Join(lines, "\n"))
+}
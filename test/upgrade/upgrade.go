@@ -0,0 +1,333 @@
+// Package upgrade tests that a stack deployed with the previous release of the modules
+// can be upgraded to the working tree. Consumers pin the modules with ?ref=v<version>,
+// so an upgrade keeps their code and only changes the modules it calls. The example is
+// checked out at the release tag and applied, then a copy of it is pointed at the
+// modules of the working tree and planned against the same state.
+package upgrade
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// FromEnvVar is the git tag that the upgrade tests apply the examples at, the tests
+	// run as usual when unset
+	FromEnvVar = "TERRATEST_UPGRADE_FROM"
+
+	// Previous selects the latest release tag before VERSION
+	Previous = "previous"
+
+	// Stage plans the upgrade of the deployed example to the working tree
+	Stage = "upgrade"
+
+	// modulesDir holds the modules that the examples call with local sources
+	modulesDir = "modules"
+)
+
+// ErrNotReleased is returned when the example is not part of the release
+var ErrNotReleased = errors.New("the example is not part of the release")
+
+// statefulTypes are the resources that lose data or interrupt consumers when they are
+// replaced or destroyed
+var statefulTypes = map[string]bool{
+	"aws_s3_bucket":                 true,
+	"aws_secretsmanager_secret":     true,
+	"mongodbatlas_cluster":          true,
+	"mongodbatlas_advanced_cluster": true,
+	"aws_ecs_service":               true,
+}
+
+// ResolveTag returns the tag that the upgrade tests apply the examples at. Previous is
+// resolved to the latest v<version> tag that is older than the VERSION of the repo.
+func ResolveTag(root string, from string) (string, error) {
+	if from != Previous {
+		return from, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "VERSION"))
+	if err != nil {
+		return "", err
+	}
+	current, err := version.NewVersion(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse VERSION: %w", err)
+	}
+
+	out, err := git(root, "tag", "--list", "v*")
+	if err != nil {
+		return "", err
+	}
+
+	var previous *version.Version
+	tag := ""
+	for _, name := range strings.Fields(string(out)) {
+		v, err := version.NewVersion(name)
+		if err != nil || !v.LessThan(current) {
+			continue
+		}
+		if previous == nil || v.GreaterThan(previous) {
+			previous = v
+			tag = name
+		}
+	}
+	if tag == "" {
+		return "", fmt.Errorf("no release tag before v%s, fetch the tags or set %s to a tag", current, FromEnvVar)
+	}
+	return tag, nil
+}
+
+// Released returns true if the example dir, relative to the root, is part of the tag
+func Released(root string, tag string, exampleDir string) (bool, error) {
+	_, err := git(root, "cat-file", "-e", fmt.Sprintf("%s:%s", tag, exampleDir))
+	if err == nil {
+		return true, nil
+	}
+	if _, err := git(root, "rev-parse", "--verify", "--quiet", tag+"^{commit}"); err != nil {
+		return false, fmt.Errorf("unknown tag %s", tag)
+	}
+	return false, nil
+}
+
+// Checkout extracts the example dir and the modules at the tag into dest and returns
+// the dir of the example in dest
+func Checkout(root string, tag string, exampleDir string, dest string) (string, error) {
+	released, err := Released(root, tag, exampleDir)
+	if err != nil {
+		return "", err
+	}
+	if !released {
+		return "", ErrNotReleased
+	}
+
+	archive, err := git(root, "archive", "--format=tar", tag, exampleDir, modulesDir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return "", err
+	}
+	if err := extract(bytes.NewReader(archive), dest); err != nil {
+		return "", err
+	}
+	return filepath.Join(dest, filepath.FromSlash(exampleDir)), nil
+}
+
+// extract writes the regular files of the tar archive to dest
+func extract(r io.Reader, dest string) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		path := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("unexpected path %s in the archive", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, os.FileMode(header.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+}
+
+// Repoint copies the files of the example that was checked out into checkoutDir,
+// including its state, to dest. The local module sources that point into checkoutDir
+// are rewritten to the same modules in the root, so the copy plans the upgrade of the
+// deployed example to the working tree.
+func Repoint(exampleDir string, checkoutDir string, root string, dest string) error {
+	// The sources are rewritten relative to dest, the dirs can be relative to another dir
+	dirs := []*string{&exampleDir, &checkoutDir, &root, &dest}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			return err
+		}
+		*dir = abs
+	}
+
+	entries, err := os.ReadDir(exampleDir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// The data dir is initialized for the sources of the release, and the working
+		// tree can require newer providers than the dependency lock file of the release
+		if !entry.Type().IsRegular() || entry.Name() == ".terraform.lock.hcl" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(exampleDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(entry.Name()) == ".tf" {
+			data, err = repointSources(data, entry.Name(), exampleDir, checkoutDir, root, dest)
+			if err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dest, entry.Name()), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func repointSources(data []byte, name string, exampleDir string, checkoutDir string, root string, dest string) ([]byte, error) {
+	f, diags := hclwrite.ParseConfig(data, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to parse %s: %s", name, diags.Error())
+	}
+
+	for _, block := range f.Body().Blocks() {
+		if block.Type() != "module" {
+			continue
+		}
+		attr := block.Body().GetAttribute("source")
+		if attr == nil {
+			continue
+		}
+		source, ok := literalString(attr.Expr().BuildTokens(nil).Bytes())
+		if !ok || !(strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")) {
+			continue
+		}
+
+		rel, err := filepath.Rel(checkoutDir, filepath.Join(exampleDir, filepath.FromSlash(source)))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		target, err := filepath.Rel(dest, filepath.Join(root, rel))
+		if err != nil {
+			return nil, err
+		}
+
+		// Terraform only treats sources that start with ./ or ../ as local paths
+		target = filepath.ToSlash(target)
+		if !strings.HasPrefix(target, "../") {
+			target = "./" + target
+		}
+		block.Body().SetAttributeValue("source", cty.StringVal(target))
+	}
+	return f.Bytes(), nil
+}
+
+// literalString returns the value of an expression that is a string literal
+func literalString(expr []byte) (string, bool) {
+	parsed, diags := hclsyntax.ParseExpression(expr, "source", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", false
+	}
+	value, diags := parsed.Value(nil)
+	if diags.HasErrors() || !value.IsKnown() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// DeclaredVariables returns the names of the variables that the example declares, the
+// tests can set variables that the release does not declare yet
+func DeclaredVariables(exampleDir string) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(exampleDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	variables := map[string]bool{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(data, file, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to parse %s: %s", file, diags.Error())
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type == "variable" && len(block.Labels) == 1 {
+				variables[block.Labels[0]] = true
+			}
+		}
+	}
+	return variables, nil
+}
+
+// DestructiveChanges returns the stateful resources that the plan replaces or destroys,
+// with their planned actions, sorted by address
+func DestructiveChanges(changes map[string]*tfjson.ResourceChange) []string {
+	destructive := []string{}
+	for address, change := range changes {
+		if change.Mode != tfjson.ManagedResourceMode || !statefulTypes[change.Type] || change.Change == nil {
+			continue
+		}
+		actions := change.Change.Actions
+		if actions.Delete() || actions.Replace() {
+			destructive = append(destructive, fmt.Sprintf("%s: %s", address, actionNames(actions)))
+		}
+	}
+	sort.Strings(destructive)
+	return destructive
+}
+
+func actionNames(actions tfjson.Actions) string {
+	if actions.Replace() {
+		return "replace"
+	}
+	names := []string{}
+	for _, action := range actions {
+		names = append(names, string(action))
+	}
+	return strings.Join(names, ", ")
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package upgrade
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRepo creates a repo with the releases v1.0.0 and v1.1.0 of an example that
+// calls a local module, and VERSION bumped to 1.2.0
+func newTestRepo(t *testing.T) string {
+	root := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	run("init", "-q", "-b", "main")
+	writeFile(t, root, "VERSION", "1.0.0\n")
+	writeFile(t, root, "modules/bucket/main.tf", "# v1.0.0\n")
+	writeFile(t, root, "examples/deploy-bucket/main.tf", `module "bucket" {
+  source = "../../modules/bucket"
+
+  name = var.name
+}
+
+module "registry" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+`)
+	writeFile(t, root, "examples/deploy-bucket/variables.tf", `variable "name" {
+  type = string
+}
+`)
+	run("add", "-A")
+	run("commit", "-q", "-m", "v1.0.0")
+	run("tag", "v1.0.0")
+
+	writeFile(t, root, "VERSION", "1.1.0\n")
+	writeFile(t, root, "modules/bucket/main.tf", "# v1.1.0\n")
+	run("commit", "-q", "-am", "v1.1.0")
+	run("tag", "v1.1.0")
+
+	writeFile(t, root, "VERSION", "1.2.0\n")
+	writeFile(t, root, "modules/bucket/main.tf", "# working tree\n")
+	writeFile(t, root, "examples/deploy-queue/main.tf", "")
+	run("add", "-A")
+	run("commit", "-q", "-m", "unreleased")
+	return root
+}
+
+func TestResolveTag(t *testing.T) {
+	root := newTestRepo(t)
+
+	tag, err := ResolveTag(root, Previous)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", tag)
+
+	// A tag is used as is
+	tag, err = ResolveTag(root, "v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", tag)
+
+	// VERSION can already be released
+	writeFile(t, root, "VERSION", "1.1.0\n")
+	tag, err = ResolveTag(root, Previous)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", tag)
+
+	writeFile(t, root, "VERSION", "1.0.0\n")
+	_, err = ResolveTag(root, Previous)
+	assert.ErrorContains(t, err, "no release tag before v1.0.0")
+}
+
+func TestCheckoutAndRepoint(t *testing.T) {
+	root := newTestRepo(t)
+
+	released, err := Released(root, "v1.1.0", "examples/deploy-queue")
+	require.NoError(t, err)
+	assert.False(t, released)
+	_, err = Checkout(root, "v1.1.0", "examples/deploy-queue", t.TempDir())
+	assert.ErrorIs(t, err, ErrNotReleased)
+	_, err = Released(root, "v9.9.9", "examples/deploy-bucket")
+	assert.EqualError(t, err, "unknown tag v9.9.9")
+
+	// The example is applied with the modules of the release
+	checkoutDir := filepath.Join(t.TempDir(), "release")
+	exampleDir, err := Checkout(root, "v1.1.0", "examples/deploy-bucket", checkoutDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(checkoutDir, "examples", "deploy-bucket"), exampleDir)
+	module, err := os.ReadFile(filepath.Join(checkoutDir, "modules", "bucket", "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, "# v1.1.0\n", string(module))
+
+	writeFile(t, exampleDir, "terraform.tfstate", `{"version": 4}`)
+	writeFile(t, exampleDir, ".terraform.lock.hcl", "")
+	require.NoError(t, os.MkdirAll(filepath.Join(exampleDir, ".terraform"), 0755))
+
+	// The copy calls the modules of the working tree with the state of the release
+	upgradeDir := filepath.Join(t.TempDir(), "upgrade")
+	require.NoError(t, Repoint(exampleDir, checkoutDir, root, upgradeDir))
+
+	main, err := os.ReadFile(filepath.Join(upgradeDir, "main.tf"))
+	require.NoError(t, err)
+	expectedSource, err := filepath.Rel(upgradeDir, filepath.Join(root, "modules", "bucket"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), `source = "`+filepath.ToSlash(expectedSource)+`"`)
+	assert.Contains(t, string(main), `source  = "terraform-aws-modules/vpc/aws"`)
+
+	state, err := os.ReadFile(filepath.Join(upgradeDir, "terraform.tfstate"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"version": 4}`, string(state))
+	assert.NoFileExists(t, filepath.Join(upgradeDir, ".terraform.lock.hcl"))
+	assert.NoDirExists(t, filepath.Join(upgradeDir, ".terraform"))
+
+	variables, err := DeclaredVariables(upgradeDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"name": true}, variables)
+}
+
+func TestDestructiveChanges(t *testing.T) {
+	change := func(resourceType string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{
+			Mode:   tfjson.ManagedResourceMode,
+			Type:   resourceType,
+			Change: &tfjson.Change{Actions: actions},
+		}
+	}
+
+	changes := map[string]*tfjson.ResourceChange{
+		"module.bucket.aws_s3_bucket.bucket":              change("aws_s3_bucket", tfjson.ActionDelete, tfjson.ActionCreate),
+		"module.secrets.aws_secretsmanager_secret.secret": change("aws_secretsmanager_secret", tfjson.ActionDelete),
+		"module.service.aws_ecs_service.service":          change("aws_ecs_service", tfjson.ActionUpdate),
+		"module.cluster.mongodbatlas_cluster.cluster":     change("mongodbatlas_cluster", tfjson.ActionCreate, tfjson.ActionDelete),
+		"module.service.aws_ecs_task_definition.task":     change("aws_ecs_task_definition", tfjson.ActionDelete, tfjson.ActionCreate),
+		"module.bucket.aws_s3_bucket_versioning.bucket":   change("aws_s3_bucket_versioning", tfjson.ActionDelete),
+	}
+
+	assert.Equal(t, []string{
+		"module.bucket.aws_s3_bucket.bucket: replace",
+		"module.cluster.mongodbatlas_cluster.cluster: replace",
+		"module.secrets.aws_secretsmanager_secret.secret: delete",
+	}, DestructiveChanges(changes))
+}
+
+func writeFile(t *testing.T, root string, name string, content string) {
+	file := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+}
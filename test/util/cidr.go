@@ -0,0 +1,48 @@
+package util
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// CidrSubnet calculates a subnet address within the given IP network address
+// prefix. It mirrors the cidrsubnet function of Terraform, newbits is the number
+// of additional bits to extend the prefix with and netnum is the number used to
+// populate those bits.
+//
+// i.e. CidrSubnet("10.0.0.0/18", 6, 1) returns "10.0.1.0/24"
+func CidrSubnet(prefix string, newbits int, netnum int) (string, error) {
+	network, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR prefix %q: %w", prefix, err)
+	}
+	network = network.Masked()
+
+	addrLen := network.Addr().BitLen()
+	newPrefixLen := network.Bits() + newbits
+	if newbits < 0 || newPrefixLen > addrLen {
+		return "", fmt.Errorf("insufficient address space to extend prefix of %d by %d", network.Bits(), newbits)
+	}
+
+	maxNetnum := new(big.Int).Lsh(big.NewInt(1), uint(newbits))
+	if netnum < 0 || big.NewInt(int64(netnum)).Cmp(maxNetnum) >= 0 {
+		return "", fmt.Errorf("prefix extension of %d does not accommodate a subnet numbered %d", newbits, netnum)
+	}
+
+	// Shift the netnum into the bits following the
+	// existing prefix and add it to the network address
+	addr := new(big.Int).SetBytes(network.Addr().AsSlice())
+	offset := new(big.Int).Lsh(big.NewInt(int64(netnum)), uint(addrLen-newPrefixLen))
+	addr.Add(addr, offset)
+
+	bytes := make([]byte, addrLen/8)
+	addr.FillBytes(bytes)
+
+	subnet, ok := netip.AddrFromSlice(bytes)
+	if !ok {
+		return "", fmt.Errorf("unable to compute subnet %d of %s", netnum, prefix)
+	}
+
+	return netip.PrefixFrom(subnet, newPrefixLen).String(), nil
+}
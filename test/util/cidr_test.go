@@ -0,0 +1,49 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCidrSubnet(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		newbits  int
+		netnum   int
+		expected string
+	}{
+		// Examples from the Terraform cidrsubnet documentation
+		{"172.16.0.0/12", 4, 2, "172.18.0.0/16"},
+		{"10.1.2.0/24", 4, 15, "10.1.2.240/28"},
+		{"fd00:fd12:3456:7890::/56", 16, 162, "fd00:fd12:3456:7800:a200::/72"},
+
+		// The vpc module's default layout
+		{"10.0.0.0/18", 6, 1, "10.0.1.0/24"},
+		{"10.0.0.0/18", 6, 63, "10.0.63.0/24"},
+		{"10.0.0.0/16", 6, 4, "10.0.16.0/22"},
+
+		// Host bits of the prefix are ignored
+		{"10.0.0.1/18", 6, 2, "10.0.2.0/24"},
+	}
+
+	for _, tt := range tests {
+		actual, err := CidrSubnet(tt.prefix, tt.newbits, tt.netnum)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, actual, "cidrsubnet(%s, %d, %d)", tt.prefix, tt.newbits, tt.netnum)
+	}
+}
+
+func TestCidrSubnetErrors(t *testing.T) {
+	// The netnum does not fit in the new bits
+	_, err := CidrSubnet("10.0.0.0/18", 6, 64)
+	assert.Error(t, err)
+
+	// The new prefix is longer than the address
+	_, err = CidrSubnet("10.0.0.0/30", 6, 1)
+	assert.Error(t, err)
+
+	// The prefix is not a CIDR block
+	_, err = CidrSubnet("10.0.0.0", 6, 1)
+	assert.Error(t, err)
+}
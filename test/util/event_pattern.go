@@ -0,0 +1,412 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MatchEventPattern matches the event against the EventBridge event pattern. It returns
+// a line per field of the pattern that the event does not match, so an empty result
+// means that EventBridge would deliver the event to the rule. An error is returned if
+// the pattern is not valid or uses a filter that is not supported.
+//
+// i.e. MatchEventPattern(`{"source": ["app"]}`, `{"source": "other"}`) returns
+// [`source: got "other", expected one of ["app"]`]
+func MatchEventPattern(pattern string, event string) ([]string, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal([]byte(pattern), &p); err != nil {
+		return nil, fmt.Errorf("event pattern must be a JSON object: %w", err)
+	}
+
+	var e map[string]interface{}
+	if err := json.Unmarshal([]byte(event), &e); err != nil {
+		return nil, fmt.Errorf("event must be a JSON object: %w", err)
+	}
+
+	return matchEventObject("", p, e)
+}
+
+// BuildEventFromPattern builds the smallest event that matches the EventBridge event
+// pattern by picking a value that satisfies the first filter of each field. Fields
+// that the pattern requires to not exist are left out of the event.
+func BuildEventFromPattern(pattern string) (map[string]interface{}, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal([]byte(pattern), &p); err != nil {
+		return nil, fmt.Errorf("event pattern must be a JSON object: %w", err)
+	}
+
+	return buildEventObject("", p)
+}
+
+// matchEventObject matches each field of the pattern against the event
+func matchEventObject(prefix string, pattern map[string]interface{}, event map[string]interface{}) ([]string, error) {
+	mismatches := []string{}
+	for _, key := range sortedKeys(pattern) {
+		fieldPath := joinFieldPath(prefix, key)
+		value, present := event[key]
+
+		switch filters := pattern[key].(type) {
+		case map[string]interface{}:
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				mismatches = append(mismatches, fmt.Sprintf("%s: got %s, expected an object", fieldPath, describeEventValue(value, present)))
+				continue
+			}
+			nestedMismatches, err := matchEventObject(fieldPath, filters, nested)
+			if err != nil {
+				return nil, err
+			}
+			mismatches = append(mismatches, nestedMismatches...)
+
+		case []interface{}:
+			matched, err := matchEventValue(fieldPath, filters, value, present)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				mismatches = append(mismatches, fmt.Sprintf("%s: got %s, expected one of %s", fieldPath, describeEventValue(value, present), toJSON(filters)))
+			}
+
+		default:
+			return nil, fmt.Errorf("%s: event pattern values must be an array or an object, got %s", fieldPath, toJSON(filters))
+		}
+	}
+	return mismatches, nil
+}
+
+// matchEventValue returns true if any of the filters matches the value. An array
+// value matches if any of its elements match.
+func matchEventValue(fieldPath string, filters []interface{}, value interface{}, present bool) (bool, error) {
+	if len(filters) == 0 {
+		return false, fmt.Errorf("%s: event pattern arrays must not be empty", fieldPath)
+	}
+
+	candidates := []interface{}{value}
+	if values, ok := value.([]interface{}); ok {
+		candidates = values
+	}
+
+	for _, filter := range filters {
+		// The exists filter matches the field rather than its values
+		if existsFilter, ok := filter.(map[string]interface{}); ok && existsFilter["exists"] != nil {
+			exists, ok := existsFilter["exists"].(bool)
+			if !ok || len(existsFilter) != 1 {
+				return false, fmt.Errorf("%s: exists must be true or false, got %s", fieldPath, toJSON(filter))
+			}
+			if exists == present {
+				return true, nil
+			}
+			continue
+		}
+
+		if !present {
+			continue
+		}
+		for _, candidate := range candidates {
+			matched, err := matchEventFilter(fieldPath, filter, candidate)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchEventFilter returns true if the filter matches a single value
+func matchEventFilter(fieldPath string, filter interface{}, value interface{}) (bool, error) {
+	switch f := filter.(type) {
+	case nil:
+		return value == nil, nil
+	case string, float64, bool:
+		return f == value, nil
+	case map[string]interface{}:
+		if len(f) != 1 {
+			return false, fmt.Errorf("%s: content filters must have a single key, got %s", fieldPath, toJSON(f))
+		}
+	default:
+		return false, fmt.Errorf("%s: unsupported filter %s", fieldPath, toJSON(filter))
+	}
+
+	contentFilter := filter.(map[string]interface{})
+	for name, operand := range contentFilter {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			return matchStringFilter(fieldPath, name, operand, value)
+
+		case "wildcard":
+			s, ok := value.(string)
+			pattern, isString := operand.(string)
+			if !isString {
+				return false, fmt.Errorf("%s: wildcard must be a string, got %s", fieldPath, toJSON(operand))
+			}
+			if !ok {
+				return false, nil
+			}
+			// path.Match treats / as a separator, which EventBridge does not
+			matched, err := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(s, "/", "\x00"))
+			if err != nil {
+				return false, fmt.Errorf("%s: invalid wildcard %q: %w", fieldPath, pattern, err)
+			}
+			return matched, nil
+
+		case "anything-but":
+			operands := []interface{}{operand}
+			if list, ok := operand.([]interface{}); ok {
+				operands = list
+			}
+			for _, o := range operands {
+				matched, err := matchEventFilter(fieldPath, o, value)
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return false, nil
+				}
+			}
+			return true, nil
+
+		case "numeric":
+			n, ok := value.(float64)
+			if !ok {
+				return false, nil
+			}
+			lower, upper, err := parseNumericFilter(fieldPath, operand)
+			if err != nil {
+				return false, err
+			}
+			return lower.allows(n) && upper.allows(n), nil
+
+		case "cidr":
+			cidr, isString := operand.(string)
+			prefix, err := netip.ParsePrefix(cidr)
+			if !isString || err != nil {
+				return false, fmt.Errorf("%s: cidr must be a CIDR block, got %s", fieldPath, toJSON(operand))
+			}
+			s, ok := value.(string)
+			if !ok {
+				return false, nil
+			}
+			addr, err := netip.ParseAddr(s)
+			return err == nil && prefix.Contains(addr), nil
+		}
+	}
+
+	return false, fmt.Errorf("%s: unsupported content filter %s", fieldPath, toJSON(filter))
+}
+
+// matchStringFilter matches the prefix, suffix and equals-ignore-case filters. The
+// prefix and suffix filters can be nested with equals-ignore-case.
+func matchStringFilter(fieldPath string, name string, operand interface{}, value interface{}) (bool, error) {
+	s, ok := value.(string)
+	if !ok {
+		return false, nil
+	}
+
+	ignoreCase := name == "equals-ignore-case"
+	if nested, ok := operand.(map[string]interface{}); ok && name != "equals-ignore-case" && len(nested) == 1 && nested["equals-ignore-case"] != nil {
+		operand = nested["equals-ignore-case"]
+		ignoreCase = true
+	}
+
+	expected, ok := operand.(string)
+	if !ok {
+		return false, fmt.Errorf("%s: %s must be a string, got %s", fieldPath, name, toJSON(operand))
+	}
+	if ignoreCase {
+		s, expected = strings.ToLower(s), strings.ToLower(expected)
+	}
+
+	switch name {
+	case "prefix":
+		return strings.HasPrefix(s, expected), nil
+	case "suffix":
+		return strings.HasSuffix(s, expected), nil
+	default:
+		return s == expected, nil
+	}
+}
+
+// numericBound is a lower or upper bound of a numeric filter
+type numericBound struct {
+	value     float64
+	inclusive bool
+	isLower   bool
+}
+
+func (b numericBound) allows(n float64) bool {
+	switch {
+	case b.isLower && b.inclusive:
+		return n >= b.value
+	case b.isLower:
+		return n > b.value
+	case b.inclusive:
+		return n <= b.value
+	default:
+		return n < b.value
+	}
+}
+
+// parseNumericFilter parses the operator and number pairs of a numeric filter into its bounds
+func parseNumericFilter(fieldPath string, operand interface{}) (numericBound, numericBound, error) {
+	lower := numericBound{value: math.Inf(-1), inclusive: true, isLower: true}
+	upper := numericBound{value: math.Inf(1), inclusive: true}
+
+	pairs, ok := operand.([]interface{})
+	if !ok || len(pairs) == 0 || len(pairs)%2 != 0 {
+		return lower, upper, fmt.Errorf("%s: numeric must be operator and number pairs, got %s", fieldPath, toJSON(operand))
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		operator, isString := pairs[i].(string)
+		n, isNumber := pairs[i+1].(float64)
+		if !isString || !isNumber {
+			return lower, upper, fmt.Errorf("%s: numeric must be operator and number pairs, got %s", fieldPath, toJSON(operand))
+		}
+
+		switch operator {
+		case "=":
+			lower = numericBound{value: n, inclusive: true, isLower: true}
+			upper = numericBound{value: n, inclusive: true}
+		case ">":
+			lower = numericBound{value: n, isLower: true}
+		case ">=":
+			lower = numericBound{value: n, inclusive: true, isLower: true}
+		case "<":
+			upper = numericBound{value: n}
+		case "<=":
+			upper = numericBound{value: n, inclusive: true}
+		default:
+			return lower, upper, fmt.Errorf("%s: unsupported numeric operator %q", fieldPath, operator)
+		}
+	}
+	return lower, upper, nil
+}
+
+// buildEventObject builds an event object that matches each field of the pattern
+func buildEventObject(prefix string, pattern map[string]interface{}) (map[string]interface{}, error) {
+	event := map[string]interface{}{}
+	for _, key := range sortedKeys(pattern) {
+		fieldPath := joinFieldPath(prefix, key)
+
+		switch filters := pattern[key].(type) {
+		case map[string]interface{}:
+			nested, err := buildEventObject(fieldPath, filters)
+			if err != nil {
+				return nil, err
+			}
+			event[key] = nested
+
+		case []interface{}:
+			if len(filters) == 0 {
+				return nil, fmt.Errorf("%s: event pattern arrays must not be empty", fieldPath)
+			}
+			value, include, err := buildEventValue(fieldPath, filters[0])
+			if err != nil {
+				return nil, err
+			}
+			if include {
+				event[key] = value
+			}
+
+		default:
+			return nil, fmt.Errorf("%s: event pattern values must be an array or an object, got %s", fieldPath, toJSON(filters))
+		}
+	}
+	return event, nil
+}
+
+// buildEventValue returns a value that matches the filter and whether the field should be in the event
+func buildEventValue(fieldPath string, filter interface{}) (interface{}, bool, error) {
+	contentFilter, ok := filter.(map[string]interface{})
+	if !ok {
+		return filter, true, nil
+	}
+
+	for name, operand := range contentFilter {
+		if nested, ok := operand.(map[string]interface{}); ok && nested["equals-ignore-case"] != nil {
+			operand = nested["equals-ignore-case"]
+		}
+
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			return operand, true, nil
+		case "exists":
+			return "exists", operand == true, nil
+		case "wildcard":
+			return strings.ReplaceAll(fmt.Sprint(operand), "*", ""), true, nil
+		case "cidr":
+			prefix, err := netip.ParsePrefix(fmt.Sprint(operand))
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: cidr must be a CIDR block, got %s", fieldPath, toJSON(operand))
+			}
+			return prefix.Masked().Addr().String(), true, nil
+		case "numeric":
+			lower, upper, err := parseNumericFilter(fieldPath, operand)
+			if err != nil {
+				return nil, false, err
+			}
+			return numericBetween(lower, upper), true, nil
+		case "anything-but":
+			return fmt.Sprintf("anything-but-%s", strings.Trim(toJSON(operand), `[]"`)), true, nil
+		}
+	}
+
+	return nil, false, fmt.Errorf("%s: unsupported content filter %s", fieldPath, toJSON(filter))
+}
+
+// numericBetween returns a number that is allowed by both bounds
+func numericBetween(lower numericBound, upper numericBound) float64 {
+	switch {
+	case lower.inclusive && !math.IsInf(lower.value, -1):
+		return lower.value
+	case upper.inclusive && !math.IsInf(upper.value, 1):
+		return upper.value
+	case math.IsInf(lower.value, -1) && math.IsInf(upper.value, 1):
+		return 0
+	case math.IsInf(lower.value, -1):
+		return upper.value - 1
+	case math.IsInf(upper.value, 1):
+		return lower.value + 1
+	default:
+		return lower.value + (upper.value-lower.value)/2
+	}
+}
+
+func describeEventValue(value interface{}, present bool) string {
+	if !present {
+		return "nothing"
+	}
+	return toJSON(value)
+}
+
+func joinFieldPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
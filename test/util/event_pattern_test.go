@@ -0,0 +1,106 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchEventPattern(t *testing.T) {
+	event := `{
+		"source": "terraform-test",
+		"detail-type": "terraform-test:place-task",
+		"resources": ["arn:aws:ecs:us-east-1:123456789012:cluster/test"],
+		"detail": {
+			"status": "READY",
+			"count": 5,
+			"ip": "10.0.1.7",
+			"tags": ["blue", "green"],
+			"nothing": null
+		}
+	}`
+
+	tests := []struct {
+		pattern string
+		matches bool
+	}{
+		{`{"source": ["terraform-test"]}`, true},
+		{`{"source": ["other", "terraform-test"]}`, true},
+		{`{"source": ["other"]}`, false},
+		{`{"detail-type": [{"prefix": "terraform-test:"}]}`, true},
+		{`{"detail-type": [{"suffix": ":place-task"}]}`, true},
+		{`{"detail": {"status": [{"equals-ignore-case": "ready"}]}}`, true},
+		{`{"detail": {"status": [{"prefix": {"equals-ignore-case": "rea"}}]}}`, true},
+		{`{"detail": {"status": [{"anything-but": ["READY", "DONE"]}]}}`, false},
+		{`{"detail": {"status": [{"anything-but": {"prefix": "DO"}}]}}`, true},
+		{`{"detail": {"count": [{"numeric": [">", 0, "<=", 5]}]}}`, true},
+		{`{"detail": {"count": [{"numeric": ["<", 5]}]}}`, false},
+		{`{"detail": {"ip": [{"cidr": "10.0.0.0/16"}]}}`, true},
+		{`{"detail": {"tags": ["green"]}}`, true},
+		{`{"detail": {"nothing": [null]}}`, true},
+		{`{"detail": {"missing": [{"exists": false}]}}`, true},
+		{`{"detail": {"status": [{"exists": false}]}}`, false},
+		{`{"detail": {"status": [{"exists": true}]}}`, true},
+		{`{"resources": [{"wildcard": "arn:aws:ecs:*:cluster/*"}]}`, true},
+		{`{"detail": {"status": {"nested": ["READY"]}}}`, false},
+	}
+
+	for _, tt := range tests {
+		mismatches, err := MatchEventPattern(tt.pattern, event)
+		require.NoError(t, err, tt.pattern)
+		assert.Equal(t, tt.matches, len(mismatches) == 0, "%s: %v", tt.pattern, mismatches)
+	}
+}
+
+func TestMatchEventPatternDiff(t *testing.T) {
+	pattern := `{"source": ["terraform-test"], "detail": {"status": ["READY"], "id": [{"exists": true}]}}`
+	event := `{"source": "other", "detail": {"status": "DONE"}}`
+
+	mismatches, err := MatchEventPattern(pattern, event)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`detail.id: got nothing, expected one of [{"exists":true}]`,
+		`detail.status: got "DONE", expected one of ["READY"]`,
+		`source: got "other", expected one of ["terraform-test"]`,
+	}, mismatches)
+}
+
+func TestMatchEventPatternErrors(t *testing.T) {
+	event := `{"source": "terraform-test"}`
+
+	// The values of a pattern must be arrays
+	_, err := MatchEventPattern(`{"source": "terraform-test"}`, event)
+	assert.Error(t, err)
+
+	// The arrays of a pattern must not be empty
+	_, err = MatchEventPattern(`{"source": []}`, event)
+	assert.Error(t, err)
+
+	// The content filter is not supported
+	_, err = MatchEventPattern(`{"source": [{"regex": ".*"}]}`, event)
+	assert.Error(t, err)
+}
+
+func TestBuildEventFromPattern(t *testing.T) {
+	patterns := []string{
+		`{"source": ["terraform-test"], "detail-type": ["terraform-test:place-task"]}`,
+		`{"source": [{"prefix": "terraform"}], "detail": {"status": [{"anything-but": "DONE"}]}}`,
+		`{"detail": {"count": [{"numeric": [">", 0, "<", 10]}], "missing": [{"exists": false}]}}`,
+		`{"detail": {"ip": [{"cidr": "10.0.0.0/16"}], "name": [{"wildcard": "task-*"}]}}`,
+	}
+
+	for _, pattern := range patterns {
+		event, err := BuildEventFromPattern(pattern)
+		require.NoError(t, err, pattern)
+
+		b, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		mismatches, err := MatchEventPattern(pattern, string(b))
+		require.NoError(t, err)
+		assert.Empty(t, mismatches, "%s built %s", pattern, string(b))
+	}
+}
@@ -0,0 +1,37 @@
+package util
+
+// SuiteTagKey and SuiteTagValue are the tag that the test suite stamps on the
+// resources it deploys, so leaked resources can be found regardless of their name.
+const (
+	SuiteTagKey   = "TerratestSuite"
+	SuiteTagValue = "terraform-cyber4all-catalog"
+)
+
+// The tags that trace a deployed resource back to the test that deployed it
+const (
+	// RunIdTagKey is the id of the test run, i.e. the CircleCI workflow id and build number
+	RunIdTagKey = "TerratestRunId"
+
+	// TestNameTagKey is the name of the test that deployed the resource
+	TestNameTagKey = "TerratestTestName"
+
+	// GitShaTagKey is the commit that the test run was started from
+	GitShaTagKey = "TerratestGitSha"
+
+	// CreatedAtTagKey is when the test deployed the resource in RFC 3339 format
+	CreatedAtTagKey = "TerratestCreatedAt"
+
+	// TtlTagKey is how long the resource is expected to live as a Go duration (i.e. 6h),
+	// a resource that lives longer was leaked by the test
+	TtlTagKey = "TerratestTtl"
+)
+
+// TestTagKeys are the tags that every resource deployed by the test suite must have
+var TestTagKeys = []string{
+	SuiteTagKey,
+	RunIdTagKey,
+	TestNameTagKey,
+	GitShaTagKey,
+	CreatedAtTagKey,
+	TtlTagKey,
+}
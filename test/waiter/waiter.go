@@ -0,0 +1,194 @@
+// Package waiter polls a condition until it holds, backing off exponentially with
+// jitter between the checks so the tests that wait in parallel do not poll the AWS
+// APIs in lockstep. The waits of a test end before the teardown destroys the
+// deployments ahead of the go test deadline, so a condition that never holds fails the
+// test with its last status instead of being cut short by the teardown.
+package waiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/teardown"
+)
+
+// ErrTimeout is returned when the condition does not hold before the deadline
+var ErrTimeout = errors.New("timed out")
+
+// Condition returns nil when the awaited state is reached, or an error that describes
+// why it is not reached yet. The error is logged and the condition is checked again,
+// unless it is wrapped with Stop.
+type Condition func(ctx context.Context) error
+
+// stopError ends the wait, the awaited state can no longer be reached
+type stopError struct {
+	err error
+}
+
+func (e stopError) Error() string {
+	return e.err.Error()
+}
+
+func (e stopError) Unwrap() error {
+	return e.err
+}
+
+// Stop wraps an error that ends the wait, i.e. a deployment that failed to roll out
+func Stop(err error) error {
+	return stopError{err: err}
+}
+
+// Backoff is the delay between the checks of a condition
+type Backoff struct {
+	// Initial is the delay after the first check
+	Initial time.Duration
+
+	// Max caps the delay
+	Max time.Duration
+
+	// Multiplier grows the delay after each check
+	Multiplier float64
+
+	// Jitter is the fraction of the delay that is randomly added or removed
+	Jitter float64
+}
+
+// DefaultBackoff checks a condition after 2s, 3s, 4.5s and so on, and at least every 30s
+var DefaultBackoff = Backoff{
+	Initial:    2 * time.Second,
+	Max:        30 * time.Second,
+	Multiplier: 1.5,
+	Jitter:     0.2,
+}
+
+// Delay returns the delay after the check with the attempt number, starting at 1, for
+// a random number in [0, 1)
+func (b Backoff) Delay(attempt int, random float64) time.Duration {
+	delay := float64(b.Initial)
+	for i := 1; i < attempt && delay < float64(b.Max); i++ {
+		delay *= b.Multiplier
+	}
+	delay = min(delay, float64(b.Max))
+	delay += delay * b.Jitter * (2*random - 1)
+	return time.Duration(delay)
+}
+
+// Waiter waits for a condition and logs its progress
+type Waiter struct {
+	// Description completes "Waiting for", i.e. "cluster foo to be ACTIVE"
+	Description string
+
+	Backoff Backoff
+
+	Logf func(format string, args ...interface{})
+
+	// now, sleep and random are replaced by the tests of the package
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func() float64
+}
+
+// New creates a waiter with the default backoff
+func New(description string, logf func(format string, args ...interface{})) *Waiter {
+	return &Waiter{
+		Description: description,
+		Backoff:     DefaultBackoff,
+		Logf:        logf,
+		now:         time.Now,
+		sleep:       sleep,
+		random:      rand.Float64,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Wait checks the condition until it holds, it is stopped or the context is done. The
+// condition is always checked once. A check is not started when it would start after
+// the deadline of the context.
+func (w *Waiter) Wait(ctx context.Context, condition Condition) error {
+	start := w.now()
+	var previous error
+	for attempt := 1; ; attempt++ {
+		err := condition(ctx)
+		if err == nil {
+			if attempt > 1 {
+				w.Logf("Done waiting for %s after %d checks in %s", w.Description, attempt, w.now().Sub(start).Round(time.Second))
+			}
+			return nil
+		}
+
+		var stop stopError
+		if errors.As(err, &stop) {
+			return fmt.Errorf("stopped waiting for %s: %w", w.Description, stop.err)
+		}
+
+		// A check that the deadline interrupts fails with the error of the context, the
+		// check before it tells why the condition does not hold
+		if ctx.Err() != nil && previous != nil {
+			err = previous
+		}
+		previous = err
+
+		delay := w.Backoff.Delay(attempt, w.random())
+		elapsed := w.now().Sub(start).Round(time.Second)
+		if deadline, ok := ctx.Deadline(); ok && !w.now().Add(delay).Before(deadline) {
+			return fmt.Errorf("%w after %s waiting for %s: %w", ErrTimeout, elapsed, w.Description, err)
+		}
+
+		w.Logf("Waiting for %s (check %d, %s elapsed): %s. Checking again in %s.", w.Description, attempt, elapsed, err, delay.Round(100*time.Millisecond))
+		if sleepErr := w.sleep(ctx, delay); sleepErr != nil {
+			return fmt.Errorf("stopped waiting for %s after %s: %w: %w", w.Description, elapsed, sleepErr, err)
+		}
+	}
+}
+
+// Test is the part of testing.T that the waits of a test use
+type Test interface {
+	Deadline() (time.Time, bool)
+	Logf(format string, args ...interface{})
+}
+
+// Context returns a context that is done after the timeout, or earlier when the
+// teardown would start destroying the deployments of the test run before then
+func Context(t Test, timeout time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(timeout)
+	if testDeadline, ok := t.Deadline(); ok {
+		margin, err := teardown.MarginFromEnv()
+		if err != nil {
+			margin = teardown.DefaultMargin
+		}
+		if teardownAt := teardown.TeardownAt(testDeadline, margin); teardownAt.Before(deadline) {
+			deadline = teardownAt
+		}
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// For waits up to the timeout for the condition with the default backoff and logs the
+// progress to the test
+func For(t Test, description string, timeout time.Duration, condition Condition) error {
+	return ForWithBackoff(t, description, timeout, DefaultBackoff, condition)
+}
+
+// ForWithBackoff waits up to the timeout for the condition with the backoff and logs the
+// progress to the test
+func ForWithBackoff(t Test, description string, timeout time.Duration, backoff Backoff, condition Condition) error {
+	ctx, cancel := Context(t, timeout)
+	defer cancel()
+	w := New(description, t.Logf)
+	w.Backoff = backoff
+	return w.Wait(ctx, condition)
+}
@@ -0,0 +1,197 @@
+package waiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Cyber4All/terraform-cyber4all-catalog/test/teardown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWaiter returns a waiter that advances a fake clock instead of sleeping and
+// records the delays
+func newTestWaiter(t *testing.T, random float64) (*Waiter, *[]time.Duration) {
+	now := time.Now()
+	delays := []time.Duration{}
+
+	w := New("the test", t.Logf)
+	w.now = func() time.Time { return now }
+	w.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	w.random = func() float64 { return random }
+	return w, &delays
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	assert.Equal(t, time.Second, b.Delay(1, 0.5))
+	assert.Equal(t, 4*time.Second, b.Delay(3, 0.5))
+	assert.Equal(t, 10*time.Second, b.Delay(100, 0.5))
+
+	// The jitter adds or removes up to half of the delay
+	assert.Equal(t, 2*time.Second, b.Delay(3, 0))
+	assert.Equal(t, 15*time.Second, b.Delay(100, 1))
+}
+
+func TestWaitReturnsOnceTheConditionHolds(t *testing.T) {
+	w, delays := newTestWaiter(t, 0.5)
+
+	checks := 0
+	err := w.Wait(context.Background(), func(ctx context.Context) error {
+		checks++
+		if checks < 4 {
+			return fmt.Errorf("%d registered container instances", checks-1)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, checks)
+	assert.Equal(t, []time.Duration{2 * time.Second, 3 * time.Second, 4500 * time.Millisecond}, *delays)
+}
+
+func TestWaitStops(t *testing.T) {
+	w, delays := newTestWaiter(t, 0.5)
+
+	checks := 0
+	rolloutFailed := errors.New("deployment failed: tasks failed to start")
+	err := w.Wait(context.Background(), func(ctx context.Context) error {
+		checks++
+		if checks == 2 {
+			return Stop(rolloutFailed)
+		}
+		return errors.New("deployment is in progress")
+	})
+	assert.ErrorIs(t, err, rolloutFailed)
+	assert.EqualError(t, err, "stopped waiting for the test: deployment failed: tasks failed to start")
+	assert.Len(t, *delays, 1)
+}
+
+func TestWaitTimesOutWithTheLastStatus(t *testing.T) {
+	w, delays := newTestWaiter(t, 0.5)
+
+	// The deadline is 10s after the start of the fake clock
+	ctx, cancel := context.WithDeadline(context.Background(), w.now().Add(10*time.Second))
+	defer cancel()
+
+	checks := 0
+	err := w.Wait(ctx, func(ctx context.Context) error {
+		checks++
+		return fmt.Errorf("cluster is PROVISIONING (check %d)", checks)
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.EqualError(t, err, "timed out after 10s waiting for the test: cluster is PROVISIONING (check 4)")
+
+	// No check is started after the deadline, the fifth check would start at 16.25s
+	assert.Equal(t, 4, checks)
+	assert.Equal(t, []time.Duration{2 * time.Second, 3 * time.Second, 4500 * time.Millisecond}, *delays)
+}
+
+func TestWaitTimesOutWithTheStatusOfTheLastCompleteCheck(t *testing.T) {
+	w := New("the test", t.Logf)
+	w.Backoff = Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The second check is interrupted by the deadline like a request that is in flight
+	checks := 0
+	err := w.Wait(ctx, func(ctx context.Context) error {
+		checks++
+		if checks == 1 {
+			return errors.New("expected the mock container image API, got 503")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Contains(t, err.Error(), "waiting for the test: expected the mock container image API, got 503")
+	assert.Equal(t, 2, checks)
+}
+
+func TestWaitIsCancelled(t *testing.T) {
+	w := New("the test", t.Logf)
+	w.Backoff = Backoff{Initial: time.Hour, Max: time.Hour, Multiplier: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := w.Wait(ctx, func(ctx context.Context) error {
+		return errors.New("alarm has not triggered")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "alarm has not triggered")
+}
+
+// fakeTest is a test with a deadline
+type fakeTest struct {
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (f fakeTest) Deadline() (time.Time, bool) {
+	return f.deadline, f.hasDeadline
+}
+
+func (f fakeTest) Logf(format string, args ...interface{}) {}
+
+func TestContextEndsBeforeTheTeardown(t *testing.T) {
+	t.Setenv(teardown.MarginEnvVar, "10m")
+
+	ctx, cancel := Context(fakeTest{}, time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// The teardown destroys the deployments 10m before the deadline of the test
+	testDeadline := time.Now().Add(30 * time.Minute)
+	ctx, cancel = Context(fakeTest{deadline: testDeadline, hasDeadline: true}, time.Hour)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, testDeadline.Add(-10*time.Minute), deadline, time.Second)
+
+	ctx, cancel = Context(fakeTest{deadline: testDeadline, hasDeadline: true}, time.Minute)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestContextWithAShortTestDeadline(t *testing.T) {
+	t.Setenv(teardown.MarginEnvVar, "")
+
+	// The default 10m timeout of go test is shorter than twice the default margin, so
+	// the teardown starts after half of the remaining time, as does the end of the wait
+	testDeadline := time.Now().Add(10 * time.Minute)
+	ctx, cancel := Context(fakeTest{deadline: testDeadline, hasDeadline: true}, time.Hour)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), deadline, time.Second)
+	require.NoError(t, ctx.Err())
+
+	// A wait that starts later still ends when the teardown starts
+	time.Sleep(10 * time.Millisecond)
+	later, cancel := Context(fakeTest{deadline: testDeadline, hasDeadline: true}, time.Hour)
+	defer cancel()
+	laterDeadline, _ := later.Deadline()
+	assert.Equal(t, deadline, laterDeadline)
+}
+
+func TestForWithBackoff(t *testing.T) {
+	checks := 0
+	err := ForWithBackoff(fakeTest{}, "the third check", time.Minute, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}, func(ctx context.Context) error {
+		checks++
+		if checks < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, checks)
+}